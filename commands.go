@@ -0,0 +1,41 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+
+	"projet-forum/config"
+	"projet-forum/models"
+	"projet-forum/services"
+)
+
+// runCommand exécute une commande de maintenance à la place du serveur, ex. go run . reconcile-reactions
+func runCommand(db *sql.DB, args []string) error {
+	switch args[0] {
+	case "reconcile-reactions":
+		// Recalcule les likes/dislikes de chaque message à partir des votes enregistrés
+		count, err := models.ReconcileReactionCounts(db, 500)
+		if err != nil {
+			return fmt.Errorf("recalcul interrompu après %d messages: %w", count, err)
+		}
+		fmt.Printf("Compteurs de likes/dislikes recalculés pour %d messages\n", count)
+		return nil
+	case "backfill-badges":
+		// Attribue sans notification les badges que les utilisateurs remplissent déjà
+		badges, err := services.NewBadgeServiceFromFile(db, config.GetEnvOrDefault("BADGES_FILE", "config/badges.json"), nil)
+		if err != nil {
+			return err
+		}
+		return badges.Backfill()
+	case "rebuild-leaderboards":
+		// Recalcule les agrégats quotidiens des classements depuis le premier message
+		days, err := models.RebuildDailyActivity(db)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Agrégats des classements recalculés pour %d journées\n", days)
+		return nil
+	default:
+		return fmt.Errorf("commande inconnue %q (commandes disponibles : reconcile-reactions, backfill-badges, rebuild-leaderboards)", args[0])
+	}
+}
@@ -3,15 +3,24 @@ package controllers
 import (
 	"database/sql"
 	"encoding/json"
+	"io"
 	"net/http"
 	"projet-forum/middleware"
+	"projet-forum/models"
+	"projet-forum/services"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 )
 
 type AdminController struct {
-	DB *sql.DB
+	DB             *sql.DB
+	Notifications  *services.NotificationService
+	Files          *services.FileService
+	Presence       *services.PresenceHub
+	TrashRetention time.Duration
 }
 
 // BanUser bannit un utilisateur
@@ -52,6 +61,8 @@ func (c *AdminController) BanUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	c.Notifications.NotifyModeration(userID, claims.UserID, "user_banned", 0, 0)
+
 	middleware.SendJSON(w, http.StatusOK, middleware.Response{
 		Status:  "success",
 		Message: "User banned successfully",
@@ -96,6 +107,8 @@ func (c *AdminController) UnbanUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	c.Notifications.NotifyModeration(userID, claims.UserID, "user_unbanned", 0, 0)
+
 	middleware.SendJSON(w, http.StatusOK, middleware.Response{
 		Status:  "success",
 		Message: "User unbanned successfully",
@@ -132,6 +145,7 @@ func (c *AdminController) UpdateThreadStatus(w http.ResponseWriter, r *http.Requ
 
 	var req struct {
 		Status string `json:"status"`
+		Reason string `json:"reason"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
@@ -142,18 +156,7 @@ func (c *AdminController) UpdateThreadStatus(w http.ResponseWriter, r *http.Requ
 	}
 
 	// Validation du statut
-	switch req.Status {
-	case "open", "closed", "archived":
-		// Mettre à jour le statut
-		_, err = c.DB.Exec("UPDATE threads SET status = ? WHERE id = ?", req.Status, threadID)
-		if err != nil {
-			middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
-				Status:  "error",
-				Message: "Error updating thread status",
-			})
-			return
-		}
-	default:
+	if !models.IsValidThreadStatus(req.Status) {
 		middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
 			Status:  "error",
 			Message: "Invalid status",
@@ -161,6 +164,37 @@ func (c *AdminController) UpdateThreadStatus(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	thread, err := models.GetThread(c.DB, threadID)
+	if err != nil {
+		middleware.SendJSON(w, http.StatusNotFound, middleware.Response{
+			Status:  "error",
+			Message: "Thread not found",
+		})
+		return
+	}
+
+	// Le changement de statut passe par l'historique du fil, avec son contenu actuel
+	changed, err := models.ReviseThread(c.DB, threadID, claims.UserID, models.ThreadEdit{
+		Title:       thread.Title,
+		Description: thread.Description,
+		Tags:        thread.Tags,
+		Status:      req.Status,
+		Reason:      req.Reason,
+	})
+	if err != nil {
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Error updating thread status",
+		})
+		return
+	}
+
+	if changed {
+		c.Notifications.NotifyModeration(thread.AuthorID, claims.UserID, "thread_"+req.Status, thread.ID, 0)
+		// Le sondage du fil est figé ou rouvert avec lui
+		broadcastPollResults(c.DB, c.Presence, threadID)
+	}
+
 	middleware.SendJSON(w, http.StatusOK, middleware.Response{
 		Status:  "success",
 		Message: "Thread status updated successfully",
@@ -229,7 +263,7 @@ func (c *AdminController) GetAdminStats(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Compter les fils de discussion
-	err = c.DB.QueryRow("SELECT COUNT(*) FROM threads").Scan(&stats.TotalThreads)
+	err = c.DB.QueryRow("SELECT COUNT(*) FROM threads WHERE deleted_at IS NULL").Scan(&stats.TotalThreads)
 	if err != nil {
 		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
 			Status:  "error",
@@ -239,7 +273,7 @@ func (c *AdminController) GetAdminStats(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Compter les fils de discussion par statut
-	err = c.DB.QueryRow("SELECT COUNT(*) FROM threads WHERE status = 'open'").Scan(&stats.OpenThreads)
+	err = c.DB.QueryRow("SELECT COUNT(*) FROM threads WHERE status = 'open' AND deleted_at IS NULL").Scan(&stats.OpenThreads)
 	if err != nil {
 		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
 			Status:  "error",
@@ -248,7 +282,7 @@ func (c *AdminController) GetAdminStats(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	err = c.DB.QueryRow("SELECT COUNT(*) FROM threads WHERE status = 'closed'").Scan(&stats.ClosedThreads)
+	err = c.DB.QueryRow("SELECT COUNT(*) FROM threads WHERE status = 'closed' AND deleted_at IS NULL").Scan(&stats.ClosedThreads)
 	if err != nil {
 		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
 			Status:  "error",
@@ -257,7 +291,7 @@ func (c *AdminController) GetAdminStats(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	err = c.DB.QueryRow("SELECT COUNT(*) FROM threads WHERE status = 'archived'").Scan(&stats.ArchivedThreads)
+	err = c.DB.QueryRow("SELECT COUNT(*) FROM threads WHERE status = 'archived' AND deleted_at IS NULL").Scan(&stats.ArchivedThreads)
 	if err != nil {
 		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
 			Status:  "error",
@@ -267,7 +301,7 @@ func (c *AdminController) GetAdminStats(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Compter les messages
-	err = c.DB.QueryRow("SELECT COUNT(*) FROM messages").Scan(&stats.TotalMessages)
+	err = c.DB.QueryRow("SELECT COUNT(*) FROM messages m JOIN threads t ON m.thread_id = t.id WHERE m.deleted_at IS NULL AND t.deleted_at IS NULL").Scan(&stats.TotalMessages)
 	if err != nil {
 		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
 			Status:  "error",
@@ -334,7 +368,7 @@ func (c *AdminController) ListUsers(w http.ResponseWriter, r *http.Request) {
 
 // ListThreads liste tous les fils de discussion
 func (c *AdminController) ListThreads(w http.ResponseWriter, r *http.Request) {
-	rows, err := c.DB.Query("SELECT id, title, status, created_at FROM threads")
+	rows, err := c.DB.Query("SELECT id, title, status, created_at FROM threads WHERE deleted_at IS NULL")
 	if err != nil {
 		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
 			Status:  "error",
@@ -373,36 +407,293 @@ func (c *AdminController) ListThreads(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-// DeleteThread supprime un fil de discussion
+// DeleteThread met un fil de discussion en corbeille (motif optionnel : {"reason": "..."})
 func (c *AdminController) DeleteThread(w http.ResponseWriter, r *http.Request) {
-	threadID := mux.Vars(r)["id"]
-	_, err := c.DB.Exec("DELETE FROM threads WHERE id = ?", threadID)
+	threadID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
 	if err != nil {
-		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+		middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
 			Status:  "error",
-			Message: "Error deleting thread",
+			Message: "Invalid thread ID",
 		})
 		return
 	}
+
+	// Récupérer l'auteur avant la suppression pour le prévenir
+	var authorID int64
+	c.DB.QueryRow("SELECT author_id FROM threads WHERE id = ?", threadID).Scan(&authorID)
+
+	claims := middleware.GetUserFromContext(r)
+	if err := models.SoftDeleteThread(c.DB, threadID, claims.UserID, deleteReason(r)); err != nil {
+		sendTrashError(w, err, "Thread not found", "Error deleting thread")
+		return
+	}
+
+	c.Notifications.NotifyModeration(authorID, claims.UserID, "thread_deleted", 0, 0)
 	middleware.SendJSON(w, http.StatusOK, middleware.Response{
 		Status:  "success",
 		Message: "Thread deleted successfully",
 	})
 }
 
-// DeleteMessage supprime un message
+// DeleteMessage met un message en corbeille (motif optionnel : {"reason": "..."})
 func (c *AdminController) DeleteMessage(w http.ResponseWriter, r *http.Request) {
-	messageID := mux.Vars(r)["id"]
-	_, err := c.DB.Exec("DELETE FROM messages WHERE id = ?", messageID)
+	messageID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
 	if err != nil {
-		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+		middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
 			Status:  "error",
-			Message: "Error deleting message",
+			Message: "Invalid message ID",
 		})
 		return
 	}
+
+	// Récupérer l'auteur et le fil avant la suppression pour prévenir l'auteur
+	var authorID, threadID int64
+	c.DB.QueryRow("SELECT author_id, thread_id FROM messages WHERE id = ?", messageID).Scan(&authorID, &threadID)
+
+	claims := middleware.GetUserFromContext(r)
+	if err := models.SoftDeleteMessage(c.DB, messageID, claims.UserID, deleteReason(r)); err != nil {
+		sendTrashError(w, err, "Message not found", "Error deleting message")
+		return
+	}
+
+	c.Notifications.NotifyModeration(authorID, claims.UserID, "message_deleted", threadID, 0)
 	middleware.SendJSON(w, http.StatusOK, middleware.Response{
 		Status:  "success",
 		Message: "Message deleted successfully",
 	})
 }
+
+// deleteReason lit le motif facultatif d'une suppression ({"reason": "..."} ou ?reason=), limité à 255 caractères
+func deleteReason(r *http.Request) string {
+	var input struct {
+		Reason string `json:"reason"`
+	}
+	if r.Body != nil {
+		json.NewDecoder(io.LimitReader(r.Body, 4096)).Decode(&input)
+	}
+	if input.Reason == "" {
+		input.Reason = r.URL.Query().Get("reason")
+	}
+	reason := []rune(strings.TrimSpace(input.Reason))
+	if len(reason) > 255 {
+		reason = reason[:255]
+	}
+	return string(reason)
+}
+
+// sendTrashError répond 404 si l'élément n'existe pas (ou n'est pas dans l'état attendu), 500 sinon
+func sendTrashError(w http.ResponseWriter, err error, notFound, message string) {
+	if err == sql.ErrNoRows {
+		middleware.SendJSON(w, http.StatusNotFound, middleware.Response{
+			Status:  "error",
+			Message: notFound,
+		})
+		return
+	}
+	middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+		Status:  "error",
+		Message: message,
+	})
+}
+
+// ListTrash liste les fils (?type=threads, par défaut) ou les messages (?type=messages) en corbeille,
+// avec la date à laquelle ils seront purgés
+func (c *AdminController) ListTrash(w http.ResponseWriter, r *http.Request) {
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+
+	perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+	if perPage < 1 || perPage > 100 {
+		perPage = 10
+	}
+
+	var items []*models.TrashItem
+	var err error
+	switch r.URL.Query().Get("type") {
+	case "", "threads":
+		items, err = models.ListDeletedThreads(c.DB, c.TrashRetention, page, perPage)
+	case "messages":
+		items, err = models.ListDeletedMessages(c.DB, c.TrashRetention, page, perPage)
+	default:
+		middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
+			Status:  "error",
+			Message: "Invalid type (threads or messages)",
+		})
+		return
+	}
+	if err != nil {
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Error getting trash",
+		})
+		return
+	}
+
+	middleware.SendJSON(w, http.StatusOK, middleware.Response{
+		Status: "success",
+		Data: map[string]interface{}{
+			"items":    items,
+			"page":     page,
+			"per_page": perPage,
+		},
+	})
+}
+
+// RestoreThread sort un fil de la corbeille
+func (c *AdminController) RestoreThread(w http.ResponseWriter, r *http.Request) {
+	threadID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
+			Status:  "error",
+			Message: "Invalid thread ID",
+		})
+		return
+	}
+
+	if err := models.RestoreThread(c.DB, threadID); err != nil {
+		sendTrashError(w, err, "Thread not found in trash", "Error restoring thread")
+		return
+	}
+
+	var authorID int64
+	c.DB.QueryRow("SELECT author_id FROM threads WHERE id = ?", threadID).Scan(&authorID)
+	if claims := middleware.GetUserFromContext(r); claims != nil && authorID != claims.UserID {
+		c.Notifications.NotifyModeration(authorID, claims.UserID, "thread_restored", threadID, 0)
+	}
+	middleware.SendJSON(w, http.StatusOK, middleware.Response{
+		Status:  "success",
+		Message: "Thread restored successfully",
+	})
+}
+
+// RestoreMessage sort un message de la corbeille
+func (c *AdminController) RestoreMessage(w http.ResponseWriter, r *http.Request) {
+	messageID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
+			Status:  "error",
+			Message: "Invalid message ID",
+		})
+		return
+	}
+
+	if err := models.RestoreMessage(c.DB, messageID); err != nil {
+		sendTrashError(w, err, "Message not found in trash", "Error restoring message")
+		return
+	}
+
+	var authorID, threadID int64
+	c.DB.QueryRow("SELECT author_id, thread_id FROM messages WHERE id = ?", messageID).Scan(&authorID, &threadID)
+	if claims := middleware.GetUserFromContext(r); claims != nil && authorID != claims.UserID {
+		c.Notifications.NotifyModeration(authorID, claims.UserID, "message_restored", threadID, messageID)
+	}
+	middleware.SendJSON(w, http.StatusOK, middleware.Response{
+		Status:  "success",
+		Message: "Message restored successfully",
+	})
+}
+
+// PurgeThread supprime définitivement un fil en corbeille, sans attendre la fin du délai de rétention
+func (c *AdminController) PurgeThread(w http.ResponseWriter, r *http.Request) {
+	threadID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
+			Status:  "error",
+			Message: "Invalid thread ID",
+		})
+		return
+	}
+
+	// Seuls les fils déjà en corbeille peuvent être purgés : une suppression reste toujours réversible
+	deleted, err := models.IsThreadDeleted(c.DB, threadID)
+	if err == nil && !deleted {
+		err = sql.ErrNoRows
+	}
+	if err == nil {
+		err = c.Files.DeleteThread(threadID)
+	}
+	if err != nil {
+		sendTrashError(w, err, "Thread not found in trash", "Error purging thread")
+		return
+	}
+
+	middleware.SendJSON(w, http.StatusOK, middleware.Response{
+		Status:  "success",
+		Message: "Thread permanently deleted",
+	})
+}
+
+// PurgeMessage supprime définitivement un message en corbeille
+func (c *AdminController) PurgeMessage(w http.ResponseWriter, r *http.Request) {
+	messageID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
+			Status:  "error",
+			Message: "Invalid message ID",
+		})
+		return
+	}
+
+	deleted, err := models.IsMessageDeleted(c.DB, messageID)
+	if err == nil && !deleted {
+		err = sql.ErrNoRows
+	}
+	if err == nil {
+		err = c.Files.DeleteMessage(messageID)
+	}
+	if err != nil {
+		sendTrashError(w, err, "Message not found in trash", "Error purging message")
+		return
+	}
+
+	middleware.SendJSON(w, http.StatusOK, middleware.Response{
+		Status:  "success",
+		Message: "Message permanently deleted",
+	})
+}
+
+// GetCounterDrift liste les compteurs dénormalisés qui ne correspondent plus aux lignes réelles
+// (au plus ?limit= par type de compteur, 100 par défaut)
+func (c *AdminController) GetCounterDrift(w http.ResponseWriter, r *http.Request) {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit < 1 || limit > 1000 {
+		limit = 100
+	}
+
+	drifts, err := models.FindCounterDrift(c.DB, limit)
+	if err != nil {
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Error checking counters",
+		})
+		return
+	}
+
+	middleware.SendJSON(w, http.StatusOK, middleware.Response{
+		Status: "success",
+		Data: map[string]interface{}{
+			"drifts": drifts,
+			"limit":  limit,
+		},
+	})
+}
+
+// RepairCounters corrige immédiatement les compteurs faux, sans attendre la tâche périodique
+func (c *AdminController) RepairCounters(w http.ResponseWriter, r *http.Request) {
+	repaired, err := services.RepairCounters(c.DB)
+	if err != nil {
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Error repairing counters",
+		})
+		return
+	}
+
+	middleware.SendJSON(w, http.StatusOK, middleware.Response{
+		Status:  "success",
+		Message: "Counters repaired",
+		Data:    repaired,
+	})
+}
@@ -0,0 +1,213 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"projet-forum/middleware"
+	"projet-forum/models"
+	"projet-forum/services"
+)
+
+// AttachmentController gère les pièces jointes de l'utilisateur connecté et l'espace de stockage
+type AttachmentController struct {
+	DB    *sql.DB
+	Files *services.FileService
+}
+
+// quotaInfo décrit l'espace utilisé et autorisé ; quota_bytes vaut -1 pour un espace illimité
+func (c *AttachmentController) quotaInfo(userID int64, role string) (map[string]interface{}, error) {
+	count, used, err := models.GetUserStorageUsage(c.DB, userID)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"attachments": count,
+		"used_bytes":  used,
+		"quota_bytes": c.Files.Quota(role),
+	}, nil
+}
+
+// ListMine liste les pièces jointes de l'utilisateur connecté avec leur taille et leur message
+func (c *AttachmentController) ListMine(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r)
+	if claims == nil {
+		middleware.SendJSON(w, http.StatusUnauthorized, middleware.Response{
+			Status:  "error",
+			Message: "Unauthorized",
+		})
+		return
+	}
+
+	// Récupérer les paramètres de pagination
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+
+	perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+	if perPage < 1 || perPage > 100 {
+		perPage = 10
+	}
+
+	attachments, err := c.Files.ListUserAttachments(claims.UserID, page, perPage)
+	if err != nil {
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Error getting attachments",
+		})
+		return
+	}
+
+	usage, err := c.quotaInfo(claims.UserID, claims.Role)
+	if err != nil {
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Error getting storage usage",
+		})
+		return
+	}
+
+	middleware.SendJSON(w, http.StatusOK, middleware.Response{
+		Status: "success",
+		Data: map[string]interface{}{
+			"attachments": attachments,
+			"usage":       usage,
+			"page":        page,
+			"per_page":    perPage,
+		},
+	})
+}
+
+// DeleteMine supprime plusieurs pièces jointes de l'utilisateur connecté, ex. {"ids": [1, 2, 3]}
+func (c *AttachmentController) DeleteMine(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r)
+	if claims == nil {
+		middleware.SendJSON(w, http.StatusUnauthorized, middleware.Response{
+			Status:  "error",
+			Message: "Unauthorized",
+		})
+		return
+	}
+
+	var input struct {
+		IDs []int64 `json:"ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || len(input.IDs) == 0 || len(input.IDs) > 100 {
+		middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
+			Status:  "error",
+			Message: "Invalid request body (1 to 100 ids)",
+		})
+		return
+	}
+
+	deleted, err := c.Files.DeleteUserAttachments(claims.UserID, input.IDs)
+	if err != nil {
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Error deleting attachments",
+		})
+		return
+	}
+
+	deletedIDs := make([]int64, len(deleted))
+	for i, a := range deleted {
+		deletedIDs[i] = a.ID
+	}
+	usage, err := c.quotaInfo(claims.UserID, claims.Role)
+	if err != nil {
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Error getting storage usage",
+		})
+		return
+	}
+
+	middleware.SendJSON(w, http.StatusOK, middleware.Response{
+		Status: "success",
+		Data: map[string]interface{}{
+			"deleted": deletedIDs,
+			"usage":   usage,
+		},
+	})
+}
+
+// AdminConsumers liste les utilisateurs qui occupent le plus d'espace (?limit=, 20 par défaut)
+func (c *AttachmentController) AdminConsumers(w http.ResponseWriter, r *http.Request) {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	consumers, err := models.GetTopStorageConsumers(c.DB, limit)
+	if err != nil {
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Error getting storage consumers",
+		})
+		return
+	}
+
+	result := make([]map[string]interface{}, len(consumers))
+	for i, consumer := range consumers {
+		result[i] = map[string]interface{}{
+			"user_id":     consumer.UserID,
+			"username":    consumer.Username,
+			"role":        consumer.Role,
+			"attachments": consumer.Attachments,
+			"used_bytes":  consumer.UsedBytes,
+			"quota_bytes": c.Files.Quota(consumer.Role),
+		}
+	}
+
+	middleware.SendJSON(w, http.StatusOK, middleware.Response{
+		Status: "success",
+		Data:   result,
+	})
+}
+
+// AdminOrphans liste les fichiers stockés qui ne sont plus référencés
+func (c *AttachmentController) AdminOrphans(w http.ResponseWriter, r *http.Request) {
+	orphans, err := c.Files.FindOrphans()
+	if err != nil {
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Error scanning storage",
+		})
+		return
+	}
+
+	var total int64
+	for _, orphan := range orphans {
+		total += orphan.Size
+	}
+	middleware.SendJSON(w, http.StatusOK, middleware.Response{
+		Status: "success",
+		Data: map[string]interface{}{
+			"orphans":     orphans,
+			"total_bytes": total,
+		},
+	})
+}
+
+// AdminCleanupOrphans supprime immédiatement les fichiers orphelins
+func (c *AttachmentController) AdminCleanupOrphans(w http.ResponseWriter, r *http.Request) {
+	removed, freed, err := c.Files.CleanupOrphans()
+	if err != nil {
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Error cleaning up storage",
+		})
+		return
+	}
+
+	middleware.SendJSON(w, http.StatusOK, middleware.Response{
+		Status: "success",
+		Data: map[string]interface{}{
+			"removed":     removed,
+			"freed_bytes": freed,
+		},
+	})
+}
@@ -0,0 +1,78 @@
+package controllers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"projet-forum/middleware"
+	"projet-forum/models"
+	"projet-forum/services"
+
+	"github.com/gorilla/mux"
+)
+
+// BadgeController expose les badges définis dans la configuration et ceux obtenus par les utilisateurs
+type BadgeController struct {
+	DB     *sql.DB
+	Badges *services.BadgeService
+}
+
+// ListBadges liste les badges existants avec le nombre d'utilisateurs qui les ont obtenus
+func (c *BadgeController) ListBadges(w http.ResponseWriter, r *http.Request) {
+	holders, err := models.CountBadgeHolders(c.DB)
+	if err != nil {
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Error getting badges",
+		})
+		return
+	}
+
+	type badgeStats struct {
+		*models.Badge
+		Holders int `json:"holders"`
+	}
+	badges := make([]*badgeStats, 0, len(c.Badges.Badges))
+	for _, badge := range c.Badges.Badges {
+		badges = append(badges, &badgeStats{Badge: badge, Holders: holders[badge.Code]})
+	}
+
+	middleware.SendJSON(w, http.StatusOK, middleware.Response{
+		Status: "success",
+		Data:   badges,
+	})
+}
+
+// GetUserBadges retourne l'historique des badges obtenus par un utilisateur
+func (c *BadgeController) GetUserBadges(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
+			Status:  "error",
+			Message: "Invalid user ID",
+		})
+		return
+	}
+	if _, err := models.GetUserByID(c.DB, id); err != nil {
+		middleware.SendJSON(w, http.StatusNotFound, middleware.Response{
+			Status:  "error",
+			Message: "User not found",
+		})
+		return
+	}
+
+	badges, err := c.Badges.UserBadges(id)
+	if err != nil {
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Error getting badges",
+		})
+		return
+	}
+
+	middleware.SendJSON(w, http.StatusOK, middleware.Response{
+		Status: "success",
+		Data:   badges,
+	})
+}
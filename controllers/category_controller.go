@@ -8,6 +8,7 @@ import (
 
 	"github.com/gorilla/mux"
 
+	"projet-forum/middleware"
 	"projet-forum/models"
 )
 
@@ -63,7 +64,7 @@ func (c *CategoryController) CreateCategory(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	createdCategory, err := models.CreateCategory(c.DB, category.Name, category.Description)
+	createdCategory, err := models.CreateCategory(c.DB, category.Name, category.Description, category.QuestionMode)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -112,7 +113,11 @@ func (c *CategoryController) DeleteCategory(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	if err := models.DeleteCategory(c.DB, id); err != nil {
+	var deletedBy int64
+	if claims := middleware.GetUserFromContext(r); claims != nil {
+		deletedBy = claims.UserID
+	}
+	if err := models.DeleteCategory(c.DB, id, deletedBy); err != nil {
 		if err == sql.ErrNoRows {
 			http.Error(w, "Category not found", http.StatusNotFound)
 			return
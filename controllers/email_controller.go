@@ -0,0 +1,180 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+
+	"projet-forum/middleware"
+	"projet-forum/models"
+	"projet-forum/services"
+)
+
+// EmailController gère les préférences email et les liens de désinscription
+type EmailController struct {
+	DB    *sql.DB
+	Email *services.EmailService
+}
+
+// GetPreferences récupère les préférences email de l'utilisateur connecté
+func (c *EmailController) GetPreferences(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r)
+	if claims == nil {
+		middleware.SendJSON(w, http.StatusUnauthorized, middleware.Response{
+			Status:  "error",
+			Message: "Unauthorized",
+		})
+		return
+	}
+
+	prefs, err := models.GetEmailPreferences(c.DB, claims.UserID)
+	if err != nil {
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Error getting email preferences",
+		})
+		return
+	}
+
+	middleware.SendJSON(w, http.StatusOK, middleware.Response{
+		Status: "success",
+		Data:   prefs,
+	})
+}
+
+// UpdatePreferences met à jour les emails de réponse et/ou la fréquence du digest
+func (c *EmailController) UpdatePreferences(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r)
+	if claims == nil {
+		middleware.SendJSON(w, http.StatusUnauthorized, middleware.Response{
+			Status:  "error",
+			Message: "Unauthorized",
+		})
+		return
+	}
+
+	var input struct {
+		ReplyEmails     *bool   `json:"reply_emails"`
+		DigestFrequency *string `json:"digest_frequency"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
+			Status:  "error",
+			Message: "Invalid request body",
+		})
+		return
+	}
+
+	if input.DigestFrequency != nil && !models.IsValidDigestFrequency(*input.DigestFrequency) {
+		middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
+			Status:  "error",
+			Message: "Invalid digest frequency (none, daily or weekly)",
+		})
+		return
+	}
+
+	if input.ReplyEmails != nil {
+		if err := models.SetReplyEmails(c.DB, claims.UserID, *input.ReplyEmails); err != nil {
+			middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+				Status:  "error",
+				Message: "Error updating email preferences",
+			})
+			return
+		}
+	}
+	if input.DigestFrequency != nil {
+		if err := models.SetDigestFrequency(c.DB, claims.UserID, models.DigestFrequency(*input.DigestFrequency)); err != nil {
+			middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+				Status:  "error",
+				Message: "Error updating email preferences",
+			})
+			return
+		}
+	}
+
+	prefs, err := models.GetEmailPreferences(c.DB, claims.UserID)
+	if err != nil {
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Error getting email preferences",
+		})
+		return
+	}
+
+	middleware.SendJSON(w, http.StatusOK, middleware.Response{
+		Status: "success",
+		Data:   prefs,
+	})
+}
+
+type unsubscribePage struct {
+	Token string
+	Scope string
+	Done  bool
+	Error string
+}
+
+// renderUnsubscribePage affiche la page de confirmation de désinscription
+func renderUnsubscribePage(w http.ResponseWriter, status int, page unsubscribePage) {
+	tmpl, err := template.ParseFiles("templates/users/unsubscribe.html")
+	if err != nil {
+		log.Printf("Erreur lors du chargement de unsubscribe.html: %v", err)
+		http.Error(w, "Erreur serveur", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := tmpl.Execute(w, page); err != nil {
+		log.Printf("Erreur lors du rendu de unsubscribe.html: %v", err)
+	}
+}
+
+// ShowUnsubscribePage vérifie le jeton et demande confirmation, sans rien modifier
+// (les scanners de liens des messageries suivent les GET)
+func (c *EmailController) ShowUnsubscribePage(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	_, scope, err := c.Email.ParseUnsubscribeToken(token)
+	if err != nil {
+		renderUnsubscribePage(w, http.StatusBadRequest, unsubscribePage{Error: "Ce lien de désinscription est invalide."})
+		return
+	}
+	renderUnsubscribePage(w, http.StatusOK, unsubscribePage{Token: token, Scope: scope})
+}
+
+// Unsubscribe applique la désinscription ; accepte le POST « One-Click » des clients mail (RFC 8058)
+// comme le formulaire de la page de confirmation
+func (c *EmailController) Unsubscribe(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		token = r.PostFormValue("token")
+	}
+
+	scope, err := c.Email.ApplyUnsubscribe(token)
+	oneClick := strings.EqualFold(r.PostFormValue("List-Unsubscribe"), "One-Click")
+	if err == services.ErrInvalidUnsubscribeToken {
+		if oneClick {
+			http.Error(w, "Invalid unsubscribe token", http.StatusBadRequest)
+			return
+		}
+		renderUnsubscribePage(w, http.StatusBadRequest, unsubscribePage{Error: "Ce lien de désinscription est invalide."})
+		return
+	}
+	if err != nil {
+		log.Printf("Erreur lors de la désinscription: %v", err)
+		if oneClick {
+			http.Error(w, "Error unsubscribing", http.StatusInternalServerError)
+			return
+		}
+		renderUnsubscribePage(w, http.StatusInternalServerError, unsubscribePage{Token: token, Error: "Une erreur est survenue, veuillez réessayer."})
+		return
+	}
+
+	if oneClick {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	renderUnsubscribePage(w, http.StatusOK, unsubscribePage{Scope: scope, Done: true})
+}
@@ -0,0 +1,103 @@
+package controllers
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"projet-forum/middleware"
+	"projet-forum/services"
+
+	"github.com/gorilla/mux"
+)
+
+// FileController sert les fichiers du stockage (avatars et pièces jointes)
+type FileController struct {
+	Files *services.FileService
+}
+
+// ServeFile sert un fichier ; les fichiers privés exigent une URL signée non expirée
+func (c *FileController) ServeFile(w http.ResponseWriter, r *http.Request) {
+	key := mux.Vars(r)["key"]
+	if services.ValidateKey(key) != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	private := services.IsPrivateKey(key)
+	if private && !c.Files.Signer.Verify(key, r.URL.Query(), time.Now()) {
+		http.Error(w, "Invalid or expired link", http.StatusForbidden)
+		return
+	}
+
+	body, info, err := c.Files.Storage.Get(key)
+	if err == services.ErrObjectNotFound {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Printf("Erreur lors de la lecture du fichier %s: %v", key, err)
+		http.Error(w, "Error reading file", http.StatusInternalServerError)
+		return
+	}
+	defer body.Close()
+
+	// Le contenu d'une clé ne change jamais : les fichiers publics peuvent être mis en cache indéfiniment
+	if private {
+		w.Header().Set("Cache-Control", "private, max-age="+strconv.Itoa(int(services.PrivateURLTTL.Seconds())))
+	} else {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	}
+	w.Header().Set("Content-Type", info.ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if info.Size > 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	}
+	if _, err := io.Copy(w, body); err != nil {
+		log.Printf("Erreur lors de l'envoi du fichier %s: %v", key, err)
+	}
+}
+
+// ServeIdenticon sert l'avatar généré d'un utilisateur (/avatars/{id}.svg)
+func (c *FileController) ServeIdenticon(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil || userID < 1 {
+		http.NotFound(w, r)
+		return
+	}
+
+	etag := `"identicon-` + services.IdenticonVersion + `-` + strconv.FormatInt(userID, 10) + `"`
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Write(services.IdenticonSVG(userID))
+}
+
+// sendUploadError répond à un envoi d'image refusé (400), hors quota (413), reporté faute de worker
+// libre (503) ou en échec (500)
+func sendUploadError(w http.ResponseWriter, err error, message string) {
+	status := http.StatusInternalServerError
+	switch err {
+	case services.ErrTooManyImages, services.ErrImageTooLarge, services.ErrUnsupportedImage,
+		services.ErrImageDimensions, services.ErrInvalidImageHeader:
+		status, message = http.StatusBadRequest, err.Error()
+	case services.ErrQuotaExceeded:
+		status, message = http.StatusRequestEntityTooLarge, err.Error()
+	case services.ErrImageProcessorBusy:
+		status, message = http.StatusServiceUnavailable, err.Error()
+	default:
+		log.Printf("Erreur lors de l'enregistrement d'un fichier: %v", err)
+	}
+	middleware.SendJSON(w, status, middleware.Response{
+		Status:  "error",
+		Message: message,
+	})
+}
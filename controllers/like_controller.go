@@ -31,33 +31,24 @@ func (c *LikeController) LikeMessage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	reaction, err := models.GetMessageReaction(c.DB, messageID, claims.UserID)
-	if err == nil {
-		if reaction.ReactionType == "like" {
-			http.Error(w, "You have already liked this message", http.StatusBadRequest)
-			return
-		} else if reaction.ReactionType == "dislike" {
-			if err := models.DeleteMessageReaction(c.DB, messageID, claims.UserID); err != nil {
-				http.Error(w, "Error removing previous reaction", http.StatusInternalServerError)
-				return
-			}
-		}
-	}
-
-	message, err := models.GetMessage(c.DB, messageID)
-	if err != nil {
+	// Le vote et les compteurs sont modifiés dans une même transaction (un dislike est remplacé)
+	vote, err := models.SetMessageVote(c.DB, messageID, claims.UserID, "like")
+	if err == sql.ErrNoRows {
 		http.Error(w, "Message not found", http.StatusNotFound)
 		return
 	}
-
-	if err := models.AddMessageReaction(c.DB, messageID, claims.UserID, "like"); err != nil {
+	if err != nil {
 		http.Error(w, "Error liking message", http.StatusInternalServerError)
 		return
 	}
+	if vote.Previous == "like" {
+		http.Error(w, "You have already liked this message", http.StatusBadRequest)
+		return
+	}
 
-	message.Likes++
-	if err := message.UpdateMessage(c.DB); err != nil {
-		http.Error(w, "Error updating message", http.StatusInternalServerError)
+	message, err := models.GetMessage(c.DB, messageID)
+	if err != nil {
+		http.Error(w, "Message not found", http.StatusNotFound)
 		return
 	}
 
@@ -83,33 +74,24 @@ func (c *LikeController) DislikeMessage(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	reaction, err := models.GetMessageReaction(c.DB, messageID, claims.UserID)
-	if err == nil {
-		if reaction.ReactionType == "dislike" {
-			http.Error(w, "You have already disliked this message", http.StatusBadRequest)
-			return
-		} else if reaction.ReactionType == "like" {
-			if err := models.DeleteMessageReaction(c.DB, messageID, claims.UserID); err != nil {
-				http.Error(w, "Error removing previous reaction", http.StatusInternalServerError)
-				return
-			}
-		}
-	}
-
-	message, err := models.GetMessage(c.DB, messageID)
-	if err != nil {
+	// Le vote et les compteurs sont modifiés dans une même transaction (un like est remplacé)
+	vote, err := models.SetMessageVote(c.DB, messageID, claims.UserID, "dislike")
+	if err == sql.ErrNoRows {
 		http.Error(w, "Message not found", http.StatusNotFound)
 		return
 	}
-
-	if err := models.AddMessageReaction(c.DB, messageID, claims.UserID, "dislike"); err != nil {
+	if err != nil {
 		http.Error(w, "Error disliking message", http.StatusInternalServerError)
 		return
 	}
+	if vote.Previous == "dislike" {
+		http.Error(w, "You have already disliked this message", http.StatusBadRequest)
+		return
+	}
 
-	message.Dislikes++
-	if err := message.UpdateMessage(c.DB); err != nil {
-		http.Error(w, "Error updating message", http.StatusInternalServerError)
+	message, err := models.GetMessage(c.DB, messageID)
+	if err != nil {
+		http.Error(w, "Message not found", http.StatusNotFound)
 		return
 	}
 
@@ -0,0 +1,174 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"projet-forum/middleware"
+	"projet-forum/models"
+	"projet-forum/services"
+
+	"github.com/gorilla/mux"
+)
+
+// Intervalle des commentaires envoyés pour garder la connexion ouverte et détecter les clients partis
+const liveHeartbeatInterval = 15 * time.Second
+
+// LiveController gère le canal temps réel des fils de discussion (présence et saisie)
+type LiveController struct {
+	DB       *sql.DB
+	Presence *services.PresenceHub
+}
+
+// loadVisibleThread récupère le fil de l'URL et vérifie que l'utilisateur peut le consulter
+func loadVisibleThread(db *sql.DB, w http.ResponseWriter, r *http.Request, claims *middleware.Claims) (*models.Thread, bool) {
+	threadID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
+			Status:  "error",
+			Message: "Invalid thread ID",
+		})
+		return nil, false
+	}
+
+	thread, err := models.GetThread(db, threadID)
+	if err != nil {
+		middleware.SendJSON(w, http.StatusNotFound, middleware.Response{
+			Status:  "error",
+			Message: "Thread not found",
+		})
+		return nil, false
+	}
+
+	allowed, err := models.CanViewThread(db, thread, claims.UserID, claims.Role)
+	if err != nil {
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Error checking thread visibility",
+		})
+		return nil, false
+	}
+	if !allowed {
+		// Ne pas révéler l'existence d'un fil privé
+		middleware.SendJSON(w, http.StatusNotFound, middleware.Response{
+			Status:  "error",
+			Message: "Thread not found",
+		})
+		return nil, false
+	}
+
+	return thread, true
+}
+
+// StreamThread ouvre un flux Server-Sent Events avec les lecteurs et les indicateurs de saisie d'un fil
+func (c *LiveController) StreamThread(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r)
+	if claims == nil {
+		middleware.SendJSON(w, http.StatusUnauthorized, middleware.Response{
+			Status:  "error",
+			Message: "Unauthorized",
+		})
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Streaming not supported",
+		})
+		return
+	}
+
+	thread, ok := loadVisibleThread(c.DB, w, r, claims)
+	if !ok {
+		return
+	}
+
+	hidden, err := models.GetBlockedUserIDs(c.DB, claims.UserID)
+	if err != nil {
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Error loading blocked users",
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	sub := c.Presence.Join(thread.ID, claims.UserID, claims.Username, hidden)
+	defer c.Presence.Leave(thread.ID, sub)
+
+	heartbeat := time.NewTicker(liveHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event := <-sub.Events:
+			data, err := json.Marshal(event)
+			if err != nil {
+				log.Printf("[DEBUG] StreamThread - Erreur d'encodage de l'événement: %v", err)
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+			c.Presence.Touch(claims.UserID)
+		}
+	}
+}
+
+// SetTyping signale que l'utilisateur est en train d'écrire (ou a arrêté) dans un fil
+func (c *LiveController) SetTyping(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r)
+	if claims == nil {
+		middleware.SendJSON(w, http.StatusUnauthorized, middleware.Response{
+			Status:  "error",
+			Message: "Unauthorized",
+		})
+		return
+	}
+
+	thread, ok := loadVisibleThread(c.DB, w, r, claims)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Typing bool `json:"typing"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
+			Status:  "error",
+			Message: "Invalid request body",
+		})
+		return
+	}
+
+	if thread.Status == string(models.ThreadClosed) {
+		input.Typing = false
+	}
+
+	c.Presence.SetTyping(thread.ID, claims.UserID, claims.Username, input.Typing)
+
+	middleware.SendJSON(w, http.StatusOK, middleware.Response{
+		Status: "success",
+	})
+}
@@ -3,15 +3,26 @@ package controllers
 import (
 	"database/sql"
 	"encoding/json"
+	"log"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"projet-forum/middleware"
 	"projet-forum/models"
+	"projet-forum/services"
+	"projet-forum/utils"
+
+	"github.com/gorilla/mux"
 )
 
 type MessageController struct {
-	DB *sql.DB
+	DB            *sql.DB
+	Notifications *services.NotificationService
+	Reputation    *services.ReputationService
+	Badges        *services.BadgeService
+	EditWindow    time.Duration
 }
 
 // CreateMessage gère la création d'un nouveau message
@@ -66,7 +77,7 @@ func (c *MessageController) CreateMessage(w http.ResponseWriter, r *http.Request
 	}
 
 	// Créer le message
-	message, err := models.CreateMessage(c.DB, input.ThreadID, claims.UserID, input.Content, "")
+	message, err := models.CreateMessage(c.DB, input.ThreadID, claims.UserID, 0, input.Content, "", models.MessageExtras{})
 	if err != nil {
 		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
 			Status:  "error",
@@ -74,6 +85,10 @@ func (c *MessageController) CreateMessage(w http.ResponseWriter, r *http.Request
 		})
 		return
 	}
+	c.Badges.Evaluate(claims.UserID)
+	if thread.AuthorID != claims.UserID {
+		c.Badges.Evaluate(thread.AuthorID)
+	}
 
 	middleware.SendJSON(w, http.StatusCreated, middleware.Response{
 		Status: "success",
@@ -81,6 +96,28 @@ func (c *MessageController) CreateMessage(w http.ResponseWriter, r *http.Request
 	})
 }
 
+// PreviewMessage retourne le rendu HTML d'un contenu Markdown, sans l'enregistrer
+func (c *MessageController) PreviewMessage(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Content string `json:"content"`
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, 64*1024)
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
+			Status:  "error",
+			Message: "Invalid request body",
+		})
+		return
+	}
+
+	middleware.SendJSON(w, http.StatusOK, middleware.Response{
+		Status: "success",
+		Data: map[string]interface{}{
+			"content_html": utils.RenderMarkdown(input.Content),
+		},
+	})
+}
+
 // GetMessage gère la récupération d'un message
 func (c *MessageController) GetMessage(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
@@ -172,55 +209,121 @@ func (c *MessageController) ListMessages(w http.ResponseWriter, r *http.Request)
 	})
 }
 
-// UpdateMessage gère la mise à jour d'un message
-func (c *MessageController) UpdateMessage(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPut {
-		middleware.SendJSON(w, http.StatusMethodNotAllowed, middleware.Response{
-			Status:  "error",
-			Message: "Method not allowed",
-		})
+// GetRaw retourne la source Markdown d'un message en texte brut, ou seulement le code d'un de ses
+// blocs (?block=N, à partir de 1) pour le copier tel quel
+func (c *MessageController) GetRaw(w http.ResponseWriter, r *http.Request) {
+	message, _, ok := loadVisibleMessage(c.DB, w, r, middleware.GetUserFromContext(r))
+	if !ok {
 		return
 	}
 
-	// Vérifier l'authentification
-	claims := middleware.GetUserFromContext(r)
-	if claims == nil {
-		middleware.SendJSON(w, http.StatusUnauthorized, middleware.Response{
-			Status:  "error",
-			Message: "Unauthorized",
-		})
-		return
+	raw := message.Content
+	if blockParam := r.URL.Query().Get("block"); blockParam != "" {
+		block, err := strconv.Atoi(blockParam)
+		blocks := utils.ExtractCodeBlocks(message.Content)
+		if err != nil || block < 1 || block > len(blocks) {
+			middleware.SendJSON(w, http.StatusNotFound, middleware.Response{
+				Status:  "error",
+				Message: "Code block not found",
+			})
+			return
+		}
+		raw = blocks[block-1].Code + "\n"
 	}
 
-	// Récupérer l'ID du message
-	idStr := r.URL.Query().Get("id")
-	id, err := strconv.ParseInt(idStr, 10, 64)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Write([]byte(raw))
+}
+
+// loadVisibleMessage charge le message désigné par l'identifiant de la route et son fil ; un message
+// d'un fil que l'utilisateur ne peut pas voir est traité comme inexistant (claims peut être nil)
+func loadVisibleMessage(db *sql.DB, w http.ResponseWriter, r *http.Request, claims *middleware.Claims) (*models.Message, *models.Thread, bool) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
 	if err != nil {
 		middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
 			Status:  "error",
 			Message: "Invalid message ID",
 		})
-		return
+		return nil, nil, false
 	}
 
-	// Récupérer le message
-	message, err := models.GetMessage(c.DB, id)
+	message, err := models.GetMessage(db, id)
 	if err != nil {
 		middleware.SendJSON(w, http.StatusNotFound, middleware.Response{
 			Status:  "error",
 			Message: "Message not found",
 		})
+		return nil, nil, false
+	}
+
+	var userID int64
+	var role string
+	if claims != nil {
+		userID, role = claims.UserID, claims.Role
+	}
+	thread, err := models.GetThread(db, message.ThreadID)
+	if err == nil {
+		var allowed bool
+		if allowed, err = models.CanViewThread(db, thread, userID, role); err == nil && !allowed {
+			err = sql.ErrNoRows
+		}
+	}
+	if err != nil {
+		middleware.SendJSON(w, http.StatusNotFound, middleware.Response{
+			Status:  "error",
+			Message: "Message not found",
+		})
+		return nil, nil, false
+	}
+
+	return message, thread, true
+}
+
+// UpdateMessage gère la modification d'un message : l'auteur dispose de EditWindow après la publication
+// (sans limite si EditWindow vaut 0), les modérateurs peuvent modifier à tout moment. L'ancienne
+// version est conservée dans l'historique.
+func (c *MessageController) UpdateMessage(w http.ResponseWriter, r *http.Request) {
+	// Vérifier l'authentification
+	claims := middleware.GetUserFromContext(r)
+	if claims == nil {
+		middleware.SendJSON(w, http.StatusUnauthorized, middleware.Response{
+			Status:  "error",
+			Message: "Unauthorized",
+		})
+		return
+	}
+
+	message, thread, ok := loadVisibleMessage(c.DB, w, r, claims)
+	if !ok {
 		return
 	}
 
 	// Vérifier les permissions
-	if message.AuthorID != claims.UserID && claims.Role != "admin" {
+	moderator := models.IsModerator(claims.Role)
+	if message.AuthorID != claims.UserID && !moderator {
 		middleware.SendJSON(w, http.StatusForbidden, middleware.Response{
 			Status:  "error",
 			Message: "Not authorized to update this message",
 		})
 		return
 	}
+	if !moderator {
+		if thread.Status != string(models.ThreadOpen) {
+			middleware.SendJSON(w, http.StatusForbidden, middleware.Response{
+				Status:  "error",
+				Message: "Thread is closed",
+			})
+			return
+		}
+		if c.EditWindow > 0 && time.Since(message.CreatedAt) > c.EditWindow {
+			middleware.SendJSON(w, http.StatusForbidden, middleware.Response{
+				Status:  "error",
+				Message: "Edit window has expired",
+			})
+			return
+		}
+	}
 
 	var input struct {
 		Content string `json:"content"`
@@ -233,16 +336,41 @@ func (c *MessageController) UpdateMessage(w http.ResponseWriter, r *http.Request
 		})
 		return
 	}
+	if strings.TrimSpace(input.Content) == "" {
+		middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
+			Status:  "error",
+			Message: "Content is required",
+		})
+		return
+	}
 
 	// Mettre à jour le message
-	message.Content = input.Content
-	if err := message.UpdateMessage(c.DB); err != nil {
+	changed, err := models.EditMessage(c.DB, message.ID, claims.UserID, input.Content)
+	if err != nil {
 		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
 			Status:  "error",
 			Message: "Error updating message: " + err.Error(),
 		})
 		return
 	}
+	if changed && message.AuthorID != claims.UserID {
+		c.Notifications.NotifyModeration(message.AuthorID, claims.UserID, "message_edited", message.ThreadID, message.ID)
+	}
+
+	message, err = models.GetMessage(c.DB, message.ID)
+	if err != nil {
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Error getting message",
+		})
+		return
+	}
+	if changed {
+		// Seuls les utilisateurs ajoutés par la modification sont notifiés
+		syncMentions(c.DB, c.Notifications, message)
+	} else if err := models.LoadMessageMentions(c.DB, []*models.Message{message}); err != nil {
+		log.Printf("Erreur lors du chargement des mentions du message %d: %v", message.ID, err)
+	}
 
 	middleware.SendJSON(w, http.StatusOK, middleware.Response{
 		Status: "success",
@@ -250,49 +378,125 @@ func (c *MessageController) UpdateMessage(w http.ResponseWriter, r *http.Request
 	})
 }
 
-// DeleteMessage gère la suppression d'un message
-func (c *MessageController) DeleteMessage(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodDelete {
-		middleware.SendJSON(w, http.StatusMethodNotAllowed, middleware.Response{
-			Status:  "error",
-			Message: "Method not allowed",
-		})
-		return
-	}
-
-	// Vérifier l'authentification
+// loadMessageHistory charge un message dont l'utilisateur peut consulter l'historique : le marqueur
+// « modifié » est public, mais le texte des versions remplacées n'est visible que par l'auteur et les
+// modérateurs (un auteur qui retire une information personnelle ne doit pas la laisser en ligne)
+func (c *MessageController) loadMessageHistory(w http.ResponseWriter, r *http.Request) (*models.Message, bool) {
 	claims := middleware.GetUserFromContext(r)
 	if claims == nil {
 		middleware.SendJSON(w, http.StatusUnauthorized, middleware.Response{
 			Status:  "error",
 			Message: "Unauthorized",
 		})
+		return nil, false
+	}
+
+	message, _, ok := loadVisibleMessage(c.DB, w, r, claims)
+	if !ok {
+		return nil, false
+	}
+	if message.AuthorID != claims.UserID && !models.IsModerator(claims.Role) {
+		middleware.SendJSON(w, http.StatusForbidden, middleware.Response{
+			Status:  "error",
+			Message: "Message history is only visible to its author and moderators",
+		})
+		return nil, false
+	}
+	return message, true
+}
+
+// GetRevisions liste les versions successives d'un message, la dernière étant le texte actuel
+func (c *MessageController) GetRevisions(w http.ResponseWriter, r *http.Request) {
+	message, ok := c.loadMessageHistory(w, r)
+	if !ok {
 		return
 	}
 
-	// Récupérer l'ID du message
-	idStr := r.URL.Query().Get("id")
-	id, err := strconv.ParseInt(idStr, 10, 64)
+	revisions, err := models.GetMessageRevisions(c.DB, message.ID)
 	if err != nil {
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Error getting message revisions",
+		})
+		return
+	}
+
+	middleware.SendJSON(w, http.StatusOK, middleware.Response{
+		Status: "success",
+		Data: map[string]interface{}{
+			"message":         message,
+			"revisions":       revisions,
+			"current_version": message.EditCount + 1,
+		},
+	})
+}
+
+// GetDiff compare deux versions d'un message (?from=&to=) ; par défaut, la version actuelle et la précédente
+func (c *MessageController) GetDiff(w http.ResponseWriter, r *http.Request) {
+	message, ok := c.loadMessageHistory(w, r)
+	if !ok {
+		return
+	}
+
+	current := message.EditCount + 1
+	to := current
+	if v := r.URL.Query().Get("to"); v != "" {
+		to, _ = strconv.Atoi(v)
+	}
+	from := to - 1
+	if v := r.URL.Query().Get("from"); v != "" {
+		from, _ = strconv.Atoi(v)
+	}
+	if from < 1 || to < 1 || from > current || to > current {
 		middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
 			Status:  "error",
-			Message: "Invalid message ID",
+			Message: "Versions must be between 1 and " + strconv.Itoa(current),
 		})
 		return
 	}
 
-	// Récupérer le message
-	message, err := models.GetMessage(c.DB, id)
-	if err != nil {
-		middleware.SendJSON(w, http.StatusNotFound, middleware.Response{
+	fromContent, err := models.GetMessageVersion(c.DB, message, from)
+	if err == nil {
+		var toContent string
+		if toContent, err = models.GetMessageVersion(c.DB, message, to); err == nil {
+			middleware.SendJSON(w, http.StatusOK, middleware.Response{
+				Status: "success",
+				Data: map[string]interface{}{
+					"message_id": message.ID,
+					"from":       from,
+					"to":         to,
+					"changes":    services.DiffWords(fromContent, toContent),
+				},
+			})
+			return
+		}
+	}
+	middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+		Status:  "error",
+		Message: "Error getting message revisions",
+	})
+}
+
+// DeleteMessage met un message en corbeille (par son auteur ou un modérateur) ; il reste restaurable
+// par un admin jusqu'à sa purge
+func (c *MessageController) DeleteMessage(w http.ResponseWriter, r *http.Request) {
+	// Vérifier l'authentification
+	claims := middleware.GetUserFromContext(r)
+	if claims == nil {
+		middleware.SendJSON(w, http.StatusUnauthorized, middleware.Response{
 			Status:  "error",
-			Message: "Message not found",
+			Message: "Unauthorized",
 		})
 		return
 	}
 
+	message, _, ok := loadVisibleMessage(c.DB, w, r, claims)
+	if !ok {
+		return
+	}
+
 	// Vérifier les permissions
-	if message.AuthorID != claims.UserID && claims.Role != "admin" {
+	if message.AuthorID != claims.UserID && !models.IsModerator(claims.Role) {
 		middleware.SendJSON(w, http.StatusForbidden, middleware.Response{
 			Status:  "error",
 			Message: "Not authorized to delete this message",
@@ -300,14 +504,13 @@ func (c *MessageController) DeleteMessage(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	// Supprimer le message
-	if err := models.DeleteMessage(c.DB, id); err != nil {
-		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
-			Status:  "error",
-			Message: "Error deleting message: " + err.Error(),
-		})
+	if err := models.SoftDeleteMessage(c.DB, message.ID, claims.UserID, deleteReason(r)); err != nil {
+		sendTrashError(w, err, "Message not found", "Error deleting message")
 		return
 	}
+	if message.AuthorID != claims.UserID {
+		c.Notifications.NotifyModeration(message.AuthorID, claims.UserID, "message_deleted", message.ThreadID, 0)
+	}
 
 	middleware.SendJSON(w, http.StatusOK, middleware.Response{
 		Status:  "success",
@@ -357,26 +560,49 @@ func (c *MessageController) VoteMessage(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Ajouter ou mettre à jour le vote
-	if err := models.AddMessageReaction(c.DB, input.MessageID, claims.UserID, input.VoteType); err != nil {
-		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+	// Ajouter ou remplacer le vote ; les compteurs sont mis à jour dans la même transaction
+	vote, err := models.SetMessageVote(c.DB, input.MessageID, claims.UserID, input.VoteType)
+	if err == sql.ErrNoRows {
+		middleware.SendJSON(w, http.StatusNotFound, middleware.Response{
 			Status:  "error",
-			Message: "Error voting on message: " + err.Error(),
+			Message: "Message not found",
 		})
 		return
 	}
-
-	// Mettre à jour les compteurs
-	if err := models.UpdateMessageReactionCount(c.DB, input.MessageID); err != nil {
+	if err != nil {
 		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
 			Status:  "error",
-			Message: "Error updating message reaction count: " + err.Error(),
+			Message: "Error voting on message: " + err.Error(),
 		})
 		return
 	}
+	if message, err := models.GetMessage(c.DB, input.MessageID); err == nil {
+		c.Reputation.Refresh(message.AuthorID)
+		c.Badges.Evaluate(message.AuthorID)
+	}
 
 	middleware.SendJSON(w, http.StatusOK, middleware.Response{
 		Status:  "success",
 		Message: "Vote recorded successfully",
+		Data:    vote,
 	})
 }
+
+// syncMentions enregistre les @mentions du contenu d'un message, les ajoute au message et notifie
+// les utilisateurs nouvellement mentionnés. Les erreurs sont journalisées sans faire échouer l'envoi.
+func syncMentions(db *sql.DB, notifications *services.NotificationService, message *models.Message) {
+	mentions, err := models.ResolveMentions(db, models.ParseMentions(message.Content))
+	if err != nil {
+		log.Printf("Erreur lors de la résolution des mentions du message %d: %v", message.ID, err)
+		return
+	}
+	added, err := models.SetMessageMentions(db, message.ID, mentions)
+	if err != nil {
+		log.Printf("Erreur lors de l'enregistrement des mentions du message %d: %v", message.ID, err)
+		return
+	}
+	message.Mentions = mentions
+	for _, userID := range added {
+		notifications.NotifyMention(userID, message)
+	}
+}
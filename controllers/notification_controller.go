@@ -0,0 +1,246 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"projet-forum/middleware"
+	"projet-forum/models"
+
+	"github.com/gorilla/mux"
+)
+
+// NotificationController gère le centre de notifications de l'utilisateur connecté
+type NotificationController struct {
+	DB *sql.DB
+}
+
+// ListNotifications récupère les notifications paginées et le nombre de non lues
+func (c *NotificationController) ListNotifications(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r)
+	if claims == nil {
+		middleware.SendJSON(w, http.StatusUnauthorized, middleware.Response{
+			Status:  "error",
+			Message: "Unauthorized",
+		})
+		return
+	}
+
+	// Récupérer les paramètres de pagination
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+
+	perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+	if perPage < 1 || perPage > 100 {
+		perPage = 10
+	}
+
+	unreadOnly := r.URL.Query().Get("unread") == "true"
+
+	notifications, err := models.ListNotifications(c.DB, claims.UserID, page, perPage, unreadOnly)
+	if err != nil {
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Error getting notifications: " + err.Error(),
+		})
+		return
+	}
+
+	unreadCount, err := models.CountUnreadNotifications(c.DB, claims.UserID)
+	if err != nil {
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Error counting unread notifications",
+		})
+		return
+	}
+
+	middleware.SendJSON(w, http.StatusOK, middleware.Response{
+		Status: "success",
+		Data: map[string]interface{}{
+			"notifications": notifications,
+			"unread_count":  unreadCount,
+			"page":          page,
+			"per_page":      perPage,
+		},
+	})
+}
+
+// GetUnreadCount récupère uniquement le nombre de notifications non lues
+func (c *NotificationController) GetUnreadCount(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r)
+	if claims == nil {
+		middleware.SendJSON(w, http.StatusUnauthorized, middleware.Response{
+			Status:  "error",
+			Message: "Unauthorized",
+		})
+		return
+	}
+
+	unreadCount, err := models.CountUnreadNotifications(c.DB, claims.UserID)
+	if err != nil {
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Error counting unread notifications",
+		})
+		return
+	}
+
+	middleware.SendJSON(w, http.StatusOK, middleware.Response{
+		Status: "success",
+		Data: map[string]int{
+			"unread_count": unreadCount,
+		},
+	})
+}
+
+// MarkRead marque une notification comme lue
+func (c *NotificationController) MarkRead(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r)
+	if claims == nil {
+		middleware.SendJSON(w, http.StatusUnauthorized, middleware.Response{
+			Status:  "error",
+			Message: "Unauthorized",
+		})
+		return
+	}
+
+	notificationID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
+			Status:  "error",
+			Message: "Invalid notification ID",
+		})
+		return
+	}
+
+	if err := models.MarkNotificationRead(c.DB, claims.UserID, notificationID); err != nil {
+		if err == sql.ErrNoRows {
+			middleware.SendJSON(w, http.StatusNotFound, middleware.Response{
+				Status:  "error",
+				Message: "Notification not found",
+			})
+			return
+		}
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Error updating notification",
+		})
+		return
+	}
+
+	middleware.SendJSON(w, http.StatusOK, middleware.Response{
+		Status:  "success",
+		Message: "Notification marked as read",
+	})
+}
+
+// MarkAllRead marque toutes les notifications comme lues
+func (c *NotificationController) MarkAllRead(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r)
+	if claims == nil {
+		middleware.SendJSON(w, http.StatusUnauthorized, middleware.Response{
+			Status:  "error",
+			Message: "Unauthorized",
+		})
+		return
+	}
+
+	if err := models.MarkAllNotificationsRead(c.DB, claims.UserID); err != nil {
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Error updating notifications",
+		})
+		return
+	}
+
+	middleware.SendJSON(w, http.StatusOK, middleware.Response{
+		Status:  "success",
+		Message: "All notifications marked as read",
+	})
+}
+
+// GetPreferences récupère les types de notifications activés
+func (c *NotificationController) GetPreferences(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r)
+	if claims == nil {
+		middleware.SendJSON(w, http.StatusUnauthorized, middleware.Response{
+			Status:  "error",
+			Message: "Unauthorized",
+		})
+		return
+	}
+
+	prefs, err := models.GetNotificationPreferences(c.DB, claims.UserID)
+	if err != nil {
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Error getting notification preferences",
+		})
+		return
+	}
+
+	middleware.SendJSON(w, http.StatusOK, middleware.Response{
+		Status: "success",
+		Data:   prefs,
+	})
+}
+
+// UpdatePreferences active ou désactive des types de notifications, ex. {"reaction": false}
+func (c *NotificationController) UpdatePreferences(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r)
+	if claims == nil {
+		middleware.SendJSON(w, http.StatusUnauthorized, middleware.Response{
+			Status:  "error",
+			Message: "Unauthorized",
+		})
+		return
+	}
+
+	var input map[string]bool
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
+			Status:  "error",
+			Message: "Invalid request body",
+		})
+		return
+	}
+
+	for notificationType := range input {
+		if !models.IsValidNotificationType(notificationType) {
+			middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
+				Status:  "error",
+				Message: "Invalid notification type: " + notificationType,
+			})
+			return
+		}
+	}
+
+	for notificationType, enabled := range input {
+		if err := models.SetNotificationPreference(c.DB, claims.UserID, notificationType, enabled); err != nil {
+			middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+				Status:  "error",
+				Message: "Error updating notification preferences",
+			})
+			return
+		}
+	}
+
+	prefs, err := models.GetNotificationPreferences(c.DB, claims.UserID)
+	if err != nil {
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Error getting notification preferences",
+		})
+		return
+	}
+
+	middleware.SendJSON(w, http.StatusOK, middleware.Response{
+		Status: "success",
+		Data:   prefs,
+	})
+}
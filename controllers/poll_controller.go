@@ -0,0 +1,169 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"projet-forum/middleware"
+	"projet-forum/models"
+	"projet-forum/services"
+)
+
+// PollController gère les sondages des fils : consultation, vote et diffusion des résultats en direct
+type PollController struct {
+	DB       *sql.DB
+	Presence *services.PresenceHub
+}
+
+// GetPoll retourne le sondage d'un fil avec les choix de l'utilisateur connecté
+func (c *PollController) GetPoll(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r)
+	if claims == nil {
+		claims = &middleware.Claims{}
+	}
+	thread, ok := loadVisibleThread(c.DB, w, r, claims)
+	if !ok {
+		return
+	}
+
+	poll, err := models.GetThreadPoll(c.DB, thread.ID, claims.UserID)
+	if err == sql.ErrNoRows {
+		middleware.SendJSON(w, http.StatusNotFound, middleware.Response{
+			Status:  "error",
+			Message: "Thread has no poll",
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("Erreur lors de la récupération du sondage du fil %d: %v", thread.ID, err)
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Error getting poll",
+		})
+		return
+	}
+
+	middleware.SendJSON(w, http.StatusOK, middleware.Response{
+		Status: "success",
+		Data:   poll,
+	})
+}
+
+// Vote enregistre les choix de l'utilisateur, ex. {"option_ids": [3]} ; un sondage à choix unique
+// n'accepte qu'une option
+func (c *PollController) Vote(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r)
+	if claims == nil {
+		middleware.SendJSON(w, http.StatusUnauthorized, middleware.Response{
+			Status:  "error",
+			Message: "Unauthorized",
+		})
+		return
+	}
+	thread, ok := loadVisibleThread(c.DB, w, r, claims)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		OptionIDs []int64 `json:"option_ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
+			Status:  "error",
+			Message: "Invalid request body",
+		})
+		return
+	}
+
+	results, err := models.VotePoll(c.DB, thread.ID, claims.UserID, input.OptionIDs)
+	c.sendVoteResult(w, thread.ID, claims.UserID, results, err, "Vote recorded")
+}
+
+// RetractVote retire les choix de l'utilisateur d'un sondage qui autorise les changements de vote
+func (c *PollController) RetractVote(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r)
+	if claims == nil {
+		middleware.SendJSON(w, http.StatusUnauthorized, middleware.Response{
+			Status:  "error",
+			Message: "Unauthorized",
+		})
+		return
+	}
+	thread, ok := loadVisibleThread(c.DB, w, r, claims)
+	if !ok {
+		return
+	}
+
+	results, err := models.RetractPollVote(c.DB, thread.ID, claims.UserID)
+	c.sendVoteResult(w, thread.ID, claims.UserID, results, err, "Vote retracted")
+}
+
+// sendVoteResult traduit le résultat d'un vote en réponse HTTP et diffuse les nouveaux résultats aux
+// lecteurs du fil
+func (c *PollController) sendVoteResult(w http.ResponseWriter, threadID, userID int64, results *models.PollResults, err error, message string) {
+	switch err {
+	case nil:
+	case sql.ErrNoRows:
+		middleware.SendJSON(w, http.StatusNotFound, middleware.Response{
+			Status:  "error",
+			Message: "Thread has no poll",
+		})
+		return
+	case models.ErrPollClosed, models.ErrPollAlreadyVoted:
+		middleware.SendJSON(w, http.StatusConflict, middleware.Response{
+			Status:  "error",
+			Message: err.Error(),
+		})
+		return
+	case models.ErrPollInvalidVote:
+		middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
+			Status:  "error",
+			Message: err.Error(),
+		})
+		return
+	default:
+		log.Printf("Erreur lors du vote de l'utilisateur %d au sondage du fil %d: %v", userID, threadID, err)
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Error recording vote",
+		})
+		return
+	}
+
+	c.Presence.BroadcastPoll(threadID, results)
+
+	poll, err := models.GetThreadPoll(c.DB, threadID, userID)
+	if err != nil {
+		log.Printf("Erreur lors de la récupération du sondage du fil %d: %v", threadID, err)
+		middleware.SendJSON(w, http.StatusOK, middleware.Response{
+			Status:  "success",
+			Message: message,
+			Data:    results,
+		})
+		return
+	}
+	middleware.SendJSON(w, http.StatusOK, middleware.Response{
+		Status:  "success",
+		Message: message,
+		Data:    poll,
+	})
+}
+
+// broadcastPollResults diffuse les résultats du sondage d'un fil, par exemple quand sa fermeture le fige
+func broadcastPollResults(db *sql.DB, presence *services.PresenceHub, threadID int64) {
+	if presence == nil {
+		return
+	}
+	results, err := models.GetPollResults(db, threadID)
+	if err == sql.ErrNoRows {
+		return
+	}
+	if err != nil {
+		log.Printf("Erreur lors de la récupération des résultats du sondage du fil %d: %v", threadID, err)
+		return
+	}
+	presence.BroadcastPoll(threadID, results)
+}
@@ -0,0 +1,164 @@
+package controllers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+
+	"projet-forum/middleware"
+	"projet-forum/models"
+	"projet-forum/services"
+)
+
+// QuestionController gère le mode questions/réponses : réponse acceptée et questions sans réponse
+type QuestionController struct {
+	DB            *sql.DB
+	Notifications *services.NotificationService
+	Badges        *services.BadgeService
+}
+
+// loadAnswer charge le message visé et vérifie que son fil est une question que l'utilisateur peut
+// résoudre (auteur du fil ou modérateur)
+func (c *QuestionController) loadAnswer(w http.ResponseWriter, r *http.Request) (*models.Message, *models.Thread, *middleware.Claims, bool) {
+	claims := middleware.GetUserFromContext(r)
+	if claims == nil {
+		middleware.SendJSON(w, http.StatusUnauthorized, middleware.Response{
+			Status:  "error",
+			Message: "Unauthorized",
+		})
+		return nil, nil, nil, false
+	}
+
+	message, thread, ok := loadVisibleMessage(c.DB, w, r, claims)
+	if !ok {
+		return nil, nil, nil, false
+	}
+	if thread.Type != models.ThreadTypeQuestion {
+		middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
+			Status:  "error",
+			Message: "Thread is not a question",
+		})
+		return nil, nil, nil, false
+	}
+	if thread.AuthorID != claims.UserID && !models.IsModerator(claims.Role) {
+		middleware.SendJSON(w, http.StatusForbidden, middleware.Response{
+			Status:  "error",
+			Message: "Only the author of the question or a moderator can choose the accepted answer",
+		})
+		return nil, nil, nil, false
+	}
+	return message, thread, claims, true
+}
+
+// AcceptAnswer marque un message comme réponse acceptée de sa question, à la place de la précédente
+func (c *QuestionController) AcceptAnswer(w http.ResponseWriter, r *http.Request) {
+	message, thread, claims, ok := c.loadAnswer(w, r)
+	if !ok {
+		return
+	}
+
+	if err := models.SetAcceptedAnswer(c.DB, thread.ID, message.ID); err != nil {
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Error accepting answer",
+		})
+		return
+	}
+
+	if thread.AcceptedMessageID != message.ID {
+		c.Notifications.Notify(models.NotificationInput{
+			UserID:    message.AuthorID,
+			Type:      models.NotificationAnswer,
+			ActorID:   claims.UserID,
+			ThreadID:  thread.ID,
+			MessageID: message.ID,
+		})
+		c.Badges.Evaluate(message.AuthorID)
+	}
+
+	middleware.SendJSON(w, http.StatusOK, middleware.Response{
+		Status:  "success",
+		Message: "Answer accepted",
+		Data:    map[string]interface{}{"thread_id": thread.ID, "accepted_message_id": message.ID},
+	})
+}
+
+// ClearAcceptedAnswer retire la réponse acceptée d'une question ; la question redevient non résolue
+func (c *QuestionController) ClearAcceptedAnswer(w http.ResponseWriter, r *http.Request) {
+	message, thread, _, ok := c.loadAnswer(w, r)
+	if !ok {
+		return
+	}
+	if thread.AcceptedMessageID != message.ID {
+		middleware.SendJSON(w, http.StatusConflict, middleware.Response{
+			Status:  "error",
+			Message: "Message is not the accepted answer",
+		})
+		return
+	}
+
+	if err := models.SetAcceptedAnswer(c.DB, thread.ID, 0); err != nil {
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Error clearing accepted answer",
+		})
+		return
+	}
+
+	middleware.SendJSON(w, http.StatusOK, middleware.Response{
+		Status:  "success",
+		Message: "Accepted answer cleared",
+		Data:    map[string]interface{}{"thread_id": thread.ID, "accepted_message_id": 0},
+	})
+}
+
+// ListUnanswered liste les questions ouvertes sans réponse acceptée ni réponse d'un autre membre,
+// les plus anciennes en premier, ex. ?category_id=3&page=1&per_page=10
+func (c *QuestionController) ListUnanswered(w http.ResponseWriter, r *http.Request) {
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+	if perPage < 1 || perPage > 100 {
+		perPage = 10
+	}
+	var categoryID int64
+	if v := r.URL.Query().Get("category_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
+				Status:  "error",
+				Message: "Invalid category_id",
+			})
+			return
+		}
+		categoryID = id
+	}
+
+	var userID int64
+	var role string
+	if claims := middleware.GetUserFromContext(r); claims != nil {
+		userID, role = claims.UserID, claims.Role
+	}
+	threads, total, err := models.ListUnansweredQuestions(c.DB, userID, role, categoryID, page, perPage)
+	if err != nil {
+		log.Printf("Erreur lors de la récupération des questions sans réponse: %v", err)
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Error getting unanswered questions",
+		})
+		return
+	}
+
+	middleware.SendJSON(w, http.StatusOK, middleware.Response{
+		Status: "success",
+		Data: map[string]interface{}{
+			"threads":  threads,
+			"total":    total,
+			"page":     page,
+			"per_page": perPage,
+		},
+	})
+}
@@ -0,0 +1,576 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"projet-forum/middleware"
+	"projet-forum/models"
+	"projet-forum/services"
+
+	"github.com/gorilla/mux"
+)
+
+// MaxReactionQueryMessages limite le nombre de messages demandés à GET /api/users/me/reactions
+const MaxReactionQueryMessages = 100
+
+var reactionCodePattern = regexp.MustCompile(`^[a-z0-9_]{1,32}$`)
+
+// ReactionController gère les réactions emoji des messages et leur configuration par les administrateurs
+type ReactionController struct {
+	DB            *sql.DB
+	Files         *services.FileService
+	Notifications *services.NotificationService
+	Reputation    *services.ReputationService
+	Badges        *services.BadgeService
+}
+
+// withImageURL renseigne l'URL publique de l'image des réactions personnalisées
+func (c *ReactionController) withImageURL(types ...*models.ReactionType) {
+	for _, t := range types {
+		if t.ImageKey != "" {
+			t.ImageURL = c.Files.URL(t.ImageKey)
+		}
+	}
+}
+
+// ListTypes liste les réactions proposées sur les messages
+func (c *ReactionController) ListTypes(w http.ResponseWriter, r *http.Request) {
+	types, err := models.ListReactionTypes(c.DB, false)
+	if err != nil {
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Error getting reactions",
+		})
+		return
+	}
+	c.withImageURL(types...)
+
+	middleware.SendJSON(w, http.StatusOK, middleware.Response{
+		Status: "success",
+		Data:   types,
+	})
+}
+
+// GetMessageReactions retourne le nombre de réactions de chaque type sur un message, en indiquant
+// celles de l'utilisateur connecté
+func (c *ReactionController) GetMessageReactions(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r)
+	message, _, ok := loadVisibleMessage(c.DB, w, r, claims)
+	if !ok {
+		return
+	}
+
+	var viewerID int64
+	if claims != nil {
+		viewerID = claims.UserID
+	}
+	summaries, err := models.GetReactionSummaries(c.DB, []int64{message.ID}, viewerID)
+	if err != nil {
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Error getting reactions",
+		})
+		return
+	}
+
+	reactions := summaries[message.ID]
+	if reactions == nil {
+		reactions = []*models.ReactionSummary{}
+	}
+	middleware.SendJSON(w, http.StatusOK, middleware.Response{
+		Status: "success",
+		Data:   reactions,
+	})
+}
+
+// ToggleReaction ajoute ou retire une réaction emoji de l'utilisateur connecté, ex. {"code": "heart"}.
+// Les likes et dislikes, qui forment le score de popularité, restent gérés par /api/messages/{id}/like.
+func (c *ReactionController) ToggleReaction(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r)
+	if claims == nil {
+		middleware.SendJSON(w, http.StatusUnauthorized, middleware.Response{
+			Status:  "error",
+			Message: "Unauthorized",
+		})
+		return
+	}
+
+	var input struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
+			Status:  "error",
+			Message: "Invalid request body",
+		})
+		return
+	}
+
+	message, _, ok := loadVisibleMessage(c.DB, w, r, claims)
+	if !ok {
+		return
+	}
+
+	reactionType, err := models.GetReactionTypeByCode(c.DB, input.Code)
+	if err != nil || !reactionType.Enabled {
+		middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
+			Status:  "error",
+			Message: "Unknown reaction",
+		})
+		return
+	}
+
+	reacted, err := models.ToggleEmojiReaction(c.DB, message.ID, claims.UserID, reactionType.ID)
+	if err != nil {
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Error updating reaction",
+		})
+		return
+	}
+	if reacted {
+		c.Notifications.NotifyReaction(message, claims.UserID, reactionType.Code)
+	}
+	c.Reputation.Refresh(message.AuthorID)
+	c.Badges.Evaluate(message.AuthorID)
+
+	summaries, err := models.GetReactionSummaries(c.DB, []int64{message.ID}, claims.UserID)
+	if err != nil {
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Error getting reactions",
+		})
+		return
+	}
+	reactions := summaries[message.ID]
+	if reactions == nil {
+		reactions = []*models.ReactionSummary{}
+	}
+
+	middleware.SendJSON(w, http.StatusOK, middleware.Response{
+		Status: "success",
+		Data: map[string]interface{}{
+			"code":      reactionType.Code,
+			"reacted":   reacted,
+			"reactions": reactions,
+		},
+	})
+}
+
+// ListReactors liste les utilisateurs ayant mis une réaction donnée à un message
+func (c *ReactionController) ListReactors(w http.ResponseWriter, r *http.Request) {
+	message, _, ok := loadVisibleMessage(c.DB, w, r, middleware.GetUserFromContext(r))
+	if !ok {
+		return
+	}
+
+	reactionType, err := models.GetReactionTypeByCode(c.DB, mux.Vars(r)["code"])
+	if err != nil {
+		middleware.SendJSON(w, http.StatusNotFound, middleware.Response{
+			Status:  "error",
+			Message: "Reaction not found",
+		})
+		return
+	}
+
+	// Récupérer les paramètres de pagination
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+
+	perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+	if perPage < 1 || perPage > 100 {
+		perPage = 10
+	}
+
+	users, total, err := models.ListReactors(c.DB, message.ID, reactionType.ID, page, perPage)
+	if err != nil {
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Error getting reactions",
+		})
+		return
+	}
+
+	middleware.SendJSON(w, http.StatusOK, middleware.Response{
+		Status: "success",
+		Data: map[string]interface{}{
+			"code":     reactionType.Code,
+			"users":    users,
+			"total":    total,
+			"page":     page,
+			"per_page": perPage,
+		},
+	})
+}
+
+// GetMyReactions retourne le vote et les réactions emoji de l'utilisateur connecté sur une page de
+// messages, ex. ?message_ids=12,13,14. Les messages sans réaction sont absents du résultat.
+func (c *ReactionController) GetMyReactions(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r)
+	if claims == nil {
+		middleware.SendJSON(w, http.StatusUnauthorized, middleware.Response{
+			Status:  "error",
+			Message: "Unauthorized",
+		})
+		return
+	}
+
+	var ids []int64
+	seen := make(map[int64]bool)
+	for _, field := range strings.Split(r.URL.Query().Get("message_ids"), ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		id, err := strconv.ParseInt(field, 10, 64)
+		if err != nil || id < 1 {
+			middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
+				Status:  "error",
+				Message: "Invalid message_ids",
+			})
+			return
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) > MaxReactionQueryMessages {
+		middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
+			Status:  "error",
+			Message: "Too many message IDs (max " + strconv.Itoa(MaxReactionQueryMessages) + ")",
+		})
+		return
+	}
+
+	// Les réactions de l'utilisateur ne révèlent rien des messages qu'il ne peut plus voir :
+	// il ne peut que retrouver ses propres réactions
+	reactions, err := models.GetUserReactions(c.DB, claims.UserID, ids)
+	if err != nil {
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Error getting reactions",
+		})
+		return
+	}
+
+	byMessage := make(map[string]*models.UserMessageReactions, len(reactions))
+	for id, reaction := range reactions {
+		byMessage[strconv.FormatInt(id, 10)] = reaction
+	}
+	middleware.SendJSON(w, http.StatusOK, middleware.Response{
+		Status: "success",
+		Data:   byMessage,
+	})
+}
+
+// reactionTypeInput regroupe les champs d'une réaction envoyés en JSON ou en multipart ;
+// les champs absents ne sont pas modifiés
+type reactionTypeInput struct {
+	Code        string  `json:"code"`
+	Label       *string `json:"label"`
+	Emoji       *string `json:"emoji"`
+	Position    *int    `json:"position"`
+	Enabled     *bool   `json:"enabled"`
+	RemoveImage bool    `json:"remove_image"`
+	image       *multipart.FileHeader
+}
+
+// parseReactionTypeInput lit un corps JSON, ou un formulaire multipart dont le champ « image » contient
+// l'image d'une réaction personnalisée
+func parseReactionTypeInput(w http.ResponseWriter, r *http.Request) (*reactionTypeInput, bool) {
+	input := &reactionTypeInput{}
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		if err := json.NewDecoder(r.Body).Decode(input); err != nil {
+			middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
+				Status:  "error",
+				Message: "Invalid request body",
+			})
+			return nil, false
+		}
+		return input, true
+	}
+
+	if err := r.ParseMultipartForm(services.MaxImageSize); err != nil {
+		middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
+			Status:  "error",
+			Message: "Invalid multipart form or request too large",
+		})
+		return nil, false
+	}
+	form := r.MultipartForm
+	field := func(name string) *string {
+		if values, ok := form.Value[name]; ok && len(values) > 0 {
+			return &values[0]
+		}
+		return nil
+	}
+	if code := field("code"); code != nil {
+		input.Code = *code
+	}
+	input.Label = field("label")
+	input.Emoji = field("emoji")
+	if position := field("position"); position != nil {
+		n, err := strconv.Atoi(*position)
+		if err != nil {
+			middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
+				Status:  "error",
+				Message: "Invalid position",
+			})
+			return nil, false
+		}
+		input.Position = &n
+	}
+	if enabled := field("enabled"); enabled != nil {
+		b, err := strconv.ParseBool(*enabled)
+		if err != nil {
+			middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
+				Status:  "error",
+				Message: "Invalid enabled value",
+			})
+			return nil, false
+		}
+		input.Enabled = &b
+	}
+	if remove := field("remove_image"); remove != nil {
+		input.RemoveImage, _ = strconv.ParseBool(*remove)
+	}
+	if files := form.File["image"]; len(files) > 0 {
+		input.image = files[0]
+	}
+	return input, true
+}
+
+// apply reporte les champs envoyés sur la réaction et vérifie le résultat
+func (input *reactionTypeInput) apply(t *models.ReactionType) string {
+	if input.Label != nil {
+		t.Label = strings.TrimSpace(*input.Label)
+	}
+	if input.Emoji != nil {
+		t.Emoji = strings.TrimSpace(*input.Emoji)
+	}
+	if input.Position != nil {
+		t.Position = *input.Position
+	}
+	if input.Enabled != nil {
+		t.Enabled = *input.Enabled
+	}
+
+	switch {
+	case t.Label == "" || utf8.RuneCountInString(t.Label) > 64:
+		return "Label is required (max 64 characters)"
+	case utf8.RuneCountInString(t.Emoji) > 16:
+		return "Emoji too long (max 16 characters)"
+	case t.Emoji == "" && t.ImageKey == "" && input.image == nil:
+		return "An emoji or an image is required"
+	}
+	return ""
+}
+
+// AdminListTypes liste toutes les réactions, y compris celles désactivées
+func (c *ReactionController) AdminListTypes(w http.ResponseWriter, r *http.Request) {
+	types, err := models.ListReactionTypes(c.DB, true)
+	if err != nil {
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Error getting reactions",
+		})
+		return
+	}
+	c.withImageURL(types...)
+
+	middleware.SendJSON(w, http.StatusOK, middleware.Response{
+		Status: "success",
+		Data:   types,
+	})
+}
+
+// CreateType ajoute une réaction, avec un emoji ou une image personnalisée (multipart, champ « image »)
+func (c *ReactionController) CreateType(w http.ResponseWriter, r *http.Request) {
+	input, ok := parseReactionTypeInput(w, r)
+	if !ok {
+		return
+	}
+
+	input.Code = strings.TrimSpace(input.Code)
+	if !reactionCodePattern.MatchString(input.Code) {
+		middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
+			Status:  "error",
+			Message: "Invalid code (1 to 32 lowercase letters, digits or underscores)",
+		})
+		return
+	}
+	// like et dislike sont réservés au vote qui forme le score de popularité
+	if input.Code == "like" || input.Code == "dislike" {
+		middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
+			Status:  "error",
+			Message: "This code is reserved",
+		})
+		return
+	}
+
+	reactionType := &models.ReactionType{Code: input.Code, Enabled: true}
+	if message := input.apply(reactionType); message != "" {
+		middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
+			Status:  "error",
+			Message: message,
+		})
+		return
+	}
+
+	if _, err := models.GetReactionTypeByCode(c.DB, reactionType.Code); err == nil {
+		middleware.SendJSON(w, http.StatusConflict, middleware.Response{
+			Status:  "error",
+			Message: "A reaction with this code already exists",
+		})
+		return
+	}
+
+	var reservationID int64
+	if input.image != nil {
+		key, id, err := c.Files.SaveReactionImage(input.image)
+		if err != nil {
+			sendUploadError(w, err, "Error saving reaction image")
+			return
+		}
+		reactionType.ImageKey, reservationID = key, id
+	}
+
+	err := models.CreateReactionType(c.DB, reactionType)
+	c.Files.ReleaseReservation(reservationID)
+	if err != nil {
+		c.Files.RemoveReactionImage(reactionType.ImageKey)
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Error creating reaction",
+		})
+		return
+	}
+	c.withImageURL(reactionType)
+
+	middleware.SendJSON(w, http.StatusCreated, middleware.Response{
+		Status:  "success",
+		Message: "Reaction created successfully",
+		Data:    reactionType,
+	})
+}
+
+// UpdateType modifie une réaction ; une nouvelle image remplace l'ancienne, remove_image la retire
+func (c *ReactionController) UpdateType(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
+			Status:  "error",
+			Message: "Invalid reaction ID",
+		})
+		return
+	}
+
+	input, ok := parseReactionTypeInput(w, r)
+	if !ok {
+		return
+	}
+
+	reactionType, err := models.GetReactionType(c.DB, id)
+	if err != nil {
+		middleware.SendJSON(w, http.StatusNotFound, middleware.Response{
+			Status:  "error",
+			Message: "Reaction not found",
+		})
+		return
+	}
+
+	oldImage := reactionType.ImageKey
+	if input.RemoveImage {
+		reactionType.ImageKey = ""
+	}
+	if message := input.apply(reactionType); message != "" {
+		middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
+			Status:  "error",
+			Message: message,
+		})
+		return
+	}
+
+	var reservationID int64
+	if input.image != nil {
+		key, id, err := c.Files.SaveReactionImage(input.image)
+		if err != nil {
+			sendUploadError(w, err, "Error saving reaction image")
+			return
+		}
+		reactionType.ImageKey, reservationID = key, id
+	}
+
+	err = models.UpdateReactionType(c.DB, reactionType)
+	c.Files.ReleaseReservation(reservationID)
+	if err != nil {
+		if reactionType.ImageKey != oldImage {
+			c.Files.RemoveReactionImage(reactionType.ImageKey)
+		}
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Error updating reaction",
+		})
+		return
+	}
+	if oldImage != reactionType.ImageKey {
+		c.Files.RemoveReactionImage(oldImage)
+	}
+	c.withImageURL(reactionType)
+
+	middleware.SendJSON(w, http.StatusOK, middleware.Response{
+		Status:  "success",
+		Message: "Reaction updated successfully",
+		Data:    reactionType,
+	})
+}
+
+// DeleteType supprime une réaction et toutes les réactions des utilisateurs de ce type ;
+// pour la retirer sans perdre l'historique, il suffit de la désactiver
+func (c *ReactionController) DeleteType(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
+			Status:  "error",
+			Message: "Invalid reaction ID",
+		})
+		return
+	}
+
+	reactionType, err := models.GetReactionType(c.DB, id)
+	if err == nil {
+		err = models.DeleteReactionType(c.DB, id)
+	}
+	if err == sql.ErrNoRows {
+		middleware.SendJSON(w, http.StatusNotFound, middleware.Response{
+			Status:  "error",
+			Message: "Reaction not found",
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("Erreur lors de la suppression de la réaction %d: %v", id, err)
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Error deleting reaction",
+		})
+		return
+	}
+	c.Files.RemoveReactionImage(reactionType.ImageKey)
+
+	middleware.SendJSON(w, http.StatusOK, middleware.Response{
+		Status:  "success",
+		Message: "Reaction deleted successfully",
+	})
+}
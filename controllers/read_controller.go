@@ -0,0 +1,109 @@
+package controllers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"projet-forum/middleware"
+	"projet-forum/models"
+
+	"github.com/gorilla/mux"
+)
+
+// ReadController gère le suivi de lecture des fils et des catégories
+type ReadController struct {
+	DB *sql.DB
+}
+
+// FirstUnread retourne le premier message non lu d'un fil et la page où il se trouve
+// (tri chronologique, pagination per_page)
+func (c *ReadController) FirstUnread(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r)
+	if claims == nil {
+		middleware.SendJSON(w, http.StatusUnauthorized, middleware.Response{
+			Status:  "error",
+			Message: "Unauthorized",
+		})
+		return
+	}
+
+	thread, ok := loadVisibleThread(c.DB, w, r, claims)
+	if !ok {
+		return
+	}
+
+	perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+	if perPage < 1 || perPage > 100 {
+		perPage = 10
+	}
+
+	messageID, position, unread, err := models.GetFirstUnreadMessage(c.DB, claims.UserID, thread.ID)
+	if err == sql.ErrNoRows {
+		middleware.SendJSON(w, http.StatusNotFound, middleware.Response{
+			Status:  "error",
+			Message: "Thread has no messages",
+		})
+		return
+	}
+	if err != nil {
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Error finding first unread message",
+		})
+		return
+	}
+
+	middleware.SendJSON(w, http.StatusOK, middleware.Response{
+		Status: "success",
+		Data: map[string]interface{}{
+			"message_id": messageID,
+			"has_unread": unread,
+			"page":       position/perPage + 1,
+			"per_page":   perPage,
+			"sort_by":    "oldest",
+		},
+	})
+}
+
+// MarkCategoryRead marque comme lus tous les fils d'une catégorie
+func (c *ReadController) MarkCategoryRead(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r)
+	if claims == nil {
+		middleware.SendJSON(w, http.StatusUnauthorized, middleware.Response{
+			Status:  "error",
+			Message: "Unauthorized",
+		})
+		return
+	}
+
+	categoryID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
+			Status:  "error",
+			Message: "Invalid category ID",
+		})
+		return
+	}
+
+	if _, err := models.GetCategory(c.DB, categoryID); err != nil {
+		middleware.SendJSON(w, http.StatusNotFound, middleware.Response{
+			Status:  "error",
+			Message: "Category not found",
+		})
+		return
+	}
+
+	if err := models.MarkCategoryRead(c.DB, claims.UserID, categoryID); err != nil {
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Error marking category as read",
+		})
+		return
+	}
+
+	middleware.SendJSON(w, http.StatusOK, middleware.Response{
+		Status:  "success",
+		Message: "Category marked as read",
+	})
+}
@@ -35,7 +35,7 @@ func (c *SearchController) SearchThreads(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Rechercher les fils de discussion
-	threads, err := models.SearchThreads(c.DB, query, limit, offset)
+	threads, err := models.SearchThreads(c.DB, query, limit, offset, nil)
 	if err != nil {
 		http.Error(w, "Error searching threads", http.StatusInternalServerError)
 		return
@@ -3,8 +3,11 @@ package controllers
 import (
 	"database/sql"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"projet-forum/middleware"
+	"projet-forum/models"
 )
 
 type StatsController struct {
@@ -34,7 +37,7 @@ func (c *StatsController) GetStats(w http.ResponseWriter, r *http.Request) {
 
 	// Récupérer le nombre total de discussions
 	var threadCount int
-	err = c.DB.QueryRow("SELECT COUNT(*) FROM threads").Scan(&threadCount)
+	err = c.DB.QueryRow("SELECT COUNT(*) FROM threads WHERE deleted_at IS NULL").Scan(&threadCount)
 	if err != nil {
 		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
 			Status:  "error",
@@ -45,7 +48,7 @@ func (c *StatsController) GetStats(w http.ResponseWriter, r *http.Request) {
 
 	// Récupérer le nombre total de messages
 	var messageCount int
-	err = c.DB.QueryRow("SELECT COUNT(*) FROM messages").Scan(&messageCount)
+	err = c.DB.QueryRow("SELECT COUNT(*) FROM messages m JOIN threads t ON m.thread_id = t.id WHERE m.deleted_at IS NULL AND t.deleted_at IS NULL").Scan(&messageCount)
 	if err != nil {
 		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
 			Status:  "error",
@@ -59,7 +62,7 @@ func (c *StatsController) GetStats(w http.ResponseWriter, r *http.Request) {
 		SELECT t.id, t.title, t.description, t.created_at, u.username as author
 		FROM threads t
 		JOIN users u ON t.author_id = u.id
-		WHERE t.status = 'open' AND t.visibility = 'public'
+		WHERE t.status = 'open' AND t.visibility = 'public' AND t.deleted_at IS NULL
 		ORDER BY t.created_at DESC
 		LIMIT 5
 	`)
@@ -100,10 +103,8 @@ func (c *StatsController) GetStats(w http.ResponseWriter, r *http.Request) {
 
 	// Récupérer les utilisateurs les plus actifs (limité à 5)
 	rows, err = c.DB.Query(`
-		SELECT u.id, u.username, COUNT(m.id) as message_count
-		FROM users u
-		LEFT JOIN messages m ON u.id = m.author_id
-		GROUP BY u.id, u.username
+		SELECT id, username, message_count
+		FROM users
 		ORDER BY message_count DESC
 		LIMIT 5
 	`)
@@ -152,3 +153,77 @@ func (c *StatsController) GetStats(w http.ResponseWriter, r *http.Request) {
 		Data:   response,
 	})
 }
+
+// GetLeaderboards retourne les classements des auteurs les plus actifs, des auteurs les plus aimés et
+// des fils les plus actifs, ex. ?period=week&category_id=3&tag=go&limit=10. Les classements sont
+// calculés à partir des agrégats quotidiens, mis à jour toutes les quelques minutes.
+func (c *StatsController) GetLeaderboards(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := models.LeaderboardFilter{
+		Period: query.Get("period"),
+		Tag:    strings.ToLower(strings.TrimSpace(query.Get("tag"))),
+		Limit:  10,
+	}
+	if filter.Period == "" {
+		filter.Period = models.LeaderboardWeek
+	}
+	if !models.IsValidLeaderboardPeriod(filter.Period) {
+		middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
+			Status:  "error",
+			Message: "Invalid period (day, week, month or all)",
+		})
+		return
+	}
+	if v := query.Get("category_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
+				Status:  "error",
+				Message: "Invalid category_id",
+			})
+			return
+		}
+		filter.CategoryID = id
+	}
+	if v, err := strconv.Atoi(query.Get("limit")); err == nil && v > 0 {
+		filter.Limit = v
+	}
+	if filter.Limit > 50 {
+		filter.Limit = 50
+	}
+
+	posters, err := models.TopPosters(c.DB, filter)
+	if err != nil {
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Error getting top posters",
+		})
+		return
+	}
+	liked, err := models.TopLikedAuthors(c.DB, filter)
+	if err != nil {
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Error getting most liked authors",
+		})
+		return
+	}
+	threads, err := models.TopThreads(c.DB, filter)
+	if err != nil {
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Error getting most active threads",
+		})
+		return
+	}
+
+	middleware.SendJSON(w, http.StatusOK, middleware.Response{
+		Status: "success",
+		Data: map[string]interface{}{
+			"period":         filter.Period,
+			"top_posters":    posters,
+			"most_liked":     liked,
+			"active_threads": threads,
+		},
+	})
+}
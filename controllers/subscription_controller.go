@@ -0,0 +1,308 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"projet-forum/middleware"
+	"projet-forum/models"
+
+	"github.com/gorilla/mux"
+)
+
+// SubscriptionController gère les niveaux de suivi des fils, catégories et tags
+type SubscriptionController struct {
+	DB *sql.DB
+}
+
+// decodeWatchLevel lit {"level": "..."} dans le corps de la requête
+func decodeWatchLevel(w http.ResponseWriter, r *http.Request) (models.WatchLevel, bool) {
+	var input struct {
+		Level string `json:"level"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
+			Status:  "error",
+			Message: "Invalid request body",
+		})
+		return "", false
+	}
+	if !models.IsValidWatchLevel(input.Level) {
+		middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
+			Status:  "error",
+			Message: "Invalid watch level (watching, tracking, normal or muted)",
+		})
+		return "", false
+	}
+	return models.WatchLevel(input.Level), true
+}
+
+// GetThreadWatch récupère le niveau de suivi effectif d'un fil et son origine
+func (c *SubscriptionController) GetThreadWatch(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r)
+	if claims == nil {
+		middleware.SendJSON(w, http.StatusUnauthorized, middleware.Response{
+			Status:  "error",
+			Message: "Unauthorized",
+		})
+		return
+	}
+
+	thread, ok := loadVisibleThread(c.DB, w, r, claims)
+	if !ok {
+		return
+	}
+
+	level, source, err := models.GetThreadWatchLevel(c.DB, claims.UserID, thread)
+	if err != nil {
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Error getting watch level",
+		})
+		return
+	}
+
+	middleware.SendJSON(w, http.StatusOK, middleware.Response{
+		Status: "success",
+		Data: map[string]string{
+			"level":  string(level),
+			"source": source,
+		},
+	})
+}
+
+// SetThreadWatch fixe le niveau de suivi d'un fil, ex. {"level": "watching"}
+func (c *SubscriptionController) SetThreadWatch(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r)
+	if claims == nil {
+		middleware.SendJSON(w, http.StatusUnauthorized, middleware.Response{
+			Status:  "error",
+			Message: "Unauthorized",
+		})
+		return
+	}
+
+	thread, ok := loadVisibleThread(c.DB, w, r, claims)
+	if !ok {
+		return
+	}
+
+	level, ok := decodeWatchLevel(w, r)
+	if !ok {
+		return
+	}
+
+	if err := models.SetThreadWatchLevel(c.DB, claims.UserID, thread.ID, level); err != nil {
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Error updating watch level",
+		})
+		return
+	}
+
+	middleware.SendJSON(w, http.StatusOK, middleware.Response{
+		Status: "success",
+		Data: map[string]string{
+			"level":  string(level),
+			"source": models.WatchSourceThread,
+		},
+	})
+}
+
+// ClearThreadWatch supprime le niveau choisi pour un fil, qui hérite alors de sa catégorie et de ses tags
+func (c *SubscriptionController) ClearThreadWatch(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r)
+	if claims == nil {
+		middleware.SendJSON(w, http.StatusUnauthorized, middleware.Response{
+			Status:  "error",
+			Message: "Unauthorized",
+		})
+		return
+	}
+
+	threadID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
+			Status:  "error",
+			Message: "Invalid thread ID",
+		})
+		return
+	}
+
+	if err := models.ClearThreadWatchLevel(c.DB, claims.UserID, threadID); err != nil {
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Error updating watch level",
+		})
+		return
+	}
+
+	middleware.SendJSON(w, http.StatusOK, middleware.Response{
+		Status:  "success",
+		Message: "Thread watch level reset",
+	})
+}
+
+// SetCategoryWatch fixe le niveau de suivi d'une catégorie ; « normal » arrête de la suivre
+func (c *SubscriptionController) SetCategoryWatch(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r)
+	if claims == nil {
+		middleware.SendJSON(w, http.StatusUnauthorized, middleware.Response{
+			Status:  "error",
+			Message: "Unauthorized",
+		})
+		return
+	}
+
+	categoryID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
+			Status:  "error",
+			Message: "Invalid category ID",
+		})
+		return
+	}
+
+	if _, err := models.GetCategory(c.DB, categoryID); err != nil {
+		middleware.SendJSON(w, http.StatusNotFound, middleware.Response{
+			Status:  "error",
+			Message: "Category not found",
+		})
+		return
+	}
+
+	level, ok := decodeWatchLevel(w, r)
+	if !ok {
+		return
+	}
+
+	if err := models.SetCategoryWatchLevel(c.DB, claims.UserID, categoryID, level); err != nil {
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Error updating watch level",
+		})
+		return
+	}
+
+	middleware.SendJSON(w, http.StatusOK, middleware.Response{
+		Status: "success",
+		Data: models.CategoryWatch{
+			CategoryID: categoryID,
+			Level:      string(level),
+		},
+	})
+}
+
+// SetTagWatch fixe le niveau de suivi d'un tag ; « normal » arrête de le suivre
+func (c *SubscriptionController) SetTagWatch(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r)
+	if claims == nil {
+		middleware.SendJSON(w, http.StatusUnauthorized, middleware.Response{
+			Status:  "error",
+			Message: "Unauthorized",
+		})
+		return
+	}
+
+	tag := models.NormalizeTag(mux.Vars(r)["tag"])
+	if tag == "" || len(tag) > 50 {
+		middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
+			Status:  "error",
+			Message: "Invalid tag",
+		})
+		return
+	}
+
+	level, ok := decodeWatchLevel(w, r)
+	if !ok {
+		return
+	}
+
+	if err := models.SetTagWatchLevel(c.DB, claims.UserID, tag, level); err != nil {
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Error updating watch level",
+		})
+		return
+	}
+
+	middleware.SendJSON(w, http.StatusOK, middleware.Response{
+		Status: "success",
+		Data: models.TagWatch{
+			Tag:   tag,
+			Level: string(level),
+		},
+	})
+}
+
+// ListWatches récupère les catégories et tags suivis ou mis en sourdine par l'utilisateur connecté
+func (c *SubscriptionController) ListWatches(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r)
+	if claims == nil {
+		middleware.SendJSON(w, http.StatusUnauthorized, middleware.Response{
+			Status:  "error",
+			Message: "Unauthorized",
+		})
+		return
+	}
+
+	categories, tags, err := models.GetWatches(c.DB, claims.UserID)
+	if err != nil {
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Error getting watches",
+		})
+		return
+	}
+
+	middleware.SendJSON(w, http.StatusOK, middleware.Response{
+		Status: "success",
+		Data: map[string]interface{}{
+			"categories": categories,
+			"tags":       tags,
+		},
+	})
+}
+
+// ListUnreadWatched récupère les fils suivis (watching ou tracking) qui ont des messages non lus
+func (c *SubscriptionController) ListUnreadWatched(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r)
+	if claims == nil {
+		middleware.SendJSON(w, http.StatusUnauthorized, middleware.Response{
+			Status:  "error",
+			Message: "Unauthorized",
+		})
+		return
+	}
+
+	// Récupérer les paramètres de pagination
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+
+	perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+	if perPage < 1 || perPage > 100 {
+		perPage = 10
+	}
+
+	threads, err := models.ListUnreadWatchedThreads(c.DB, claims.UserID, claims.Role, page, perPage)
+	if err != nil {
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Error getting watched threads",
+		})
+		return
+	}
+
+	middleware.SendJSON(w, http.StatusOK, middleware.Response{
+		Status: "success",
+		Data: map[string]interface{}{
+			"threads":  threads,
+			"page":     page,
+			"per_page": perPage,
+		},
+	})
+}
@@ -9,17 +9,25 @@ import (
 	"strconv"
 	"strings"
 	"text/template"
+	"time"
 
 	"projet-forum/middleware"
 	"projet-forum/models"
+	"projet-forum/services"
 
 	"github.com/gorilla/mux"
 )
 
 // ThreadController gère les opérations liées aux fils de discussion
 type ThreadController struct {
-	DB        *sql.DB
-	Templates *template.Template
+	DB            *sql.DB
+	Templates     *template.Template
+	Notifications *services.NotificationService
+	Email         *services.EmailService
+	Files         *services.FileService
+	Reputation    *services.ReputationService
+	Badges        *services.BadgeService
+	Presence      *services.PresenceHub
 }
 
 // NewThreadController crée une nouvelle instance de ThreadController
@@ -89,9 +97,12 @@ func (c *ThreadController) CreateThread(w http.ResponseWriter, r *http.Request)
 	}
 
 	var input struct {
-		Title       string   `json:"title"`
-		Description string   `json:"description"`
-		Tags        []string `json:"tags"`
+		Title       string            `json:"title"`
+		Description string            `json:"description"`
+		Tags        []string          `json:"tags"`
+		CategoryID  int64             `json:"category_id"`
+		Type        string            `json:"type"`
+		Poll        *models.PollInput `json:"poll"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
@@ -102,8 +113,55 @@ func (c *ThreadController) CreateThread(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Créer le fil de discussion
-	thread, err := models.CreateThread(c.DB, input.Title, input.Description, claims.UserID, input.Tags)
+	// Sans type explicite, un fil est une question si sa catégorie est en mode question
+	threadType := input.Type
+	if input.CategoryID != 0 {
+		category, err := models.GetCategory(c.DB, input.CategoryID)
+		if err != nil {
+			middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
+				Status:  "error",
+				Message: "Category not found",
+			})
+			return
+		}
+		if threadType == "" && category.QuestionMode {
+			threadType = models.ThreadTypeQuestion
+		}
+	}
+	if threadType == "" {
+		threadType = models.ThreadTypeDiscussion
+	}
+	if !models.IsValidThreadType(threadType) {
+		middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
+			Status:  "error",
+			Message: "Invalid thread type (discussion or question)",
+		})
+		return
+	}
+
+	if input.Poll != nil {
+		if err := input.Poll.Normalize(); err != nil {
+			middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
+				Status:  "error",
+				Message: err.Error(),
+			})
+			return
+		}
+		if input.Poll.ClosesAt != nil && !input.Poll.ClosesAt.After(time.Now()) {
+			middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
+				Status:  "error",
+				Message: "Poll closing date must be in the future",
+			})
+			return
+		}
+	}
+
+	if !c.checkNewTags(w, claims, input.Tags, 0) {
+		return
+	}
+
+	// Créer le fil de discussion et son sondage éventuel
+	thread, err := models.CreateThread(c.DB, input.Title, input.Description, claims.UserID, input.CategoryID, input.Tags, threadType, input.Poll)
 	if err != nil {
 		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
 			Status:  "error",
@@ -112,6 +170,12 @@ func (c *ThreadController) CreateThread(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// L'auteur surveille automatiquement son fil
+	if err := models.AutoWatchThread(c.DB, claims.UserID, thread.ID); err != nil {
+		log.Printf("Erreur lors du suivi automatique du fil %d: %v", thread.ID, err)
+	}
+	c.Badges.Evaluate(claims.UserID)
+
 	middleware.SendJSON(w, http.StatusCreated, middleware.Response{
 		Status: "success",
 		Data:   thread,
@@ -131,32 +195,16 @@ func (c *ThreadController) GetThread(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Récupérer l'ID du fil de discussion depuis les variables de route
-	vars := mux.Vars(r)
-	idStr := vars["id"]
-	log.Printf("[DEBUG] GetThread - Thread ID depuis l'URL: %s", idStr)
-
-	id, err := strconv.ParseInt(idStr, 10, 64)
-	if err != nil {
-		log.Printf("[DEBUG] GetThread - Format d'ID invalide: %v", err)
-		middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
-			Status:  "error",
-			Message: "Invalid thread ID",
-		})
-		return
+	// Le fil, son sondage et sa réponse acceptée ne sont donnés qu'à qui peut le voir
+	claims := middleware.GetUserFromContext(r)
+	if claims == nil {
+		claims = &middleware.Claims{}
 	}
-
-	// Récupérer le fil de discussion
-	log.Printf("[DEBUG] GetThread - Tentative de récupération du thread ID: %d", id)
-	thread, err := models.GetThread(c.DB, id)
-	if err != nil {
-		log.Printf("[DEBUG] GetThread - Erreur lors de la récupération du thread: %v", err)
-		middleware.SendJSON(w, http.StatusNotFound, middleware.Response{
-			Status:  "error",
-			Message: "Thread not found",
-		})
+	thread, ok := loadVisibleThread(c.DB, w, r, claims)
+	if !ok {
 		return
 	}
+	id := thread.ID
 
 	log.Printf("[DEBUG] GetThread - Thread récupéré avec succès:")
 	log.Printf("[DEBUG] GetThread - ID: %d", thread.ID)
@@ -207,16 +255,39 @@ func (c *ThreadController) GetThread(w http.ResponseWriter, r *http.Request) {
 	createdAt := thread.CreatedAt.Format("02/01/2006 à 15:04")
 	log.Printf("[DEBUG] GetThread - Date formatée: %s", createdAt)
 
+	// La réponse acceptée d'une question est affichée sous le message d'origine
+	var acceptedAnswer *models.Message
+	if thread.AcceptedMessageID != 0 {
+		if acceptedAnswer, err = models.GetMessage(c.DB, thread.AcceptedMessageID); err != nil {
+			log.Printf("Erreur lors de la récupération de la réponse acceptée du fil %d: %v", thread.ID, err)
+			acceptedAnswer = nil
+		}
+	}
+
+	// Sondage du fil, avec les choix du visiteur s'il est connecté
+	poll, err := models.GetThreadPoll(c.DB, thread.ID, claims.UserID)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Erreur lors de la récupération du sondage du fil %d: %v", thread.ID, err)
+		}
+		poll = nil
+	}
+
 	// Préparer les données pour la réponse JSON
 	responseData := map[string]interface{}{
-		"id":          thread.ID,
-		"title":       thread.Title,
-		"description": thread.Description,
-		"author":      thread.Author, // ou map[string]interface{} si besoin de filtrer
-		"created_at":  thread.CreatedAt,
-		"tags":        tags,
-		"views":       thread.MessageCount,
-		"messages":    messages,
+		"id":              thread.ID,
+		"title":           thread.Title,
+		"description":     thread.Description,
+		"author":          thread.Author, // ou map[string]interface{} si besoin de filtrer
+		"author_id":       thread.AuthorID,
+		"created_at":      thread.CreatedAt,
+		"tags":            tags,
+		"views":           thread.MessageCount,
+		"type":            thread.Type,
+		"solved":          acceptedAnswer != nil,
+		"accepted_answer": acceptedAnswer,
+		"poll":            poll,
+		"messages":        messages,
 	}
 
 	log.Printf("[DEBUG] GetThread - Envoi de la réponse JSON")
@@ -259,8 +330,13 @@ func (c *ThreadController) ListThreads(w http.ResponseWriter, r *http.Request) {
 		visibility = "public"
 	}
 
+	solved, ok := parseSolvedFilter(w, r)
+	if !ok {
+		return
+	}
+
 	// Récupérer les discussions
-	threads, err := models.ListThreads(c.DB, page, perPage, status, visibility)
+	threads, err := models.ListThreads(c.DB, page, perPage, status, visibility, solved)
 	if err != nil {
 		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
 			Status:  "error",
@@ -269,6 +345,25 @@ func (c *ThreadController) ListThreads(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Nombre de messages non lus pour l'utilisateur connecté, calculé pour la page seulement
+	if claims := middleware.GetUserFromContext(r); claims != nil && len(threads) > 0 {
+		threadIDs := make([]int64, 0, len(threads))
+		for _, thread := range threads {
+			threadIDs = append(threadIDs, thread["id"].(int64))
+		}
+		counts, err := models.GetUnreadCounts(c.DB, claims.UserID, threadIDs)
+		if err != nil {
+			middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+				Status:  "error",
+				Message: "Error counting unread messages",
+			})
+			return
+		}
+		for _, thread := range threads {
+			thread["unread_count"] = counts[thread["id"].(int64)]
+		}
+	}
+
 	middleware.SendJSON(w, http.StatusOK, middleware.Response{
 		Status: "success",
 		Data: map[string]interface{}{
@@ -298,8 +393,7 @@ func (c *ThreadController) UpdateThread(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Récupérer l'ID du fil de discussion
-	idStr := r.URL.Query().Get("id")
-	id, err := strconv.ParseInt(idStr, 10, 64)
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
 	if err != nil {
 		middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
 			Status:  "error",
@@ -332,6 +426,8 @@ func (c *ThreadController) UpdateThread(w http.ResponseWriter, r *http.Request)
 		Description string   `json:"description"`
 		Tags        []string `json:"tags"`
 		Status      string   `json:"status"`
+		Type        string   `json:"type"`
+		Reason      string   `json:"reason"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
@@ -342,15 +438,48 @@ func (c *ThreadController) UpdateThread(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Mettre à jour le fil de discussion
-	thread.Title = input.Title
-	thread.Description = input.Description
-	thread.Tags = strings.Join(input.Tags, ",")
-	if input.Status != "" {
-		thread.Status = string(models.ThreadStatus(input.Status))
+	if input.Type != "" && !models.IsValidThreadType(input.Type) {
+		middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
+			Status:  "error",
+			Message: "Invalid thread type (discussion or question)",
+		})
+		return
+	}
+	if input.Status != "" && !models.IsValidThreadStatus(input.Status) {
+		middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
+			Status:  "error",
+			Message: "Invalid thread status (open, closed or archived)",
+		})
+		return
+	}
+
+	if strings.TrimSpace(input.Title) == "" || len([]rune(input.Reason)) > 255 {
+		middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
+			Status:  "error",
+			Message: "Title is required and reason is limited to 255 characters",
+		})
+		return
 	}
 
-	if err := thread.UpdateThread(c.DB); err != nil {
+	if !c.checkNewTags(w, claims, input.Tags, id) {
+		return
+	}
+
+	// Mettre à jour le fil de discussion (contenu, statut et type en une seule transaction) ; la nouvelle
+	// version est ajoutée à l'historique
+	_, err = models.ReviseThread(c.DB, id, claims.UserID, models.ThreadEdit{
+		Title:       input.Title,
+		Description: input.Description,
+		Tags:        strings.Join(input.Tags, ","),
+		Status:      input.Status,
+		Type:        input.Type,
+		Reason:      input.Reason,
+	})
+	if err == nil && input.Status != "" && input.Status != thread.Status {
+		// Le sondage du fil est figé ou rouvert avec lui
+		broadcastPollResults(c.DB, c.Presence, id)
+	}
+	if err != nil {
 		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
 			Status:  "error",
 			Message: "Error updating thread: " + err.Error(),
@@ -358,6 +487,134 @@ func (c *ThreadController) UpdateThread(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	thread, err = models.GetThread(c.DB, id)
+	if err != nil {
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Error getting thread",
+		})
+		return
+	}
+
+	middleware.SendJSON(w, http.StatusOK, middleware.Response{
+		Status: "success",
+		Data:   thread,
+	})
+}
+
+// GetThreadHistory liste les versions successives du titre, de la description, des tags, du statut et du
+// type d'un fil (visible par l'auteur du fil et les modérateurs)
+func (c *ThreadController) GetThreadHistory(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r)
+	if claims == nil {
+		middleware.SendJSON(w, http.StatusUnauthorized, middleware.Response{
+			Status:  "error",
+			Message: "Unauthorized",
+		})
+		return
+	}
+
+	thread, ok := loadVisibleThread(c.DB, w, r, claims)
+	if !ok {
+		return
+	}
+	if thread.AuthorID != claims.UserID && !models.IsModerator(claims.Role) {
+		middleware.SendJSON(w, http.StatusForbidden, middleware.Response{
+			Status:  "error",
+			Message: "Thread history is only visible to its author and moderators",
+		})
+		return
+	}
+
+	revisions, err := models.GetThreadRevisions(c.DB, thread.ID)
+	if err != nil {
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Error getting thread history",
+		})
+		return
+	}
+
+	middleware.SendJSON(w, http.StatusOK, middleware.Response{
+		Status: "success",
+		Data:   revisions,
+	})
+}
+
+// RevertThread restaure le titre, la description et les tags d'une version précédente, ex. {"version": 2,
+// "reason": "vandalisme"} ; la restauration est elle-même ajoutée à l'historique
+func (c *ThreadController) RevertThread(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r)
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
+			Status:  "error",
+			Message: "Invalid thread ID",
+		})
+		return
+	}
+
+	var input struct {
+		Version int    `json:"version"`
+		Reason  string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Version < 1 || len([]rune(input.Reason)) > 255 {
+		middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
+			Status:  "error",
+			Message: "Invalid request body",
+		})
+		return
+	}
+	if input.Reason == "" {
+		input.Reason = fmt.Sprintf("Revert to version %d", input.Version)
+	}
+
+	thread, err := models.GetThread(c.DB, id)
+	if err != nil {
+		middleware.SendJSON(w, http.StatusNotFound, middleware.Response{
+			Status:  "error",
+			Message: "Thread not found",
+		})
+		return
+	}
+
+	revision, err := models.GetThreadRevision(c.DB, id, input.Version)
+	if err != nil {
+		middleware.SendJSON(w, http.StatusNotFound, middleware.Response{
+			Status:  "error",
+			Message: "Revision not found",
+		})
+		return
+	}
+
+	// Seul le contenu est restauré : le statut et le type actuels sont conservés
+	changed, err := models.ReviseThread(c.DB, id, claims.UserID, models.ThreadEdit{
+		Title:       revision.Title,
+		Description: revision.Description,
+		Tags:        revision.Tags,
+		Reason:      input.Reason,
+	})
+	if err != nil {
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Error reverting thread",
+		})
+		return
+	}
+	if changed && thread.AuthorID != claims.UserID {
+		c.Notifications.NotifyModeration(thread.AuthorID, claims.UserID, "thread_reverted", thread.ID, 0)
+	}
+
+	thread, err = models.GetThread(c.DB, id)
+	if err != nil {
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Error getting thread",
+		})
+		return
+	}
+
 	middleware.SendJSON(w, http.StatusOK, middleware.Response{
 		Status: "success",
 		Data:   thread,
@@ -385,8 +642,7 @@ func (c *ThreadController) DeleteThread(w http.ResponseWriter, r *http.Request)
 	}
 
 	// Récupérer l'ID du fil de discussion
-	idStr := r.URL.Query().Get("id")
-	id, err := strconv.ParseInt(idStr, 10, 64)
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
 	if err != nil {
 		middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
 			Status:  "error",
@@ -414,8 +670,8 @@ func (c *ThreadController) DeleteThread(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Supprimer le fil de discussion
-	if err := models.DeleteThread(c.DB, id); err != nil {
+	// Mettre le fil en corbeille ; il sera purgé définitivement après le délai de rétention
+	if err := models.SoftDeleteThread(c.DB, id, claims.UserID, deleteReason(r)); err != nil {
 		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
 			Status:  "error",
 			Message: "Error deleting thread: " + err.Error(),
@@ -423,6 +679,11 @@ func (c *ThreadController) DeleteThread(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// Un admin qui supprime le fil d'un autre utilisateur le prévient
+	if thread.AuthorID != claims.UserID {
+		c.Notifications.NotifyModeration(thread.AuthorID, claims.UserID, "thread_deleted", 0, 0)
+	}
+
 	middleware.SendJSON(w, http.StatusOK, middleware.Response{
 		Status:  "success",
 		Message: "Thread deleted successfully",
@@ -460,8 +721,13 @@ func (c *ThreadController) SearchThreads(w http.ResponseWriter, r *http.Request)
 		perPage = 10
 	}
 
+	solved, ok := parseSolvedFilter(w, r)
+	if !ok {
+		return
+	}
+
 	// Rechercher les fils de discussion
-	threads, err := models.SearchThreads(c.DB, query, page, perPage)
+	threads, err := models.SearchThreads(c.DB, query, page, perPage, solved)
 	if err != nil {
 		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
 			Status:  "error",
@@ -515,6 +781,7 @@ func (c *ThreadController) AdminUpdateThread(w http.ResponseWriter, r *http.Requ
 		})
 		return
 	}
+	broadcastPollResults(c.DB, c.Presence, threadID)
 
 	middleware.SendJSON(w, http.StatusOK, middleware.Response{
 		Status:  "success",
@@ -522,7 +789,7 @@ func (c *ThreadController) AdminUpdateThread(w http.ResponseWriter, r *http.Requ
 	})
 }
 
-// AdminDeleteMessage permet à un admin de supprimer un message
+// AdminDeleteMessage permet à un admin de mettre un message en corbeille
 func (c *ThreadController) AdminDeleteMessage(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodDelete {
 		middleware.SendJSON(w, http.StatusMethodNotAllowed, middleware.Response{
@@ -541,7 +808,11 @@ func (c *ThreadController) AdminDeleteMessage(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	if err := models.DeleteMessage(c.DB, messageID); err != nil {
+	var deletedBy int64
+	if claims := middleware.GetUserFromContext(r); claims != nil {
+		deletedBy = claims.UserID
+	}
+	if err := models.SoftDeleteMessage(c.DB, messageID, deletedBy, deleteReason(r)); err != nil {
 		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
 			Status:  "error",
 			Message: "Error deleting message",
@@ -597,8 +868,39 @@ func (c *ThreadController) GetThreadMessages(w http.ResponseWriter, r *http.Requ
 		sortBy = "newest"
 	}
 
-	// Récupérer les messages
-	messages, err := models.ListMessages(c.DB, id, page, perPage, sortBy)
+	// Les messages (et les URL signées de leurs pièces jointes) ne sont donnés qu'à qui peut voir le fil
+	claims := middleware.GetUserFromContext(r)
+	var userID int64
+	var role string
+	if claims != nil {
+		userID, role = claims.UserID, claims.Role
+	}
+	thread, err := models.GetThread(c.DB, id)
+	if err != nil {
+		middleware.SendJSON(w, http.StatusNotFound, middleware.Response{
+			Status:  "error",
+			Message: "Thread not found",
+		})
+		return
+	}
+	if allowed, err := models.CanViewThread(c.DB, thread, userID, role); err != nil || !allowed {
+		middleware.SendJSON(w, http.StatusNotFound, middleware.Response{
+			Status:  "error",
+			Message: "Thread not found",
+		})
+		return
+	}
+
+	// Récupérer les messages : liste triée par sort_by (newest par défaut, oldest ou likes) ou arbre des
+	// réponses (?view=tree), paginé sur les messages de premier niveau
+	tree := r.URL.Query().Get("view") == "tree"
+	var messages, roots []*models.Message
+	var totalRoots int
+	if tree {
+		roots, messages, totalRoots, err = models.ListMessageTree(c.DB, id, page, perPage, sortBy)
+	} else {
+		messages, err = models.ListMessages(c.DB, id, page, perPage, sortBy)
+	}
 	if err != nil {
 		log.Printf("[DEBUG] GetThreadMessages - Error getting messages: %v", err)
 		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
@@ -608,12 +910,68 @@ func (c *ThreadController) GetThreadMessages(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	// Les messages supprimés gardés dans l'arbre n'exposent ni pièces jointes ni citations
+	visible := make([]*models.Message, 0, len(messages))
+	for _, m := range messages {
+		if !m.Deleted {
+			visible = append(visible, m)
+		}
+	}
+	if err := c.Files.LoadAttachments(visible); err != nil {
+		log.Printf("Erreur lors du chargement des pièces jointes du fil %d: %v", id, err)
+	}
+	if err := models.LoadMessageQuotes(c.DB, visible); err != nil {
+		log.Printf("Erreur lors du chargement des citations du fil %d: %v", id, err)
+	}
+	if err := models.LoadMessageMentions(c.DB, visible); err != nil {
+		log.Printf("Erreur lors du chargement des mentions du fil %d: %v", id, err)
+	}
+	if err := models.LoadMessageReactions(c.DB, visible, userID); err != nil {
+		log.Printf("Erreur lors du chargement des réactions du fil %d: %v", id, err)
+	}
+	for _, m := range visible {
+		m.Accepted = m.ID == thread.AcceptedMessageID
+	}
+	messages = visible
+
+	// L'ancien pointeur de lecture est renvoyé pour marquer les messages nouveaux de cette page. Il
+	// n'avance que dans la liste chronologique (?sort_by=oldest), et seulement si aucun message non lu ne
+	// précède la page : les messages lus forment alors une suite continue jusqu'au dernier affiché. Une
+	// page triée du plus récent au plus ancien, par likes ou en arbre laisse des messages antérieurs non
+	// affichés et ne marque rien comme lu.
+	var lastReadMessageID int64
+	if claims != nil {
+		if lastReadMessageID, err = models.GetThreadReadPointer(c.DB, claims.UserID, id); err != nil && err != sql.ErrNoRows {
+			log.Printf("Erreur lors de la lecture du pointeur du fil %d: %v", id, err)
+		}
+	}
+	if claims != nil && !tree && sortBy == "oldest" && len(messages) > 0 {
+		first, last := messages[0].ID, messages[len(messages)-1].ID
+		if last > lastReadMessageID {
+			unreadBefore, err := models.HasUnreadBefore(c.DB, id, claims.UserID, lastReadMessageID, first)
+			if err == nil && !unreadBefore {
+				err = models.MarkThreadRead(c.DB, claims.UserID, id, last)
+			}
+			if err != nil {
+				log.Printf("Erreur lors de la mise à jour de la lecture du fil %d: %v", id, err)
+			}
+		}
+	}
+
 	log.Printf("[DEBUG] GetThreadMessages - Messages found: %+v", messages)
+	data := map[string]interface{}{
+		"messages":             messages,
+		"last_read_message_id": lastReadMessageID,
+		"accepted_message_id":  thread.AcceptedMessageID,
+	}
+	if tree {
+		data["view"] = "tree"
+		data["messages"] = roots
+		data["total_roots"] = totalRoots
+	}
 	middleware.SendJSON(w, http.StatusOK, middleware.Response{
 		Status: "success",
-		Data: map[string]interface{}{
-			"messages": messages,
-		},
+		Data:   data,
 	})
 }
 
@@ -652,39 +1010,210 @@ func (c *ThreadController) CreateMessage(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Lire le contenu du message depuis le corps de la requête
-	var request struct {
-		Content string `json:"content"`
+	// Le fil doit exister et être visible ; ses images seront privées si le fil l'est
+	thread, err := models.GetThread(c.DB, threadID)
+	if err != nil {
+		middleware.SendJSON(w, http.StatusNotFound, middleware.Response{
+			Status:  "error",
+			Message: "Thread not found",
+		})
+		return
+	}
+	if allowed, err := models.CanViewThread(c.DB, thread, claims.UserID, claims.Role); err != nil || !allowed {
+		middleware.SendJSON(w, http.StatusNotFound, middleware.Response{
+			Status:  "error",
+			Message: "Thread not found",
+		})
+		return
+	}
+
+	// Lire le message : JSON {"content", "parent_id", "quotes"} ou multipart (mêmes champs + images,
+	// quotes encodé en JSON)
+	var content string
+	var parentID int64
+	var quoteInputs []models.QuoteInput
+	var images []*services.StoredImage
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		r.Body = http.MaxBytesReader(w, r.Body, services.MaxImagesPerMessage*services.MaxImageSize+1024*1024)
+		if err := r.ParseMultipartForm(8 * 1024 * 1024); err != nil {
+			middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
+				Status:  "error",
+				Message: "Invalid multipart form or request too large",
+			})
+			return
+		}
+		defer r.MultipartForm.RemoveAll()
+
+		content = r.FormValue("content")
+		if v := r.FormValue("parent_id"); v != "" {
+			if parentID, err = strconv.ParseInt(v, 10, 64); err != nil {
+				middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
+					Status:  "error",
+					Message: "Invalid parent_id",
+				})
+				return
+			}
+		}
+		if v := r.FormValue("quotes"); v != "" {
+			if err := json.Unmarshal([]byte(v), &quoteInputs); err != nil {
+				middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
+					Status:  "error",
+					Message: "Invalid quotes",
+				})
+				return
+			}
+		}
+		if len(r.MultipartForm.File["images"]) > 0 &&
+			!requireReputation(c.Reputation, w, claims, services.PrivilegePostImages, "Posting images") {
+			return
+		}
+		images, err = c.Files.SaveImages(claims.UserID, claims.Role, r.MultipartForm.File["images"], thread.Visibility == string(models.ThreadPrivate))
+		if err != nil {
+			sendUploadError(w, err, "Error saving images")
+			return
+		}
+	} else {
+		var request struct {
+			Content  string              `json:"content"`
+			ParentID int64               `json:"parent_id"`
+			Quotes   []models.QuoteInput `json:"quotes"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			log.Printf("[DEBUG] CreateMessage - Error decoding request body: %v", err)
+			middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
+				Status:  "error",
+				Message: "Invalid request body",
+			})
+			return
+		}
+		content, parentID, quoteInputs = request.Content, request.ParentID, request.Quotes
 	}
-	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-		log.Printf("[DEBUG] CreateMessage - Error decoding request body: %v", err)
+
+	if strings.TrimSpace(content) == "" && len(images) == 0 {
 		middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
 			Status:  "error",
-			Message: "Invalid request body",
+			Message: "Message content or image is required",
 		})
 		return
 	}
 
-	// Créer le message
-	message, err := models.CreateMessage(c.DB, threadID, claims.UserID, request.Content, "")
+	// Le message auquel on répond doit être visible dans le même fil
+	var parent *models.Message
+	if parentID != 0 {
+		if parent, err = models.GetMessage(c.DB, parentID); err != nil || parent.ThreadID != threadID {
+			c.Files.DiscardImages(images)
+			middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
+				Status:  "error",
+				Message: "Parent message not found in this thread",
+			})
+			return
+		}
+	}
+	quotes, err := models.PrepareQuotes(c.DB, threadID, quoteInputs)
+	if err != nil {
+		c.Files.DiscardImages(images)
+		if models.IsQuoteError(err) {
+			middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
+				Status:  "error",
+				Message: err.Error(),
+			})
+			return
+		}
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Error checking quotes",
+		})
+		return
+	}
+
+	// Créer le message ; image_url garde la première image publique pour les anciens clients
+	imageURL := ""
+	if len(images) > 0 && !services.IsPrivateKey(images[0].Key) {
+		imageURL = c.Files.URL(images[0].Key)
+	}
+	// Le message, ses citations et ses pièces jointes sont enregistrés en une transaction : en cas
+	// d'échec, seuls les fichiers envoyés sont à supprimer
+	var attachments []*models.Attachment
+	quota := services.UnlimitedQuota
+	if len(images) > 0 {
+		attachments, quota = c.Files.NewAttachments(images), c.Files.Quota(claims.Role)
+	}
+	message, err := models.CreateMessage(c.DB, threadID, claims.UserID, parentID, content, imageURL, models.MessageExtras{
+		Quotes:          quotes,
+		Attachments:     attachments,
+		AttachmentQuota: quota,
+	})
 	if err != nil {
 		log.Printf("[DEBUG] CreateMessage - Error creating message: %v", err)
+		c.Files.DiscardImages(images)
+		if err == services.ErrQuotaExceeded {
+			sendUploadError(w, err, "Error creating message")
+			return
+		}
 		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
 			Status:  "error",
 			Message: "Error creating message",
 		})
 		return
 	}
+	c.Files.CommitImages(images, message.Attachments)
+	syncMentions(c.DB, c.Notifications, message)
 
 	log.Printf("[DEBUG] CreateMessage - Message created: %+v", message)
+
+	// Répondre à un fil le fait surveiller, sauf si l'utilisateur a déjà choisi un niveau
+	if err := models.AutoWatchThread(c.DB, claims.UserID, threadID); err != nil {
+		log.Printf("Erreur lors du suivi automatique du fil %d: %v", threadID, err)
+	}
+	// Son propre message est lu, mais le pointeur n'avance pas au-delà de réponses plus anciennes
+	// que l'utilisateur n'a pas encore lues
+	pointer, err := models.GetThreadReadPointer(c.DB, claims.UserID, threadID)
+	if err == nil {
+		var unreadBefore bool
+		unreadBefore, err = models.HasUnreadBefore(c.DB, threadID, claims.UserID, pointer, message.ID)
+		if err == nil && !unreadBefore {
+			err = models.MarkThreadRead(c.DB, claims.UserID, threadID, message.ID)
+		}
+	}
+	if err != nil {
+		log.Printf("Erreur lors de la mise à jour de la lecture du fil %d: %v", threadID, err)
+	}
+
+	// Prévenir les abonnés du fil, l'auteur du message auquel on répond et les auteurs cités
+	c.Notifications.NotifyReply(thread, message, parent)
+	c.Email.NotifyReply(thread, message)
+	notified := map[int64]bool{}
+	for _, q := range quotes {
+		if !notified[q.QuotedAuthorID] {
+			notified[q.QuotedAuthorID] = true
+			c.Notifications.NotifyQuote(q.QuotedAuthorID, message)
+		}
+	}
+
+	// Le message peut valoir un badge à son auteur, et la réponse un badge à l'auteur du fil
+	c.Badges.Evaluate(claims.UserID)
+	if thread.AuthorID != claims.UserID {
+		c.Badges.Evaluate(thread.AuthorID)
+	}
 	middleware.SendJSON(w, http.StatusCreated, middleware.Response{
 		Status: "success",
 		Data:   message,
 	})
 }
 
-// LikeMessage ajoute un like à un message
+// LikeMessage ajoute un like à un message, le retire s'il y était déjà ou remplace un dislike
 func (c *ThreadController) LikeMessage(w http.ResponseWriter, r *http.Request) {
+	c.voteMessage(w, r, "like")
+}
+
+// DislikeMessage ajoute un dislike à un message, le retire s'il y était déjà ou remplace un like
+func (c *ThreadController) DislikeMessage(w http.ResponseWriter, r *http.Request) {
+	c.voteMessage(w, r, "dislike")
+}
+
+// voteMessage applique un clic sur like ou dislike et retourne le vote de l'utilisateur et les compteurs
+// à jour ; le vote et les compteurs sont modifiés dans une même transaction
+func (c *ThreadController) voteMessage(w http.ResponseWriter, r *http.Request, voteType string) {
 	if r.Method != http.MethodPost {
 		middleware.SendJSON(w, http.StatusMethodNotAllowed, middleware.Response{
 			Status:  "error",
@@ -693,21 +1222,6 @@ func (c *ThreadController) LikeMessage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Récupérer l'ID du message depuis les variables de route
-	vars := mux.Vars(r)
-	messageIDStr := vars["id"]
-	log.Printf("[DEBUG] LikeMessage - Message ID from URL: %s", messageIDStr)
-
-	messageID, err := strconv.ParseInt(messageIDStr, 10, 64)
-	if err != nil {
-		log.Printf("[DEBUG] LikeMessage - Invalid message ID format: %v", err)
-		middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
-			Status:  "error",
-			Message: "Invalid message ID",
-		})
-		return
-	}
-
 	// Récupérer l'utilisateur depuis le token JWT
 	claims := middleware.GetUserFromContext(r)
 	if claims == nil {
@@ -718,95 +1232,105 @@ func (c *ThreadController) LikeMessage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Récupérer le message
-	message, err := models.GetMessage(c.DB, messageID)
-	if err != nil {
-		log.Printf("[DEBUG] LikeMessage - Error getting message: %v", err)
+	message, _, ok := loadVisibleMessage(c.DB, w, r, claims)
+	if !ok {
+		return
+	}
+
+	vote, err := models.ToggleMessageVote(c.DB, message.ID, claims.UserID, voteType)
+	if err == sql.ErrNoRows {
 		middleware.SendJSON(w, http.StatusNotFound, middleware.Response{
 			Status:  "error",
 			Message: "Message not found",
 		})
 		return
 	}
-
-	// Ajouter le like
-	message.Likes++
-	if err := message.UpdateMessage(c.DB); err != nil {
-		log.Printf("[DEBUG] LikeMessage - Error liking message: %v", err)
+	if err != nil {
+		log.Printf("Erreur lors du vote sur le message %d: %v", message.ID, err)
 		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
 			Status:  "error",
-			Message: "Error liking message",
+			Message: "Error voting on message",
 		})
 		return
 	}
 
-	log.Printf("[DEBUG] LikeMessage - Message liked successfully")
+	if vote.Vote != "" {
+		c.Notifications.NotifyReaction(message, claims.UserID, vote.Vote)
+	}
+	c.Reputation.Refresh(message.AuthorID)
+	c.Badges.Evaluate(message.AuthorID)
+	status := "Vote removed successfully"
+	if vote.Vote == "like" {
+		status = "Message liked successfully"
+	} else if vote.Vote == "dislike" {
+		status = "Message disliked successfully"
+	}
 	middleware.SendJSON(w, http.StatusOK, middleware.Response{
 		Status:  "success",
-		Message: "Message liked successfully",
+		Message: status,
+		Data:    vote,
 	})
 }
 
-// DislikeMessage ajoute un dislike à un message
-func (c *ThreadController) DislikeMessage(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		middleware.SendJSON(w, http.StatusMethodNotAllowed, middleware.Response{
-			Status:  "error",
-			Message: "Method not allowed",
-		})
-		return
+// checkNewTags vérifie que l'utilisateur a la réputation requise s'il introduit des tags qu'aucun autre
+// fil n'utilise encore
+func (c *ThreadController) checkNewTags(w http.ResponseWriter, claims *middleware.Claims, tags []string, threadID int64) bool {
+	if c.Reputation == nil || len(tags) == 0 {
+		return true
 	}
-
-	// Récupérer l'ID du message depuis les variables de route
-	vars := mux.Vars(r)
-	messageIDStr := vars["id"]
-	log.Printf("[DEBUG] DislikeMessage - Message ID from URL: %s", messageIDStr)
-
-	messageID, err := strconv.ParseInt(messageIDStr, 10, 64)
+	unknown, err := models.UnknownTags(c.DB, tags, threadID)
 	if err != nil {
-		log.Printf("[DEBUG] DislikeMessage - Invalid message ID format: %v", err)
-		middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
 			Status:  "error",
-			Message: "Invalid message ID",
+			Message: "Error checking tags",
 		})
-		return
+		return false
 	}
+	if len(unknown) == 0 {
+		return true
+	}
+	return requireReputation(c.Reputation, w, claims, services.PrivilegeCreateTags, "Creating new tags")
+}
 
-	// Récupérer l'utilisateur depuis le token JWT
-	claims := middleware.GetUserFromContext(r)
-	if claims == nil {
-		middleware.SendJSON(w, http.StatusUnauthorized, middleware.Response{
+// requireReputation répond 403 avec la réputation requise si l'utilisateur n'a pas encore débloqué un
+// privilège ; sans service de réputation, tout est autorisé
+func requireReputation(reputation *services.ReputationService, w http.ResponseWriter, claims *middleware.Claims, privilege, action string) bool {
+	if reputation == nil {
+		return true
+	}
+	allowed, required, err := reputation.Can(claims.UserID, claims.Role, privilege)
+	if err != nil {
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
 			Status:  "error",
-			Message: "Unauthorized",
+			Message: "Error checking reputation",
 		})
-		return
+		return false
 	}
-
-	// Récupérer le message
-	message, err := models.GetMessage(c.DB, messageID)
-	if err != nil {
-		log.Printf("[DEBUG] DislikeMessage - Error getting message: %v", err)
-		middleware.SendJSON(w, http.StatusNotFound, middleware.Response{
+	if !allowed {
+		middleware.SendJSON(w, http.StatusForbidden, middleware.Response{
 			Status:  "error",
-			Message: "Message not found",
+			Message: fmt.Sprintf("%s requires %d reputation", action, required),
+			Data:    map[string]interface{}{"privilege": privilege, "required_reputation": required},
 		})
-		return
+		return false
 	}
+	return true
+}
 
-	// Ajouter le dislike
-	message.Dislikes++
-	if err := message.UpdateMessage(c.DB); err != nil {
-		log.Printf("[DEBUG] DislikeMessage - Error disliking message: %v", err)
-		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+// parseSolvedFilter lit le filtre ?solved=true|false des listes de fils, qui ne garde que les questions
+// résolues ou non résolues ; nil sans filtre
+func parseSolvedFilter(w http.ResponseWriter, r *http.Request) (*bool, bool) {
+	v := r.URL.Query().Get("solved")
+	if v == "" {
+		return nil, true
+	}
+	solved, err := strconv.ParseBool(v)
+	if err != nil {
+		middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
 			Status:  "error",
-			Message: "Error disliking message",
+			Message: "Invalid solved filter (true or false)",
 		})
-		return
+		return nil, false
 	}
-
-	log.Printf("[DEBUG] DislikeMessage - Message disliked successfully")
-	middleware.SendJSON(w, http.StatusOK, middleware.Response{
-		Status:  "success",
-		Message: "Message disliked successfully",
-	})
+	return &solved, true
 }
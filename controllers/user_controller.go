@@ -4,13 +4,11 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
-	"os"
-	"path/filepath"
 	"projet-forum/middleware"
 	"projet-forum/models"
+	"projet-forum/services"
 	"strconv"
 	"strings"
 	"time"
@@ -19,7 +17,12 @@ import (
 )
 
 type UserController struct {
-	DB *sql.DB
+	DB            *sql.DB
+	Presence      *services.PresenceHub
+	Notifications *services.NotificationService
+	Files         *services.FileService
+	Reputation    *services.ReputationService
+	Badges        *services.BadgeService
 }
 
 // Register gère l'inscription d'un nouvel utilisateur
@@ -147,7 +150,10 @@ func (c *UserController) GetUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Récupérer l'ID de l'utilisateur
-	idStr := r.URL.Query().Get("id")
+	idStr := mux.Vars(r)["id"]
+	if idStr == "" {
+		idStr = r.URL.Query().Get("id")
+	}
 	id, err := strconv.ParseInt(idStr, 10, 64)
 	if err != nil {
 		middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
@@ -167,12 +173,54 @@ func (c *UserController) GetUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// L'adresse email n'est visible que par l'utilisateur lui-même et les admins
+	claims := middleware.GetUserFromContext(r)
+	if claims == nil || (claims.UserID != user.ID && claims.Role != "admin") {
+		user.Email = ""
+	}
+
+	// La présence n'est pas montrée entre utilisateurs qui se sont bloqués
+	hidePresence := false
+	if claims != nil && claims.UserID != user.ID {
+		hidePresence, err = models.IsBlocked(c.DB, claims.UserID, user.ID)
+		if err != nil {
+			middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+				Status:  "error",
+				Message: "Error checking blocked users",
+			})
+			return
+		}
+	}
+	c.applyPresence(user, hidePresence)
+	c.loadBadges(user)
+
 	middleware.SendJSON(w, http.StatusOK, middleware.Response{
 		Status: "success",
 		Data:   user,
 	})
 }
 
+// loadBadges ajoute au profil les badges obtenus ; une erreur est journalisée sans faire échouer l'affichage
+func (c *UserController) loadBadges(user *models.User) {
+	badges, err := c.Badges.UserBadges(user.ID)
+	if err != nil {
+		log.Printf("Erreur lors de la récupération des badges de l'utilisateur %d: %v", user.ID, err)
+		return
+	}
+	user.Badges = badges
+}
+
+// applyPresence renseigne l'indicateur en ligne et la dernière activité d'un utilisateur
+func (c *UserController) applyPresence(user *models.User, hide bool) {
+	if c.Presence == nil || hide {
+		return
+	}
+	user.Online = c.Presence.IsOnline(user.ID)
+	if seen, ok := c.Presence.LastSeen(user.ID); ok && seen.After(user.LastConnection) {
+		user.LastConnection = seen
+	}
+}
+
 // UpdateUser gère la mise à jour d'un utilisateur
 func (c *UserController) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPut {
@@ -380,6 +428,8 @@ func (c *UserController) GetUserProfile(w http.ResponseWriter, r *http.Request)
 		})
 		return
 	}
+	c.applyPresence(user, false)
+	c.loadBadges(user)
 
 	middleware.SendJSON(w, http.StatusOK, middleware.Response{
 		Status: "success",
@@ -474,6 +524,48 @@ func (c *UserController) GetUserStats(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(stats)
 }
 
+// GetUserReputation retourne la réputation d'un utilisateur et les privilèges qu'elle débloque
+func (c *UserController) GetUserReputation(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
+			Status:  "error",
+			Message: "Invalid user ID",
+		})
+		return
+	}
+
+	user, err := models.GetUserByID(c.DB, id)
+	if err != nil {
+		middleware.SendJSON(w, http.StatusNotFound, middleware.Response{
+			Status:  "error",
+			Message: "User not found",
+		})
+		return
+	}
+
+	privileges := []*services.Privilege{}
+	if c.Reputation != nil {
+		privileges = c.Reputation.Privileges(user.Reputation, user.Role)
+	}
+	middleware.SendJSON(w, http.StatusOK, middleware.Response{
+		Status: "success",
+		Data: map[string]interface{}{
+			"user_id":    user.ID,
+			"reputation": user.Reputation,
+			"privileges": privileges,
+		},
+	})
+}
+
+// refreshAuthorReputation recalcule la réputation et les badges de l'auteur d'un message après un vote
+func (c *UserController) refreshAuthorReputation(messageID int64) {
+	if message, err := models.GetMessage(c.DB, messageID); err == nil {
+		c.Reputation.Refresh(message.AuthorID)
+		c.Badges.Evaluate(message.AuthorID)
+	}
+}
+
 // GetUserThreads récupère les discussions créées par un utilisateur
 func (c *UserController) GetUserThreads(w http.ResponseWriter, r *http.Request) {
 	// Récupérer l'ID utilisateur depuis l'URL
@@ -491,9 +583,9 @@ func (c *UserController) GetUserThreads(w http.ResponseWriter, r *http.Request)
 	// Récupérer les discussions de l'utilisateur
 	query := `
 		SELECT t.id, t.title, t.content, t.created_at, 
-			   (SELECT COUNT(*) FROM messages m WHERE m.thread_id = t.id) as message_count
+			   (SELECT COUNT(*) FROM messages m WHERE m.thread_id = t.id AND m.deleted_at IS NULL) as message_count
 		FROM threads t
-		WHERE t.author_id = ?
+		WHERE t.author_id = ? AND t.deleted_at IS NULL
 		ORDER BY t.created_at DESC
 		LIMIT 20
 	`
@@ -557,7 +649,7 @@ func (c *UserController) GetUserMessages(w http.ResponseWriter, r *http.Request)
 		SELECT m.id, m.content, m.created_at, m.thread_id, t.title as thread_title
 		FROM messages m
 		JOIN threads t ON m.thread_id = t.id
-		WHERE m.author_id = ?
+		WHERE m.author_id = ? AND m.deleted_at IS NULL AND t.deleted_at IS NULL
 		ORDER BY m.created_at DESC
 		LIMIT 20
 	`
@@ -640,66 +732,25 @@ func (c *UserController) UploadAvatar(w http.ResponseWriter, r *http.Request) {
 		})
 		return
 	}
-	defer file.Close()
-
-	// Valider le type de fichier
-	if !strings.HasPrefix(header.Header.Get("Content-Type"), "image/") {
-		middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
-			Status:  "error",
-			Message: "File must be an image",
-		})
-		return
-	}
+	file.Close()
 
-	// Créer le dossier uploads s'il n'existe pas
-	uploadsDir := "static/uploads/avatars"
-	if err := os.MkdirAll(uploadsDir, 0755); err != nil {
-		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
-			Status:  "error",
-			Message: "Error creating upload directory",
-		})
-		return
-	}
-
-	// Générer un nom de fichier unique
-	ext := filepath.Ext(header.Filename)
-	filename := fmt.Sprintf("avatar_%d_%d%s", claims.UserID, time.Now().Unix(), ext)
-	filepath := fmt.Sprintf("%s/%s", uploadsDir, filename)
-
-	// Sauvegarder le fichier
-	dst, err := os.Create(filepath)
+	// Le type est vérifié sur le contenu du fichier, pas sur le Content-Type envoyé ;
+	// l'image est recadrée et ré-encodée sans ses métadonnées
+	avatars, err := c.Files.SaveAvatar(claims.UserID, header)
 	if err != nil {
-		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
-			Status:  "error",
-			Message: "Error saving file",
-		})
+		sendUploadError(w, err, "Error saving avatar")
 		return
 	}
-	defer dst.Close()
 
-	if _, err := io.Copy(dst, file); err != nil {
-		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
-			Status:  "error",
-			Message: "Error copying file",
-		})
-		return
+	sizes := make(map[string]string, len(avatars))
+	for size, url := range avatars {
+		sizes[strconv.Itoa(size)] = url
 	}
-
-	// Mettre à jour l'utilisateur avec le nouveau chemin de l'avatar
-	profilePictureURL := fmt.Sprintf("/static/uploads/avatars/%s", filename)
-	_, err = c.DB.Exec("UPDATE users SET profile_picture = ? WHERE id = ?", profilePictureURL, claims.UserID)
-	if err != nil {
-		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
-			Status:  "error",
-			Message: "Error updating user profile",
-		})
-		return
-	}
-
 	middleware.SendJSON(w, http.StatusOK, middleware.Response{
 		Status: "success",
-		Data: map[string]string{
-			"profile_picture": profilePictureURL,
+		Data: map[string]interface{}{
+			"profile_picture": avatars[services.AvatarSizes[len(services.AvatarSizes)-1]],
+			"sizes":           sizes,
 		},
 	})
 }
@@ -888,6 +939,8 @@ func (c *UserController) DeleteMessageReaction(w http.ResponseWriter, r *http.Re
 		return
 	}
 
+	c.refreshAuthorReputation(messageID)
+
 	middleware.SendJSON(w, http.StatusOK, middleware.Response{
 		Status:  "success",
 		Message: "Message reaction deleted successfully",
@@ -945,12 +998,267 @@ func (c *UserController) AddMessageReaction(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	c.refreshAuthorReputation(messageID)
+
 	middleware.SendJSON(w, http.StatusOK, middleware.Response{
 		Status:  "success",
 		Message: "Message reaction added successfully",
 	})
 }
 
+// ListMentions liste les messages où l'utilisateur connecté a été mentionné
+func (c *UserController) ListMentions(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r)
+	if claims == nil {
+		middleware.SendJSON(w, http.StatusUnauthorized, middleware.Response{
+			Status:  "error",
+			Message: "Unauthorized",
+		})
+		return
+	}
+
+	page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+	if perPage < 1 || perPage > 100 {
+		perPage = 10
+	}
+
+	messages, err := models.ListUserMentions(c.DB, claims.UserID, claims.Role, page, perPage)
+	if err != nil {
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Error fetching mentions",
+		})
+		return
+	}
+
+	middleware.SendJSON(w, http.StatusOK, middleware.Response{
+		Status: "success",
+		Data: map[string]interface{}{
+			"messages": messages,
+			"page":     page,
+			"per_page": perPage,
+		},
+	})
+}
+
+// SuggestMentions propose des pseudos pour l'autocomplétion des @mentions (?q=début du pseudo)
+func (c *UserController) SuggestMentions(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r)
+	if claims == nil {
+		middleware.SendJSON(w, http.StatusUnauthorized, middleware.Response{
+			Status:  "error",
+			Message: "Unauthorized",
+		})
+		return
+	}
+
+	prefix := strings.TrimPrefix(strings.TrimSpace(r.URL.Query().Get("q")), "@")
+	if prefix == "" {
+		middleware.SendJSON(w, http.StatusOK, middleware.Response{
+			Status: "success",
+			Data:   []*models.UserSuggestion{},
+		})
+		return
+	}
+
+	suggestions, err := models.SuggestMentions(c.DB, claims.UserID, prefix, 10)
+	if err != nil {
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Error fetching suggestions",
+		})
+		return
+	}
+
+	middleware.SendJSON(w, http.StatusOK, middleware.Response{
+		Status: "success",
+		Data:   suggestions,
+	})
+}
+
+// BlockUser bloque un utilisateur : il n'apparaît plus dans la présence ni les indicateurs de saisie
+func (c *UserController) BlockUser(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r)
+	if claims == nil {
+		middleware.SendJSON(w, http.StatusUnauthorized, middleware.Response{
+			Status:  "error",
+			Message: "Unauthorized",
+		})
+		return
+	}
+
+	targetID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil || targetID == claims.UserID {
+		middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
+			Status:  "error",
+			Message: "Invalid user ID",
+		})
+		return
+	}
+
+	if _, err := models.GetUserByID(c.DB, targetID); err != nil {
+		middleware.SendJSON(w, http.StatusNotFound, middleware.Response{
+			Status:  "error",
+			Message: "User not found",
+		})
+		return
+	}
+
+	if err := models.BlockUser(c.DB, claims.UserID, targetID); err != nil {
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Error blocking user: " + err.Error(),
+		})
+		return
+	}
+
+	middleware.SendJSON(w, http.StatusOK, middleware.Response{
+		Status:  "success",
+		Message: "User blocked successfully",
+	})
+}
+
+// UnblockUser débloque un utilisateur
+func (c *UserController) UnblockUser(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r)
+	if claims == nil {
+		middleware.SendJSON(w, http.StatusUnauthorized, middleware.Response{
+			Status:  "error",
+			Message: "Unauthorized",
+		})
+		return
+	}
+
+	targetID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
+			Status:  "error",
+			Message: "Invalid user ID",
+		})
+		return
+	}
+
+	if err := models.UnblockUser(c.DB, claims.UserID, targetID); err != nil {
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Error unblocking user: " + err.Error(),
+		})
+		return
+	}
+
+	middleware.SendJSON(w, http.StatusOK, middleware.Response{
+		Status:  "success",
+		Message: "User unblocked successfully",
+	})
+}
+
+// SendFriendRequest envoie une demande d'ami à un utilisateur
+func (c *UserController) SendFriendRequest(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r)
+	if claims == nil {
+		middleware.SendJSON(w, http.StatusUnauthorized, middleware.Response{
+			Status:  "error",
+			Message: "Unauthorized",
+		})
+		return
+	}
+
+	friendID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil || friendID == claims.UserID {
+		middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
+			Status:  "error",
+			Message: "Invalid user ID",
+		})
+		return
+	}
+
+	if _, err := models.GetUserByID(c.DB, friendID); err != nil {
+		middleware.SendJSON(w, http.StatusNotFound, middleware.Response{
+			Status:  "error",
+			Message: "User not found",
+		})
+		return
+	}
+
+	exists, err := models.HasFriendship(c.DB, claims.UserID, friendID)
+	if err != nil {
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Error checking friendship",
+		})
+		return
+	}
+	if exists {
+		middleware.SendJSON(w, http.StatusConflict, middleware.Response{
+			Status:  "error",
+			Message: "A friend request or relationship already exists",
+		})
+		return
+	}
+
+	if err := models.SendFriendRequest(c.DB, claims.UserID, friendID); err != nil {
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Error sending friend request: " + err.Error(),
+		})
+		return
+	}
+
+	c.Notifications.NotifyFriendRequest(claims.UserID, friendID)
+
+	middleware.SendJSON(w, http.StatusCreated, middleware.Response{
+		Status:  "success",
+		Message: "Friend request sent successfully",
+	})
+}
+
+// AcceptFriendRequest accepte la demande d'ami envoyée par un utilisateur
+func (c *UserController) AcceptFriendRequest(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetUserFromContext(r)
+	if claims == nil {
+		middleware.SendJSON(w, http.StatusUnauthorized, middleware.Response{
+			Status:  "error",
+			Message: "Unauthorized",
+		})
+		return
+	}
+
+	requesterID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		middleware.SendJSON(w, http.StatusBadRequest, middleware.Response{
+			Status:  "error",
+			Message: "Invalid user ID",
+		})
+		return
+	}
+
+	if err := models.AcceptFriendRequest(c.DB, claims.UserID, requesterID); err != nil {
+		if err == sql.ErrNoRows {
+			middleware.SendJSON(w, http.StatusNotFound, middleware.Response{
+				Status:  "error",
+				Message: "Friend request not found",
+			})
+			return
+		}
+		middleware.SendJSON(w, http.StatusInternalServerError, middleware.Response{
+			Status:  "error",
+			Message: "Error accepting friend request: " + err.Error(),
+		})
+		return
+	}
+
+	c.Notifications.NotifyFriendAccept(claims.UserID, requesterID)
+
+	middleware.SendJSON(w, http.StatusOK, middleware.Response{
+		Status:  "success",
+		Message: "Friend request accepted",
+	})
+}
+
 // ShowProfilePage affiche la page de profil de l'utilisateur
 func (c *UserController) ShowProfilePage(w http.ResponseWriter, r *http.Request) {
 	// Servir la page de profil - l'authentification se fait côté client
@@ -10,9 +10,20 @@ CREATE TABLE users (
     created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
     last_connection TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
     profile_picture VARCHAR(255),
+    avatar_key VARCHAR(255),
     biography TEXT,
     message_count INT NOT NULL DEFAULT 0,
-    thread_count INT NOT NULL DEFAULT 0
+    thread_count INT NOT NULL DEFAULT 0,
+    reputation INT NOT NULL DEFAULT 0
+);
+
+CREATE TABLE categories (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(100) UNIQUE NOT NULL,
+    description TEXT NOT NULL,
+    question_mode BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
 );
 
 CREATE TABLE threads (
@@ -22,25 +33,118 @@ CREATE TABLE threads (
     tags TEXT NOT NULL,
     status VARCHAR(20) NOT NULL DEFAULT 'open',
     visibility VARCHAR(20) NOT NULL DEFAULT 'public',
+    thread_type VARCHAR(20) NOT NULL DEFAULT 'discussion',
+    accepted_message_id INT NULL,
     author_id INT NOT NULL,
+    category_id INT NULL,
     created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
     message_count INT NOT NULL DEFAULT 0,
-    FOREIGN KEY (author_id) REFERENCES users(id) ON DELETE CASCADE
+    deleted_at TIMESTAMP NULL,
+    deleted_by INT NULL,
+    delete_reason VARCHAR(255) NOT NULL DEFAULT '',
+    FOREIGN KEY (author_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (category_id) REFERENCES categories(id) ON DELETE SET NULL,
+    FOREIGN KEY (deleted_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE TABLE thread_revisions (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    thread_id INT NOT NULL,
+    version INT NOT NULL,
+    title VARCHAR(200) NOT NULL,
+    description TEXT NOT NULL,
+    tags TEXT NOT NULL,
+    status VARCHAR(20) NULL,
+    thread_type VARCHAR(20) NULL,
+    editor_id INT,
+    reason VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (thread_id) REFERENCES threads(id) ON DELETE CASCADE,
+    FOREIGN KEY (editor_id) REFERENCES users(id) ON DELETE SET NULL,
+    UNIQUE(thread_id, version)
 );
 
 CREATE TABLE messages (
     id INT AUTO_INCREMENT PRIMARY KEY,
     thread_id INT NOT NULL,
     author_id INT NOT NULL,
+    parent_id INT NULL,
     content TEXT NOT NULL,
+    content_html MEDIUMTEXT NULL,
     image_url VARCHAR(255),
     created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    edited_at TIMESTAMP NULL,
+    edit_count INT NOT NULL DEFAULT 0,
     likes INT NOT NULL DEFAULT 0,
     dislikes INT NOT NULL DEFAULT 0,
+    deleted_at TIMESTAMP NULL,
+    deleted_by INT NULL,
+    delete_reason VARCHAR(255) NOT NULL DEFAULT '',
     FOREIGN KEY (thread_id) REFERENCES threads(id) ON DELETE CASCADE,
-    FOREIGN KEY (author_id) REFERENCES users(id) ON DELETE CASCADE
+    FOREIGN KEY (author_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (parent_id) REFERENCES messages(id) ON DELETE SET NULL,
+    FOREIGN KEY (deleted_by) REFERENCES users(id) ON DELETE SET NULL
+);
+
+-- La réponse acceptée d'une question référence un message, créé après les fils
+ALTER TABLE threads ADD FOREIGN KEY (accepted_message_id) REFERENCES messages(id) ON DELETE SET NULL;
+
+CREATE TABLE message_quotes (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    message_id INT NOT NULL,
+    quoted_message_id INT NULL,
+    quoted_author_id INT NULL,
+    quoted_version INT NOT NULL,
+    content TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE,
+    FOREIGN KEY (quoted_message_id) REFERENCES messages(id) ON DELETE SET NULL,
+    FOREIGN KEY (quoted_author_id) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE TABLE message_mentions (
+    message_id INT NOT NULL,
+    user_id INT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (message_id, user_id),
+    FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE message_revisions (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    message_id INT NOT NULL,
+    version INT NOT NULL,
+    content TEXT NOT NULL,
+    edited_by INT,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE,
+    FOREIGN KEY (edited_by) REFERENCES users(id) ON DELETE SET NULL,
+    UNIQUE(message_id, version)
+);
+
+CREATE TABLE attachments (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    message_id INT NOT NULL,
+    uploader_id INT NOT NULL,
+    storage_key VARCHAR(255) NOT NULL,
+    thumbnail_key VARCHAR(255),
+    original_name VARCHAR(255) NOT NULL,
+    mime_type VARCHAR(50) NOT NULL,
+    size_bytes INT NOT NULL,
+    width INT NOT NULL,
+    height INT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE,
+    FOREIGN KEY (uploader_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE storage_reservations (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    storage_key VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
 );
 
 CREATE TABLE friendships (
@@ -66,14 +170,205 @@ CREATE TABLE message_reactions (
     UNIQUE(message_id, user_id)
 );
 
+CREATE TABLE reaction_types (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    code VARCHAR(32) NOT NULL UNIQUE,
+    label VARCHAR(64) NOT NULL,
+    emoji VARCHAR(16) NULL,
+    image_key VARCHAR(255) NULL,
+    position INT NOT NULL DEFAULT 0,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE message_emoji_reactions (
+    message_id INT NOT NULL,
+    user_id INT NOT NULL,
+    reaction_type_id INT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (message_id, user_id, reaction_type_id),
+    FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (reaction_type_id) REFERENCES reaction_types(id) ON DELETE CASCADE
+);
+
+CREATE TABLE user_badges (
+    user_id INT NOT NULL,
+    badge_code VARCHAR(50) NOT NULL,
+    awarded_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, badge_code),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE daily_activity (
+    day DATE NOT NULL,
+    thread_id INT NOT NULL,
+    user_id INT NOT NULL,
+    messages INT NOT NULL DEFAULT 0,
+    likes INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (day, thread_id, user_id),
+    FOREIGN KEY (thread_id) REFERENCES threads(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE polls (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    thread_id INT NOT NULL UNIQUE,
+    question VARCHAR(255) NOT NULL,
+    multiple_choice BOOLEAN NOT NULL DEFAULT false,
+    anonymous BOOLEAN NOT NULL DEFAULT false,
+    allow_change BOOLEAN NOT NULL DEFAULT true,
+    closes_at TIMESTAMP NULL,
+    voter_count INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (thread_id) REFERENCES threads(id) ON DELETE CASCADE
+);
+
+CREATE TABLE poll_options (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    poll_id INT NOT NULL,
+    label VARCHAR(100) NOT NULL,
+    position INT NOT NULL,
+    vote_count INT NOT NULL DEFAULT 0,
+    FOREIGN KEY (poll_id) REFERENCES polls(id) ON DELETE CASCADE
+);
+
+CREATE TABLE poll_votes (
+    poll_id INT NOT NULL,
+    user_id INT NOT NULL,
+    option_id INT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (poll_id, user_id, option_id),
+    FOREIGN KEY (poll_id) REFERENCES polls(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (option_id) REFERENCES poll_options(id) ON DELETE CASCADE
+);
+
+CREATE TABLE notifications (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    type VARCHAR(30) NOT NULL,
+    actor_id INT NULL,
+    actor_count INT NOT NULL DEFAULT 0,
+    thread_id INT NULL,
+    message_id INT NULL,
+    detail VARCHAR(255) NULL,
+    group_key VARCHAR(100) NULL,
+    is_read BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (actor_id) REFERENCES users(id) ON DELETE SET NULL,
+    FOREIGN KEY (thread_id) REFERENCES threads(id) ON DELETE SET NULL,
+    FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE SET NULL
+);
+
+CREATE TABLE notification_actors (
+    notification_id INT NOT NULL,
+    actor_id INT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (notification_id, actor_id),
+    FOREIGN KEY (notification_id) REFERENCES notifications(id) ON DELETE CASCADE,
+    FOREIGN KEY (actor_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE notification_preferences (
+    user_id INT NOT NULL,
+    type VARCHAR(30) NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    PRIMARY KEY (user_id, type),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE thread_subscriptions (
+    user_id INT NOT NULL,
+    thread_id INT NOT NULL,
+    level VARCHAR(10) NOT NULL DEFAULT 'watching' CHECK (level IN ('watching', 'tracking', 'normal', 'muted')),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, thread_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (thread_id) REFERENCES threads(id) ON DELETE CASCADE
+);
+
+CREATE TABLE category_follows (
+    user_id INT NOT NULL,
+    category_id INT NOT NULL,
+    level VARCHAR(10) NOT NULL DEFAULT 'watching' CHECK (level IN ('watching', 'tracking', 'normal', 'muted')),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, category_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (category_id) REFERENCES categories(id) ON DELETE CASCADE
+);
+
+CREATE TABLE tag_follows (
+    user_id INT NOT NULL,
+    tag VARCHAR(50) NOT NULL,
+    level VARCHAR(10) NOT NULL DEFAULT 'watching' CHECK (level IN ('watching', 'tracking', 'normal', 'muted')),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, tag),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE thread_reads (
+    user_id INT NOT NULL,
+    thread_id INT NOT NULL,
+    last_read_message_id INT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, thread_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (thread_id) REFERENCES threads(id) ON DELETE CASCADE
+);
+
+CREATE TABLE category_reads (
+    user_id INT NOT NULL,
+    category_id INT NOT NULL,
+    last_read_message_id INT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, category_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (category_id) REFERENCES categories(id) ON DELETE CASCADE
+);
+
+CREATE TABLE email_preferences (
+    user_id INT PRIMARY KEY,
+    reply_emails BOOLEAN NOT NULL DEFAULT true,
+    digest_frequency VARCHAR(10) NOT NULL DEFAULT 'weekly' CHECK (digest_frequency IN ('none', 'daily', 'weekly')),
+    last_digest_at TIMESTAMP NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
 CREATE INDEX idx_threads_author ON threads(author_id);
 CREATE INDEX idx_threads_status ON threads(status);
 CREATE INDEX idx_threads_visibility ON threads(visibility);
-CREATE INDEX idx_messages_thread ON messages(thread_id);
+CREATE INDEX idx_messages_thread ON messages(thread_id, id);
 CREATE INDEX idx_messages_author ON messages(author_id);
+CREATE INDEX idx_threads_deleted ON threads(deleted_at);
+CREATE INDEX idx_messages_deleted ON messages(deleted_at);
+CREATE INDEX idx_messages_parent ON messages(parent_id);
+CREATE INDEX idx_messages_created ON messages(created_at);
+CREATE INDEX idx_message_quotes_message ON message_quotes(message_id);
+CREATE INDEX idx_message_mentions_user ON message_mentions(user_id, message_id);
+CREATE INDEX idx_attachments_message ON attachments(message_id);
+CREATE INDEX idx_attachments_storage_key ON attachments(storage_key);
+CREATE INDEX idx_storage_reservations_key ON storage_reservations(storage_key, created_at);
+CREATE INDEX idx_users_avatar_key ON users(avatar_key);
+CREATE INDEX idx_users_reputation ON users(reputation);
 CREATE INDEX idx_friendships_users ON friendships(user_id, friend_id);
 CREATE INDEX idx_message_reactions_message ON message_reactions(message_id);
 CREATE INDEX idx_message_reactions_user ON message_reactions(user_id);
+CREATE INDEX idx_message_reactions_created ON message_reactions(created_at);
+CREATE INDEX idx_emoji_reactions_type ON message_emoji_reactions(message_id, reaction_type_id);
+CREATE INDEX idx_emoji_reactions_user ON message_emoji_reactions(user_id);
+CREATE INDEX idx_user_badges_code ON user_badges(badge_code, awarded_at);
+CREATE INDEX idx_poll_options_poll ON poll_options(poll_id, position);
+CREATE INDEX idx_poll_votes_option ON poll_votes(option_id);
+CREATE INDEX idx_notifications_user_read ON notifications(user_id, is_read);
+CREATE INDEX idx_notifications_user_group ON notifications(user_id, group_key);
+CREATE INDEX idx_threads_category ON threads(category_id);
+CREATE INDEX idx_threads_type ON threads(thread_type, accepted_message_id);
+CREATE INDEX idx_thread_subscriptions_thread ON thread_subscriptions(thread_id);
+CREATE INDEX idx_category_follows_category ON category_follows(category_id);
+CREATE INDEX idx_tag_follows_tag ON tag_follows(tag);
 
 INSERT INTO users (username, email, password_hash, role, created_at, last_connection)
 VALUES (
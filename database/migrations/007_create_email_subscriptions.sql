@@ -0,0 +1,47 @@
+CREATE TABLE categories (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(100) UNIQUE NOT NULL,
+    description TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+);
+
+ALTER TABLE threads ADD COLUMN category_id INT NULL AFTER author_id;
+ALTER TABLE threads ADD FOREIGN KEY (category_id) REFERENCES categories(id) ON DELETE SET NULL;
+
+CREATE TABLE thread_subscriptions (
+    user_id INT NOT NULL,
+    thread_id INT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, thread_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (thread_id) REFERENCES threads(id) ON DELETE CASCADE
+);
+
+CREATE TABLE category_follows (
+    user_id INT NOT NULL,
+    category_id INT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, category_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (category_id) REFERENCES categories(id) ON DELETE CASCADE
+);
+
+CREATE TABLE tag_follows (
+    user_id INT NOT NULL,
+    tag VARCHAR(50) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, tag),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE email_preferences (
+    user_id INT PRIMARY KEY,
+    reply_emails BOOLEAN NOT NULL DEFAULT true,
+    digest_frequency VARCHAR(10) NOT NULL DEFAULT 'weekly' CHECK (digest_frequency IN ('none', 'daily', 'weekly')),
+    last_digest_at TIMESTAMP NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_threads_category ON threads(category_id);
+CREATE INDEX idx_thread_subscriptions_thread ON thread_subscriptions(thread_id);
@@ -0,0 +1,19 @@
+ALTER TABLE thread_subscriptions
+    ADD COLUMN level VARCHAR(10) NOT NULL DEFAULT 'watching' CHECK (level IN ('watching', 'tracking', 'normal', 'muted')) AFTER thread_id;
+ALTER TABLE category_follows
+    ADD COLUMN level VARCHAR(10) NOT NULL DEFAULT 'watching' CHECK (level IN ('watching', 'tracking', 'normal', 'muted')) AFTER category_id;
+ALTER TABLE tag_follows
+    ADD COLUMN level VARCHAR(10) NOT NULL DEFAULT 'watching' CHECK (level IN ('watching', 'tracking', 'normal', 'muted')) AFTER tag;
+
+CREATE TABLE thread_reads (
+    user_id INT NOT NULL,
+    thread_id INT NOT NULL,
+    last_read_message_id INT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, thread_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (thread_id) REFERENCES threads(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_category_follows_category ON category_follows(category_id);
+CREATE INDEX idx_tag_follows_tag ON tag_follows(tag);
@@ -0,0 +1,13 @@
+CREATE TABLE category_reads (
+    user_id INT NOT NULL,
+    category_id INT NOT NULL,
+    last_read_message_id INT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, category_id),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (category_id) REFERENCES categories(id) ON DELETE CASCADE
+);
+
+-- Les compteurs de non-lus parcourent les messages d'un fil au-delà d'un identifiant
+DROP INDEX idx_messages_thread ON messages;
+CREATE INDEX idx_messages_thread ON messages(thread_id, id);
@@ -0,0 +1,6 @@
+-- Les fichiers sont adressés par leur contenu et partagés : avant de supprimer un fichier,
+-- on vérifie qu'aucune pièce jointe ni aucun avatar ne le référence encore
+ALTER TABLE users ADD COLUMN avatar_key VARCHAR(255) AFTER profile_picture;
+
+CREATE INDEX idx_attachments_storage_key ON attachments(storage_key);
+CREATE INDEX idx_users_avatar_key ON users(avatar_key);
@@ -0,0 +1,2 @@
+-- Miniature générée à l'envoi ; NULL pour les images enregistrées avant le traitement des images
+ALTER TABLE attachments ADD COLUMN thumbnail_key VARCHAR(255) AFTER storage_key;
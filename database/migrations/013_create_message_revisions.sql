@@ -0,0 +1,16 @@
+-- Marqueur « modifié » : updated_at change aussi lors des votes, il ne peut pas servir
+ALTER TABLE messages ADD COLUMN edited_at TIMESTAMP NULL AFTER updated_at;
+ALTER TABLE messages ADD COLUMN edit_count INT NOT NULL DEFAULT 0 AFTER edited_at;
+
+-- Chaque modification conserve la version remplacée (version 1 = texte d'origine)
+CREATE TABLE message_revisions (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    message_id INT NOT NULL,
+    version INT NOT NULL,
+    content TEXT NOT NULL,
+    edited_by INT,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE,
+    FOREIGN KEY (edited_by) REFERENCES users(id) ON DELETE SET NULL,
+    UNIQUE(message_id, version)
+);
@@ -0,0 +1,15 @@
+-- Historique des titres, descriptions et tags des fils : chaque ligne est l'état du fil après une modification
+CREATE TABLE thread_revisions (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    thread_id INT NOT NULL,
+    version INT NOT NULL,
+    title VARCHAR(200) NOT NULL,
+    description TEXT NOT NULL,
+    tags TEXT NOT NULL,
+    editor_id INT,
+    reason VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (thread_id) REFERENCES threads(id) ON DELETE CASCADE,
+    FOREIGN KEY (editor_id) REFERENCES users(id) ON DELETE SET NULL,
+    UNIQUE(thread_id, version)
+);
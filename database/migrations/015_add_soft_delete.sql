@@ -0,0 +1,13 @@
+-- Suppression réversible : les fils et messages supprimés restent en corbeille jusqu'à leur purge
+ALTER TABLE threads ADD COLUMN deleted_at TIMESTAMP NULL;
+ALTER TABLE threads ADD COLUMN deleted_by INT NULL;
+ALTER TABLE threads ADD COLUMN delete_reason VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE threads ADD FOREIGN KEY (deleted_by) REFERENCES users(id) ON DELETE SET NULL;
+
+ALTER TABLE messages ADD COLUMN deleted_at TIMESTAMP NULL;
+ALTER TABLE messages ADD COLUMN deleted_by INT NULL;
+ALTER TABLE messages ADD COLUMN delete_reason VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE messages ADD FOREIGN KEY (deleted_by) REFERENCES users(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_threads_deleted ON threads(deleted_at);
+CREATE INDEX idx_messages_deleted ON messages(deleted_at);
@@ -0,0 +1,20 @@
+-- Réponse à un message précis du fil ; une réponse dont le parent est purgé remonte au premier niveau
+ALTER TABLE messages ADD COLUMN parent_id INT NULL AFTER author_id;
+ALTER TABLE messages ADD FOREIGN KEY (parent_id) REFERENCES messages(id) ON DELETE SET NULL;
+CREATE INDEX idx_messages_parent ON messages(parent_id);
+
+-- Citations : le fragment cité est copié, il reste intact si le message cité est modifié ou supprimé
+CREATE TABLE message_quotes (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    message_id INT NOT NULL,
+    quoted_message_id INT NULL,
+    quoted_author_id INT NULL,
+    quoted_version INT NOT NULL,
+    content TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE,
+    FOREIGN KEY (quoted_message_id) REFERENCES messages(id) ON DELETE SET NULL,
+    FOREIGN KEY (quoted_author_id) REFERENCES users(id) ON DELETE SET NULL
+);
+
+CREATE INDEX idx_message_quotes_message ON message_quotes(message_id);
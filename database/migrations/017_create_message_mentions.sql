@@ -0,0 +1,11 @@
+-- Utilisateurs mentionnés (@pseudo) dans un message
+CREATE TABLE message_mentions (
+    message_id INT NOT NULL,
+    user_id INT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (message_id, user_id),
+    FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_message_mentions_user ON message_mentions(user_id, message_id);
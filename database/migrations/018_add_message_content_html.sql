@@ -0,0 +1,2 @@
+-- Rendu HTML (Markdown assaini) du contenu des messages ; content garde la source
+ALTER TABLE messages ADD COLUMN content_html MEDIUMTEXT NULL AFTER content;
@@ -0,0 +1,33 @@
+-- Réactions emoji configurables, en plus du like/dislike qui reste le score de popularité
+CREATE TABLE reaction_types (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    code VARCHAR(32) NOT NULL UNIQUE,
+    label VARCHAR(64) NOT NULL,
+    emoji VARCHAR(16) NULL,
+    image_key VARCHAR(255) NULL,
+    position INT NOT NULL DEFAULT 0,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE message_emoji_reactions (
+    message_id INT NOT NULL,
+    user_id INT NOT NULL,
+    reaction_type_id INT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (message_id, user_id, reaction_type_id),
+    FOREIGN KEY (message_id) REFERENCES messages(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (reaction_type_id) REFERENCES reaction_types(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_emoji_reactions_type ON message_emoji_reactions(message_id, reaction_type_id);
+CREATE INDEX idx_emoji_reactions_user ON message_emoji_reactions(user_id);
+
+INSERT INTO reaction_types (code, label, emoji, position) VALUES
+('heart', 'J''adore', '❤️', 1),
+('laugh', 'Drôle', '😂', 2),
+('wow', 'Surprenant', '😮', 3),
+('sad', 'Triste', '😢', 4),
+('party', 'Bravo', '🎉', 5),
+('eyes', 'Je regarde', '👀', 6);
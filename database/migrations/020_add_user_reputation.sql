@@ -0,0 +1,4 @@
+-- Réputation des utilisateurs, calculée à partir des réactions reçues sur leurs messages
+ALTER TABLE users ADD COLUMN reputation INT NOT NULL DEFAULT 0;
+
+CREATE INDEX idx_users_reputation ON users(reputation);
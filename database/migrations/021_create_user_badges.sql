@@ -0,0 +1,10 @@
+-- Badges obtenus par les utilisateurs ; les définitions des badges sont dans config/badges.json
+CREATE TABLE user_badges (
+    user_id INT NOT NULL,
+    badge_code VARCHAR(50) NOT NULL,
+    awarded_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, badge_code),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_user_badges_code ON user_badges(badge_code, awarded_at);
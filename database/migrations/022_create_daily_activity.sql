@@ -0,0 +1,14 @@
+-- Agrégats quotidiens des classements : messages postés et likes reçus par auteur et par fil
+CREATE TABLE daily_activity (
+    day DATE NOT NULL,
+    thread_id INT NOT NULL,
+    user_id INT NOT NULL,
+    messages INT NOT NULL DEFAULT 0,
+    likes INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (day, thread_id, user_id),
+    FOREIGN KEY (thread_id) REFERENCES threads(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_messages_created ON messages(created_at);
+CREATE INDEX idx_message_reactions_created ON message_reactions(created_at);
@@ -0,0 +1,10 @@
+-- Mode questions/réponses : un fil de type question peut avoir une réponse acceptée ; les fils créés
+-- dans une catégorie en mode question sont des questions par défaut
+ALTER TABLE categories ADD COLUMN question_mode BOOLEAN NOT NULL DEFAULT false;
+
+ALTER TABLE threads
+    ADD COLUMN thread_type VARCHAR(20) NOT NULL DEFAULT 'discussion',
+    ADD COLUMN accepted_message_id INT NULL,
+    ADD FOREIGN KEY (accepted_message_id) REFERENCES messages(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_threads_type ON threads(thread_type, accepted_message_id);
@@ -0,0 +1,37 @@
+-- Sondages attachés aux fils : un sondage par fil, figé quand le fil n'est plus ouvert ou à sa date
+-- de clôture. Les compteurs de votes sont maintenus dans la transaction de chaque vote.
+CREATE TABLE polls (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    thread_id INT NOT NULL UNIQUE,
+    question VARCHAR(255) NOT NULL,
+    multiple_choice BOOLEAN NOT NULL DEFAULT false,
+    anonymous BOOLEAN NOT NULL DEFAULT false,
+    allow_change BOOLEAN NOT NULL DEFAULT true,
+    closes_at TIMESTAMP NULL,
+    voter_count INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (thread_id) REFERENCES threads(id) ON DELETE CASCADE
+);
+
+CREATE TABLE poll_options (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    poll_id INT NOT NULL,
+    label VARCHAR(100) NOT NULL,
+    position INT NOT NULL,
+    vote_count INT NOT NULL DEFAULT 0,
+    FOREIGN KEY (poll_id) REFERENCES polls(id) ON DELETE CASCADE
+);
+
+CREATE TABLE poll_votes (
+    poll_id INT NOT NULL,
+    user_id INT NOT NULL,
+    option_id INT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (poll_id, user_id, option_id),
+    FOREIGN KEY (poll_id) REFERENCES polls(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (option_id) REFERENCES poll_options(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_poll_options_poll ON poll_options(poll_id, position);
+CREATE INDEX idx_poll_votes_option ON poll_votes(option_id);
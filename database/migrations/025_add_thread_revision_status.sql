@@ -0,0 +1,4 @@
+-- Le statut et le type des fils font partie de l'historique ; NULL pour les versions enregistrées avant
+ALTER TABLE thread_revisions
+    ADD COLUMN status VARCHAR(20) NULL,
+    ADD COLUMN thread_type VARCHAR(20) NULL;
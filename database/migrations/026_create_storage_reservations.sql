@@ -0,0 +1,9 @@
+-- Réservations des clés de stockage : un envoi réserve la clé (dérivée du contenu) avant de vérifier si
+-- le fichier existe déjà, pour qu'une suppression simultanée ne retire pas un fichier qu'il va référencer
+CREATE TABLE storage_reservations (
+    id INT AUTO_INCREMENT PRIMARY KEY,
+    storage_key VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_storage_reservations_key ON storage_reservations(storage_key, created_at);
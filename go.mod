@@ -9,4 +9,4 @@ require (
 	golang.org/x/crypto v0.17.0
 )
 
-require github.com/joho/godotenv v1.5.1 // indirect
+require github.com/joho/godotenv v1.5.1
@@ -8,13 +8,18 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/gorilla/mux"
 	"github.com/joho/godotenv"
 
+	"projet-forum/config"
 	"projet-forum/controllers"
+	"projet-forum/middleware"
+	"projet-forum/models"
 	"projet-forum/routes"
+	"projet-forum/services"
 )
 
 func main() {
@@ -43,12 +48,121 @@ func main() {
 		log.Fatal(err)
 	}
 
+	// Commandes de maintenance (ex. go run . reconcile-reactions) : exécutées à la place du serveur
+	if len(os.Args) > 1 {
+		if err := runCommand(db, os.Args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// Suivi de la présence et de l'activité des utilisateurs
+	presence := services.NewPresenceHub()
+	middleware.ActivityHook = presence.Touch
+	services.RunPeriodically("expiration de la présence", 2*time.Second, nil, presence.Sweep)
+	services.RunPeriodically("enregistrement de l'activité", time.Minute, nil, func() error {
+		return presence.FlushActivity(db)
+	})
+
+	// Services partagés
+	notifications := services.NewNotificationService(db)
+
+	// Stockage des fichiers envoyés (disque local ou S3)
+	files, err := services.NewFileServiceFromEnv(db)
+	if err != nil {
+		log.Fatal(err)
+	}
+	services.RunPeriodically("nettoyage des fichiers orphelins", 24*time.Hour, nil, func() error {
+		_, _, err := files.CleanupOrphans()
+		return err
+	})
+
+	// Envoi des emails (réponses et digests)
+	mailer, err := services.NewMailerFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	appURL := os.Getenv("APP_URL")
+	if appURL == "" {
+		appURL = "http://localhost:8080"
+	}
+	emailService, err := services.NewEmailService(db, mailer, appURL, "templates/emails")
+	if err != nil {
+		log.Fatal(err)
+	}
+	services.RunPeriodically("envoi des digests", time.Hour, nil, emailService.SendDueDigests)
+
+	// Délai pendant lequel l'auteur d'un message peut le modifier (0 : sans limite)
+	editWindow, err := time.ParseDuration(config.GetEnvOrDefault("MESSAGE_EDIT_WINDOW", "15m"))
+	if err != nil {
+		log.Fatal("MESSAGE_EDIT_WINDOW invalide: ", err)
+	}
+
+	// Les fils et messages supprimés restent en corbeille pendant TRASH_RETENTION avant leur purge définitive
+	trashRetention, err := time.ParseDuration(config.GetEnvOrDefault("TRASH_RETENTION", "720h"))
+	if err != nil {
+		log.Fatal("TRASH_RETENTION invalide: ", err)
+	}
+	services.RunPeriodically("purge de la corbeille", time.Hour, nil, func() error {
+		_, _, err := files.PurgeTrash(time.Now().Add(-trashRetention))
+		return err
+	})
+
+	// Les compteurs dénormalisés sont maintenus en transaction ; la réparation corrige les écarts restants
+	services.RunPeriodically("réparation des compteurs", 24*time.Hour, nil, func() error {
+		_, err := services.RepairCounters(db)
+		return err
+	})
+
+	// La réputation est recalculée à chaque réaction ; le recalcul quotidien applique la décroissance
+	reputation, err := services.NewReputationServiceFromEnv(db)
+	if err != nil {
+		log.Fatal(err)
+	}
+	services.RunPeriodically("recalcul des réputations", 24*time.Hour, nil, reputation.RefreshAll)
+
+	// Les badges sont attribués à chaque événement ; le rattrapage quotidien couvre les badges ajoutés à
+	// la configuration et ceux liés à l'ancienneté
+	badges, err := services.NewBadgeServiceFromFile(db, config.GetEnvOrDefault("BADGES_FILE", "config/badges.json"), notifications)
+	if err != nil {
+		log.Fatal(err)
+	}
+	services.RunPeriodically("attribution des badges", 24*time.Hour, nil, badges.Backfill)
+
+	// Les classements lisent des agrégats quotidiens, calculés sur tout l'historique au premier démarrage
+	// puis recalculés à chaque mise en corbeille ou restauration d'un message. Ceux des deux derniers jours
+	// sont recalculés régulièrement, ceux du dernier mois chaque jour pour rattraper un recalcul manqué.
+	go func() {
+		if err := models.InitDailyActivity(db); err != nil {
+			log.Printf("Erreur lors du calcul initial des agrégats des classements: %v", err)
+		}
+	}()
+	services.RunPeriodically("agrégats des classements", 10*time.Minute, nil, func() error {
+		return models.RollupRecentActivity(db, 2)
+	})
+	services.RunPeriodically("agrégats mensuels des classements", 24*time.Hour, nil, func() error {
+		return models.RollupRecentActivity(db, 31)
+	})
+
 	// Initialiser les contrôleurs
 	authController := &controllers.AuthController{DB: db}
-	userController := &controllers.UserController{DB: db}
-	threadController := &controllers.ThreadController{DB: db}
+	userController := &controllers.UserController{DB: db, Presence: presence, Notifications: notifications, Files: files, Reputation: reputation, Badges: badges}
+	threadController := &controllers.ThreadController{DB: db, Notifications: notifications, Email: emailService, Files: files, Reputation: reputation, Badges: badges, Presence: presence}
 	statsController := &controllers.StatsController{DB: db}
-	adminController := &controllers.AdminController{DB: db}
+	adminController := &controllers.AdminController{DB: db, Notifications: notifications, Files: files, Presence: presence, TrashRetention: trashRetention}
+	liveController := &controllers.LiveController{DB: db, Presence: presence}
+	notificationController := &controllers.NotificationController{DB: db}
+	subscriptionController := &controllers.SubscriptionController{DB: db}
+	emailController := &controllers.EmailController{DB: db, Email: emailService}
+	categoryController := &controllers.CategoryController{DB: db}
+	readController := &controllers.ReadController{DB: db}
+	messageController := &controllers.MessageController{DB: db, Notifications: notifications, Reputation: reputation, Badges: badges, EditWindow: editWindow}
+	fileController := &controllers.FileController{Files: files}
+	attachmentController := &controllers.AttachmentController{DB: db, Files: files}
+	badgeController := &controllers.BadgeController{DB: db, Badges: badges}
+	questionController := &controllers.QuestionController{DB: db, Notifications: notifications, Badges: badges}
+	pollController := &controllers.PollController{DB: db, Presence: presence}
+	reactionController := &controllers.ReactionController{DB: db, Files: files, Notifications: notifications, Reputation: reputation, Badges: badges}
 
 	// Créer le routeur
 	router := mux.NewRouter()
@@ -99,6 +213,19 @@ func main() {
 	routes.SetupAPIRoutes(router, authController, threadController, statsController, userController)
 	routes.SetupAuthRoutes(router, authController)
 	routes.SetupAdminRoutes(router, adminController)
+	routes.SetupLiveRoutes(router, liveController)
+	routes.SetupNotificationRoutes(router, notificationController)
+	routes.SetupSubscriptionRoutes(router, subscriptionController)
+	routes.SetupEmailRoutes(router, emailController)
+	routes.SetupCategoryRoutes(router, categoryController)
+	routes.SetupReadRoutes(router, readController)
+	routes.SetupMessageRoutes(router, messageController)
+	routes.SetupFileRoutes(router, fileController)
+	routes.SetupAttachmentRoutes(router, attachmentController)
+	routes.SetupReactionRoutes(router, reactionController)
+	routes.SetupBadgeRoutes(router, badgeController)
+	routes.SetupQuestionRoutes(router, questionController)
+	routes.SetupPollRoutes(router, pollController)
 
 	// Route pour la page d'accueil
 	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
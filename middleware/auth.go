@@ -13,6 +13,9 @@ import (
 
 var jwtKey = []byte("votre_clé_secrète") // À remplacer par une vraie clé secrète
 
+// ActivityHook est appelé à chaque requête authentifiée pour suivre l'activité des utilisateurs
+var ActivityHook func(userID int64)
+
 type Claims struct {
 	UserID   int64  `json:"user_id"`
 	Username string `json:"username"`
@@ -112,12 +115,44 @@ func AuthMiddleware(next http.Handler) http.Handler {
 
 		fmt.Printf("[DEBUG] AuthMiddleware - Token valide pour l'utilisateur: %s (ID: %d)\n", claims.Username, claims.UserID)
 
+		if ActivityHook != nil {
+			ActivityHook(claims.UserID)
+		}
+
 		// Ajouter les claims au contexte
 		ctx := context.WithValue(r.Context(), "user", claims)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// OptionalAuthMiddleware ajoute les claims au contexte si un token valide est fourni,
+// sans bloquer les visiteurs non authentifiés
+func OptionalAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		parts := strings.Split(r.Header.Get("Authorization"), " ")
+		if len(parts) != 2 || parts[0] != "Bearer" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		claims := &Claims{}
+		token, err := jwt.ParseWithClaims(parts[1], claims, func(token *jwt.Token) (interface{}, error) {
+			return jwtKey, nil
+		})
+		if err != nil || !token.Valid {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if ActivityHook != nil {
+			ActivityHook(claims.UserID)
+		}
+
+		ctx := context.WithValue(r.Context(), "user", claims)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
 // AdminMiddleware vérifie si l'utilisateur est un administrateur
 func AdminMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
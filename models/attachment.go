@@ -0,0 +1,332 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var ErrQuotaExceeded = errors.New("storage quota exceeded, delete some attachments first")
+
+// Attachment est une image jointe à un message
+type Attachment struct {
+	ID           int64     `json:"id"`
+	MessageID    int64     `json:"message_id"`
+	UploaderID   int64     `json:"uploader_id"`
+	StorageKey   string    `json:"-"`
+	ThumbnailKey string    `json:"-"`
+	URL          string    `json:"url"`
+	ThumbnailURL string    `json:"thumbnail_url,omitempty"`
+	OriginalName string    `json:"original_name"`
+	MimeType     string    `json:"mime_type"`
+	SizeBytes    int64     `json:"size_bytes"`
+	Width        int       `json:"width"`
+	Height       int       `json:"height"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+const attachmentColumns = `a.id, a.message_id, a.uploader_id, a.storage_key, COALESCE(a.thumbnail_key, ''), a.original_name, a.mime_type,
+	a.size_bytes, a.width, a.height, a.created_at`
+
+func scanAttachments(rows *sql.Rows) ([]*Attachment, error) {
+	defer rows.Close()
+
+	attachments := []*Attachment{}
+	for rows.Next() {
+		a := &Attachment{}
+		if err := rows.Scan(&a.ID, &a.MessageID, &a.UploaderID, &a.StorageKey, &a.ThumbnailKey, &a.OriginalName, &a.MimeType,
+			&a.SizeBytes, &a.Width, &a.Height, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, a)
+	}
+	return attachments, rows.Err()
+}
+
+// insertAttachments insère les pièces jointes d'un envoi dans une transaction. Avec un quota positif ou
+// nul (en octets), la ligne de l'utilisateur reste verrouillée du calcul de l'espace occupé jusqu'à la
+// fin de la transaction : des envois simultanés ne peuvent pas dépasser le quota ensemble.
+func insertAttachments(tx *sql.Tx, uploaderID, quota int64, attachments []*Attachment) error {
+	if len(attachments) == 0 {
+		return nil
+	}
+	if quota >= 0 {
+		var id int64
+		if err := tx.QueryRow("SELECT id FROM users WHERE id = ? FOR UPDATE", uploaderID).Scan(&id); err != nil {
+			return err
+		}
+		var used int64
+		if err := tx.QueryRow(`
+			SELECT COALESCE(SUM(size_bytes), 0) FROM attachments WHERE uploader_id = ?
+		`, uploaderID).Scan(&used); err != nil {
+			return err
+		}
+		for _, a := range attachments {
+			used += a.SizeBytes
+		}
+		if used > quota {
+			return ErrQuotaExceeded
+		}
+	}
+
+	now := time.Now()
+	for _, a := range attachments {
+		a.UploaderID = uploaderID
+		result, err := tx.Exec(`
+			INSERT INTO attachments (message_id, uploader_id, storage_key, thumbnail_key, original_name, mime_type, size_bytes, width, height)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, a.MessageID, a.UploaderID, a.StorageKey, nullableString(a.ThumbnailKey), a.OriginalName, a.MimeType, a.SizeBytes, a.Width, a.Height)
+		if err != nil {
+			return err
+		}
+		if a.ID, err = result.LastInsertId(); err != nil {
+			return err
+		}
+		a.CreatedAt = now
+	}
+	return nil
+}
+
+// GetAttachmentsForMessages récupère les pièces jointes d'une liste de messages, groupées par message
+func GetAttachmentsForMessages(db *sql.DB, messageIDs []int64) (map[int64][]*Attachment, error) {
+	byMessage := make(map[int64][]*Attachment, len(messageIDs))
+	if len(messageIDs) == 0 {
+		return byMessage, nil
+	}
+
+	args := make([]interface{}, len(messageIDs))
+	for i, id := range messageIDs {
+		args[i] = id
+	}
+	rows, err := db.Query(`
+		SELECT `+attachmentColumns+`
+		FROM attachments a
+		WHERE a.message_id IN (`+inPlaceholders(len(messageIDs))+`)
+		ORDER BY a.id
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	attachments, err := scanAttachments(rows)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range attachments {
+		byMessage[a.MessageID] = append(byMessage[a.MessageID], a)
+	}
+	return byMessage, nil
+}
+
+// GetThreadAttachments récupère toutes les pièces jointes des messages d'un fil
+func GetThreadAttachments(db *sql.DB, threadID int64) ([]*Attachment, error) {
+	rows, err := db.Query(`
+		SELECT `+attachmentColumns+`
+		FROM attachments a
+		JOIN messages m ON m.id = a.message_id
+		WHERE m.thread_id = ?
+	`, threadID)
+	if err != nil {
+		return nil, err
+	}
+	return scanAttachments(rows)
+}
+
+// DeleteMessageAttachments supprime les pièces jointes d'un message
+func DeleteMessageAttachments(db *sql.DB, messageID int64) error {
+	_, err := db.Exec("DELETE FROM attachments WHERE message_id = ?", messageID)
+	return err
+}
+
+// IsStorageKeyInUse indique si un fichier est encore référencé par une pièce jointe, un avatar, une
+// réaction ou un envoi en cours (réservation non expirée)
+func IsStorageKeyInUse(db *sql.DB, key string) (bool, error) {
+	var inUse bool
+	err := db.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM attachments WHERE storage_key = ?)
+		    OR EXISTS (SELECT 1 FROM users WHERE avatar_key = ?)
+		    OR EXISTS (SELECT 1 FROM reaction_types WHERE image_key = ?)
+		    OR EXISTS (
+		        SELECT 1 FROM storage_reservations
+		        WHERE storage_key = ? AND created_at >= CURRENT_TIMESTAMP - INTERVAL ? SECOND
+		    )
+	`, key, key, key, key, int(StorageReservationTTL.Seconds())).Scan(&inUse)
+	return inUse, err
+}
+
+// UserAttachment est une pièce jointe listée avec le message et le fil auxquels elle appartient
+type UserAttachment struct {
+	*Attachment
+	ThreadID    int64  `json:"thread_id"`
+	ThreadTitle string `json:"thread_title"`
+}
+
+// StorageConsumer résume l'espace occupé par un utilisateur
+type StorageConsumer struct {
+	UserID      int64  `json:"user_id"`
+	Username    string `json:"username"`
+	Role        string `json:"role"`
+	Attachments int    `json:"attachments"`
+	UsedBytes   int64  `json:"used_bytes"`
+}
+
+// GetUserStorageUsage compte les pièces jointes envoyées par un utilisateur et leur taille totale
+func GetUserStorageUsage(db *sql.DB, userID int64) (int, int64, error) {
+	var count int
+	var used int64
+	err := db.QueryRow(`
+		SELECT COUNT(*), COALESCE(SUM(size_bytes), 0) FROM attachments WHERE uploader_id = ?
+	`, userID).Scan(&count, &used)
+	return count, used, err
+}
+
+// ListUserAttachments liste les pièces jointes d'un utilisateur, des plus récentes aux plus anciennes
+func ListUserAttachments(db *sql.DB, userID int64, page, perPage int) ([]*UserAttachment, error) {
+	rows, err := db.Query(`
+		SELECT `+attachmentColumns+`, m.thread_id, t.title
+		FROM attachments a
+		JOIN messages m ON m.id = a.message_id
+		JOIN threads t ON t.id = m.thread_id
+		WHERE a.uploader_id = ?
+		ORDER BY a.id DESC
+		LIMIT ? OFFSET ?
+	`, userID, perPage, (page-1)*perPage)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attachments := []*UserAttachment{}
+	for rows.Next() {
+		a := &UserAttachment{Attachment: &Attachment{}}
+		if err := rows.Scan(&a.ID, &a.MessageID, &a.UploaderID, &a.StorageKey, &a.ThumbnailKey, &a.OriginalName, &a.MimeType,
+			&a.SizeBytes, &a.Width, &a.Height, &a.CreatedAt, &a.ThreadID, &a.ThreadTitle); err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, a)
+	}
+	return attachments, rows.Err()
+}
+
+// DeleteUserAttachments supprime les pièces jointes indiquées qui appartiennent à l'utilisateur et
+// retourne celles qui ont été supprimées. image_url des messages concernés est vidé.
+func DeleteUserAttachments(db *sql.DB, userID int64, ids []int64) ([]*Attachment, error) {
+	if len(ids) == 0 {
+		return []*Attachment{}, nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	args := []interface{}{userID}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	rows, err := tx.Query(`
+		SELECT `+attachmentColumns+`
+		FROM attachments a
+		WHERE a.uploader_id = ? AND a.id IN (`+inPlaceholders(len(ids))+`)
+		FOR UPDATE
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	deleted, err := scanAttachments(rows)
+	if err != nil || len(deleted) == 0 {
+		return deleted, err
+	}
+
+	deletedIDs := make([]interface{}, len(deleted))
+	messageIDs := make([]interface{}, len(deleted))
+	for i, a := range deleted {
+		deletedIDs[i] = a.ID
+		messageIDs[i] = a.MessageID
+	}
+	if _, err := tx.Exec("DELETE FROM attachments WHERE id IN ("+inPlaceholders(len(deleted))+")", deletedIDs...); err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec("UPDATE messages SET image_url = '' WHERE id IN ("+inPlaceholders(len(deleted))+")", messageIDs...); err != nil {
+		return nil, err
+	}
+	return deleted, tx.Commit()
+}
+
+// GetTopStorageConsumers liste les utilisateurs qui occupent le plus d'espace
+func GetTopStorageConsumers(db *sql.DB, limit int) ([]*StorageConsumer, error) {
+	rows, err := db.Query(`
+		SELECT u.id, u.username, u.role, COUNT(a.id), SUM(a.size_bytes) AS used
+		FROM attachments a
+		JOIN users u ON u.id = a.uploader_id
+		GROUP BY u.id, u.username, u.role
+		ORDER BY used DESC
+		LIMIT ?
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	consumers := []*StorageConsumer{}
+	for rows.Next() {
+		c := &StorageConsumer{}
+		if err := rows.Scan(&c.UserID, &c.Username, &c.Role, &c.Attachments, &c.UsedBytes); err != nil {
+			return nil, err
+		}
+		consumers = append(consumers, c)
+	}
+	return consumers, rows.Err()
+}
+
+// GetStorageReferences retourne toutes les clés référencées en base : fichiers et miniatures des
+// pièces jointes et images de réaction, et clés d'avatar (dont les tailles sont des variantes)
+func GetStorageReferences(db *sql.DB) (attachmentKeys, avatarKeys []string, err error) {
+	rows, err := db.Query(`
+		SELECT storage_key FROM attachments
+		UNION SELECT thumbnail_key FROM attachments WHERE thumbnail_key IS NOT NULL
+		UNION SELECT image_key FROM reaction_types WHERE image_key IS NOT NULL
+	`)
+	if err != nil {
+		return nil, nil, err
+	}
+	if attachmentKeys, err = scanStrings(rows); err != nil {
+		return nil, nil, err
+	}
+
+	rows, err = db.Query("SELECT DISTINCT avatar_key FROM users WHERE avatar_key IS NOT NULL")
+	if err != nil {
+		return nil, nil, err
+	}
+	if avatarKeys, err = scanStrings(rows); err != nil {
+		return nil, nil, err
+	}
+	return attachmentKeys, avatarKeys, nil
+}
+
+// GetLegacyUploadReferences retourne les URL /static/uploads/ encore utilisées par des avatars ou
+// des messages enregistrés avant le stockage actuel
+func GetLegacyUploadReferences(db *sql.DB) ([]string, error) {
+	rows, err := db.Query(`
+		SELECT profile_picture FROM users WHERE profile_picture LIKE '/static/uploads/%'
+		UNION SELECT image_url FROM messages WHERE image_url LIKE '/static/uploads/%'
+	`)
+	if err != nil {
+		return nil, err
+	}
+	return scanStrings(rows)
+}
+
+func scanStrings(rows *sql.Rows) ([]string, error) {
+	defer rows.Close()
+
+	values := []string{}
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
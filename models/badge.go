@@ -0,0 +1,169 @@
+package models
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// Badge est la définition d'un badge, chargée depuis la configuration : il est obtenu quand la
+// métrique Metric de l'utilisateur atteint Threshold
+type Badge struct {
+	Code        string `json:"code"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Icon        string `json:"icon"`
+	Metric      string `json:"metric"`
+	Threshold   int    `json:"threshold"`
+}
+
+// UserBadge est un badge obtenu par un utilisateur
+type UserBadge struct {
+	*Badge
+	AwardedAt time.Time `json:"awarded_at"`
+}
+
+// BadgeAward est l'attribution enregistrée d'un badge, sans sa définition
+type BadgeAward struct {
+	Code      string
+	AwardedAt time.Time
+}
+
+// badgeMetrics associe à chaque métrique son calcul pour un utilisateur (alias u). Les contenus en
+// corbeille ne comptent pas ; un badge obtenu n'est jamais retiré.
+var badgeMetrics = map[string]string{
+	"messages": "u.message_count",
+	"threads":  "u.thread_count",
+	"likes_received": `(SELECT COALESCE(SUM(m.likes), 0) FROM messages m
+		WHERE m.author_id = u.id AND m.deleted_at IS NULL)`,
+	"thread_messages": `(SELECT COALESCE(MAX(t.message_count), 0) FROM threads t
+		WHERE t.author_id = u.id AND t.deleted_at IS NULL)`,
+	"accepted_answers": `(SELECT COUNT(*) FROM threads t JOIN messages m ON m.id = t.accepted_message_id
+		WHERE m.author_id = u.id AND t.author_id != u.id AND m.deleted_at IS NULL AND t.deleted_at IS NULL)`,
+	"membership_days": "DATEDIFF(CURRENT_TIMESTAMP, u.created_at)",
+	"reputation":      "u.reputation",
+}
+
+// IsValidBadgeMetric vérifie qu'une métrique de badge existe
+func IsValidBadgeMetric(metric string) bool {
+	_, ok := badgeMetrics[metric]
+	return ok
+}
+
+// AwardBadges attribue à un utilisateur les badges dont il remplit désormais la condition et retourne
+// ceux qu'il vient d'obtenir. Les métriques nécessaires sont calculées en une seule requête.
+func AwardBadges(db *sql.DB, userID int64, badges []*Badge) ([]*Badge, error) {
+	held, err := GetBadgeAwards(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	owned := make(map[string]bool, len(held))
+	for _, award := range held {
+		owned[award.Code] = true
+	}
+
+	var pending []*Badge
+	var metrics []string
+	position := make(map[string]int)
+	for _, badge := range badges {
+		if owned[badge.Code] {
+			continue
+		}
+		pending = append(pending, badge)
+		if _, ok := position[badge.Metric]; !ok {
+			position[badge.Metric] = len(metrics)
+			metrics = append(metrics, badge.Metric)
+		}
+	}
+	if len(pending) == 0 {
+		return nil, nil
+	}
+
+	columns := make([]string, len(metrics))
+	values := make([]int64, len(metrics))
+	dest := make([]interface{}, len(metrics))
+	for i, metric := range metrics {
+		columns[i] = badgeMetrics[metric]
+		dest[i] = &values[i]
+	}
+	err = db.QueryRow("SELECT "+strings.Join(columns, ", ")+" FROM users u WHERE u.id = ?", userID).Scan(dest...)
+	if err != nil {
+		return nil, err
+	}
+
+	var awarded []*Badge
+	for _, badge := range pending {
+		if values[position[badge.Metric]] < int64(badge.Threshold) {
+			continue
+		}
+		// INSERT IGNORE : le badge n'est attribué qu'une fois même si deux événements arrivent ensemble
+		result, err := db.Exec("INSERT IGNORE INTO user_badges (user_id, badge_code) VALUES (?, ?)", userID, badge.Code)
+		if err != nil {
+			return awarded, err
+		}
+		if inserted, err := result.RowsAffected(); err != nil {
+			return awarded, err
+		} else if inserted > 0 {
+			awarded = append(awarded, badge)
+		}
+	}
+	return awarded, nil
+}
+
+// BackfillBadge attribue un badge à tous les utilisateurs qui remplissent sa condition et ne l'ont pas
+// encore (badges ajoutés à la configuration, métriques liées au temps). Retourne le nombre d'attributions.
+func BackfillBadge(db *sql.DB, badge *Badge) (int64, error) {
+	result, err := db.Exec(`
+		INSERT IGNORE INTO user_badges (user_id, badge_code)
+		SELECT u.id, ? FROM users u
+		WHERE `+badgeMetrics[badge.Metric]+` >= ?
+		AND NOT EXISTS (SELECT 1 FROM user_badges ub WHERE ub.user_id = u.id AND ub.badge_code = ?)
+	`, badge.Code, badge.Threshold, badge.Code)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// GetBadgeAwards liste les badges obtenus par un utilisateur, les plus récents en premier
+func GetBadgeAwards(db *sql.DB, userID int64) ([]*BadgeAward, error) {
+	rows, err := db.Query(`
+		SELECT badge_code, awarded_at FROM user_badges
+		WHERE user_id = ?
+		ORDER BY awarded_at DESC, badge_code
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	awards := []*BadgeAward{}
+	for rows.Next() {
+		a := &BadgeAward{}
+		if err := rows.Scan(&a.Code, &a.AwardedAt); err != nil {
+			return nil, err
+		}
+		awards = append(awards, a)
+	}
+	return awards, rows.Err()
+}
+
+// CountBadgeHolders compte les utilisateurs ayant obtenu chaque badge
+func CountBadgeHolders(db *sql.DB) (map[string]int, error) {
+	rows, err := db.Query("SELECT badge_code, COUNT(*) FROM user_badges GROUP BY badge_code")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int)
+	for rows.Next() {
+		var code string
+		var count int
+		if err := rows.Scan(&code, &count); err != nil {
+			return nil, err
+		}
+		counts[code] = count
+	}
+	return counts, rows.Err()
+}
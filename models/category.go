@@ -6,21 +6,23 @@ import (
 )
 
 type Category struct {
-	ID          int64     `json:"id"`
-	Name        string    `json:"name"`
-	Description string    `json:"description"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
-	ThreadCount int       `json:"thread_count"`
+	ID          int64  `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// QuestionMode : les fils créés dans la catégorie sont des questions par défaut
+	QuestionMode bool      `json:"question_mode"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	ThreadCount  int       `json:"thread_count"`
 }
 
 // CreateCategory crée une nouvelle catégorie
-func CreateCategory(db *sql.DB, name, description string) (*Category, error) {
+func CreateCategory(db *sql.DB, name, description string, questionMode bool) (*Category, error) {
 	query := `
-		INSERT INTO categories (name, description, created_at, updated_at)
-		VALUES (?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		INSERT INTO categories (name, description, question_mode, created_at, updated_at)
+		VALUES (?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
 	`
-	result, err := db.Exec(query, name, description)
+	result, err := db.Exec(query, name, description, questionMode)
 	if err != nil {
 		return nil, err
 	}
@@ -36,10 +38,10 @@ func CreateCategory(db *sql.DB, name, description string) (*Category, error) {
 // GetCategory récupère une catégorie par son ID
 func GetCategory(db *sql.DB, id int64) (*Category, error) {
 	query := `
-		SELECT c.id, c.name, c.description, c.created_at, c.updated_at,
+		SELECT c.id, c.name, c.description, c.question_mode, c.created_at, c.updated_at,
 		       COUNT(t.id) as thread_count
 		FROM categories c
-		LEFT JOIN threads t ON c.id = t.category_id
+		LEFT JOIN threads t ON c.id = t.category_id AND t.deleted_at IS NULL
 		WHERE c.id = ?
 		GROUP BY c.id
 	`
@@ -48,6 +50,7 @@ func GetCategory(db *sql.DB, id int64) (*Category, error) {
 		&category.ID,
 		&category.Name,
 		&category.Description,
+		&category.QuestionMode,
 		&category.CreatedAt,
 		&category.UpdatedAt,
 		&category.ThreadCount,
@@ -62,23 +65,40 @@ func GetCategory(db *sql.DB, id int64) (*Category, error) {
 func (c *Category) UpdateCategory(db *sql.DB) error {
 	query := `
 		UPDATE categories
-		SET name = ?, description = ?, updated_at = CURRENT_TIMESTAMP
+		SET name = ?, description = ?, question_mode = ?, updated_at = CURRENT_TIMESTAMP
 		WHERE id = ?
 	`
-	_, err := db.Exec(query, c.Name, c.Description, c.ID)
+	_, err := db.Exec(query, c.Name, c.Description, c.QuestionMode, c.ID)
 	return err
 }
 
-// DeleteCategory supprime une catégorie
-func DeleteCategory(db *sql.DB, id int64) error {
+// DeleteCategory supprime une catégorie ; ses fils passent en corbeille (sans catégorie s'ils sont restaurés)
+func DeleteCategory(db *sql.DB, id, deletedBy int64) error {
 	tx, err := db.Begin()
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback()
 
-	// Supprimer d'abord les fils de discussion associés
-	_, err = tx.Exec("DELETE FROM threads WHERE category_id = ?", id)
+	// Les fils mis en corbeille ne sont plus comptés pour leurs auteurs
+	_, err = tx.Exec(`
+		UPDATE users u
+		JOIN (
+			SELECT author_id, COUNT(*) AS n FROM threads
+			WHERE category_id = ? AND deleted_at IS NULL
+			GROUP BY author_id
+		) c ON c.author_id = u.id
+		SET u.thread_count = GREATEST(u.thread_count - c.n, 0)
+	`, id)
+	if err != nil {
+		return err
+	}
+
+	// Mettre ensuite les fils de discussion associés en corbeille
+	_, err = tx.Exec(`
+		UPDATE threads SET deleted_at = CURRENT_TIMESTAMP, deleted_by = ?, delete_reason = 'category deleted'
+		WHERE category_id = ? AND deleted_at IS NULL
+	`, nullableID(deletedBy), id)
 	if err != nil {
 		return err
 	}
@@ -95,10 +115,10 @@ func DeleteCategory(db *sql.DB, id int64) error {
 // ListCategories récupère la liste des catégories
 func ListCategories(db *sql.DB) ([]*Category, error) {
 	query := `
-		SELECT c.id, c.name, c.description, c.created_at, c.updated_at,
+		SELECT c.id, c.name, c.description, c.question_mode, c.created_at, c.updated_at,
 		       COUNT(t.id) as thread_count
 		FROM categories c
-		LEFT JOIN threads t ON c.id = t.category_id
+		LEFT JOIN threads t ON c.id = t.category_id AND t.deleted_at IS NULL
 		GROUP BY c.id
 		ORDER BY c.name ASC
 	`
@@ -116,6 +136,7 @@ func ListCategories(db *sql.DB) ([]*Category, error) {
 			&category.ID,
 			&category.Name,
 			&category.Description,
+			&category.QuestionMode,
 			&category.CreatedAt,
 			&category.UpdatedAt,
 			&category.ThreadCount,
@@ -0,0 +1,119 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Les compteurs dénormalisés ne comptent que ce qui n'est pas en corbeille :
+//   - threads.message_count : messages du fil
+//   - users.message_count : messages de l'utilisateur, quel que soit l'état de leur fil
+//   - users.thread_count : fils de l'utilisateur
+// Ils sont modifiés dans la même transaction que les lignes qu'ils comptent ; RepairCounters corrige
+// les écarts hérités d'anciennes versions ou de modifications faites directement en base.
+
+// Types de compteurs vérifiés par FindCounterDrift
+const (
+	CounterThreadMessages = "thread_messages"
+	CounterUserMessages   = "user_messages"
+	CounterUserThreads    = "user_threads"
+)
+
+// execer est implémenté par *sql.DB et *sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// addMessageCounts ajoute delta aux compteurs de messages d'un fil et de l'auteur d'un message
+func addMessageCounts(tx execer, threadID, authorID int64, delta int) error {
+	if _, err := tx.Exec("UPDATE threads SET message_count = GREATEST(message_count + ?, 0) WHERE id = ?", delta, threadID); err != nil {
+		return err
+	}
+	_, err := tx.Exec("UPDATE users SET message_count = GREATEST(message_count + ?, 0) WHERE id = ?", delta, authorID)
+	return err
+}
+
+// addThreadCount ajoute delta au compteur de fils de l'auteur d'un fil
+func addThreadCount(tx execer, threadID int64, delta int) error {
+	_, err := tx.Exec(`
+		UPDATE users SET thread_count = GREATEST(thread_count + ?, 0)
+		WHERE id = (SELECT author_id FROM threads WHERE id = ?)
+	`, delta, threadID)
+	return err
+}
+
+// counterCheck décrit comment recalculer un compteur : la table et la colonne stockées, et le nombre
+// réel de lignes pour un identifiant (alias x)
+type counterCheck struct {
+	kind   string
+	table  string
+	column string
+	actual string
+}
+
+var counterChecks = []counterCheck{
+	{CounterThreadMessages, "threads", "message_count",
+		"(SELECT COUNT(*) FROM messages m WHERE m.thread_id = x.id AND m.deleted_at IS NULL)"},
+	{CounterUserMessages, "users", "message_count",
+		"(SELECT COUNT(*) FROM messages m WHERE m.author_id = x.id AND m.deleted_at IS NULL)"},
+	{CounterUserThreads, "users", "thread_count",
+		"(SELECT COUNT(*) FROM threads t WHERE t.author_id = x.id AND t.deleted_at IS NULL)"},
+}
+
+// CounterDrift est un compteur qui ne correspond plus au nombre réel de lignes
+type CounterDrift struct {
+	Kind   string `json:"kind"`
+	ID     int64  `json:"id"`
+	Stored int    `json:"stored"`
+	Actual int    `json:"actual"`
+}
+
+// FindCounterDrift liste les compteurs faux, au plus limit par type de compteur
+func FindCounterDrift(db *sql.DB, limit int) ([]*CounterDrift, error) {
+	drifts := []*CounterDrift{}
+	for _, check := range counterChecks {
+		rows, err := db.Query(fmt.Sprintf(`
+			SELECT id, stored, actual FROM (
+				SELECT x.id, x.%s AS stored, %s AS actual FROM %s x
+			) c
+			WHERE stored != actual
+			ORDER BY id
+			LIMIT ?
+		`, check.column, check.actual, check.table), limit)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			d := &CounterDrift{Kind: check.kind}
+			if err := rows.Scan(&d.ID, &d.Stored, &d.Actual); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			drifts = append(drifts, d)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return drifts, nil
+}
+
+// RepairCounters recalcule les compteurs faux et retourne le nombre de corrections par type de
+// compteur. Chaque ligne est recalculée au moment de sa mise à jour : une écriture concurrente entre la
+// détection et la correction ne réintroduit pas d'écart.
+func RepairCounters(db *sql.DB) (map[string]int64, error) {
+	repaired := make(map[string]int64, len(counterChecks))
+	for _, check := range counterChecks {
+		result, err := db.Exec(fmt.Sprintf(`
+			UPDATE %[1]s x SET x.%[2]s = %[3]s WHERE x.%[2]s != %[3]s
+		`, check.table, check.column, check.actual))
+		if err != nil {
+			return repaired, err
+		}
+		if repaired[check.kind], err = result.RowsAffected(); err != nil {
+			return repaired, err
+		}
+	}
+	return repaired, nil
+}
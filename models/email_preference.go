@@ -0,0 +1,140 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+type DigestFrequency string
+
+const (
+	DigestNone   DigestFrequency = "none"
+	DigestDaily  DigestFrequency = "daily"
+	DigestWeekly DigestFrequency = "weekly"
+)
+
+type EmailPreferences struct {
+	UserID          int64      `json:"user_id"`
+	ReplyEmails     bool       `json:"reply_emails"`
+	DigestFrequency string     `json:"digest_frequency"`
+	LastDigestAt    *time.Time `json:"last_digest_at,omitempty"`
+}
+
+// DigestRecipient représente un utilisateur à qui un digest doit être envoyé
+type DigestRecipient struct {
+	UserID       int64
+	Username     string
+	Email        string
+	Frequency    DigestFrequency
+	LastDigestAt *time.Time
+}
+
+// IsValidDigestFrequency vérifie qu'une fréquence de digest existe
+func IsValidDigestFrequency(f string) bool {
+	switch DigestFrequency(f) {
+	case DigestNone, DigestDaily, DigestWeekly:
+		return true
+	}
+	return false
+}
+
+// Period retourne l'intervalle entre deux digests
+func (f DigestFrequency) Period() time.Duration {
+	if f == DigestDaily {
+		return 24 * time.Hour
+	}
+	return 7 * 24 * time.Hour
+}
+
+// GetEmailPreferences récupère les préférences email d'un utilisateur (valeurs par défaut si absentes)
+func GetEmailPreferences(db *sql.DB, userID int64) (*EmailPreferences, error) {
+	prefs := &EmailPreferences{
+		UserID:          userID,
+		ReplyEmails:     true,
+		DigestFrequency: string(DigestWeekly),
+	}
+	var lastDigest sql.NullTime
+	err := db.QueryRow(`
+		SELECT reply_emails, digest_frequency, last_digest_at
+		FROM email_preferences WHERE user_id = ?
+	`, userID).Scan(&prefs.ReplyEmails, &prefs.DigestFrequency, &lastDigest)
+	if err == sql.ErrNoRows {
+		return prefs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if lastDigest.Valid {
+		prefs.LastDigestAt = &lastDigest.Time
+	}
+	return prefs, nil
+}
+
+// SetReplyEmails active ou désactive les emails envoyés à chaque réponse
+func SetReplyEmails(db *sql.DB, userID int64, enabled bool) error {
+	_, err := db.Exec(`
+		INSERT INTO email_preferences (user_id, reply_emails, digest_frequency)
+		VALUES (?, ?, 'weekly')
+		ON DUPLICATE KEY UPDATE reply_emails = VALUES(reply_emails)
+	`, userID, enabled)
+	return err
+}
+
+// SetDigestFrequency modifie la fréquence du digest d'un utilisateur
+func SetDigestFrequency(db *sql.DB, userID int64, frequency DigestFrequency) error {
+	_, err := db.Exec(`
+		INSERT INTO email_preferences (user_id, reply_emails, digest_frequency)
+		VALUES (?, true, ?)
+		ON DUPLICATE KEY UPDATE digest_frequency = VALUES(digest_frequency)
+	`, userID, string(frequency))
+	return err
+}
+
+// MarkDigestSent enregistre la date d'envoi du dernier digest
+func MarkDigestSent(db *sql.DB, userID int64, sentAt time.Time) error {
+	_, err := db.Exec(`
+		INSERT INTO email_preferences (user_id, reply_emails, digest_frequency, last_digest_at)
+		VALUES (?, true, 'weekly', ?)
+		ON DUPLICATE KEY UPDATE last_digest_at = VALUES(last_digest_at)
+	`, userID, sentAt)
+	return err
+}
+
+// GetDigestRecipients récupère les utilisateurs qui suivent (sans sourdine) au moins une catégorie ou un tag
+// et dont le dernier digest est plus ancien que leur fréquence
+func GetDigestRecipients(db *sql.DB, now time.Time) ([]*DigestRecipient, error) {
+	rows, err := db.Query(`
+		SELECT u.id, u.username, u.email, COALESCE(p.digest_frequency, 'weekly'), p.last_digest_at
+		FROM users u
+		LEFT JOIN email_preferences p ON p.user_id = u.id
+		WHERE u.is_banned = false
+		AND COALESCE(p.digest_frequency, 'weekly') != 'none'
+		AND (
+			EXISTS (SELECT 1 FROM category_follows cf WHERE cf.user_id = u.id AND cf.level != 'muted')
+			OR EXISTS (SELECT 1 FROM tag_follows tf WHERE tf.user_id = u.id AND tf.level != 'muted')
+		)
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	recipients := []*DigestRecipient{}
+	for rows.Next() {
+		r := &DigestRecipient{}
+		var frequency string
+		var lastDigest sql.NullTime
+		if err := rows.Scan(&r.UserID, &r.Username, &r.Email, &frequency, &lastDigest); err != nil {
+			return nil, err
+		}
+		r.Frequency = DigestFrequency(frequency)
+		if lastDigest.Valid {
+			if now.Sub(lastDigest.Time) < r.Frequency.Period() {
+				continue
+			}
+			r.LastDigestAt = &lastDigest.Time
+		}
+		recipients = append(recipients, r)
+	}
+	return recipients, rows.Err()
+}
@@ -0,0 +1,283 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// ReactionType est une réaction emoji proposée sur les messages, avec un emoji ou une image personnalisée
+type ReactionType struct {
+	ID        int64     `json:"id"`
+	Code      string    `json:"code"`
+	Label     string    `json:"label"`
+	Emoji     string    `json:"emoji,omitempty"`
+	ImageKey  string    `json:"-"`
+	ImageURL  string    `json:"image_url,omitempty"`
+	Position  int       `json:"position"`
+	Enabled   bool      `json:"enabled"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ReactionSummary est le nombre de réactions d'un type sur un message
+type ReactionSummary struct {
+	ReactionTypeID int64  `json:"reaction_type_id"`
+	Code           string `json:"code"`
+	Count          int    `json:"count"`
+	Reacted        bool   `json:"reacted"`
+}
+
+// Reactor est un utilisateur ayant réagi à un message
+type Reactor struct {
+	UserID         int64     `json:"user_id"`
+	Username       string    `json:"username"`
+	ProfilePicture string    `json:"profile_picture"`
+	ReactedAt      time.Time `json:"reacted_at"`
+}
+
+// UserMessageReactions regroupe les réactions d'un utilisateur à un message : son vote et ses emojis
+type UserMessageReactions struct {
+	Vote   string   `json:"vote,omitempty"`
+	Emojis []string `json:"emojis"`
+}
+
+const reactionTypeColumns = "id, code, label, COALESCE(emoji, ''), COALESCE(image_key, ''), position, enabled, created_at"
+
+func scanReactionType(row rowScanner) (*ReactionType, error) {
+	t := &ReactionType{}
+	err := row.Scan(&t.ID, &t.Code, &t.Label, &t.Emoji, &t.ImageKey, &t.Position, &t.Enabled, &t.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// ListReactionTypes liste les réactions dans leur ordre d'affichage ; les réactions désactivées ne sont
+// incluses que sur demande
+func ListReactionTypes(db *sql.DB, includeDisabled bool) ([]*ReactionType, error) {
+	query := "SELECT " + reactionTypeColumns + " FROM reaction_types"
+	if !includeDisabled {
+		query += " WHERE enabled = true"
+	}
+	rows, err := db.Query(query + " ORDER BY position, id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	types := []*ReactionType{}
+	for rows.Next() {
+		t, err := scanReactionType(rows)
+		if err != nil {
+			return nil, err
+		}
+		types = append(types, t)
+	}
+	return types, rows.Err()
+}
+
+// GetReactionType récupère une réaction par son ID
+func GetReactionType(db *sql.DB, id int64) (*ReactionType, error) {
+	return scanReactionType(db.QueryRow("SELECT "+reactionTypeColumns+" FROM reaction_types WHERE id = ?", id))
+}
+
+// GetReactionTypeByCode récupère une réaction par son code
+func GetReactionTypeByCode(db *sql.DB, code string) (*ReactionType, error) {
+	return scanReactionType(db.QueryRow("SELECT "+reactionTypeColumns+" FROM reaction_types WHERE code = ?", code))
+}
+
+// CreateReactionType ajoute une réaction à la liste proposée
+func CreateReactionType(db *sql.DB, t *ReactionType) error {
+	result, err := db.Exec(`
+		INSERT INTO reaction_types (code, label, emoji, image_key, position, enabled)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, t.Code, t.Label, nullableString(t.Emoji), nullableString(t.ImageKey), t.Position, t.Enabled)
+	if err != nil {
+		return err
+	}
+	t.ID, err = result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	created, err := GetReactionType(db, t.ID)
+	if err != nil {
+		return err
+	}
+	*t = *created
+	return nil
+}
+
+// UpdateReactionType enregistre les modifications d'une réaction existante (le code n'est pas modifiable)
+func UpdateReactionType(db *sql.DB, t *ReactionType) error {
+	_, err := db.Exec(`
+		UPDATE reaction_types SET label = ?, emoji = ?, image_key = ?, position = ?, enabled = ?
+		WHERE id = ?
+	`, t.Label, nullableString(t.Emoji), nullableString(t.ImageKey), t.Position, t.Enabled, t.ID)
+	return err
+}
+
+// DeleteReactionType supprime une réaction et toutes les réactions des utilisateurs de ce type
+func DeleteReactionType(db *sql.DB, id int64) error {
+	return requireAffected(db.Exec("DELETE FROM reaction_types WHERE id = ?", id))
+}
+
+// ToggleEmojiReaction ajoute la réaction d'un utilisateur à un message, ou la retire s'il l'avait déjà
+// mise. Retourne true si la réaction est désormais présente.
+func ToggleEmojiReaction(db *sql.DB, messageID, userID, reactionTypeID int64) (bool, error) {
+	result, err := db.Exec(`
+		DELETE FROM message_emoji_reactions
+		WHERE message_id = ? AND user_id = ? AND reaction_type_id = ?
+	`, messageID, userID, reactionTypeID)
+	if err != nil {
+		return false, err
+	}
+	if removed, err := result.RowsAffected(); err != nil || removed > 0 {
+		return false, err
+	}
+
+	// INSERT IGNORE : deux clics simultanés ne produisent qu'une réaction
+	_, err = db.Exec(`
+		INSERT IGNORE INTO message_emoji_reactions (message_id, user_id, reaction_type_id)
+		VALUES (?, ?, ?)
+	`, messageID, userID, reactionTypeID)
+	return err == nil, err
+}
+
+// GetReactionSummaries compte les réactions emoji de chaque message par type, en indiquant celles
+// de viewerID (0 pour un visiteur). Les types désactivés ne sont plus affichés.
+func GetReactionSummaries(db *sql.DB, messageIDs []int64, viewerID int64) (map[int64][]*ReactionSummary, error) {
+	byMessage := make(map[int64][]*ReactionSummary, len(messageIDs))
+	if len(messageIDs) == 0 {
+		return byMessage, nil
+	}
+
+	args := []interface{}{viewerID}
+	for _, id := range messageIDs {
+		args = append(args, id)
+	}
+	rows, err := db.Query(`
+		SELECT er.message_id, rt.id, rt.code, COUNT(*), MAX(er.user_id = ?)
+		FROM message_emoji_reactions er
+		JOIN reaction_types rt ON rt.id = er.reaction_type_id
+		WHERE er.message_id IN (`+inPlaceholders(len(messageIDs))+`) AND rt.enabled = true
+		GROUP BY er.message_id, rt.id, rt.code, rt.position
+		ORDER BY er.message_id, rt.position, rt.id
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var messageID int64
+		s := &ReactionSummary{}
+		if err := rows.Scan(&messageID, &s.ReactionTypeID, &s.Code, &s.Count, &s.Reacted); err != nil {
+			return nil, err
+		}
+		byMessage[messageID] = append(byMessage[messageID], s)
+	}
+	return byMessage, rows.Err()
+}
+
+// LoadMessageReactions ajoute leurs réactions emoji aux messages
+func LoadMessageReactions(db *sql.DB, messages []*Message, viewerID int64) error {
+	ids := make([]int64, 0, len(messages))
+	for _, m := range messages {
+		ids = append(ids, m.ID)
+	}
+	byMessage, err := GetReactionSummaries(db, ids, viewerID)
+	if err != nil {
+		return err
+	}
+	for _, m := range messages {
+		m.Reactions = byMessage[m.ID]
+	}
+	return nil
+}
+
+// ListReactors liste les utilisateurs ayant mis une réaction à un message, les plus récents en premier
+func ListReactors(db *sql.DB, messageID, reactionTypeID int64, page, perPage int) ([]*Reactor, int, error) {
+	var total int
+	err := db.QueryRow(`
+		SELECT COUNT(*) FROM message_emoji_reactions WHERE message_id = ? AND reaction_type_id = ?
+	`, messageID, reactionTypeID).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := db.Query(`
+		SELECT u.id, u.username, u.profile_picture, er.created_at
+		FROM message_emoji_reactions er
+		JOIN users u ON u.id = er.user_id
+		WHERE er.message_id = ? AND er.reaction_type_id = ?
+		ORDER BY er.created_at DESC, u.id
+		LIMIT ? OFFSET ?
+	`, messageID, reactionTypeID, perPage, (page-1)*perPage)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	reactors := []*Reactor{}
+	for rows.Next() {
+		r := &Reactor{}
+		var profilePicture sql.NullString
+		if err := rows.Scan(&r.UserID, &r.Username, &profilePicture, &r.ReactedAt); err != nil {
+			return nil, 0, err
+		}
+		r.ProfilePicture = AvatarURL(r.UserID, profilePicture.String)
+		reactors = append(reactors, r)
+	}
+	return reactors, total, rows.Err()
+}
+
+// GetUserReactions récupère en une seule requête le vote (like/dislike) et les réactions emoji d'un
+// utilisateur sur une liste de messages. Les messages sans réaction sont absents du résultat.
+func GetUserReactions(db *sql.DB, userID int64, messageIDs []int64) (map[int64]*UserMessageReactions, error) {
+	byMessage := make(map[int64]*UserMessageReactions, len(messageIDs))
+	if len(messageIDs) == 0 {
+		return byMessage, nil
+	}
+
+	ids := make([]interface{}, len(messageIDs))
+	for i, id := range messageIDs {
+		ids[i] = id
+	}
+	args := append([]interface{}{userID}, ids...)
+	args = append(args, userID)
+	args = append(args, ids...)
+	rows, err := db.Query(`
+		SELECT message_id, 'vote', reaction_type, 0
+		FROM message_reactions
+		WHERE user_id = ? AND message_id IN (`+inPlaceholders(len(ids))+`)
+		UNION ALL
+		SELECT er.message_id, 'emoji', rt.code, rt.position
+		FROM message_emoji_reactions er
+		JOIN reaction_types rt ON rt.id = er.reaction_type_id
+		WHERE er.user_id = ? AND er.message_id IN (`+inPlaceholders(len(ids))+`) AND rt.enabled = true
+		ORDER BY 1, 4
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var messageID int64
+		var kind, value string
+		var position int
+		if err := rows.Scan(&messageID, &kind, &value, &position); err != nil {
+			return nil, err
+		}
+		reactions := byMessage[messageID]
+		if reactions == nil {
+			reactions = &UserMessageReactions{Emojis: []string{}}
+			byMessage[messageID] = reactions
+		}
+		if kind == "vote" {
+			reactions.Vote = value
+		} else {
+			reactions.Emojis = append(reactions.Emojis, value)
+		}
+	}
+	return byMessage, rows.Err()
+}
@@ -0,0 +1,147 @@
+package models
+
+import (
+	"database/sql"
+)
+
+type FriendshipStatus string
+
+const (
+	FriendshipPending  FriendshipStatus = "pending"
+	FriendshipAccepted FriendshipStatus = "accepted"
+	FriendshipBlocked  FriendshipStatus = "blocked"
+)
+
+// AreFriends vérifie si deux utilisateurs sont amis (demande acceptée dans un sens ou dans l'autre)
+func AreFriends(db *sql.DB, userID, otherID int64) (bool, error) {
+	var count int
+	err := db.QueryRow(`
+		SELECT COUNT(*)
+		FROM friendships
+		WHERE status = 'accepted'
+		AND ((user_id = ? AND friend_id = ?) OR (user_id = ? AND friend_id = ?))
+	`, userID, otherID, otherID, userID).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// IsBlocked vérifie si l'un des deux utilisateurs a bloqué l'autre
+func IsBlocked(db *sql.DB, userID, otherID int64) (bool, error) {
+	var count int
+	err := db.QueryRow(`
+		SELECT COUNT(*)
+		FROM friendships
+		WHERE status = 'blocked'
+		AND ((user_id = ? AND friend_id = ?) OR (user_id = ? AND friend_id = ?))
+	`, userID, otherID, otherID, userID).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// GetBlockedUserIDs récupère les utilisateurs bloqués par un utilisateur ou l'ayant bloqué
+func GetBlockedUserIDs(db *sql.DB, userID int64) (map[int64]bool, error) {
+	rows, err := db.Query(`
+		SELECT friend_id FROM friendships WHERE user_id = ? AND status = 'blocked'
+		UNION
+		SELECT user_id FROM friendships WHERE friend_id = ? AND status = 'blocked'
+	`, userID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	blocked := make(map[int64]bool)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		blocked[id] = true
+	}
+	return blocked, rows.Err()
+}
+
+// BlockUser bloque un utilisateur, ce qui remplace une éventuelle amitié entre les deux
+func BlockUser(db *sql.DB, userID, targetID int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Supprimer la relation inverse, sauf si la cible nous a elle-même bloqué
+	_, err = tx.Exec(`
+		DELETE FROM friendships
+		WHERE user_id = ? AND friend_id = ? AND status != 'blocked'
+	`, targetID, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO friendships (user_id, friend_id, status, created_at, updated_at)
+		VALUES (?, ?, 'blocked', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		ON DUPLICATE KEY UPDATE status = 'blocked', updated_at = CURRENT_TIMESTAMP
+	`, userID, targetID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UnblockUser débloque un utilisateur
+func UnblockUser(db *sql.DB, userID, targetID int64) error {
+	_, err := db.Exec(`
+		DELETE FROM friendships
+		WHERE user_id = ? AND friend_id = ? AND status = 'blocked'
+	`, userID, targetID)
+	return err
+}
+
+// SendFriendRequest crée une demande d'ami en attente
+func SendFriendRequest(db *sql.DB, userID, friendID int64) error {
+	_, err := db.Exec(`
+		INSERT INTO friendships (user_id, friend_id, status, created_at, updated_at)
+		VALUES (?, ?, 'pending', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+	`, userID, friendID)
+	return err
+}
+
+// AcceptFriendRequest accepte une demande d'ami reçue de requesterID
+func AcceptFriendRequest(db *sql.DB, userID, requesterID int64) error {
+	result, err := db.Exec(`
+		UPDATE friendships
+		SET status = 'accepted', updated_at = CURRENT_TIMESTAMP
+		WHERE user_id = ? AND friend_id = ? AND status = 'pending'
+	`, requesterID, userID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// HasFriendship vérifie si une relation (demande, amitié ou blocage) existe entre deux utilisateurs
+func HasFriendship(db *sql.DB, userID, otherID int64) (bool, error) {
+	var count int
+	err := db.QueryRow(`
+		SELECT COUNT(*)
+		FROM friendships
+		WHERE (user_id = ? AND friend_id = ?) OR (user_id = ? AND friend_id = ?)
+	`, userID, otherID, otherID, userID).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
@@ -0,0 +1,253 @@
+package models
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+// Périodes des classements
+const (
+	LeaderboardDay   = "day"
+	LeaderboardWeek  = "week"
+	LeaderboardMonth = "month"
+	LeaderboardAll   = "all"
+)
+
+// leaderboardDays est le nombre de jours précédant aujourd'hui inclus dans chaque période
+var leaderboardDays = map[string]int{
+	LeaderboardDay:   0,
+	LeaderboardWeek:  6,
+	LeaderboardMonth: 29,
+}
+
+// IsValidLeaderboardPeriod vérifie qu'une période de classement existe
+func IsValidLeaderboardPeriod(period string) bool {
+	_, ok := leaderboardDays[period]
+	return ok || period == LeaderboardAll
+}
+
+// LeaderboardFilter restreint un classement à une période, une catégorie et un tag
+type LeaderboardFilter struct {
+	Period     string
+	CategoryID int64
+	Tag        string
+	Limit      int
+}
+
+// LeaderboardUser est un utilisateur classé avec son score (messages postés ou likes reçus)
+type LeaderboardUser struct {
+	UserID         int64  `json:"user_id"`
+	Username       string `json:"username"`
+	ProfilePicture string `json:"profile_picture"`
+	Score          int    `json:"score"`
+}
+
+// LeaderboardThread est un fil classé avec le nombre de messages postés sur la période
+type LeaderboardThread struct {
+	ThreadID int64  `json:"thread_id"`
+	Title    string `json:"title"`
+	Messages int    `json:"messages"`
+}
+
+// RollupDailyActivity recalcule les agrégats d'une journée (format 2006-01-02) : messages postés et likes
+// reçus (hors likes de l'auteur à lui-même) par auteur et par fil. Les messages en corbeille ne comptent pas.
+func RollupDailyActivity(db *sql.DB, day string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM daily_activity WHERE day = ?", day); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO daily_activity (day, thread_id, user_id, messages, likes)
+		SELECT ?, thread_id, author_id, SUM(messages), SUM(likes) FROM (
+			SELECT m.thread_id, m.author_id, 1 AS messages, 0 AS likes
+			FROM messages m
+			WHERE m.created_at >= ? AND m.created_at < ? + INTERVAL 1 DAY AND m.deleted_at IS NULL
+			UNION ALL
+			SELECT m.thread_id, m.author_id, 0, 1
+			FROM message_reactions mr
+			JOIN messages m ON m.id = mr.message_id
+			WHERE mr.created_at >= ? AND mr.created_at < ? + INTERVAL 1 DAY
+			AND mr.reaction_type = 'like' AND mr.user_id != m.author_id AND m.deleted_at IS NULL
+		) activity
+		GROUP BY thread_id, author_id
+	`, day, day, day, day, day)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RollupRecentActivity recalcule les agrégats des days derniers jours, aujourd'hui compris
+func RollupRecentActivity(db *sql.DB, days int) error {
+	var today time.Time
+	if err := db.QueryRow("SELECT CURDATE()").Scan(&today); err != nil {
+		return err
+	}
+	for i := 0; i < days; i++ {
+		if err := RollupDailyActivity(db, today.AddDate(0, 0, -i).Format("2006-01-02")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InitDailyActivity prépare les agrégats au démarrage : tout l'historique est calculé si la table est vide
+// (première installation ou migration), sinon seules les deux dernières journées sont recalculées
+func InitDailyActivity(db *sql.DB) error {
+	var empty bool
+	if err := db.QueryRow("SELECT NOT EXISTS (SELECT 1 FROM daily_activity)").Scan(&empty); err != nil {
+		return err
+	}
+	if !empty {
+		return RollupRecentActivity(db, 2)
+	}
+	days, err := RebuildDailyActivity(db)
+	if err == nil && days > 0 {
+		log.Printf("Agrégats des classements calculés sur %d journée(s)", days)
+	}
+	return err
+}
+
+// RollupMessageDays recalcule les journées dont les agrégats comptent un message : celle où il a été
+// posté et celles où il a reçu des likes. Appelée quand le message entre ou sort de la corbeille.
+func RollupMessageDays(db *sql.DB, messageID int64) error {
+	rows, err := db.Query(`
+		SELECT DATE_FORMAT(created_at, '%Y-%m-%d') FROM messages WHERE id = ?
+		UNION
+		SELECT DISTINCT DATE_FORMAT(created_at, '%Y-%m-%d') FROM message_reactions
+		WHERE message_id = ? AND reaction_type = 'like'
+	`, messageID, messageID)
+	if err != nil {
+		return err
+	}
+	var days []string
+	for rows.Next() {
+		var day string
+		if err := rows.Scan(&day); err != nil {
+			rows.Close()
+			return err
+		}
+		days = append(days, day)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, day := range days {
+		if err := RollupDailyActivity(db, day); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RebuildDailyActivity recalcule les agrégats de toutes les journées depuis le premier message et
+// retourne le nombre de journées traitées
+func RebuildDailyActivity(db *sql.DB) (int, error) {
+	var days sql.NullInt64
+	if err := db.QueryRow("SELECT DATEDIFF(CURDATE(), MIN(created_at)) FROM messages").Scan(&days); err != nil {
+		return 0, err
+	}
+	if !days.Valid {
+		return 0, nil
+	}
+	count := int(days.Int64) + 1
+	return count, RollupRecentActivity(db, count)
+}
+
+// leaderboardCondition construit la condition commune aux classements (alias a pour daily_activity et t
+// pour threads) : seuls les fils visibles par tous comptent
+func leaderboardCondition(f LeaderboardFilter) (string, []interface{}) {
+	condition, args := visibleThreadCondition("t", 0, "")
+	if days, ok := leaderboardDays[f.Period]; ok {
+		condition += " AND a.day >= CURDATE() - INTERVAL ? DAY"
+		args = append(args, days)
+	}
+	if f.CategoryID != 0 {
+		condition += " AND t.category_id = ?"
+		args = append(args, f.CategoryID)
+	}
+	if f.Tag != "" {
+		condition += " AND FIND_IN_SET(?, LOWER(REPLACE(t.tags, ', ', ','))) > 0"
+		args = append(args, f.Tag)
+	}
+	return condition, args
+}
+
+// topAuthors classe les auteurs selon une colonne de daily_activity (messages ou likes)
+func topAuthors(db *sql.DB, column string, f LeaderboardFilter) ([]*LeaderboardUser, error) {
+	condition, args := leaderboardCondition(f)
+	rows, err := db.Query(`
+		SELECT u.id, u.username, u.profile_picture, SUM(a.`+column+`) AS score
+		FROM daily_activity a
+		JOIN threads t ON t.id = a.thread_id
+		JOIN users u ON u.id = a.user_id AND u.is_banned = false
+		WHERE `+condition+`
+		GROUP BY u.id, u.username, u.profile_picture
+		HAVING score > 0
+		ORDER BY score DESC, u.id
+		LIMIT ?
+	`, append(args, f.Limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*LeaderboardUser{}
+	for rows.Next() {
+		u := &LeaderboardUser{}
+		var profilePicture sql.NullString
+		if err := rows.Scan(&u.UserID, &u.Username, &profilePicture, &u.Score); err != nil {
+			return nil, err
+		}
+		u.ProfilePicture = AvatarURL(u.UserID, profilePicture.String)
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// TopPosters classe les auteurs par nombre de messages postés sur la période
+func TopPosters(db *sql.DB, f LeaderboardFilter) ([]*LeaderboardUser, error) {
+	return topAuthors(db, "messages", f)
+}
+
+// TopLikedAuthors classe les auteurs par nombre de likes reçus sur la période
+func TopLikedAuthors(db *sql.DB, f LeaderboardFilter) ([]*LeaderboardUser, error) {
+	return topAuthors(db, "likes", f)
+}
+
+// TopThreads classe les fils par nombre de messages postés sur la période
+func TopThreads(db *sql.DB, f LeaderboardFilter) ([]*LeaderboardThread, error) {
+	condition, args := leaderboardCondition(f)
+	rows, err := db.Query(`
+		SELECT t.id, t.title, SUM(a.messages) AS messages
+		FROM daily_activity a
+		JOIN threads t ON t.id = a.thread_id
+		WHERE `+condition+`
+		GROUP BY t.id, t.title
+		HAVING messages > 0
+		ORDER BY messages DESC, t.id
+		LIMIT ?
+	`, append(args, f.Limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	threads := []*LeaderboardThread{}
+	for rows.Next() {
+		t := &LeaderboardThread{}
+		if err := rows.Scan(&t.ThreadID, &t.Title, &t.Messages); err != nil {
+			return nil, err
+		}
+		threads = append(threads, t)
+	}
+	return threads, rows.Err()
+}
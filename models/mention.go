@@ -0,0 +1,260 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"projet-forum/utils"
+)
+
+// MaxMentionsPerMessage limite le nombre d'utilisateurs notifiés par un même message
+const MaxMentionsPerMessage = 20
+
+// Un @ précédé d'une lettre ou d'un chiffre (adresse email) n'est pas une mention
+var mentionPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_@.])@([\p{L}\p{N}_.\-]{1,50})`)
+
+// Mention est un utilisateur mentionné dans un message
+type Mention struct {
+	UserID     int64  `json:"user_id"`
+	Username   string `json:"username"`
+	ProfileURL string `json:"profile_url"`
+}
+
+// MentionedMessage est un message où l'utilisateur a été mentionné, avec le titre de son fil
+type MentionedMessage struct {
+	*Message
+	ThreadTitle string `json:"thread_title"`
+}
+
+// ProfileURL retourne l'adresse de la page de profil d'un utilisateur
+func ProfileURL(userID int64) string {
+	return fmt.Sprintf("/users/%d", userID)
+}
+
+// ParseMentions extrait les pseudos mentionnés (@pseudo) d'un contenu Markdown, sans doublons et dans
+// l'ordre ; comme à l'affichage, le code et les liens sont ignorés
+func ParseMentions(content string) []string {
+	seen := make(map[string]bool)
+	names := []string{}
+	for _, match := range mentionPattern.FindAllStringSubmatch(utils.MentionText(content), -1) {
+		// Un point ou un tiret final termine la phrase, il ne fait pas partie du pseudo
+		name := strings.TrimRight(match[1], ".-")
+		key := strings.ToLower(name)
+		if name == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		names = append(names, name)
+		if len(names) == MaxMentionsPerMessage {
+			break
+		}
+	}
+	return names
+}
+
+// ResolveMentions retrouve les utilisateurs correspondant aux pseudos ; les pseudos inconnus sont ignorés
+func ResolveMentions(db *sql.DB, usernames []string) ([]*Mention, error) {
+	mentions := []*Mention{}
+	if len(usernames) == 0 {
+		return mentions, nil
+	}
+
+	args := make([]interface{}, len(usernames))
+	for i, name := range usernames {
+		args[i] = name
+	}
+	rows, err := db.Query("SELECT id, username FROM users WHERE username IN ("+inPlaceholders(len(usernames))+")", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		m := &Mention{}
+		if err := rows.Scan(&m.UserID, &m.Username); err != nil {
+			return nil, err
+		}
+		m.ProfileURL = ProfileURL(m.UserID)
+		mentions = append(mentions, m)
+	}
+	return mentions, rows.Err()
+}
+
+// SetMessageMentions remplace les mentions d'un message et retourne les utilisateurs nouvellement mentionnés
+func SetMessageMentions(db *sql.DB, messageID int64, mentions []*Mention) ([]int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT user_id FROM message_mentions WHERE message_id = ? FOR UPDATE", messageID)
+	if err != nil {
+		return nil, err
+	}
+	existing := make(map[int64]bool)
+	for rows.Next() {
+		var userID int64
+		if err := rows.Scan(&userID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		existing[userID] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	added := []int64{}
+	for _, m := range mentions {
+		if existing[m.UserID] {
+			delete(existing, m.UserID)
+			continue
+		}
+		if _, err := tx.Exec("INSERT INTO message_mentions (message_id, user_id) VALUES (?, ?)", messageID, m.UserID); err != nil {
+			return nil, err
+		}
+		added = append(added, m.UserID)
+	}
+	for userID := range existing {
+		if _, err := tx.Exec("DELETE FROM message_mentions WHERE message_id = ? AND user_id = ?", messageID, userID); err != nil {
+			return nil, err
+		}
+	}
+	return added, tx.Commit()
+}
+
+// GetMentionsForMessages récupère les mentions d'une liste de messages, groupées par message
+func GetMentionsForMessages(db *sql.DB, messageIDs []int64) (map[int64][]*Mention, error) {
+	byMessage := make(map[int64][]*Mention, len(messageIDs))
+	if len(messageIDs) == 0 {
+		return byMessage, nil
+	}
+
+	args := make([]interface{}, len(messageIDs))
+	for i, id := range messageIDs {
+		args[i] = id
+	}
+	rows, err := db.Query(`
+		SELECT mm.message_id, u.id, u.username
+		FROM message_mentions mm
+		JOIN users u ON u.id = mm.user_id
+		WHERE mm.message_id IN (`+inPlaceholders(len(messageIDs))+`)
+		ORDER BY mm.message_id, u.username
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var messageID int64
+		m := &Mention{}
+		if err := rows.Scan(&messageID, &m.UserID, &m.Username); err != nil {
+			return nil, err
+		}
+		m.ProfileURL = ProfileURL(m.UserID)
+		byMessage[messageID] = append(byMessage[messageID], m)
+	}
+	return byMessage, rows.Err()
+}
+
+// LoadMessageMentions ajoute leurs mentions aux messages
+func LoadMessageMentions(db *sql.DB, messages []*Message) error {
+	ids := make([]int64, 0, len(messages))
+	for _, m := range messages {
+		ids = append(ids, m.ID)
+	}
+	byMessage, err := GetMentionsForMessages(db, ids)
+	if err != nil {
+		return err
+	}
+	for _, m := range messages {
+		m.Mentions = byMessage[m.ID]
+	}
+	return nil
+}
+
+// ListUserMentions liste les messages où un utilisateur est mentionné, les plus récents en premier.
+// Seuls les messages des fils qu'il peut voir et d'auteurs qu'il n'a pas bloqués (ni qui l'ont bloqué)
+// sont retournés.
+func ListUserMentions(db *sql.DB, userID int64, role string, page, perPage int) ([]*MentionedMessage, error) {
+	visible, visibleArgs := visibleThreadCondition("t", userID, role)
+	args := append([]interface{}{userID}, visibleArgs...)
+	args = append(args, userID, userID, perPage, (page-1)*perPage)
+
+	rows, err := db.Query(`
+		SELECT `+messageColumns+`, t.title
+		FROM message_mentions mm
+		JOIN messages m ON m.id = mm.message_id
+		JOIN threads t ON t.id = m.thread_id
+		LEFT JOIN users u ON m.author_id = u.id
+		WHERE mm.user_id = ? AND m.deleted_at IS NULL AND `+visible+`
+		AND NOT EXISTS (
+			SELECT 1 FROM friendships b
+			WHERE b.status = 'blocked'
+			AND ((b.user_id = ? AND b.friend_id = m.author_id) OR (b.user_id = m.author_id AND b.friend_id = ?))
+		)
+		ORDER BY m.id DESC
+		LIMIT ? OFFSET ?
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []*MentionedMessage{}
+	for rows.Next() {
+		var title string
+		message, err := scanMessage(scanExtra{rows, []interface{}{&title}})
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, &MentionedMessage{Message: message, ThreadTitle: title})
+	}
+	return messages, rows.Err()
+}
+
+// UserSuggestion est un utilisateur proposé par l'autocomplétion des mentions
+type UserSuggestion struct {
+	ID             int64  `json:"id"`
+	Username       string `json:"username"`
+	ProfilePicture string `json:"profile_picture"`
+}
+
+// SuggestMentions propose jusqu'à limit utilisateurs dont le pseudo commence par prefix, sans les comptes
+// bannis ni les utilisateurs bloqués par (ou ayant bloqué) celui qui écrit
+func SuggestMentions(db *sql.DB, viewerID int64, prefix string, limit int) ([]*UserSuggestion, error) {
+	escaped := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(prefix)
+	rows, err := db.Query(`
+		SELECT u.id, u.username, u.profile_picture
+		FROM users u
+		WHERE u.username LIKE ? AND u.is_banned = false AND u.id != ?
+		AND NOT EXISTS (
+			SELECT 1 FROM friendships b
+			WHERE b.status = 'blocked'
+			AND ((b.user_id = ? AND b.friend_id = u.id) OR (b.user_id = u.id AND b.friend_id = ?))
+		)
+		ORDER BY u.username
+		LIMIT ?
+	`, escaped+"%", viewerID, viewerID, viewerID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	suggestions := []*UserSuggestion{}
+	for rows.Next() {
+		s := &UserSuggestion{}
+		var profilePicture sql.NullString
+		if err := rows.Scan(&s.ID, &s.Username, &profilePicture); err != nil {
+			return nil, err
+		}
+		s.ProfilePicture = AvatarURL(s.ID, profilePicture.String)
+		suggestions = append(suggestions, s)
+	}
+	return suggestions, rows.Err()
+}
@@ -3,20 +3,38 @@ package models
 import (
 	"database/sql"
 	"projet-forum/config"
+	"projet-forum/utils"
+	"sort"
 	"time"
 )
 
 type Message struct {
-	ID        int64     `json:"id"`
-	ThreadID  int64     `json:"thread_id"`
-	AuthorID  int64     `json:"author_id"`
-	Content   string    `json:"content"`
-	ImageURL  string    `json:"image_url,omitempty"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Likes     int       `json:"likes"`
-	Dislikes  int       `json:"dislikes"`
-	Author    *User     `json:"author,omitempty"`
+	ID          int64      `json:"id"`
+	ThreadID    int64      `json:"thread_id"`
+	AuthorID    int64      `json:"author_id"`
+	ParentID    int64      `json:"parent_id,omitempty"`
+	Content     string     `json:"content"`
+	ContentHTML string     `json:"content_html"`
+	ImageURL    string     `json:"image_url,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	EditedAt    *time.Time `json:"edited_at,omitempty"`
+	EditCount   int        `json:"edit_count"`
+	Likes       int        `json:"likes"`
+	Dislikes    int        `json:"dislikes"`
+	ReplyCount  int        `json:"reply_count"`
+	Author      *User      `json:"author,omitempty"`
+
+	// Deleted marque, dans la vue arborescente, un message supprimé conservé pour ses réponses
+	Deleted bool `json:"deleted,omitempty"`
+	// Accepted marque la réponse acceptée d'une question
+	Accepted bool `json:"accepted,omitempty"`
+
+	Attachments []*Attachment      `json:"attachments,omitempty"`
+	Quotes      []*MessageQuote    `json:"quotes,omitempty"`
+	Mentions    []*Mention         `json:"mentions,omitempty"`
+	Reactions   []*ReactionSummary `json:"reactions,omitempty"`
+	Replies     []*Message         `json:"replies,omitempty"`
 }
 
 // TableName retourne le nom de la table pour le modèle Message
@@ -24,56 +42,131 @@ func (Message) TableName() string {
 	return "messages"
 }
 
-// GetMessage récupère un message par son ID
-func GetMessage(db *sql.DB, id int64) (*Message, error) {
-	query := `
-		SELECT m.id, m.thread_id, m.author_id, m.content, m.image_url, m.created_at, m.updated_at, m.likes, m.dislikes,
-		       u.username, u.email, u.role
-		FROM messages m
-		LEFT JOIN users u ON m.author_id = u.id
-		WHERE m.id = ?
-	`
+// messageColumns liste les colonnes lues par scanMessage ; la requête doit joindre users u
+const messageColumns = `m.id, m.thread_id, m.author_id, COALESCE(m.parent_id, 0), m.content, COALESCE(m.content_html, ''),
+	COALESCE(m.image_url, ''),
+	m.created_at, m.updated_at, m.edited_at, m.edit_count, m.likes, m.dislikes,
+	(SELECT COUNT(*) FROM messages r WHERE r.parent_id = m.id AND r.deleted_at IS NULL),
+	u.username, u.email, u.role, u.profile_picture, COALESCE(u.reputation, 0)`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanMessage(row rowScanner) (*Message, error) {
 	message := &Message{}
 	var author User
-	err := db.QueryRow(query, id).Scan(
+	var username, email, role, profilePicture sql.NullString
+	var editedAt sql.NullTime
+	err := row.Scan(
 		&message.ID,
 		&message.ThreadID,
 		&message.AuthorID,
+		&message.ParentID,
 		&message.Content,
+		&message.ContentHTML,
 		&message.ImageURL,
 		&message.CreatedAt,
 		&message.UpdatedAt,
+		&editedAt,
+		&message.EditCount,
 		&message.Likes,
 		&message.Dislikes,
-		&author.Username,
-		&author.Email,
-		&author.Role,
+		&message.ReplyCount,
+		&username,
+		&email,
+		&role,
+		&profilePicture,
+		&author.Reputation,
 	)
 	if err != nil {
 		return nil, err
 	}
+	author.ID = message.AuthorID
+	author.Username, author.Email, author.Role = username.String, email.String, role.String
+	author.ProfilePicture = AvatarURL(author.ID, profilePicture.String)
 	message.Author = &author
+	if editedAt.Valid {
+		message.EditedAt = &editedAt.Time
+	}
+	// Messages enregistrés avant le rendu Markdown
+	if message.ContentHTML == "" && message.Content != "" {
+		message.ContentHTML = utils.RenderMessageMarkdown(message.Content, message.ID)
+	}
 	return message, nil
 }
 
-// UpdateMessage met à jour un message
+func scanMessages(rows *sql.Rows) ([]*Message, error) {
+	defer rows.Close()
+
+	var messages []*Message
+	for rows.Next() {
+		message, err := scanMessage(rows)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, message)
+	}
+	return messages, rows.Err()
+}
+
+// scanExtra lit des colonnes supplémentaires placées après messageColumns
+type scanExtra struct {
+	row   rowScanner
+	extra []interface{}
+}
+
+func (s scanExtra) Scan(dest ...interface{}) error {
+	return s.row.Scan(append(dest, s.extra...)...)
+}
+
+// GetMessage récupère un message par son ID
+func GetMessage(db *sql.DB, id int64) (*Message, error) {
+	query := `
+		SELECT ` + messageColumns + `
+		FROM messages m
+		LEFT JOIN users u ON m.author_id = u.id
+		WHERE m.id = ? AND m.deleted_at IS NULL
+	`
+	return scanMessage(db.QueryRow(query, id))
+}
+
+// UpdateMessage met à jour le contenu d'un message ; les compteurs de votes ne sont modifiés que par
+// ToggleMessageVote et SetMessageVote
 func (m *Message) UpdateMessage(db *sql.DB) error {
 	query := `
 		UPDATE messages
-		SET content = ?, image_url = ?, likes = ?, dislikes = ?, updated_at = CURRENT_TIMESTAMP
+		SET content = ?, content_html = ?, image_url = ?, updated_at = CURRENT_TIMESTAMP
 		WHERE id = ?
 	`
-	_, err := db.Exec(query, m.Content, m.ImageURL, m.Likes, m.Dislikes, m.ID)
+	m.ContentHTML = utils.RenderMessageMarkdown(m.Content, m.ID)
+	_, err := db.Exec(query, m.Content, m.ContentHTML, m.ImageURL, m.ID)
 	return err
 }
 
-// CreateMessage crée un nouveau message
-func CreateMessage(db *sql.DB, threadID, authorID int64, content, imageURL string) (*Message, error) {
+// MessageExtras sont les citations et pièces jointes enregistrées avec un message. AttachmentQuota est
+// l'espace autorisé à l'auteur en octets (négatif : illimité), vérifié à l'insertion des pièces jointes.
+type MessageExtras struct {
+	Quotes          []*MessageQuote
+	Attachments     []*Attachment
+	AttachmentQuota int64
+}
+
+// CreateMessage crée un nouveau message, éventuellement en réponse à parentID (0 pour aucun), avec ses
+// citations et ses pièces jointes, et incrémente les compteurs de messages du fil et de l'auteur dans la
+// même transaction ; un quota dépassé annule tout l'envoi (ErrQuotaExceeded)
+func CreateMessage(db *sql.DB, threadID, authorID, parentID int64, content, imageURL string, extras MessageExtras) (*Message, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
 	query := `
-		INSERT INTO messages (thread_id, author_id, content, image_url, created_at, updated_at)
-		VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		INSERT INTO messages (thread_id, author_id, parent_id, content, image_url, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
 	`
-	result, err := db.Exec(query, threadID, authorID, content, imageURL)
+	result, err := tx.Exec(query, threadID, authorID, nullableID(parentID), content, imageURL)
 	if err != nil {
 		return nil, err
 	}
@@ -83,84 +176,161 @@ func CreateMessage(db *sql.DB, threadID, authorID int64, content, imageURL strin
 		return nil, err
 	}
 
-	// Mettre à jour le compteur de messages du fil de discussion
-	_, err = db.Exec("UPDATE threads SET message_count = message_count + 1 WHERE id = ?", threadID)
+	// Le rendu dépend de l'ID du message (ancres des lignes de code, liens vers la version brute)
+	_, err = tx.Exec("UPDATE messages SET content_html = ? WHERE id = ?", utils.RenderMessageMarkdown(content, id), id)
 	if err != nil {
 		return nil, err
 	}
 
-	// Mettre à jour le compteur de messages de l'auteur
-	_, err = db.Exec("UPDATE users SET message_count = message_count + 1 WHERE id = ?", authorID)
-	if err != nil {
+	if err := addMessageCounts(tx, threadID, authorID, 1); err != nil {
+		return nil, err
+	}
+	if err := insertMessageQuotes(tx, id, extras.Quotes); err != nil {
+		return nil, err
+	}
+	for _, a := range extras.Attachments {
+		a.MessageID = id
+	}
+	if err := insertAttachments(tx, authorID, extras.AttachmentQuota, extras.Attachments); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
 		return nil, err
 	}
 
-	return GetMessage(db, id)
+	message, err := GetMessage(db, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(extras.Quotes) > 0 {
+		message.Quotes = extras.Quotes
+	}
+	if len(extras.Attachments) > 0 {
+		message.Attachments = extras.Attachments
+	}
+	return message, nil
 }
 
-// DeleteMessage supprime un message
+// DeleteMessage supprime définitivement un message ; s'il n'était pas en corbeille, les compteurs de
+// son fil et de son auteur sont décrémentés dans la même transaction
 func DeleteMessage(db *sql.DB, id int64) error {
-	query := `DELETE FROM messages WHERE id = ?`
-	_, err := db.Exec(query, id)
-	return err
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var threadID, authorID int64
+	var deletedAt sql.NullTime
+	err = tx.QueryRow("SELECT thread_id, author_id, deleted_at FROM messages WHERE id = ? FOR UPDATE", id).Scan(&threadID, &authorID, &deletedAt)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM messages WHERE id = ?", id); err != nil {
+		return err
+	}
+	if !deletedAt.Valid {
+		if err := addMessageCounts(tx, threadID, authorID, -1); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
 }
 
 // ListMessages récupère la liste des messages d'un fil de discussion
 func ListMessages(db *sql.DB, threadID int64, page, perPage int, sortBy string) ([]*Message, error) {
 	offset := (page - 1) * perPage
-	var orderBy string
 
+	query := `
+		SELECT ` + messageColumns + `
+		FROM messages m
+		LEFT JOIN users u ON m.author_id = u.id
+		WHERE m.thread_id = ? AND m.deleted_at IS NULL
+		ORDER BY ` + messageOrder(sortBy) + `
+		LIMIT ? OFFSET ?
+	`
+
+	rows, err := db.Query(query, threadID, perPage, offset)
+	if err != nil {
+		return nil, err
+	}
+	return scanMessages(rows)
+}
+
+func messageOrder(sortBy string) string {
 	switch sortBy {
 	case "likes":
-		orderBy = "m.likes - m.dislikes DESC"
+		return "m.likes - m.dislikes DESC, m.id ASC"
 	case "oldest":
-		orderBy = "m.created_at ASC"
+		return "m.created_at ASC, m.id ASC"
 	default:
-		orderBy = "m.created_at DESC"
+		return "m.created_at DESC, m.id DESC"
 	}
+}
 
-	query := `
-		SELECT m.id, m.thread_id, m.author_id, m.content, m.image_url, m.created_at, m.updated_at, m.likes, m.dislikes,
-		       u.username, u.email, u.role
+// GetMessagesByIDs récupère des messages d'un fil, y compris ceux en corbeille (la vue
+// arborescente les affiche vidés quand ils ont encore des réponses), indexés par ID
+func GetMessagesByIDs(db *sql.DB, threadID int64, ids []int64) (map[int64]*Message, error) {
+	byID := make(map[int64]*Message, len(ids))
+	if len(ids) == 0 {
+		return byID, nil
+	}
+
+	args := []interface{}{threadID}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+	rows, err := db.Query(`
+		SELECT `+messageColumns+`
 		FROM messages m
 		LEFT JOIN users u ON m.author_id = u.id
-		WHERE m.thread_id = ?
-		ORDER BY ` + orderBy + `
-		LIMIT ? OFFSET ?
-	`
+		WHERE m.thread_id = ? AND m.id IN (`+inPlaceholders(len(ids))+`)
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	messages, err := scanMessages(rows)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range messages {
+		byID[m.ID] = m
+	}
+	return byID, nil
+}
 
-	rows, err := db.Query(query, threadID, perPage, offset)
+// MessageNode est un message du fil réduit à sa place dans l'arborescence
+type MessageNode struct {
+	ID       int64
+	ParentID int64
+	Deleted  bool
+}
+
+// GetThreadMessageNodes récupère la structure de tous les messages d'un fil, corbeille comprise
+func GetThreadMessageNodes(db *sql.DB, threadID int64, sortBy string) ([]MessageNode, error) {
+	rows, err := db.Query(`
+		SELECT m.id, COALESCE(m.parent_id, 0), m.deleted_at IS NOT NULL
+		FROM messages m
+		WHERE m.thread_id = ?
+		ORDER BY `+messageOrder(sortBy), threadID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var messages []*Message
+	nodes := []MessageNode{}
 	for rows.Next() {
-		message := &Message{}
-		var author User
-		err := rows.Scan(
-			&message.ID,
-			&message.ThreadID,
-			&message.AuthorID,
-			&message.Content,
-			&message.ImageURL,
-			&message.CreatedAt,
-			&message.UpdatedAt,
-			&message.Likes,
-			&message.Dislikes,
-			&author.Username,
-			&author.Email,
-			&author.Role,
-		)
-		if err != nil {
+		var n MessageNode
+		if err := rows.Scan(&n.ID, &n.ParentID, &n.Deleted); err != nil {
 			return nil, err
 		}
-		message.Author = &author
-		messages = append(messages, message)
+		nodes = append(nodes, n)
 	}
-
-	return messages, nil
+	return nodes, rows.Err()
 }
 
 // GetMessagesByThreadID récupère tous les messages d'un fil de discussion
@@ -176,8 +346,9 @@ func GetMessagesByThreadID(threadID int, limit, offset int, sortBy string) ([]*M
 	}
 
 	query := `
-		SELECT * FROM messages 
-		WHERE thread_id = ?
+		SELECT id, thread_id, author_id, content, COALESCE(image_url, ''), created_at, updated_at, likes, dislikes
+		FROM messages
+		WHERE thread_id = ? AND deleted_at IS NULL
 		ORDER BY ` + orderBy + `
 		LIMIT ? OFFSET ?`
 
@@ -212,8 +383,9 @@ func GetMessagesByThreadID(threadID int, limit, offset int, sortBy string) ([]*M
 // GetMessagesByAuthorID récupère les messages d'un auteur
 func GetMessagesByAuthorID(authorID, limit, offset int) ([]*Message, error) {
 	query := `
-		SELECT * FROM messages 
-		WHERE author_id = ?
+		SELECT id, thread_id, author_id, content, COALESCE(image_url, ''), created_at, updated_at, likes, dislikes
+		FROM messages
+		WHERE author_id = ? AND deleted_at IS NULL
 		ORDER BY created_at DESC
 		LIMIT ? OFFSET ?`
 
@@ -244,3 +416,107 @@ func GetMessagesByAuthorID(authorID, limit, offset int) ([]*Message, error) {
 	}
 	return messages, nil
 }
+
+// ListMessageTree récupère une page de messages de premier niveau d'un fil avec toutes leurs réponses
+// imbriquées dans Replies (du plus ancien au plus récent). Un message en corbeille qui a encore des
+// réponses visibles est gardé, vidé et marqué Deleted ; une réponse dont le parent a été purgé remonte
+// au premier niveau. Retourne les racines de la page, tous les messages de la page à plat et le nombre
+// total de racines.
+func ListMessageTree(db *sql.DB, threadID int64, page, perPage int, sortBy string) (roots, all []*Message, total int, err error) {
+	nodes, err := GetThreadMessageNodes(db, threadID, sortBy)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	deleted := make(map[int64]bool, len(nodes))
+	for _, n := range nodes {
+		deleted[n.ID] = n.Deleted
+	}
+	children := make(map[int64][]int64)
+	var rootIDs []int64
+	for _, n := range nodes {
+		if _, ok := deleted[n.ParentID]; ok && n.ParentID != n.ID {
+			children[n.ParentID] = append(children[n.ParentID], n.ID)
+		} else {
+			rootIDs = append(rootIDs, n.ID)
+		}
+	}
+	for _, ids := range children {
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	}
+
+	// Un message est affiché s'il n'est pas en corbeille ou si l'une de ses réponses est affichée
+	kept := make(map[int64]bool, len(nodes))
+	var keep func(id int64) bool
+	keep = func(id int64) bool {
+		if k, ok := kept[id]; ok {
+			return k
+		}
+		k := !deleted[id]
+		for _, child := range children[id] {
+			if keep(child) {
+				k = true
+			}
+		}
+		kept[id] = k
+		return k
+	}
+	var keptRoots []int64
+	for _, id := range rootIDs {
+		if keep(id) {
+			keptRoots = append(keptRoots, id)
+		}
+	}
+
+	total = len(keptRoots)
+	start := (page - 1) * perPage
+	if start > total {
+		start = total
+	}
+	end := start + perPage
+	if end > total {
+		end = total
+	}
+	pageRoots := keptRoots[start:end]
+
+	var ids []int64
+	var collect func(id int64)
+	collect = func(id int64) {
+		ids = append(ids, id)
+		for _, child := range children[id] {
+			if kept[child] {
+				collect(child)
+			}
+		}
+	}
+	for _, id := range pageRoots {
+		collect(id)
+	}
+
+	byID, err := GetMessagesByIDs(db, threadID, ids)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	for _, id := range ids {
+		m, ok := byID[id]
+		if !ok {
+			continue
+		}
+		if deleted[id] {
+			*m = Message{ID: m.ID, ThreadID: m.ThreadID, ParentID: m.ParentID, CreatedAt: m.CreatedAt, ReplyCount: m.ReplyCount, Deleted: true}
+		}
+		for _, child := range children[id] {
+			if c, ok := byID[child]; ok && kept[child] {
+				m.Replies = append(m.Replies, c)
+			}
+		}
+		all = append(all, m)
+	}
+	roots = []*Message{}
+	for _, id := range pageRoots {
+		if m, ok := byID[id]; ok {
+			roots = append(roots, m)
+		}
+	}
+	return roots, all, total, nil
+}
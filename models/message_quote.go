@@ -0,0 +1,182 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Limites des citations d'un message
+const (
+	MaxQuotesPerMessage = 5
+	MaxQuoteLength      = 1000
+)
+
+// État d'une citation par rapport au message cité
+const (
+	QuoteCurrent = "current" // le message cité n'a pas changé depuis la citation
+	QuoteEdited  = "edited"  // le message cité a été modifié depuis
+	QuoteDeleted = "deleted" // le message cité a été supprimé ; seule la copie reste
+)
+
+var (
+	ErrTooManyQuotes = fmt.Errorf("too many quotes (max %d)", MaxQuotesPerMessage)
+	ErrQuoteTooLong  = fmt.Errorf("quoted text too long (max %d characters)", MaxQuoteLength)
+	ErrQuoteEmpty    = errors.New("quoted text is required")
+	ErrQuoteNotFound = errors.New("quoted message not found in this thread")
+	ErrQuoteMismatch = errors.New("quoted text does not appear in the quoted message")
+)
+
+// MessageQuote est un fragment d'un autre message du fil, copié au moment de la citation
+type MessageQuote struct {
+	ID              int64     `json:"id"`
+	MessageID       int64     `json:"-"`
+	QuotedMessageID int64     `json:"quoted_message_id,omitempty"`
+	QuotedAuthorID  int64     `json:"quoted_author_id,omitempty"`
+	QuotedAuthor    string    `json:"quoted_author,omitempty"`
+	QuotedVersion   int       `json:"quoted_version"`
+	Content         string    `json:"content"`
+	Status          string    `json:"status"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// QuoteInput est une citation demandée à la création d'un message
+type QuoteInput struct {
+	MessageID int64  `json:"message_id"`
+	Text      string `json:"text"`
+}
+
+// IsQuoteError indique si une erreur vient de citations invalides (et non de la base)
+func IsQuoteError(err error) bool {
+	switch err {
+	case ErrTooManyQuotes, ErrQuoteTooLong, ErrQuoteEmpty, ErrQuoteNotFound, ErrQuoteMismatch:
+		return true
+	}
+	return false
+}
+
+// PrepareQuotes vérifie les citations demandées : le message cité doit être visible dans le même fil
+// et contenir le fragment. La version citée est celle que le message porte à cet instant.
+func PrepareQuotes(db *sql.DB, threadID int64, inputs []QuoteInput) ([]*MessageQuote, error) {
+	if len(inputs) > MaxQuotesPerMessage {
+		return nil, ErrTooManyQuotes
+	}
+
+	quotes := make([]*MessageQuote, 0, len(inputs))
+	for _, input := range inputs {
+		text := strings.TrimSpace(input.Text)
+		if text == "" {
+			return nil, ErrQuoteEmpty
+		}
+		if utf8.RuneCountInString(text) > MaxQuoteLength {
+			return nil, ErrQuoteTooLong
+		}
+
+		quoted, err := GetMessage(db, input.MessageID)
+		if err == sql.ErrNoRows || (err == nil && quoted.ThreadID != threadID) {
+			return nil, ErrQuoteNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !strings.Contains(quoted.Content, text) {
+			return nil, ErrQuoteMismatch
+		}
+
+		quotes = append(quotes, &MessageQuote{
+			QuotedMessageID: quoted.ID,
+			QuotedAuthorID:  quoted.AuthorID,
+			QuotedAuthor:    quoted.Author.Username,
+			QuotedVersion:   quoted.EditCount + 1,
+			Content:         text,
+			Status:          QuoteCurrent,
+		})
+	}
+	return quotes, nil
+}
+
+// insertMessageQuotes enregistre les citations d'un message dans la transaction de sa création
+func insertMessageQuotes(tx *sql.Tx, messageID int64, quotes []*MessageQuote) error {
+	for _, q := range quotes {
+		result, err := tx.Exec(`
+			INSERT INTO message_quotes (message_id, quoted_message_id, quoted_author_id, quoted_version, content)
+			VALUES (?, ?, ?, ?, ?)
+		`, messageID, q.QuotedMessageID, nullableID(q.QuotedAuthorID), q.QuotedVersion, q.Content)
+		if err != nil {
+			return err
+		}
+		if q.ID, err = result.LastInsertId(); err != nil {
+			return err
+		}
+		q.MessageID = messageID
+		q.CreatedAt = time.Now()
+	}
+	return nil
+}
+
+// GetQuotesForMessages récupère les citations d'une liste de messages, groupées par message,
+// avec l'état actuel du message cité
+func GetQuotesForMessages(db *sql.DB, messageIDs []int64) (map[int64][]*MessageQuote, error) {
+	byMessage := make(map[int64][]*MessageQuote, len(messageIDs))
+	if len(messageIDs) == 0 {
+		return byMessage, nil
+	}
+
+	args := make([]interface{}, len(messageIDs))
+	for i, id := range messageIDs {
+		args[i] = id
+	}
+	rows, err := db.Query(`
+		SELECT q.id, q.message_id, COALESCE(q.quoted_message_id, 0), COALESCE(q.quoted_author_id, 0),
+		       COALESCE(u.username, ''), q.quoted_version, q.content, q.created_at,
+		       qm.id IS NULL OR qm.deleted_at IS NOT NULL, COALESCE(qm.edit_count, 0) + 1
+		FROM message_quotes q
+		LEFT JOIN messages qm ON qm.id = q.quoted_message_id
+		LEFT JOIN users u ON u.id = q.quoted_author_id
+		WHERE q.message_id IN (`+inPlaceholders(len(messageIDs))+`)
+		ORDER BY q.id
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		q := &MessageQuote{}
+		var deleted bool
+		var currentVersion int
+		if err := rows.Scan(&q.ID, &q.MessageID, &q.QuotedMessageID, &q.QuotedAuthorID, &q.QuotedAuthor,
+			&q.QuotedVersion, &q.Content, &q.CreatedAt, &deleted, &currentVersion); err != nil {
+			return nil, err
+		}
+		switch {
+		case deleted:
+			q.Status = QuoteDeleted
+		case currentVersion != q.QuotedVersion:
+			q.Status = QuoteEdited
+		default:
+			q.Status = QuoteCurrent
+		}
+		byMessage[q.MessageID] = append(byMessage[q.MessageID], q)
+	}
+	return byMessage, rows.Err()
+}
+
+// LoadMessageQuotes ajoute leurs citations aux messages
+func LoadMessageQuotes(db *sql.DB, messages []*Message) error {
+	ids := make([]int64, 0, len(messages))
+	for _, m := range messages {
+		ids = append(ids, m.ID)
+	}
+	byMessage, err := GetQuotesForMessages(db, ids)
+	if err != nil {
+		return err
+	}
+	for _, m := range messages {
+		m.Quotes = byMessage[m.ID]
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package models
+
+import (
+	"database/sql"
+	"projet-forum/utils"
+	"time"
+)
+
+// MessageRevision est une version remplacée d'un message. La version 1 est le texte d'origine ;
+// le texte actuel du message porte le numéro edit_count + 1.
+type MessageRevision struct {
+	ID        int64     `json:"id"`
+	MessageID int64     `json:"message_id"`
+	Version   int       `json:"version"`
+	Content   string    `json:"content"`
+	EditedBy  int64     `json:"edited_by,omitempty"`
+	Editor    string    `json:"editor,omitempty"`
+	CreatedAt time.Time `json:"replaced_at"`
+}
+
+// EditMessage remplace le contenu d'un message et archive l'ancienne version dans la même transaction ;
+// si le contenu est identique, rien n'est enregistré et changed vaut false
+func EditMessage(db *sql.DB, messageID, editorID int64, content string) (changed bool, err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// Verrouiller la ligne : deux modifications simultanées ne doivent pas obtenir le même numéro de version
+	var current string
+	var editCount int
+	err = tx.QueryRow("SELECT content, edit_count FROM messages WHERE id = ? FOR UPDATE", messageID).Scan(&current, &editCount)
+	if err != nil {
+		return false, err
+	}
+	if current == content {
+		return false, nil
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO message_revisions (message_id, version, content, edited_by, created_at)
+		VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)
+	`, messageID, editCount+1, current, nullableID(editorID))
+	if err != nil {
+		return false, err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE messages
+		SET content = ?, content_html = ?, edit_count = edit_count + 1, edited_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, content, utils.RenderMessageMarkdown(content, messageID), messageID)
+	if err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// GetMessageRevisions récupère les versions remplacées d'un message, de la plus ancienne à la plus récente
+func GetMessageRevisions(db *sql.DB, messageID int64) ([]*MessageRevision, error) {
+	rows, err := db.Query(`
+		SELECT r.id, r.message_id, r.version, r.content, COALESCE(r.edited_by, 0), COALESCE(u.username, ''), r.created_at
+		FROM message_revisions r
+		LEFT JOIN users u ON u.id = r.edited_by
+		WHERE r.message_id = ?
+		ORDER BY r.version
+	`, messageID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []*MessageRevision{}
+	for rows.Next() {
+		revision := &MessageRevision{}
+		if err := rows.Scan(&revision.ID, &revision.MessageID, &revision.Version, &revision.Content,
+			&revision.EditedBy, &revision.Editor, &revision.CreatedAt); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+	return revisions, rows.Err()
+}
+
+// GetMessageVersion retourne le texte d'une version d'un message (edit_count + 1 désigne le texte actuel)
+func GetMessageVersion(db *sql.DB, message *Message, version int) (string, error) {
+	if version == message.EditCount+1 {
+		return message.Content, nil
+	}
+	var content string
+	err := db.QueryRow("SELECT content FROM message_revisions WHERE message_id = ? AND version = ?", message.ID, version).Scan(&content)
+	return content, err
+}
@@ -0,0 +1,354 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+type NotificationType string
+
+const (
+	NotificationReply         NotificationType = "reply"
+	NotificationQuote         NotificationType = "quote"
+	NotificationMention       NotificationType = "mention"
+	NotificationReaction      NotificationType = "reaction"
+	NotificationFriendRequest NotificationType = "friend_request"
+	NotificationFriendAccept  NotificationType = "friend_accept"
+	NotificationModeration    NotificationType = "moderation"
+	NotificationBadge         NotificationType = "badge"
+	NotificationAnswer        NotificationType = "answer_accepted"
+)
+
+// NotificationTypes liste les types de notifications configurables par l'utilisateur
+var NotificationTypes = []NotificationType{
+	NotificationReply,
+	NotificationQuote,
+	NotificationMention,
+	NotificationReaction,
+	NotificationFriendRequest,
+	NotificationFriendAccept,
+	NotificationModeration,
+	NotificationBadge,
+	NotificationAnswer,
+}
+
+type Notification struct {
+	ID          int64     `json:"id"`
+	UserID      int64     `json:"user_id"`
+	Type        string    `json:"type"`
+	ActorID     int64     `json:"actor_id,omitempty"`
+	ActorName   string    `json:"actor_username,omitempty"`
+	ActorCount  int       `json:"actor_count"`
+	ThreadID    int64     `json:"thread_id,omitempty"`
+	ThreadTitle string    `json:"thread_title,omitempty"`
+	MessageID   int64     `json:"message_id,omitempty"`
+	Detail      string    `json:"detail,omitempty"`
+	Text        string    `json:"text"`
+	IsRead      bool      `json:"is_read"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// NotificationInput décrit un événement à notifier
+type NotificationInput struct {
+	UserID    int64
+	Type      NotificationType
+	ActorID   int64
+	ThreadID  int64
+	MessageID int64
+	Detail    string
+	// GroupKey regroupe les événements similaires dans une seule notification non lue
+	GroupKey string
+}
+
+// TableName retourne le nom de la table pour le modèle Notification
+func (Notification) TableName() string {
+	return "notifications"
+}
+
+func nullableID(id int64) interface{} {
+	if id == 0 {
+		return nil
+	}
+	return id
+}
+
+func nullableString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// CreateNotification enregistre une notification ; si GroupKey est renseigné et qu'une notification
+// non lue existe déjà pour ce groupe, l'acteur y est ajouté au lieu d'en créer une nouvelle
+func CreateNotification(db *sql.DB, input NotificationInput) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var notificationID int64
+	if input.GroupKey != "" {
+		err = tx.QueryRow(`
+			SELECT id FROM notifications
+			WHERE user_id = ? AND group_key = ? AND is_read = false
+			FOR UPDATE
+		`, input.UserID, input.GroupKey).Scan(&notificationID)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+	}
+
+	if notificationID == 0 {
+		result, err := tx.Exec(`
+			INSERT INTO notifications (user_id, type, actor_id, actor_count, thread_id, message_id, detail, group_key, is_read, created_at, updated_at)
+			VALUES (?, ?, ?, 0, ?, ?, ?, ?, false, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		`, input.UserID, string(input.Type), nullableID(input.ActorID), nullableID(input.ThreadID),
+			nullableID(input.MessageID), nullableString(input.Detail), nullableString(input.GroupKey))
+		if err != nil {
+			return err
+		}
+		notificationID, err = result.LastInsertId()
+		if err != nil {
+			return err
+		}
+	}
+
+	// Un même acteur n'est compté qu'une fois par notification
+	added := int64(1)
+	if input.ActorID != 0 {
+		result, err := tx.Exec(`
+			INSERT IGNORE INTO notification_actors (notification_id, actor_id, created_at)
+			VALUES (?, ?, CURRENT_TIMESTAMP)
+		`, notificationID, input.ActorID)
+		if err != nil {
+			return err
+		}
+		added, err = result.RowsAffected()
+		if err != nil {
+			return err
+		}
+	}
+
+	if added > 0 {
+		_, err = tx.Exec(`
+			UPDATE notifications
+			SET actor_count = actor_count + 1, actor_id = COALESCE(?, actor_id), updated_at = CURRENT_TIMESTAMP
+			WHERE id = ?
+		`, nullableID(input.ActorID), notificationID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ListNotifications récupère les notifications d'un utilisateur, les plus récentes en premier
+func ListNotifications(db *sql.DB, userID int64, page, perPage int, unreadOnly bool) ([]*Notification, error) {
+	offset := (page - 1) * perPage
+
+	query := `
+		SELECT n.id, n.user_id, n.type, n.actor_id, COALESCE(u.username, ''), n.actor_count,
+		       n.thread_id, COALESCE(t.title, ''), n.message_id, COALESCE(n.detail, ''),
+		       n.is_read, n.created_at, n.updated_at
+		FROM notifications n
+		LEFT JOIN users u ON n.actor_id = u.id
+		LEFT JOIN threads t ON n.thread_id = t.id
+		WHERE n.user_id = ?
+	`
+	if unreadOnly {
+		query += " AND n.is_read = false"
+	}
+	query += `
+		ORDER BY n.updated_at DESC, n.id DESC
+		LIMIT ? OFFSET ?
+	`
+
+	rows, err := db.Query(query, userID, perPage, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notifications := []*Notification{}
+	for rows.Next() {
+		n := &Notification{}
+		var actorID, threadID, messageID sql.NullInt64
+		if err := rows.Scan(
+			&n.ID,
+			&n.UserID,
+			&n.Type,
+			&actorID,
+			&n.ActorName,
+			&n.ActorCount,
+			&threadID,
+			&n.ThreadTitle,
+			&messageID,
+			&n.Detail,
+			&n.IsRead,
+			&n.CreatedAt,
+			&n.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		n.ActorID = actorID.Int64
+		n.ThreadID = threadID.Int64
+		n.MessageID = messageID.Int64
+		n.Text = n.describe()
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
+
+// CountUnreadNotifications compte les notifications non lues d'un utilisateur
+func CountUnreadNotifications(db *sql.DB, userID int64) (int, error) {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM notifications WHERE user_id = ? AND is_read = false", userID).Scan(&count)
+	return count, err
+}
+
+// MarkNotificationRead marque une notification de l'utilisateur comme lue
+func MarkNotificationRead(db *sql.DB, userID, notificationID int64) error {
+	result, err := db.Exec("UPDATE notifications SET is_read = true WHERE id = ? AND user_id = ?", notificationID, userID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		// Soit la notification n'existe pas, soit elle était déjà lue
+		var count int
+		if err := db.QueryRow("SELECT COUNT(*) FROM notifications WHERE id = ? AND user_id = ?", notificationID, userID).Scan(&count); err != nil {
+			return err
+		}
+		if count == 0 {
+			return sql.ErrNoRows
+		}
+	}
+	return nil
+}
+
+// MarkAllNotificationsRead marque toutes les notifications de l'utilisateur comme lues
+func MarkAllNotificationsRead(db *sql.DB, userID int64) error {
+	_, err := db.Exec("UPDATE notifications SET is_read = true WHERE user_id = ? AND is_read = false", userID)
+	return err
+}
+
+// GetNotificationPreferences récupère les préférences d'un utilisateur ; un type absent est activé
+func GetNotificationPreferences(db *sql.DB, userID int64) (map[string]bool, error) {
+	prefs := make(map[string]bool, len(NotificationTypes))
+	for _, t := range NotificationTypes {
+		prefs[string(t)] = true
+	}
+
+	rows, err := db.Query("SELECT type, enabled FROM notification_preferences WHERE user_id = ?", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var t string
+		var enabled bool
+		if err := rows.Scan(&t, &enabled); err != nil {
+			return nil, err
+		}
+		prefs[t] = enabled
+	}
+	return prefs, rows.Err()
+}
+
+// SetNotificationPreference active ou désactive un type de notification pour un utilisateur
+func SetNotificationPreference(db *sql.DB, userID int64, notificationType string, enabled bool) error {
+	_, err := db.Exec(`
+		INSERT INTO notification_preferences (user_id, type, enabled)
+		VALUES (?, ?, ?)
+		ON DUPLICATE KEY UPDATE enabled = VALUES(enabled)
+	`, userID, notificationType, enabled)
+	return err
+}
+
+// IsNotificationEnabled vérifie si un utilisateur souhaite recevoir un type de notification
+func IsNotificationEnabled(db *sql.DB, userID int64, notificationType NotificationType) (bool, error) {
+	var enabled bool
+	err := db.QueryRow("SELECT enabled FROM notification_preferences WHERE user_id = ? AND type = ?", userID, string(notificationType)).Scan(&enabled)
+	if err == sql.ErrNoRows {
+		return true, nil
+	}
+	return enabled, err
+}
+
+// IsValidNotificationType vérifie qu'un type de notification existe
+func IsValidNotificationType(t string) bool {
+	for _, known := range NotificationTypes {
+		if string(known) == t {
+			return true
+		}
+	}
+	return false
+}
+
+// describe construit le texte affiché pour la notification
+func (n *Notification) describe() string {
+	actor := n.ActorName
+	if actor == "" {
+		actor = "Quelqu'un"
+	}
+
+	switch NotificationType(n.Type) {
+	case NotificationReply:
+		if n.ActorCount > 1 {
+			return fmt.Sprintf("%s et %d autres personnes ont répondu dans « %s »", actor, n.ActorCount-1, n.ThreadTitle)
+		}
+		return fmt.Sprintf("%s a répondu dans « %s »", actor, n.ThreadTitle)
+	case NotificationQuote:
+		return fmt.Sprintf("%s a cité votre message dans « %s »", actor, n.ThreadTitle)
+	case NotificationMention:
+		return fmt.Sprintf("%s vous a mentionné dans « %s »", actor, n.ThreadTitle)
+	case NotificationReaction:
+		if n.ActorCount > 1 {
+			return fmt.Sprintf("%d personnes ont aimé votre message dans « %s »", n.ActorCount, n.ThreadTitle)
+		}
+		return fmt.Sprintf("%s a aimé votre message dans « %s »", actor, n.ThreadTitle)
+	case NotificationFriendRequest:
+		return fmt.Sprintf("%s vous a envoyé une demande d'ami", actor)
+	case NotificationFriendAccept:
+		return fmt.Sprintf("%s a accepté votre demande d'ami", actor)
+	case NotificationModeration:
+		return describeModeration(n.Detail, n.ThreadTitle)
+	case NotificationAnswer:
+		return fmt.Sprintf("%s a accepté votre réponse dans « %s »", actor, n.ThreadTitle)
+	case NotificationBadge:
+		return fmt.Sprintf("Vous avez obtenu le badge « %s »", n.Detail)
+	}
+	return "Nouvelle notification"
+}
+
+func describeModeration(action, threadTitle string) string {
+	switch action {
+	case "thread_deleted":
+		return "Un modérateur a supprimé votre discussion"
+	case "message_deleted":
+		return fmt.Sprintf("Un modérateur a supprimé votre message dans « %s »", threadTitle)
+	case "user_banned":
+		return "Votre compte a été banni par un modérateur"
+	case "user_unbanned":
+		return "Votre compte a été réactivé par un modérateur"
+	case "thread_open":
+		return fmt.Sprintf("Un modérateur a rouvert votre discussion « %s »", threadTitle)
+	case "thread_closed":
+		return fmt.Sprintf("Un modérateur a fermé votre discussion « %s »", threadTitle)
+	case "thread_archived":
+		return fmt.Sprintf("Un modérateur a archivé votre discussion « %s »", threadTitle)
+	}
+	if threadTitle != "" {
+		return fmt.Sprintf("Un modérateur a modifié votre discussion « %s » (%s)", threadTitle, action)
+	}
+	return "Un modérateur est intervenu sur votre contenu"
+}
@@ -0,0 +1,402 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Limites d'un sondage
+const (
+	PollMinOptions     = 2
+	PollMaxOptions     = 10
+	PollMaxQuestionLen = 255
+	PollMaxOptionLen   = 100
+)
+
+var (
+	ErrPollInvalid      = errors.New("a poll needs a question and between 2 and 10 distinct options")
+	ErrPollClosed       = errors.New("poll is closed")
+	ErrPollInvalidVote  = errors.New("invalid poll options")
+	ErrPollAlreadyVoted = errors.New("votes cannot be changed on this poll")
+)
+
+// PollInput décrit le sondage à créer avec un fil
+type PollInput struct {
+	Question       string     `json:"question"`
+	Options        []string   `json:"options"`
+	MultipleChoice bool       `json:"multiple_choice"`
+	Anonymous      bool       `json:"anonymous"`
+	AllowChange    bool       `json:"allow_change"`
+	ClosesAt       *time.Time `json:"closes_at"`
+}
+
+// Normalize nettoie la question et les choix puis vérifie le sondage ; retourne ErrPollInvalid s'il
+// est incomplet
+func (p *PollInput) Normalize() error {
+	p.Question = strings.TrimSpace(p.Question)
+	if p.Question == "" || len([]rune(p.Question)) > PollMaxQuestionLen {
+		return ErrPollInvalid
+	}
+	seen := make(map[string]bool, len(p.Options))
+	options := make([]string, 0, len(p.Options))
+	for _, option := range p.Options {
+		option = strings.TrimSpace(option)
+		key := strings.ToLower(option)
+		if option == "" || len([]rune(option)) > PollMaxOptionLen || seen[key] {
+			return ErrPollInvalid
+		}
+		seen[key] = true
+		options = append(options, option)
+	}
+	if len(options) < PollMinOptions || len(options) > PollMaxOptions {
+		return ErrPollInvalid
+	}
+	p.Options = options
+	return nil
+}
+
+// PollVoter est un membre ayant choisi une option d'un sondage public
+type PollVoter struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+}
+
+// PollOption est un choix d'un sondage avec son nombre de votes ; Voters n'est renseigné que pour les
+// sondages publics
+type PollOption struct {
+	ID        int64        `json:"id"`
+	Label     string       `json:"label"`
+	Position  int          `json:"position"`
+	VoteCount int          `json:"vote_count"`
+	Voters    []*PollVoter `json:"voters,omitempty"`
+}
+
+// Poll est le sondage d'un fil. Il est figé (Closed) quand le fil n'est plus ouvert ou que sa date de
+// clôture est passée ; MyVotes contient les choix de l'utilisateur qui le consulte.
+type Poll struct {
+	ID             int64         `json:"id"`
+	ThreadID       int64         `json:"thread_id"`
+	Question       string        `json:"question"`
+	MultipleChoice bool          `json:"multiple_choice"`
+	Anonymous      bool          `json:"anonymous"`
+	AllowChange    bool          `json:"allow_change"`
+	ClosesAt       *time.Time    `json:"closes_at"`
+	Closed         bool          `json:"closed"`
+	VoterCount     int           `json:"voter_count"`
+	CreatedAt      time.Time     `json:"created_at"`
+	Options        []*PollOption `json:"options"`
+	MyVotes        []int64       `json:"my_votes"`
+}
+
+// PollOptionCount est le nombre de votes d'un choix
+type PollOptionCount struct {
+	ID        int64 `json:"id"`
+	VoteCount int   `json:"vote_count"`
+}
+
+// PollResults sont les résultats d'un sondage diffusés en direct aux lecteurs du fil
+type PollResults struct {
+	PollID     int64             `json:"poll_id"`
+	Closed     bool              `json:"closed"`
+	VoterCount int               `json:"voter_count"`
+	Options    []PollOptionCount `json:"options"`
+}
+
+// pollClosed est la condition « le sondage est figé » (alias p pour polls et t pour threads)
+const pollClosed = "(t.status != 'open' OR (p.closes_at IS NOT NULL AND p.closes_at <= CURRENT_TIMESTAMP))"
+
+// queryer est implémenté par *sql.DB et *sql.Tx
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// createPoll enregistre le sondage d'un fil et ses choix dans la transaction de création du fil
+func createPoll(tx *sql.Tx, threadID int64, input *PollInput) error {
+	var closesAt interface{}
+	if input.ClosesAt != nil {
+		closesAt = *input.ClosesAt
+	}
+	result, err := tx.Exec(`
+		INSERT INTO polls (thread_id, question, multiple_choice, anonymous, allow_change, closes_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, threadID, input.Question, input.MultipleChoice, input.Anonymous, input.AllowChange, closesAt)
+	if err != nil {
+		return err
+	}
+	pollID, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	for i, label := range input.Options {
+		if _, err := tx.Exec("INSERT INTO poll_options (poll_id, label, position) VALUES (?, ?, ?)", pollID, label, i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetThreadPoll récupère le sondage d'un fil avec les choix de viewerID (0 : visiteur) et, pour un
+// sondage public, les votants de chaque choix. Retourne sql.ErrNoRows si le fil n'a pas de sondage.
+func GetThreadPoll(db *sql.DB, threadID, viewerID int64) (*Poll, error) {
+	p := &Poll{ThreadID: threadID, MyVotes: []int64{}}
+	var closesAt sql.NullTime
+	err := db.QueryRow(`
+		SELECT p.id, p.question, p.multiple_choice, p.anonymous, p.allow_change, p.closes_at,
+		       `+pollClosed+`, p.voter_count, p.created_at
+		FROM polls p
+		JOIN threads t ON t.id = p.thread_id
+		WHERE p.thread_id = ? AND t.deleted_at IS NULL
+	`, threadID).Scan(&p.ID, &p.Question, &p.MultipleChoice, &p.Anonymous, &p.AllowChange, &closesAt,
+		&p.Closed, &p.VoterCount, &p.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if closesAt.Valid {
+		p.ClosesAt = &closesAt.Time
+	}
+
+	rows, err := db.Query(`
+		SELECT id, label, position, vote_count FROM poll_options WHERE poll_id = ? ORDER BY position
+	`, p.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byID := make(map[int64]*PollOption)
+	p.Options = []*PollOption{}
+	for rows.Next() {
+		o := &PollOption{}
+		if err := rows.Scan(&o.ID, &o.Label, &o.Position, &o.VoteCount); err != nil {
+			return nil, err
+		}
+		if !p.Anonymous {
+			o.Voters = []*PollVoter{}
+		}
+		byID[o.ID] = o
+		p.Options = append(p.Options, o)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if viewerID != 0 {
+		if p.MyVotes, err = pollUserVotes(db, p.ID, viewerID); err != nil {
+			return nil, err
+		}
+	}
+	if p.Anonymous {
+		return p, nil
+	}
+
+	voters, err := db.Query(`
+		SELECT v.option_id, u.id, u.username
+		FROM poll_votes v
+		JOIN users u ON u.id = v.user_id
+		WHERE v.poll_id = ?
+		ORDER BY v.created_at, u.id
+	`, p.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer voters.Close()
+	for voters.Next() {
+		var optionID int64
+		voter := &PollVoter{}
+		if err := voters.Scan(&optionID, &voter.ID, &voter.Username); err != nil {
+			return nil, err
+		}
+		if o := byID[optionID]; o != nil {
+			o.Voters = append(o.Voters, voter)
+		}
+	}
+	return p, voters.Err()
+}
+
+// pollUserVotes liste les choix d'un utilisateur dans un sondage
+func pollUserVotes(q queryer, pollID, userID int64) ([]int64, error) {
+	rows, err := q.Query("SELECT option_id FROM poll_votes WHERE poll_id = ? AND user_id = ? ORDER BY option_id", pollID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	options := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		options = append(options, id)
+	}
+	return options, rows.Err()
+}
+
+// GetPollResults retourne les résultats du sondage d'un fil
+func GetPollResults(db *sql.DB, threadID int64) (*PollResults, error) {
+	var pollID int64
+	var closed bool
+	err := db.QueryRow(`
+		SELECT p.id, `+pollClosed+` FROM polls p JOIN threads t ON t.id = p.thread_id WHERE p.thread_id = ?
+	`, threadID).Scan(&pollID, &closed)
+	if err != nil {
+		return nil, err
+	}
+	return pollResults(db, pollID, closed)
+}
+
+func pollResults(q queryer, pollID int64, closed bool) (*PollResults, error) {
+	results := &PollResults{PollID: pollID, Closed: closed, Options: []PollOptionCount{}}
+	if err := q.QueryRow("SELECT voter_count FROM polls WHERE id = ?", pollID).Scan(&results.VoterCount); err != nil {
+		return nil, err
+	}
+	rows, err := q.Query("SELECT id, vote_count FROM poll_options WHERE poll_id = ? ORDER BY position", pollID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var o PollOptionCount
+		if err := rows.Scan(&o.ID, &o.VoteCount); err != nil {
+			return nil, err
+		}
+		results.Options = append(results.Options, o)
+	}
+	return results, rows.Err()
+}
+
+// VotePoll enregistre les choix d'un utilisateur dans le sondage d'un fil, à la place des précédents si
+// le sondage autorise les changements. Retourne sql.ErrNoRows si le fil n'a pas de sondage,
+// ErrPollClosed, ErrPollInvalidVote ou ErrPollAlreadyVoted.
+func VotePoll(db *sql.DB, threadID, userID int64, optionIDs []int64) (*PollResults, error) {
+	if len(optionIDs) == 0 {
+		return nil, ErrPollInvalidVote
+	}
+	return changePollVote(db, threadID, userID, optionIDs)
+}
+
+// RetractPollVote retire les choix d'un utilisateur d'un sondage qui autorise les changements
+func RetractPollVote(db *sql.DB, threadID, userID int64) (*PollResults, error) {
+	return changePollVote(db, threadID, userID, nil)
+}
+
+// changePollVote remplace les choix d'un utilisateur (aucun choix : retrait) et met à jour les compteurs
+// dans une même transaction. La ligne du sondage est verrouillée en premier : les votes simultanés
+// s'exécutent l'un après l'autre, ce qui garantit un seul vote par utilisateur et des compteurs égaux
+// aux votes enregistrés.
+func changePollVote(db *sql.DB, threadID, userID int64, optionIDs []int64) (*PollResults, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var pollID int64
+	var multipleChoice, allowChange, closed bool
+	err = tx.QueryRow(`
+		SELECT p.id, p.multiple_choice, p.allow_change, `+pollClosed+`
+		FROM polls p
+		JOIN threads t ON t.id = p.thread_id
+		WHERE p.thread_id = ? AND t.deleted_at IS NULL
+		FOR UPDATE
+	`, threadID).Scan(&pollID, &multipleChoice, &allowChange, &closed)
+	if err != nil {
+		return nil, err
+	}
+	if closed {
+		return nil, ErrPollClosed
+	}
+
+	chosen := make(map[int64]bool, len(optionIDs))
+	var options []int64
+	for _, id := range optionIDs {
+		if !chosen[id] {
+			chosen[id] = true
+			options = append(options, id)
+		}
+	}
+	if len(options) > 1 && !multipleChoice {
+		return nil, ErrPollInvalidVote
+	}
+	if len(options) > 0 {
+		args := []interface{}{pollID}
+		for _, id := range options {
+			args = append(args, id)
+		}
+		var count int
+		err = tx.QueryRow("SELECT COUNT(*) FROM poll_options WHERE poll_id = ? AND id IN ("+inPlaceholders(len(options))+")", args...).Scan(&count)
+		if err != nil {
+			return nil, err
+		}
+		if count != len(options) {
+			return nil, ErrPollInvalidVote
+		}
+	}
+
+	previous, err := pollUserVotes(tx, pollID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(previous) > 0 && !allowChange {
+		return nil, ErrPollAlreadyVoted
+	}
+
+	unchanged := len(previous) == len(options)
+	for _, id := range previous {
+		unchanged = unchanged && chosen[id]
+	}
+	if !unchanged {
+		if len(previous) > 0 {
+			if _, err := tx.Exec("DELETE FROM poll_votes WHERE poll_id = ? AND user_id = ?", pollID, userID); err != nil {
+				return nil, err
+			}
+			if err := addPollOptionVotes(tx, previous, -1); err != nil {
+				return nil, err
+			}
+		}
+		for _, id := range options {
+			_, err := tx.Exec("INSERT INTO poll_votes (poll_id, user_id, option_id) VALUES (?, ?, ?)", pollID, userID, id)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if err := addPollOptionVotes(tx, options, 1); err != nil {
+			return nil, err
+		}
+
+		voterDelta := 0
+		if len(previous) == 0 {
+			voterDelta = 1
+		} else if len(options) == 0 {
+			voterDelta = -1
+		}
+		if voterDelta != 0 {
+			_, err := tx.Exec("UPDATE polls SET voter_count = GREATEST(voter_count + ?, 0) WHERE id = ?", voterDelta, pollID)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	results, err := pollResults(tx, pollID, false)
+	if err != nil {
+		return nil, err
+	}
+	return results, tx.Commit()
+}
+
+// addPollOptionVotes ajoute delta au nombre de votes des choix donnés
+func addPollOptionVotes(tx execer, optionIDs []int64, delta int) error {
+	if len(optionIDs) == 0 {
+		return nil
+	}
+	args := []interface{}{delta}
+	for _, id := range optionIDs {
+		args = append(args, id)
+	}
+	_, err := tx.Exec("UPDATE poll_options SET vote_count = GREATEST(vote_count + ?, 0) WHERE id IN ("+inPlaceholders(len(optionIDs))+")", args...)
+	return err
+}
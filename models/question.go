@@ -0,0 +1,111 @@
+package models
+
+import (
+	"database/sql"
+)
+
+// Types de fils : une question peut avoir une réponse acceptée
+const (
+	ThreadTypeDiscussion = "discussion"
+	ThreadTypeQuestion   = "question"
+)
+
+// IsValidThreadType vérifie qu'un type de fil existe
+func IsValidThreadType(threadType string) bool {
+	return threadType == ThreadTypeDiscussion || threadType == ThreadTypeQuestion
+}
+
+// acceptedAnswerExists est la condition « la question a une réponse acceptée hors corbeille » pour
+// l'alias de table donné
+func acceptedAnswerExists(alias string) string {
+	return "EXISTS (SELECT 1 FROM messages am WHERE am.id = " + alias + ".accepted_message_id AND am.deleted_at IS NULL)"
+}
+
+// solvedColumn retourne l'expression SQL indiquant si un fil est une question résolue
+func solvedColumn(alias string) string {
+	return "(" + alias + ".thread_type = '" + ThreadTypeQuestion + "' AND " + acceptedAnswerExists(alias) + ")"
+}
+
+// solvedFilter retourne la condition à ajouter à un WHERE pour ne garder que les questions résolues
+// (solved vrai) ou non résolues (solved faux) ; rien si solved est nil
+func solvedFilter(alias string, solved *bool) string {
+	if solved == nil {
+		return ""
+	}
+	condition := " AND " + alias + ".thread_type = '" + ThreadTypeQuestion + "' AND "
+	if !*solved {
+		condition += "NOT "
+	}
+	return condition + acceptedAnswerExists(alias)
+}
+
+// SetAcceptedAnswer marque un message comme réponse acceptée d'une question (0 pour retirer la réponse
+// acceptée). Retourne sql.ErrNoRows si le fil n'est pas une question.
+func SetAcceptedAnswer(db *sql.DB, threadID, messageID int64) error {
+	result, err := db.Exec(`
+		UPDATE threads SET accepted_message_id = ?
+		WHERE id = ? AND thread_type = 'question' AND deleted_at IS NULL
+	`, nullableID(messageID), threadID)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected > 0 {
+		return err
+	}
+	// Aucune ligne modifiée : soit la valeur était déjà la même, soit le fil n'est pas une question
+	var isQuestion bool
+	err = db.QueryRow(`
+		SELECT thread_type = 'question' FROM threads WHERE id = ? AND deleted_at IS NULL
+	`, threadID).Scan(&isQuestion)
+	if err == nil && !isQuestion {
+		err = sql.ErrNoRows
+	}
+	return err
+}
+
+// ListUnansweredQuestions liste les questions visibles par l'utilisateur sans réponse acceptée ni réponse
+// d'un autre membre, les plus anciennes en premier ; categoryID les restreint à une catégorie (0 : toutes)
+func ListUnansweredQuestions(db *sql.DB, userID int64, role string, categoryID int64, page, perPage int) ([]*Thread, int, error) {
+	visible, args := visibleThreadCondition("t", userID, role)
+	condition := visible + ` AND t.thread_type = 'question' AND t.status = 'open' AND NOT ` + acceptedAnswerExists("t") + `
+		AND NOT EXISTS (
+			SELECT 1 FROM messages r WHERE r.thread_id = t.id AND r.author_id != t.author_id AND r.deleted_at IS NULL
+		)`
+	if categoryID != 0 {
+		condition += " AND t.category_id = ?"
+		args = append(args, categoryID)
+	}
+
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM threads t WHERE "+condition, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := db.Query(`
+		SELECT t.id, t.title, t.description, t.tags, t.author_id, COALESCE(t.category_id, 0), t.status, t.visibility,
+		       t.thread_type, t.created_at, t.updated_at, t.message_count, u.id, u.username, u.profile_picture
+		FROM threads t
+		JOIN users u ON u.id = t.author_id
+		WHERE `+condition+`
+		ORDER BY t.created_at ASC, t.id
+		LIMIT ? OFFSET ?
+	`, append(args, perPage, (page-1)*perPage)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	threads := []*Thread{}
+	for rows.Next() {
+		t := &Thread{Author: &User{}}
+		var profilePicture sql.NullString
+		err := rows.Scan(&t.ID, &t.Title, &t.Description, &t.Tags, &t.AuthorID, &t.CategoryID, &t.Status, &t.Visibility,
+			&t.Type, &t.CreatedAt, &t.UpdatedAt, &t.MessageCount, &t.Author.ID, &t.Author.Username, &profilePicture)
+		if err != nil {
+			return nil, 0, err
+		}
+		t.Author.ProfilePicture = AvatarURL(t.Author.ID, profilePicture.String)
+		threads = append(threads, t)
+	}
+	return threads, total, rows.Err()
+}
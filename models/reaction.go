@@ -2,6 +2,7 @@ package models
 
 import (
 	"database/sql"
+	"log"
 	"time"
 )
 
@@ -67,3 +68,158 @@ func UpdateMessageReactionCount(db *sql.DB, messageID int64) error {
 	_, err := db.Exec(query, messageID)
 	return err
 }
+
+// MessageVote est le vote d'un utilisateur sur un message après modification, avec les compteurs à jour
+type MessageVote struct {
+	MessageID int64  `json:"message_id"`
+	Vote      string `json:"vote"`     // like, dislike ou vide si le vote a été retiré
+	Previous  string `json:"previous"` // vote remplacé ou retiré, vide s'il n'y en avait pas
+	Likes     int    `json:"likes"`
+	Dislikes  int    `json:"dislikes"`
+}
+
+// ToggleMessageVote applique un clic sur like ou dislike : sans vote, le vote est ajouté ; sur le même
+// vote, il est retiré ; sur le vote opposé, il est remplacé (like → dislike)
+func ToggleMessageVote(db *sql.DB, messageID, userID int64, voteType string) (*MessageVote, error) {
+	return changeMessageVote(db, messageID, userID, func(current string) string {
+		if current == voteType {
+			return ""
+		}
+		return voteType
+	})
+}
+
+// SetMessageVote remplace le vote d'un utilisateur sur un message (vide pour le retirer)
+func SetMessageVote(db *sql.DB, messageID, userID int64, voteType string) (*MessageVote, error) {
+	return changeMessageVote(db, messageID, userID, func(string) string { return voteType })
+}
+
+// voteColumns associe chaque vote à son compteur dans messages
+var voteColumns = map[string]string{"like": "likes", "dislike": "dislikes"}
+
+// changeMessageVote modifie un vote et les compteurs du message dans une même transaction. La ligne du
+// message est verrouillée en premier : les votes simultanés sur un message s'exécutent l'un après
+// l'autre, ce qui garde likes et dislikes égaux au nombre de votes enregistrés. Retourne sql.ErrNoRows
+// si le message n'existe pas ou est en corbeille. Les agrégats des classements sont ensuite recalculés
+// pour la journée où comptait un like retiré ou remplacé et pour celle d'un nouveau like.
+func changeMessageVote(db *sql.DB, messageID, userID int64, next func(current string) string) (*MessageVote, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	err = tx.QueryRow("SELECT id FROM messages WHERE id = ? AND deleted_at IS NULL FOR UPDATE", messageID).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+
+	vote := &MessageVote{MessageID: messageID}
+	// Journées des agrégats à recalculer : celle où comptait le like retiré, celle du nouveau like
+	var previousDay string
+	var days []string
+	err = tx.QueryRow(`
+		SELECT reaction_type, DATE_FORMAT(created_at, '%Y-%m-%d')
+		FROM message_reactions WHERE message_id = ? AND user_id = ? FOR UPDATE
+	`, messageID, userID).Scan(&vote.Previous, &previousDay)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	vote.Vote = next(vote.Previous)
+
+	if vote.Vote != vote.Previous {
+		switch {
+		case vote.Previous == "":
+			_, err = tx.Exec(`
+				INSERT INTO message_reactions (message_id, user_id, reaction_type, created_at)
+				VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+			`, messageID, userID, vote.Vote)
+		case vote.Vote == "":
+			_, err = tx.Exec("DELETE FROM message_reactions WHERE message_id = ? AND user_id = ?", messageID, userID)
+		default:
+			_, err = tx.Exec(`
+				UPDATE message_reactions SET reaction_type = ?, created_at = CURRENT_TIMESTAMP
+				WHERE message_id = ? AND user_id = ?
+			`, vote.Vote, messageID, userID)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if column, ok := voteColumns[vote.Previous]; ok {
+			if _, err := tx.Exec("UPDATE messages SET "+column+" = GREATEST("+column+" - 1, 0) WHERE id = ?", messageID); err != nil {
+				return nil, err
+			}
+		}
+		if column, ok := voteColumns[vote.Vote]; ok {
+			if _, err := tx.Exec("UPDATE messages SET "+column+" = "+column+" + 1 WHERE id = ?", messageID); err != nil {
+				return nil, err
+			}
+		}
+
+		if vote.Previous == "like" {
+			days = append(days, previousDay)
+		}
+		if vote.Vote == "like" {
+			var today string
+			if err := tx.QueryRow("SELECT DATE_FORMAT(CURRENT_TIMESTAMP, '%Y-%m-%d')").Scan(&today); err != nil {
+				return nil, err
+			}
+			days = append(days, today)
+		}
+	}
+
+	err = tx.QueryRow("SELECT likes, dislikes FROM messages WHERE id = ?", messageID).Scan(&vote.Likes, &vote.Dislikes)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	// En cas d'échec, le recalcul périodique corrigera les journées récentes
+	for _, day := range days {
+		if err := RollupDailyActivity(db, day); err != nil {
+			log.Printf("Erreur lors du recalcul des agrégats du %s: %v", day, err)
+		}
+	}
+	return vote, nil
+}
+
+// ReconcileReactionCounts recalcule les likes et dislikes de tous les messages à partir des votes
+// enregistrés, par lots de batchSize messages. Retourne le nombre de messages recalculés.
+func ReconcileReactionCounts(db *sql.DB, batchSize int) (int, error) {
+	var lastID int64
+	count := 0
+	for {
+		rows, err := db.Query("SELECT id FROM messages WHERE id > ? ORDER BY id LIMIT ?", lastID, batchSize)
+		if err != nil {
+			return count, err
+		}
+		var ids []int64
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return count, err
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return count, err
+		}
+		if len(ids) == 0 {
+			return count, nil
+		}
+
+		for _, id := range ids {
+			if err := UpdateMessageReactionCount(db, id); err != nil {
+				return count, err
+			}
+			count++
+		}
+		lastID = ids[len(ids)-1]
+	}
+}
@@ -0,0 +1,104 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"time"
+)
+
+// ReputationRules décrit le calcul de la réputation à partir des réactions reçues
+type ReputationRules struct {
+	LikeWeight    float64       // points par like reçu
+	DislikeWeight float64       // points par dislike reçu (négatif pour pénaliser)
+	EmojiWeight   float64       // points par message ayant reçu au moins une réaction emoji d'un votant
+	HalfLife      time.Duration // une réaction perd la moitié de son poids après HalfLife (0 : pas de décroissance)
+	VoterCap      float64       // points qu'un même votant peut au plus donner ou retirer à un auteur (0 : sans limite)
+}
+
+// reputationScores construit la requête des scores de réputation par auteur. Les réactions de l'auteur
+// à ses propres messages, celles des comptes bannis et celles des messages en corbeille ne comptent pas.
+// Les points d'un même votant sont plafonnés pour qu'un groupe de comptes ne puisse pas faire ou défaire
+// une réputation à lui seul. authorFilter restreint le calcul (ex. « AND m.author_id = ? »).
+func reputationScores(rules ReputationRules, authorFilter string) (string, []interface{}) {
+	decay := "1"
+	var decayArgs []interface{}
+	if rules.HalfLife > 0 {
+		decay = "POW(0.5, TIMESTAMPDIFF(SECOND, v.created_at, CURRENT_TIMESTAMP) / ?)"
+		decayArgs = []interface{}{rules.HalfLife.Seconds()}
+	}
+	capped := "points"
+	var capArgs []interface{}
+	if rules.VoterCap > 0 {
+		capped = "LEAST(GREATEST(points, ?), ?)"
+		capArgs = []interface{}{-rules.VoterCap, rules.VoterCap}
+	}
+
+	query := fmt.Sprintf(`
+		SELECT author_id, SUM(%s) AS score FROM (
+			SELECT v.author_id, v.voter_id, SUM(v.weight * %s) AS points
+			FROM (
+				SELECT m.author_id, mr.user_id AS voter_id, mr.created_at,
+					CASE mr.reaction_type WHEN 'like' THEN ? ELSE ? END AS weight
+				FROM message_reactions mr
+				JOIN messages m ON m.id = mr.message_id
+				WHERE m.deleted_at IS NULL AND mr.user_id != m.author_id %[3]s
+				UNION ALL
+				SELECT m.author_id, er.user_id, MIN(er.created_at), ?
+				FROM message_emoji_reactions er
+				JOIN messages m ON m.id = er.message_id
+				WHERE m.deleted_at IS NULL AND er.user_id != m.author_id %[3]s
+				GROUP BY m.author_id, er.user_id, er.message_id
+			) v
+			JOIN users voter ON voter.id = v.voter_id AND voter.is_banned = false
+			GROUP BY v.author_id, v.voter_id
+		) per_voter
+		GROUP BY author_id
+	`, capped, decay, authorFilter)
+
+	args := append([]interface{}{}, capArgs...)
+	args = append(args, decayArgs...)
+	args = append(args, rules.LikeWeight, rules.DislikeWeight)
+	return query, args
+}
+
+// RefreshUserReputation recalcule et enregistre la réputation d'un utilisateur (jamais négative)
+func RefreshUserReputation(db *sql.DB, rules ReputationRules, userID int64) (int, error) {
+	query, args := reputationScores(rules, "AND m.author_id = ?")
+	args = append(args, userID, rules.EmojiWeight, userID)
+
+	var score sql.NullFloat64
+	err := db.QueryRow(query, args...).Scan(new(int64), &score)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, err
+	}
+	reputation := 0
+	if score.Float64 > 0 {
+		reputation = int(math.Round(score.Float64))
+	}
+	_, err = db.Exec("UPDATE users SET reputation = ? WHERE id = ?", reputation, userID)
+	return reputation, err
+}
+
+// RefreshAllReputations recalcule la réputation de tous les utilisateurs, ce qui applique la
+// décroissance des réactions anciennes. Retourne le nombre de réputations modifiées.
+func RefreshAllReputations(db *sql.DB, rules ReputationRules) (int64, error) {
+	query, args := reputationScores(rules, "")
+	args = append(args, rules.EmojiWeight)
+	result, err := db.Exec(`
+		UPDATE users u
+		LEFT JOIN (`+query+`) r ON r.author_id = u.id
+		SET u.reputation = GREATEST(ROUND(COALESCE(r.score, 0)), 0)
+	`, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// GetUserReputation retourne la réputation enregistrée d'un utilisateur
+func GetUserReputation(db *sql.DB, userID int64) (int, error) {
+	var reputation int
+	err := db.QueryRow("SELECT reputation FROM users WHERE id = ?", userID).Scan(&reputation)
+	return reputation, err
+}
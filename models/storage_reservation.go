@@ -0,0 +1,82 @@
+package models
+
+import (
+	"context"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+// StorageReservationTTL est la durée pendant laquelle une réservation protège un fichier : un envoi
+// référence ses fichiers en base bien avant son expiration
+const StorageReservationTTL = time.Hour
+
+// Délai d'attente du verrou d'une clé de stockage, en secondes
+const storageLockTimeout = 10
+
+var ErrStorageKeyLocked = errors.New("storage key is locked")
+
+// WithStorageKeyLock exécute fn en détenant un verrou MySQL nommé propre à la clé. Les réservations et
+// les suppressions d'une même clé s'exécutent ainsi l'une après l'autre : une suppression qui vérifie
+// que la clé n'est plus utilisée ne peut pas s'intercaler entre la réservation d'un envoi et sa
+// vérification de l'existence du fichier.
+func WithStorageKeyLock(db *sql.DB, key string, fn func() error) error {
+	ctx := context.Background()
+	// GET_LOCK appartient à la connexion : elle est gardée jusqu'à la libération du verrou
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	sum := sha1.Sum([]byte(key))
+	name := "storage:" + hex.EncodeToString(sum[:])
+	var acquired sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", name, storageLockTimeout).Scan(&acquired); err != nil {
+		return err
+	}
+	if acquired.Int64 != 1 {
+		return ErrStorageKeyLocked
+	}
+	defer func() {
+		var released sql.NullInt64
+		conn.QueryRowContext(ctx, "SELECT RELEASE_LOCK(?)", name).Scan(&released)
+	}()
+
+	return fn()
+}
+
+// ReserveStorageKey réserve une clé de stockage avant l'enregistrement d'un fichier et retourne
+// l'identifiant de la réservation. La clé reste considérée comme utilisée jusqu'à la libération de la
+// réservation, une fois le fichier référencé en base ou abandonné, et au plus StorageReservationTTL.
+func ReserveStorageKey(db *sql.DB, key string) (int64, error) {
+	var id int64
+	err := WithStorageKeyLock(db, key, func() error {
+		result, err := db.Exec("INSERT INTO storage_reservations (storage_key, created_at) VALUES (?, CURRENT_TIMESTAMP)", key)
+		if err != nil {
+			return err
+		}
+		id, err = result.LastInsertId()
+		return err
+	})
+	return id, err
+}
+
+// ReleaseStorageReservation supprime une réservation ; un identifiant nul est ignoré
+func ReleaseStorageReservation(db *sql.DB, id int64) error {
+	if id == 0 {
+		return nil
+	}
+	_, err := db.Exec("DELETE FROM storage_reservations WHERE id = ?", id)
+	return err
+}
+
+// PurgeStorageReservations supprime les réservations expirées
+func PurgeStorageReservations(db *sql.DB) error {
+	_, err := db.Exec(`
+		DELETE FROM storage_reservations WHERE created_at < CURRENT_TIMESTAMP - INTERVAL ? SECOND
+	`, int(StorageReservationTTL.Seconds()))
+	return err
+}
@@ -0,0 +1,478 @@
+package models
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+type WatchLevel string
+
+const (
+	// WatchWatching notifie chaque nouvelle réponse (in-app et email)
+	WatchWatching WatchLevel = "watching"
+	// WatchTracking affiche le fil dans les non-lus sans notifier les réponses
+	WatchTracking WatchLevel = "tracking"
+	// WatchNormal ne notifie que les mentions et citations
+	WatchNormal WatchLevel = "normal"
+	// WatchMuted ne notifie plus rien pour le fil
+	WatchMuted WatchLevel = "muted"
+)
+
+// IsValidWatchLevel vérifie qu'un niveau de suivi existe
+func IsValidWatchLevel(level string) bool {
+	switch WatchLevel(level) {
+	case WatchWatching, WatchTracking, WatchNormal, WatchMuted:
+		return true
+	}
+	return false
+}
+
+// rank ordonne les niveaux du plus faible au plus fort suivi
+func (l WatchLevel) rank() int {
+	switch l {
+	case WatchWatching:
+		return 2
+	case WatchTracking:
+		return 1
+	}
+	return 0
+}
+
+// Sources possibles du niveau de suivi effectif d'un fil
+const (
+	WatchSourceThread   = "thread"
+	WatchSourceCategory = "category"
+	WatchSourceTag      = "tag"
+	WatchSourceDefault  = "default"
+)
+
+// resolveWatchLevel calcule le niveau effectif : un choix sur le fil l'emporte, sinon une catégorie
+// ou un tag en sourdine coupe tout, sinon le niveau le plus fort entre la catégorie et les tags
+func resolveWatchLevel(thread, category *WatchLevel, tags []WatchLevel) (WatchLevel, string) {
+	if thread != nil {
+		return *thread, WatchSourceThread
+	}
+
+	level, source := WatchNormal, WatchSourceDefault
+	if category != nil {
+		if *category == WatchMuted {
+			return WatchMuted, WatchSourceCategory
+		}
+		level, source = *category, WatchSourceCategory
+	}
+	for _, tagLevel := range tags {
+		if tagLevel == WatchMuted {
+			return WatchMuted, WatchSourceTag
+		}
+		if tagLevel.rank() > level.rank() {
+			level, source = tagLevel, WatchSourceTag
+		}
+	}
+	return level, source
+}
+
+// NormalizeTag met un tag sous sa forme canonique (minuscules, sans espaces autour)
+func NormalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+// ThreadTags retourne les tags normalisés d'un fil (stockés séparés par des virgules)
+func ThreadTags(thread *Thread) []string {
+	tags := []string{}
+	for _, tag := range strings.Split(thread.Tags, ",") {
+		if tag = NormalizeTag(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// inPlaceholders construit la liste « ?, ?, ? » d'une clause IN
+func inPlaceholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// AutoWatchThread suit un fil à la création ou à la première réponse, sans écraser un choix existant
+func AutoWatchThread(db *sql.DB, userID, threadID int64) error {
+	_, err := db.Exec(`
+		INSERT IGNORE INTO thread_subscriptions (user_id, thread_id, level, created_at)
+		VALUES (?, ?, 'watching', CURRENT_TIMESTAMP)
+	`, userID, threadID)
+	return err
+}
+
+// SetThreadWatchLevel fixe le niveau de suivi d'un fil pour un utilisateur
+func SetThreadWatchLevel(db *sql.DB, userID, threadID int64, level WatchLevel) error {
+	_, err := db.Exec(`
+		INSERT INTO thread_subscriptions (user_id, thread_id, level, created_at)
+		VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+		ON DUPLICATE KEY UPDATE level = VALUES(level)
+	`, userID, threadID, string(level))
+	return err
+}
+
+// ClearThreadWatchLevel supprime le choix explicite : le fil hérite de sa catégorie et de ses tags
+func ClearThreadWatchLevel(db *sql.DB, userID, threadID int64) error {
+	_, err := db.Exec("DELETE FROM thread_subscriptions WHERE user_id = ? AND thread_id = ?", userID, threadID)
+	return err
+}
+
+// SetCategoryWatchLevel fixe le niveau de suivi d'une catégorie ; « normal » supprime le suivi
+func SetCategoryWatchLevel(db *sql.DB, userID, categoryID int64, level WatchLevel) error {
+	if level == WatchNormal {
+		_, err := db.Exec("DELETE FROM category_follows WHERE user_id = ? AND category_id = ?", userID, categoryID)
+		return err
+	}
+	_, err := db.Exec(`
+		INSERT INTO category_follows (user_id, category_id, level, created_at)
+		VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+		ON DUPLICATE KEY UPDATE level = VALUES(level)
+	`, userID, categoryID, string(level))
+	return err
+}
+
+// SetTagWatchLevel fixe le niveau de suivi d'un tag ; « normal » supprime le suivi
+func SetTagWatchLevel(db *sql.DB, userID int64, tag string, level WatchLevel) error {
+	tag = NormalizeTag(tag)
+	if level == WatchNormal {
+		_, err := db.Exec("DELETE FROM tag_follows WHERE user_id = ? AND tag = ?", userID, tag)
+		return err
+	}
+	_, err := db.Exec(`
+		INSERT INTO tag_follows (user_id, tag, level, created_at)
+		VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+		ON DUPLICATE KEY UPDATE level = VALUES(level)
+	`, userID, tag, string(level))
+	return err
+}
+
+type CategoryWatch struct {
+	CategoryID int64  `json:"category_id"`
+	Name       string `json:"name"`
+	Level      string `json:"level"`
+}
+
+type TagWatch struct {
+	Tag   string `json:"tag"`
+	Level string `json:"level"`
+}
+
+// GetWatches récupère les catégories et tags suivis (ou mis en sourdine) par un utilisateur
+func GetWatches(db *sql.DB, userID int64) ([]CategoryWatch, []TagWatch, error) {
+	categories := []CategoryWatch{}
+	rows, err := db.Query(`
+		SELECT f.category_id, c.name, f.level
+		FROM category_follows f
+		JOIN categories c ON f.category_id = c.id
+		WHERE f.user_id = ?
+		ORDER BY c.name
+	`, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var w CategoryWatch
+		if err := rows.Scan(&w.CategoryID, &w.Name, &w.Level); err != nil {
+			return nil, nil, err
+		}
+		categories = append(categories, w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	tags := []TagWatch{}
+	tagRows, err := db.Query("SELECT tag, level FROM tag_follows WHERE user_id = ? ORDER BY tag", userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tagRows.Close()
+	for tagRows.Next() {
+		var w TagWatch
+		if err := tagRows.Scan(&w.Tag, &w.Level); err != nil {
+			return nil, nil, err
+		}
+		tags = append(tags, w)
+	}
+	return categories, tags, tagRows.Err()
+}
+
+// GetThreadWatchLevel calcule le niveau de suivi effectif d'un fil pour un utilisateur et sa source
+func GetThreadWatchLevel(db *sql.DB, userID int64, thread *Thread) (WatchLevel, string, error) {
+	var threadLevel, categoryLevel *WatchLevel
+
+	var level string
+	err := db.QueryRow("SELECT level FROM thread_subscriptions WHERE user_id = ? AND thread_id = ?", userID, thread.ID).Scan(&level)
+	if err != nil && err != sql.ErrNoRows {
+		return "", "", err
+	}
+	if err == nil {
+		l := WatchLevel(level)
+		threadLevel = &l
+	}
+
+	if thread.CategoryID != 0 {
+		err = db.QueryRow("SELECT level FROM category_follows WHERE user_id = ? AND category_id = ?", userID, thread.CategoryID).Scan(&level)
+		if err != nil && err != sql.ErrNoRows {
+			return "", "", err
+		}
+		if err == nil {
+			l := WatchLevel(level)
+			categoryLevel = &l
+		}
+	}
+
+	var tagLevels []WatchLevel
+	if tags := ThreadTags(thread); len(tags) > 0 {
+		args := []interface{}{userID}
+		for _, tag := range tags {
+			args = append(args, tag)
+		}
+		rows, err := db.Query("SELECT level FROM tag_follows WHERE user_id = ? AND tag IN ("+inPlaceholders(len(tags))+")", args...)
+		if err != nil {
+			return "", "", err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			if err := rows.Scan(&level); err != nil {
+				return "", "", err
+			}
+			tagLevels = append(tagLevels, WatchLevel(level))
+		}
+		if err := rows.Err(); err != nil {
+			return "", "", err
+		}
+	}
+
+	effective, source := resolveWatchLevel(threadLevel, categoryLevel, tagLevels)
+	return effective, source, nil
+}
+
+// GetThreadWatchers récupère les utilisateurs dont le niveau effectif sur le fil vaut level
+func GetThreadWatchers(db *sql.DB, thread *Thread, level WatchLevel) ([]int64, error) {
+	threadLevels := make(map[int64]*WatchLevel)
+	categoryLevels := make(map[int64]*WatchLevel)
+	tagLevels := make(map[int64][]WatchLevel)
+
+	collect := func(query string, args []interface{}, add func(userID int64, l WatchLevel)) error {
+		rows, err := db.Query(query, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var userID int64
+			var l string
+			if err := rows.Scan(&userID, &l); err != nil {
+				return err
+			}
+			add(userID, WatchLevel(l))
+		}
+		return rows.Err()
+	}
+
+	err := collect("SELECT user_id, level FROM thread_subscriptions WHERE thread_id = ?", []interface{}{thread.ID},
+		func(userID int64, l WatchLevel) { threadLevels[userID] = &l })
+	if err != nil {
+		return nil, err
+	}
+
+	if thread.CategoryID != 0 {
+		err = collect("SELECT user_id, level FROM category_follows WHERE category_id = ?", []interface{}{thread.CategoryID},
+			func(userID int64, l WatchLevel) { categoryLevels[userID] = &l })
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if tags := ThreadTags(thread); len(tags) > 0 {
+		args := []interface{}{}
+		for _, tag := range tags {
+			args = append(args, tag)
+		}
+		err = collect("SELECT user_id, level FROM tag_follows WHERE tag IN ("+inPlaceholders(len(tags))+")", args,
+			func(userID int64, l WatchLevel) { tagLevels[userID] = append(tagLevels[userID], l) })
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	candidates := make(map[int64]bool)
+	for userID := range threadLevels {
+		candidates[userID] = true
+	}
+	for userID := range categoryLevels {
+		candidates[userID] = true
+	}
+	for userID := range tagLevels {
+		candidates[userID] = true
+	}
+
+	watchers := []int64{}
+	for userID := range candidates {
+		if effective, _ := resolveWatchLevel(threadLevels[userID], categoryLevels[userID], tagLevels[userID]); effective == level {
+			watchers = append(watchers, userID)
+		}
+	}
+	return watchers, nil
+}
+
+// Subscriber représente un destinataire d'emails pour un fil de discussion
+type Subscriber struct {
+	UserID   int64
+	Username string
+	Email    string
+	Role     string
+}
+
+// GetReplyEmailSubscribers filtre les utilisateurs qui acceptent les emails de réponse
+// (les utilisateurs bannis sont exclus)
+func GetReplyEmailSubscribers(db *sql.DB, userIDs []int64) ([]*Subscriber, error) {
+	subscribers := []*Subscriber{}
+	if len(userIDs) == 0 {
+		return subscribers, nil
+	}
+
+	args := make([]interface{}, len(userIDs))
+	for i, id := range userIDs {
+		args[i] = id
+	}
+	rows, err := db.Query(`
+		SELECT u.id, u.username, u.email, u.role
+		FROM users u
+		LEFT JOIN email_preferences p ON p.user_id = u.id
+		WHERE u.id IN (`+inPlaceholders(len(userIDs))+`) AND u.is_banned = false
+		AND COALESCE(p.reply_emails, true) = true
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		s := &Subscriber{}
+		if err := rows.Scan(&s.UserID, &s.Username, &s.Email, &s.Role); err != nil {
+			return nil, err
+		}
+		subscribers = append(subscribers, s)
+	}
+	return subscribers, rows.Err()
+}
+
+// WatchedThread est un fil suivi contenant des messages non lus ; Level est vide quand
+// le fil est suivi via sa catégorie ou ses tags
+type WatchedThread struct {
+	ID          int64     `json:"id"`
+	Title       string    `json:"title"`
+	CategoryID  int64     `json:"category_id,omitempty"`
+	Level       string    `json:"level,omitempty"`
+	UnreadCount int       `json:"unread_count"`
+	LastPostAt  time.Time `json:"last_post_at"`
+}
+
+// followedThreadCondition sélectionne les fils suivis via leur catégorie ou leurs tags (watching
+// ou tracking), en excluant ceux dont la catégorie ou un tag est en sourdine ; 4 paramètres userID
+const followedThreadCondition = `
+	(
+		(
+			t.category_id IN (SELECT category_id FROM category_follows WHERE user_id = ? AND level IN ('watching', 'tracking'))
+			OR EXISTS (
+				SELECT 1 FROM tag_follows tf
+				WHERE tf.user_id = ? AND tf.level IN ('watching', 'tracking')
+				AND FIND_IN_SET(tf.tag, LOWER(REPLACE(t.tags, ', ', ','))) > 0
+			)
+		)
+		AND NOT EXISTS (SELECT 1 FROM category_follows cm WHERE cm.user_id = ? AND cm.category_id = t.category_id AND cm.level = 'muted')
+		AND NOT EXISTS (
+			SELECT 1 FROM tag_follows tm
+			WHERE tm.user_id = ? AND tm.level = 'muted'
+			AND FIND_IN_SET(tm.tag, LOWER(REPLACE(t.tags, ', ', ','))) > 0
+		)
+	)`
+
+// watchedThreadCondition ajoute les fils suivis explicitement (alias s pour thread_subscriptions)
+const watchedThreadCondition = `(s.level IN ('watching', 'tracking') OR (s.level IS NULL AND ` + followedThreadCondition + `))`
+
+// ListUnreadWatchedThreads récupère les fils suivis ayant des messages non lus, les plus récents en premier
+func ListUnreadWatchedThreads(db *sql.DB, userID int64, role string, page, perPage int) ([]*WatchedThread, error) {
+	offset := (page - 1) * perPage
+	visibility, visibilityArgs := visibleThreadCondition("t", userID, role)
+
+	query := `
+		SELECT t.id, t.title, COALESCE(t.category_id, 0), COALESCE(s.level, ''), COUNT(m.id), MAX(m.created_at)
+		FROM threads t
+		LEFT JOIN thread_subscriptions s ON s.thread_id = t.id AND s.user_id = ?` + readPointerJoin + `
+		JOIN messages m ON m.thread_id = t.id AND m.id > ` + readPointerExpr + ` AND m.author_id != ? AND m.deleted_at IS NULL
+		WHERE ` + watchedThreadCondition + `
+		AND ` + visibility + `
+		GROUP BY t.id, t.title, t.category_id, s.level
+		ORDER BY MAX(m.id) DESC
+		LIMIT ? OFFSET ?
+	`
+	args := []interface{}{userID, userID, userID, userID, userID, userID, userID, userID}
+	args = append(args, visibilityArgs...)
+	args = append(args, perPage, offset)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	threads := []*WatchedThread{}
+	for rows.Next() {
+		t := &WatchedThread{}
+		if err := rows.Scan(&t.ID, &t.Title, &t.CategoryID, &t.Level, &t.UnreadCount, &t.LastPostAt); err != nil {
+			return nil, err
+		}
+		threads = append(threads, t)
+	}
+	return threads, rows.Err()
+}
+
+// DigestThread résume un fil de discussion pour un email de digest
+type DigestThread struct {
+	ID           int64
+	Title        string
+	Description  string
+	AuthorID     int64
+	AuthorName   string
+	CategoryName string
+	NewMessages  int
+}
+
+// GetDigestThreads récupère les fils publics les plus actifs depuis since, dans les catégories
+// et tags suivis par l'utilisateur (hors fils, catégories et tags mis en sourdine)
+func GetDigestThreads(db *sql.DB, userID int64, since time.Time, limit int) ([]*DigestThread, error) {
+	rows, err := db.Query(`
+		SELECT t.id, t.title, t.description, t.author_id, u.username, COALESCE(c.name, ''), COUNT(m.id) AS new_messages
+		FROM threads t
+		JOIN users u ON t.author_id = u.id
+		LEFT JOIN categories c ON t.category_id = c.id
+		LEFT JOIN messages m ON m.thread_id = t.id AND m.created_at >= ? AND m.deleted_at IS NULL
+		LEFT JOIN thread_subscriptions s ON s.thread_id = t.id AND s.user_id = ?
+		WHERE t.visibility = 'public' AND t.status != 'archived' AND t.deleted_at IS NULL
+		AND (t.created_at >= ? OR m.id IS NOT NULL)
+		AND COALESCE(s.level, '') != 'muted'
+		AND `+followedThreadCondition+`
+		GROUP BY t.id, t.title, t.description, t.author_id, u.username, c.name
+		ORDER BY new_messages DESC, t.created_at DESC
+		LIMIT ?
+	`, since, userID, since, userID, userID, userID, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	threads := []*DigestThread{}
+	for rows.Next() {
+		t := &DigestThread{}
+		if err := rows.Scan(&t.ID, &t.Title, &t.Description, &t.AuthorID, &t.AuthorName, &t.CategoryName, &t.NewMessages); err != nil {
+			return nil, err
+		}
+		threads = append(threads, t)
+	}
+	return threads, rows.Err()
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"projet-forum/config"
+	"strings"
 	"time"
 )
 
@@ -16,6 +17,15 @@ const (
 	ThreadArchived ThreadStatus = "archived"
 )
 
+// IsValidThreadStatus vérifie qu'un statut de fil existe
+func IsValidThreadStatus(status string) bool {
+	switch ThreadStatus(status) {
+	case ThreadOpen, ThreadClosed, ThreadArchived:
+		return true
+	}
+	return false
+}
+
 type ThreadVisibility string
 
 const (
@@ -24,18 +34,22 @@ const (
 )
 
 type Thread struct {
-	ID           int64     `json:"id"`
-	Title        string    `json:"title"`
-	Description  string    `json:"description"`
-	Tags         string    `json:"tags"`
-	AuthorID     int64     `json:"author_id"`
-	Status       string    `json:"status"`
-	Visibility   string    `json:"visibility"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
-	MessageCount int       `json:"message_count"`
-	ViewCount    int       `json:"view_count"`
-	Author       *User     `json:"author,omitempty"`
+	ID          int64  `json:"id"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Tags        string `json:"tags"`
+	AuthorID    int64  `json:"author_id"`
+	CategoryID  int64  `json:"category_id,omitempty"`
+	Status      string `json:"status"`
+	Visibility  string `json:"visibility"`
+	Type        string `json:"type"`
+	// AcceptedMessageID est la réponse acceptée d'une question (0 si aucune, ou si elle est en corbeille)
+	AcceptedMessageID int64     `json:"accepted_message_id,omitempty"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+	MessageCount      int       `json:"message_count"`
+	ViewCount         int       `json:"view_count"`
+	Author            *User     `json:"author,omitempty"`
 }
 
 // TableName retourne le nom de la table pour le modèle Thread
@@ -43,8 +57,9 @@ func (Thread) TableName() string {
 	return "threads"
 }
 
-// CreateThread crée un nouveau fil de discussion
-func CreateThread(db *sql.DB, title, description string, authorID int64, tags []string) (*Thread, error) {
+// CreateThread crée un nouveau fil de discussion (ThreadTypeDiscussion ou ThreadTypeQuestion), avec son
+// sondage éventuel (poll peut être nil), et incrémente le compteur de fils de son auteur
+func CreateThread(db *sql.DB, title, description string, authorID, categoryID int64, tags []string, threadType string, poll *PollInput) (*Thread, error) {
 	tagsStr := ""
 	if len(tags) > 0 {
 		for i, tag := range tags {
@@ -55,11 +70,17 @@ func CreateThread(db *sql.DB, title, description string, authorID int64, tags []
 		}
 	}
 
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
 	query := `
-		INSERT INTO threads (title, description, tags, author_id, status, visibility, created_at, updated_at)
-		VALUES (?, ?, ?, ?, 'open', 'public', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		INSERT INTO threads (title, description, tags, author_id, category_id, status, visibility, thread_type, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, 'open', 'public', ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
 	`
-	result, err := db.Exec(query, title, description, tagsStr, authorID)
+	result, err := tx.Exec(query, title, description, tagsStr, authorID, nullableID(categoryID), threadType)
 	if err != nil {
 		return nil, err
 	}
@@ -69,7 +90,28 @@ func CreateThread(db *sql.DB, title, description string, authorID int64, tags []
 		return nil, err
 	}
 
-	return GetThread(db, id)
+	// Incrémenter le compteur de fils de l'auteur dans la même transaction
+	if err := addThreadCount(tx, id, 1); err != nil {
+		return nil, err
+	}
+	if poll != nil {
+		if err := createPoll(tx, id, poll); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	thread, err := GetThread(db, id)
+	if err != nil {
+		return nil, err
+	}
+	// Sans version initiale, la première modification enregistrera l'état d'origine sans auteur
+	if err := createInitialThreadRevision(db, thread); err != nil {
+		log.Printf("Erreur lors de l'enregistrement de la version initiale du fil %d: %v", id, err)
+	}
+	return thread, nil
 }
 
 // GetThread récupère un fil de discussion par son ID
@@ -77,15 +119,17 @@ func GetThread(db *sql.DB, id int64) (*Thread, error) {
 	log.Printf("[DEBUG] GetThread (model) - Début de la fonction pour l'ID: %d", id)
 
 	query := `
-		SELECT t.id, t.title, t.description, t.tags, t.author_id, t.status, t.visibility, t.created_at, t.updated_at,
+		SELECT t.id, t.title, t.description, t.tags, t.author_id, COALESCE(t.category_id, 0), t.status, t.visibility,
+			   t.thread_type, COALESCE(am.id, 0), t.created_at, t.updated_at,
 			   COUNT(DISTINCT m.id) as message_count,
 			   u.username, u.email, u.role
 		FROM threads t
-		LEFT JOIN messages m ON t.id = m.thread_id
+		LEFT JOIN messages m ON t.id = m.thread_id AND m.deleted_at IS NULL
+		LEFT JOIN messages am ON am.id = t.accepted_message_id AND am.deleted_at IS NULL
 		LEFT JOIN users u ON t.author_id = u.id
-		WHERE t.id = ?
-		GROUP BY t.id, t.title, t.description, t.tags, t.author_id, t.status, t.visibility, t.created_at, t.updated_at,
-				 u.username, u.email, u.role
+		WHERE t.id = ? AND t.deleted_at IS NULL
+		GROUP BY t.id, t.title, t.description, t.tags, t.author_id, t.category_id, t.status, t.visibility,
+				 t.thread_type, am.id, t.created_at, t.updated_at, u.username, u.email, u.role
 	`
 	log.Printf("[DEBUG] GetThread (model) - Requête SQL: %s", query)
 
@@ -99,8 +143,11 @@ func GetThread(db *sql.DB, id int64) (*Thread, error) {
 		&thread.Description,
 		&thread.Tags,
 		&thread.AuthorID,
+		&thread.CategoryID,
 		&thread.Status,
 		&thread.Visibility,
+		&thread.Type,
+		&thread.AcceptedMessageID,
 		&thread.CreatedAt,
 		&thread.UpdatedAt,
 		&thread.MessageCount,
@@ -141,7 +188,8 @@ func (t *Thread) UpdateThread(db *sql.DB) error {
 	return err
 }
 
-// DeleteThread supprime un fil de discussion
+// DeleteThread supprime définitivement un fil de discussion et ses messages, en décrémentant les
+// compteurs de leurs auteurs
 func DeleteThread(db *sql.DB, id int64) error {
 	tx, err := db.Begin()
 	if err != nil {
@@ -149,6 +197,35 @@ func DeleteThread(db *sql.DB, id int64) error {
 	}
 	defer tx.Rollback()
 
+	var deletedAt sql.NullTime
+	err = tx.QueryRow("SELECT deleted_at FROM threads WHERE id = ? FOR UPDATE", id).Scan(&deletedAt)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// Un fil en corbeille n'est déjà plus compté pour son auteur
+	if !deletedAt.Valid {
+		if err := addThreadCount(tx, id, -1); err != nil {
+			return err
+		}
+	}
+
+	// Retirer les messages hors corbeille du compteur de chaque auteur
+	_, err = tx.Exec(`
+		UPDATE users u
+		JOIN (
+			SELECT author_id, COUNT(*) AS n FROM messages
+			WHERE thread_id = ? AND deleted_at IS NULL
+			GROUP BY author_id
+		) c ON c.author_id = u.id
+		SET u.message_count = GREATEST(u.message_count - c.n, 0)
+	`, id)
+	if err != nil {
+		return err
+	}
+
 	// Supprimer d'abord les messages associés
 	_, err = tx.Exec("DELETE FROM messages WHERE thread_id = ?", id)
 	if err != nil {
@@ -164,15 +241,17 @@ func DeleteThread(db *sql.DB, id int64) error {
 	return tx.Commit()
 }
 
-// ListThreads récupère une liste de fils de discussion
-func ListThreads(db *sql.DB, page, limit int, status, visibility string) ([]map[string]interface{}, error) {
+// ListThreads récupère une liste de fils de discussion ; si solved n'est pas nil, seules les questions
+// résolues (ou non résolues) sont retournées
+func ListThreads(db *sql.DB, page, limit int, status, visibility string, solved *bool) ([]map[string]interface{}, error) {
 	offset := (page - 1) * limit
 	query := `
-		SELECT t.id, t.title, t.description, t.tags, t.status, t.visibility, t.created_at, t.message_count,
+		SELECT t.id, t.title, t.description, t.tags, t.status, t.visibility, t.thread_type, ` + solvedColumn("t") + `,
+			   t.created_at, t.message_count,
 			   u.id as author_id, u.username as author_username, u.email as author_email, u.role as author_role
 		FROM threads t
 		JOIN users u ON t.author_id = u.id
-		WHERE t.status = ? AND t.visibility = ?
+		WHERE t.status = ? AND t.visibility = ? AND t.deleted_at IS NULL` + solvedFilter("t", solved) + `
 		ORDER BY t.created_at DESC
 		LIMIT ? OFFSET ?
 	`
@@ -196,6 +275,8 @@ func ListThreads(db *sql.DB, page, limit int, status, visibility string) ([]map[
 			Tags         string `json:"tags"`
 			Status       string `json:"status"`
 			Visibility   string `json:"visibility"`
+			Type         string `json:"type"`
+			Solved       bool   `json:"solved"`
 			CreatedAt    string `json:"created_at"`
 			MessageCount int    `json:"message_count"`
 			AuthorID     int64  `json:"author_id"`
@@ -210,6 +291,8 @@ func ListThreads(db *sql.DB, page, limit int, status, visibility string) ([]map[
 			&thread.Tags,
 			&thread.Status,
 			&thread.Visibility,
+			&thread.Type,
+			&thread.Solved,
 			&thread.CreatedAt,
 			&thread.MessageCount,
 			&thread.AuthorID,
@@ -231,6 +314,8 @@ func ListThreads(db *sql.DB, page, limit int, status, visibility string) ([]map[
 			"tags":          thread.Tags,
 			"status":        thread.Status,
 			"visibility":    thread.Visibility,
+			"type":          thread.Type,
+			"solved":        thread.Solved,
 			"created_at":    thread.CreatedAt,
 			"message_count": thread.MessageCount,
 			"author": map[string]interface{}{
@@ -252,21 +337,24 @@ func UpdateThreadStatus(db *sql.DB, id int64, status string) error {
 	return err
 }
 
-// SearchThreads recherche des fils de discussion
-func SearchThreads(db *sql.DB, query string, page, perPage int) ([]*Thread, error) {
+// SearchThreads recherche des fils de discussion ; si solved n'est pas nil, seules les questions
+// résolues (ou non résolues) sont retournées
+func SearchThreads(db *sql.DB, query string, page, perPage int, solved *bool) ([]*Thread, error) {
 	offset := (page - 1) * perPage
 	searchPattern := "%" + query + "%"
 
 	sqlQuery := `
-		SELECT t.id, t.title, t.description, t.tags, t.author_id, t.status, t.visibility, t.created_at, t.updated_at,
+		SELECT t.id, t.title, t.description, t.tags, t.author_id, t.status, t.visibility, t.thread_type,
+		       COALESCE(am.id, 0), t.created_at, t.updated_at,
 		       COUNT(m.id) as message_count,
 		       u.username, u.email, u.role
 		FROM threads t
-		LEFT JOIN messages m ON t.id = m.thread_id
+		LEFT JOIN messages m ON t.id = m.thread_id AND m.deleted_at IS NULL
+		LEFT JOIN messages am ON am.id = t.accepted_message_id AND am.deleted_at IS NULL
 		LEFT JOIN users u ON t.author_id = u.id
 		WHERE (t.title LIKE ? OR t.description LIKE ? OR FIND_IN_SET(?, t.tags))
-		AND t.status != 'archived'
-		GROUP BY t.id
+		AND t.status != 'archived' AND t.deleted_at IS NULL` + solvedFilter("t", solved) + `
+		GROUP BY t.id, am.id
 		ORDER BY t.created_at DESC
 		LIMIT ? OFFSET ?
 	`
@@ -289,6 +377,8 @@ func SearchThreads(db *sql.DB, query string, page, perPage int) ([]*Thread, erro
 			&thread.AuthorID,
 			&thread.Status,
 			&thread.Visibility,
+			&thread.Type,
+			&thread.AcceptedMessageID,
 			&thread.CreatedAt,
 			&thread.UpdatedAt,
 			&thread.MessageCount,
@@ -310,7 +400,7 @@ func SearchThreads(db *sql.DB, query string, page, perPage int) ([]*Thread, erro
 func GetThreadsByTag(tag string, limit, offset int) ([]*Thread, error) {
 	query := `
 		SELECT * FROM threads 
-		WHERE FIND_IN_SET(?, tags) AND status != 'archived'
+		WHERE FIND_IN_SET(?, tags) AND status != 'archived' AND deleted_at IS NULL
 		ORDER BY created_at DESC
 		LIMIT ? OFFSET ?`
 
@@ -342,11 +432,40 @@ func GetThreadsByTag(tag string, limit, offset int) ([]*Thread, error) {
 	return threads, nil
 }
 
+// UnknownTags retourne les tags qui ne sont utilisés par aucun fil hors corbeille (sans tenir compte de
+// la casse) ; le fil excludeThreadID est ignoré pour qu'un auteur puisse garder les tags qu'il a créés
+func UnknownTags(db *sql.DB, tags []string, excludeThreadID int64) ([]string, error) {
+	unknown := []string{}
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+
+		var exists bool
+		err := db.QueryRow(`
+			SELECT EXISTS(
+				SELECT 1 FROM threads
+				WHERE FIND_IN_SET(?, LOWER(REPLACE(tags, ', ', ','))) > 0 AND deleted_at IS NULL AND id != ?
+			)
+		`, tag, excludeThreadID).Scan(&exists)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			unknown = append(unknown, tag)
+		}
+	}
+	return unknown, nil
+}
+
 // GetThreadsByTitle récupère les fils de discussion par titre
 func GetThreadsByTitle(title string, limit, offset int) ([]*Thread, error) {
 	query := `
 		SELECT * FROM threads 
-		WHERE title LIKE ? AND status != 'archived'
+		WHERE title LIKE ? AND status != 'archived' AND deleted_at IS NULL
 		ORDER BY created_at DESC
 		LIMIT ? OFFSET ?`
 
@@ -382,7 +501,7 @@ func GetThreadsByTitle(title string, limit, offset int) ([]*Thread, error) {
 func GetThreadsByAuthorID(authorID, limit, offset int) ([]*Thread, error) {
 	query := `
 		SELECT * FROM threads 
-		WHERE author_id = ? AND status != 'archived'
+		WHERE author_id = ? AND status != 'archived' AND deleted_at IS NULL
 		ORDER BY created_at DESC
 		LIMIT ? OFFSET ?`
 
@@ -414,6 +533,29 @@ func GetThreadsByAuthorID(authorID, limit, offset int) ([]*Thread, error) {
 	return threads, nil
 }
 
+// CanViewThread vérifie si un utilisateur peut consulter un fil de discussion
+// (userID vaut 0 pour un visiteur non authentifié)
+func CanViewThread(db *sql.DB, thread *Thread, userID int64, role string) (bool, error) {
+	if role == "admin" {
+		return true, nil
+	}
+	// Un fil archivé n'est plus affiché ni accessible
+	if thread.Status == string(ThreadArchived) {
+		return false, nil
+	}
+	if thread.Visibility != string(ThreadPrivate) {
+		return true, nil
+	}
+	if userID == 0 {
+		return false, nil
+	}
+	if thread.AuthorID == userID {
+		return true, nil
+	}
+	// Les fils privés ne sont visibles que par les amis de l'auteur
+	return AreFriends(db, thread.AuthorID, userID)
+}
+
 // AdminUpdateThread permet à un admin de mettre à jour un fil de discussion
 func AdminUpdateThread(db *sql.DB, threadID int64, status, visibility string) error {
 	query := `
@@ -424,3 +566,21 @@ func AdminUpdateThread(db *sql.DB, threadID int64, status, visibility string) er
 	_, err := db.Exec(query, status, visibility, threadID)
 	return err
 }
+
+// visibleThreadCondition retourne la condition SQL équivalente à CanViewThread pour l'alias
+// de table donné, et ses paramètres
+func visibleThreadCondition(alias string, userID int64, role string) (string, []interface{}) {
+	if role == "admin" {
+		return alias + ".deleted_at IS NULL", nil
+	}
+	condition := fmt.Sprintf(`%[1]s.deleted_at IS NULL AND %[1]s.status != 'archived' AND (
+		%[1]s.visibility != 'private'
+		OR %[1]s.author_id = ?
+		OR EXISTS (
+			SELECT 1 FROM friendships vf
+			WHERE vf.status = 'accepted'
+			AND ((vf.user_id = %[1]s.author_id AND vf.friend_id = ?) OR (vf.user_id = ? AND vf.friend_id = %[1]s.author_id))
+		)
+	)`, alias)
+	return condition, []interface{}{userID, userID, userID}
+}
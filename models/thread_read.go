@@ -0,0 +1,132 @@
+package models
+
+import (
+	"database/sql"
+)
+
+// Les pointeurs de lecture sont des identifiants de message : les identifiants étant croissants,
+// « non lu » signifie simplement id > pointeur. Marquer une catégorie comme lue n'écrit qu'une
+// seule ligne (category_reads) quel que soit le nombre de fils qu'elle contient ; le pointeur
+// effectif d'un fil est le plus grand des deux.
+
+// readPointerJoin joint les pointeurs de lecture d'un utilisateur (2 paramètres userID) sur l'alias t
+const readPointerJoin = `
+	LEFT JOIN thread_reads r ON r.thread_id = t.id AND r.user_id = ?
+	LEFT JOIN category_reads cr ON cr.category_id = t.category_id AND cr.user_id = ?`
+
+// readPointerExpr est le dernier message lu effectif d'un fil, utilisable avec readPointerJoin
+const readPointerExpr = `GREATEST(COALESCE(r.last_read_message_id, 0), COALESCE(cr.last_read_message_id, 0))`
+
+// MarkThreadRead avance le dernier message lu d'un utilisateur dans un fil (sans jamais reculer)
+func MarkThreadRead(db *sql.DB, userID, threadID, messageID int64) error {
+	_, err := db.Exec(`
+		INSERT INTO thread_reads (user_id, thread_id, last_read_message_id, updated_at)
+		VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+		ON DUPLICATE KEY UPDATE
+			last_read_message_id = GREATEST(last_read_message_id, VALUES(last_read_message_id)),
+			updated_at = CURRENT_TIMESTAMP
+	`, userID, threadID, messageID)
+	return err
+}
+
+// HasUnreadBefore indique s'il reste dans un fil un message non lu (identifiant supérieur au pointeur)
+// plus ancien que le message donné ; les messages de l'utilisateur lui-même ne comptent pas
+func HasUnreadBefore(db *sql.DB, threadID, userID, pointer, messageID int64) (bool, error) {
+	var exists bool
+	err := db.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM messages
+			WHERE thread_id = ? AND author_id != ? AND id > ? AND id < ? AND deleted_at IS NULL
+		)
+	`, threadID, userID, pointer, messageID).Scan(&exists)
+	return exists, err
+}
+
+// GetThreadReadPointer récupère le dernier message lu effectif d'un utilisateur dans un fil
+func GetThreadReadPointer(db *sql.DB, userID, threadID int64) (int64, error) {
+	var pointer int64
+	err := db.QueryRow(`
+		SELECT `+readPointerExpr+`
+		FROM threads t`+readPointerJoin+`
+		WHERE t.id = ?
+	`, userID, userID, threadID).Scan(&pointer)
+	return pointer, err
+}
+
+// GetUnreadCounts compte les messages non lus (hors messages de l'utilisateur) pour une page de fils
+func GetUnreadCounts(db *sql.DB, userID int64, threadIDs []int64) (map[int64]int, error) {
+	counts := make(map[int64]int, len(threadIDs))
+	if len(threadIDs) == 0 {
+		return counts, nil
+	}
+
+	args := []interface{}{userID, userID, userID}
+	for _, id := range threadIDs {
+		args = append(args, id)
+	}
+	rows, err := db.Query(`
+		SELECT t.id, COUNT(m.id)
+		FROM threads t`+readPointerJoin+`
+		JOIN messages m ON m.thread_id = t.id AND m.id > `+readPointerExpr+` AND m.author_id != ? AND m.deleted_at IS NULL
+		WHERE t.id IN (`+inPlaceholders(len(threadIDs))+`)
+		GROUP BY t.id
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var threadID int64
+		var count int
+		if err := rows.Scan(&threadID, &count); err != nil {
+			return nil, err
+		}
+		counts[threadID] = count
+	}
+	return counts, rows.Err()
+}
+
+// GetFirstUnreadMessage retourne le premier message non lu d'un fil et sa position (à partir de 0)
+// dans l'ordre chronologique ; sans message non lu, c'est le dernier message qui est retourné
+func GetFirstUnreadMessage(db *sql.DB, userID, threadID int64) (int64, int, bool, error) {
+	pointer, err := GetThreadReadPointer(db, userID, threadID)
+	if err != nil {
+		return 0, 0, false, err
+	}
+
+	var messageID sql.NullInt64
+	err = db.QueryRow("SELECT MIN(id) FROM messages WHERE thread_id = ? AND id > ? AND author_id != ? AND deleted_at IS NULL", threadID, pointer, userID).Scan(&messageID)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	unread := messageID.Valid
+	if !unread {
+		if err := db.QueryRow("SELECT MAX(id) FROM messages WHERE thread_id = ? AND deleted_at IS NULL", threadID).Scan(&messageID); err != nil {
+			return 0, 0, false, err
+		}
+		if !messageID.Valid {
+			return 0, 0, false, sql.ErrNoRows
+		}
+	}
+
+	var position int
+	err = db.QueryRow("SELECT COUNT(*) FROM messages WHERE thread_id = ? AND id < ? AND deleted_at IS NULL", threadID, messageID.Int64).Scan(&position)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	return messageID.Int64, position, unread, nil
+}
+
+// MarkCategoryRead marque comme lus tous les messages actuels d'une catégorie. Le plus grand
+// identifiant de message du forum suffit comme pointeur : tout message de la catégorie lui est inférieur.
+func MarkCategoryRead(db *sql.DB, userID, categoryID int64) error {
+	_, err := db.Exec(`
+		INSERT INTO category_reads (user_id, category_id, last_read_message_id, updated_at)
+		SELECT ?, ?, COALESCE(MAX(id), 0), CURRENT_TIMESTAMP FROM messages
+		ON DUPLICATE KEY UPDATE
+			last_read_message_id = GREATEST(category_reads.last_read_message_id, VALUES(last_read_message_id)),
+			updated_at = CURRENT_TIMESTAMP
+	`, userID, categoryID)
+	return err
+}
@@ -0,0 +1,153 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// ThreadRevision est l'état du titre, de la description, des tags, du statut et du type d'un fil après
+// une modification ; la version 1 est l'état initial du fil. Status et Type sont vides pour les versions
+// enregistrées avant leur ajout à l'historique.
+type ThreadRevision struct {
+	ID          int64     `json:"id"`
+	ThreadID    int64     `json:"thread_id"`
+	Version     int       `json:"version"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Tags        string    `json:"tags"`
+	Status      string    `json:"status,omitempty"`
+	Type        string    `json:"type,omitempty"`
+	EditorID    int64     `json:"editor_id,omitempty"`
+	Editor      string    `json:"editor,omitempty"`
+	Reason      string    `json:"reason,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// ThreadEdit est une modification d'un fil ; Status et Type vides laissent le statut et le type inchangés
+type ThreadEdit struct {
+	Title       string
+	Description string
+	Tags        string
+	Status      string
+	Type        string
+	Reason      string
+}
+
+// ReviseThread applique une modification à un fil et enregistre la révision correspondante dans la même
+// transaction ; si rien ne change, aucune révision n'est créée et changed vaut false. La réponse acceptée
+// est oubliée si le fil n'est plus une question.
+func ReviseThread(db *sql.DB, threadID, editorID int64, edit ThreadEdit) (changed bool, err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var current ThreadRevision
+	var authorID int64
+	err = tx.QueryRow(`
+		SELECT title, description, tags, status, thread_type, author_id, updated_at FROM threads WHERE id = ? FOR UPDATE
+	`, threadID).Scan(&current.Title, &current.Description, &current.Tags, &current.Status, &current.Type, &authorID, &current.CreatedAt)
+	if err != nil {
+		return false, err
+	}
+	if edit.Status == "" {
+		edit.Status = current.Status
+	}
+	if edit.Type == "" {
+		edit.Type = current.Type
+	}
+	if current.Title == edit.Title && current.Description == edit.Description && current.Tags == edit.Tags &&
+		current.Status == edit.Status && current.Type == edit.Type {
+		return false, nil
+	}
+
+	var version int
+	if err := tx.QueryRow("SELECT COALESCE(MAX(version), 0) FROM thread_revisions WHERE thread_id = ?", threadID).Scan(&version); err != nil {
+		return false, err
+	}
+	// Fil antérieur à l'historique : son état actuel devient la version 1, d'auteur inconnu
+	if version == 0 {
+		_, err = tx.Exec(`
+			INSERT INTO thread_revisions (thread_id, version, title, description, tags, status, thread_type, editor_id, reason, created_at)
+			VALUES (?, 1, ?, ?, ?, ?, ?, NULL, '', ?)
+		`, threadID, current.Title, current.Description, current.Tags, current.Status, current.Type, current.CreatedAt)
+		if err != nil {
+			return false, err
+		}
+		version = 1
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO thread_revisions (thread_id, version, title, description, tags, status, thread_type, editor_id, reason, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+	`, threadID, version+1, edit.Title, edit.Description, edit.Tags, edit.Status, edit.Type, nullableID(editorID), edit.Reason)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE threads
+		SET title = ?, description = ?, tags = ?, status = ?, thread_type = ?,
+		    accepted_message_id = IF(? = 'question', accepted_message_id, NULL), updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?
+	`, edit.Title, edit.Description, edit.Tags, edit.Status, edit.Type, edit.Type, threadID)
+	if err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// createInitialThreadRevision enregistre l'état d'un fil à sa création
+func createInitialThreadRevision(db *sql.DB, thread *Thread) error {
+	_, err := db.Exec(`
+		INSERT INTO thread_revisions (thread_id, version, title, description, tags, status, thread_type, editor_id, reason, created_at)
+		VALUES (?, 1, ?, ?, ?, ?, ?, ?, '', ?)
+	`, thread.ID, thread.Title, thread.Description, thread.Tags, thread.Status, thread.Type, thread.AuthorID, thread.CreatedAt)
+	return err
+}
+
+// GetThreadRevisions récupère l'historique d'un fil, de la plus ancienne à la plus récente version
+func GetThreadRevisions(db *sql.DB, threadID int64) ([]*ThreadRevision, error) {
+	rows, err := db.Query(`
+		SELECT r.id, r.thread_id, r.version, r.title, r.description, r.tags, COALESCE(r.status, ''),
+		       COALESCE(r.thread_type, ''), COALESCE(r.editor_id, 0),
+		       COALESCE(u.username, ''), r.reason, r.created_at
+		FROM thread_revisions r
+		LEFT JOIN users u ON u.id = r.editor_id
+		WHERE r.thread_id = ?
+		ORDER BY r.version
+	`, threadID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []*ThreadRevision{}
+	for rows.Next() {
+		revision := &ThreadRevision{}
+		if err := rows.Scan(&revision.ID, &revision.ThreadID, &revision.Version, &revision.Title, &revision.Description,
+			&revision.Tags, &revision.Status, &revision.Type, &revision.EditorID, &revision.Editor, &revision.Reason, &revision.CreatedAt); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+	return revisions, rows.Err()
+}
+
+// GetThreadRevision récupère une version précise d'un fil
+func GetThreadRevision(db *sql.DB, threadID int64, version int) (*ThreadRevision, error) {
+	revision := &ThreadRevision{}
+	err := db.QueryRow(`
+		SELECT id, thread_id, version, title, description, tags, COALESCE(status, ''), COALESCE(thread_type, ''),
+		       COALESCE(editor_id, 0), reason, created_at
+		FROM thread_revisions
+		WHERE thread_id = ? AND version = ?
+	`, threadID, version).Scan(&revision.ID, &revision.ThreadID, &revision.Version, &revision.Title, &revision.Description,
+		&revision.Tags, &revision.Status, &revision.Type, &revision.EditorID, &revision.Reason, &revision.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return revision, nil
+}
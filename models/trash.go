@@ -0,0 +1,226 @@
+package models
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+// TrashItem est un fil ou un message en corbeille
+type TrashItem struct {
+	Type          string    `json:"type"`
+	ID            int64     `json:"id"`
+	ThreadID      int64     `json:"thread_id"`
+	ThreadTitle   string    `json:"thread_title"`
+	ThreadDeleted bool      `json:"thread_deleted,omitempty"`
+	Content       string    `json:"content,omitempty"`
+	AuthorID      int64     `json:"author_id"`
+	AuthorName    string    `json:"author_username"`
+	DeletedAt     time.Time `json:"deleted_at"`
+	DeletedBy     int64     `json:"deleted_by,omitempty"`
+	DeletedByName string    `json:"deleted_by_username,omitempty"`
+	Reason        string    `json:"reason,omitempty"`
+	PurgeAt       time.Time `json:"purge_at"`
+}
+
+// SoftDeleteThread met un fil en corbeille et décrémente le compteur de fils de son auteur ; ses messages
+// restent intacts mais ne sont plus visibles
+func SoftDeleteThread(db *sql.DB, id, deletedBy int64, reason string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = requireAffected(tx.Exec(`
+		UPDATE threads SET deleted_at = CURRENT_TIMESTAMP, deleted_by = ?, delete_reason = ?
+		WHERE id = ? AND deleted_at IS NULL
+	`, nullableID(deletedBy), reason, id))
+	if err != nil {
+		return err
+	}
+	if err := addThreadCount(tx, id, -1); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RestoreThread sort un fil de la corbeille et rétablit le compteur de fils de son auteur
+func RestoreThread(db *sql.DB, id int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = requireAffected(tx.Exec(`
+		UPDATE threads SET deleted_at = NULL, deleted_by = NULL, delete_reason = ''
+		WHERE id = ? AND deleted_at IS NOT NULL
+	`, id))
+	if err != nil {
+		return err
+	}
+	if err := addThreadCount(tx, id, 1); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SoftDeleteMessage met un message en corbeille et décrémente les compteurs de son fil et de son auteur
+func SoftDeleteMessage(db *sql.DB, id, deletedBy int64, reason string) error {
+	return setMessageDeleted(db, id, true, deletedBy, reason)
+}
+
+// RestoreMessage sort un message de la corbeille et rétablit les compteurs
+func RestoreMessage(db *sql.DB, id int64) error {
+	return setMessageDeleted(db, id, false, 0, "")
+}
+
+func setMessageDeleted(db *sql.DB, id int64, deleted bool, deletedBy int64, reason string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var threadID, authorID int64
+	var deletedAt sql.NullTime
+	err = tx.QueryRow("SELECT thread_id, author_id, deleted_at FROM messages WHERE id = ? FOR UPDATE", id).Scan(&threadID, &authorID, &deletedAt)
+	if err != nil {
+		return err
+	}
+	if deletedAt.Valid == deleted {
+		return sql.ErrNoRows
+	}
+
+	delta := 1
+	if deleted {
+		delta = -1
+		_, err = tx.Exec(`
+			UPDATE messages SET deleted_at = CURRENT_TIMESTAMP, deleted_by = ?, delete_reason = ? WHERE id = ?
+		`, nullableID(deletedBy), reason, id)
+	} else {
+		_, err = tx.Exec("UPDATE messages SET deleted_at = NULL, deleted_by = NULL, delete_reason = '' WHERE id = ?", id)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := addMessageCounts(tx, threadID, authorID, delta); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	// Les classements ne comptent pas les messages en corbeille. En cas d'échec, le recalcul périodique
+	// corrigera les journées récentes.
+	if err := RollupMessageDays(db, id); err != nil {
+		log.Printf("Erreur lors du recalcul des agrégats du message %d: %v", id, err)
+	}
+	return nil
+}
+
+// requireAffected transforme une mise à jour sans effet en sql.ErrNoRows
+func requireAffected(result sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ListDeletedThreads liste les fils en corbeille, les derniers supprimés en premier
+func ListDeletedThreads(db *sql.DB, retention time.Duration, page, perPage int) ([]*TrashItem, error) {
+	return listTrash(db, retention, `
+		SELECT 'thread', t.id, t.id, t.title, FALSE, '', t.author_id, COALESCE(a.username, ''),
+		       t.deleted_at, COALESCE(t.deleted_by, 0), COALESCE(d.username, ''), t.delete_reason
+		FROM threads t
+		LEFT JOIN users a ON a.id = t.author_id
+		LEFT JOIN users d ON d.id = t.deleted_by
+		WHERE t.deleted_at IS NOT NULL
+		ORDER BY t.deleted_at DESC, t.id DESC
+		LIMIT ? OFFSET ?
+	`, perPage, (page-1)*perPage)
+}
+
+// ListDeletedMessages liste les messages en corbeille, les derniers supprimés en premier
+func ListDeletedMessages(db *sql.DB, retention time.Duration, page, perPage int) ([]*TrashItem, error) {
+	return listTrash(db, retention, `
+		SELECT 'message', m.id, m.thread_id, t.title, t.deleted_at IS NOT NULL, m.content, m.author_id,
+		       COALESCE(a.username, ''), m.deleted_at, COALESCE(m.deleted_by, 0), COALESCE(d.username, ''), m.delete_reason
+		FROM messages m
+		JOIN threads t ON t.id = m.thread_id
+		LEFT JOIN users a ON a.id = m.author_id
+		LEFT JOIN users d ON d.id = m.deleted_by
+		WHERE m.deleted_at IS NOT NULL
+		ORDER BY m.deleted_at DESC, m.id DESC
+		LIMIT ? OFFSET ?
+	`, perPage, (page-1)*perPage)
+}
+
+func listTrash(db *sql.DB, retention time.Duration, query string, args ...interface{}) ([]*TrashItem, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []*TrashItem{}
+	for rows.Next() {
+		item := &TrashItem{}
+		if err := rows.Scan(&item.Type, &item.ID, &item.ThreadID, &item.ThreadTitle, &item.ThreadDeleted, &item.Content,
+			&item.AuthorID, &item.AuthorName, &item.DeletedAt, &item.DeletedBy, &item.DeletedByName, &item.Reason); err != nil {
+			return nil, err
+		}
+		item.PurgeAt = item.DeletedAt.Add(retention)
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// GetExpiredTrash récupère les fils et messages mis en corbeille avant une date
+func GetExpiredTrash(db *sql.DB, before time.Time) (threadIDs, messageIDs []int64, err error) {
+	rows, err := db.Query(`
+		SELECT 'thread', id FROM threads WHERE deleted_at < ?
+		UNION ALL SELECT 'message', id FROM messages WHERE deleted_at < ?
+	`, before, before)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var kind string
+		var id int64
+		if err := rows.Scan(&kind, &id); err != nil {
+			return nil, nil, err
+		}
+		if kind == "thread" {
+			threadIDs = append(threadIDs, id)
+		} else {
+			messageIDs = append(messageIDs, id)
+		}
+	}
+	return threadIDs, messageIDs, rows.Err()
+}
+
+// IsThreadDeleted indique si un fil existe et se trouve en corbeille
+func IsThreadDeleted(db *sql.DB, id int64) (bool, error) {
+	var deletedAt sql.NullTime
+	err := db.QueryRow("SELECT deleted_at FROM threads WHERE id = ?", id).Scan(&deletedAt)
+	return deletedAt.Valid, err
+}
+
+// IsMessageDeleted indique si un message existe et se trouve en corbeille
+func IsMessageDeleted(db *sql.DB, id int64) (bool, error) {
+	var deletedAt sql.NullTime
+	err := db.QueryRow("SELECT deleted_at FROM messages WHERE id = ?", id).Scan(&deletedAt)
+	return deletedAt.Valid, err
+}
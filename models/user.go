@@ -13,19 +13,30 @@ import (
 )
 
 type User struct {
-	ID             int64     `json:"id"`
-	Username       string    `json:"username"`
-	Email          string    `json:"email"`
-	PasswordHash   string    `json:"-"`
-	Role           string    `json:"role"`
-	Banned         bool      `json:"banned"`
-	ThreadCount    int       `json:"thread_count"`
-	MessageCount   int       `json:"message_count"`
-	LastConnection time.Time `json:"last_connection"`
-	CreatedAt      time.Time `json:"created_at"`
-	UpdatedAt      time.Time `json:"updated_at"`
-	ProfilePicture string    `json:"profile_picture,omitempty"`
-	Biography      string    `json:"biography,omitempty"`
+	ID             int64        `json:"id"`
+	Username       string       `json:"username"`
+	Email          string       `json:"email"`
+	PasswordHash   string       `json:"-"`
+	Role           string       `json:"role"`
+	Banned         bool         `json:"banned"`
+	ThreadCount    int          `json:"thread_count"`
+	MessageCount   int          `json:"message_count"`
+	Reputation     int          `json:"reputation"`
+	LastConnection time.Time    `json:"last_connection"`
+	CreatedAt      time.Time    `json:"created_at"`
+	UpdatedAt      time.Time    `json:"updated_at"`
+	ProfilePicture string       `json:"profile_picture,omitempty"`
+	Biography      string       `json:"biography,omitempty"`
+	Online         bool         `json:"online"`
+	Badges         []*UserBadge `json:"badges,omitempty"`
+}
+
+// AvatarURL retourne la photo de profil d'un utilisateur, ou son avatar généré s'il n'en a pas
+func AvatarURL(userID int64, profilePicture string) string {
+	if profilePicture != "" {
+		return profilePicture
+	}
+	return fmt.Sprintf("/avatars/%d.svg", userID)
 }
 
 // TableName retourne le nom de la table pour le modèle User
@@ -55,11 +66,12 @@ func CreateUser(db *sql.DB, username, email, password, role string) (*User, erro
 // GetUserByID récupère un utilisateur par son ID
 func GetUserByID(db *sql.DB, id int64) (*User, error) {
 	query := `
-		SELECT id, username, email, password_hash, role, is_banned, thread_count, message_count, last_connection, created_at
+		SELECT id, username, email, password_hash, role, is_banned, thread_count, message_count, reputation, last_connection, created_at, profile_picture
 		FROM users
 		WHERE id = ?
 	`
 	user := &User{}
+	var profilePicture sql.NullString
 	err := db.QueryRow(query, id).Scan(
 		&user.ID,
 		&user.Username,
@@ -69,22 +81,26 @@ func GetUserByID(db *sql.DB, id int64) (*User, error) {
 		&user.Banned,
 		&user.ThreadCount,
 		&user.MessageCount,
+		&user.Reputation,
 		&user.LastConnection,
 		&user.CreatedAt,
+		&profilePicture,
 	)
 	if err != nil {
 		return nil, err
 	}
+	user.ProfilePicture = AvatarURL(user.ID, profilePicture.String)
 	return user, nil
 }
 
 // GetUserByEmail récupère un utilisateur par son email
 func GetUserByEmail(db *sql.DB, email string) (*User, error) {
 	query := `
-		SELECT id, username, email, password_hash, role, is_banned, thread_count, message_count, last_connection, created_at
+		SELECT id, username, email, password_hash, role, is_banned, thread_count, message_count, reputation, last_connection, created_at, profile_picture
 		FROM users WHERE email = ?
 	`
 	user := &User{}
+	var profilePicture sql.NullString
 	err := db.QueryRow(query, email).Scan(
 		&user.ID,
 		&user.Username,
@@ -94,23 +110,27 @@ func GetUserByEmail(db *sql.DB, email string) (*User, error) {
 		&user.Banned,
 		&user.ThreadCount,
 		&user.MessageCount,
+		&user.Reputation,
 		&user.LastConnection,
 		&user.CreatedAt,
+		&profilePicture,
 	)
 	if err != nil {
 		return nil, err
 	}
+	user.ProfilePicture = AvatarURL(user.ID, profilePicture.String)
 	return user, nil
 }
 
 // GetUserByUsername récupère un utilisateur par son nom d'utilisateur
 func GetUserByUsername(db *sql.DB, username string) (*User, error) {
 	query := `
-		SELECT id, username, email, password_hash, role, is_banned, thread_count, message_count, last_connection, created_at
+		SELECT id, username, email, password_hash, role, is_banned, thread_count, message_count, reputation, last_connection, created_at, profile_picture
 		FROM users
 		WHERE username = ?
 	`
 	user := &User{}
+	var profilePicture sql.NullString
 	err := db.QueryRow(query, username).Scan(
 		&user.ID,
 		&user.Username,
@@ -120,12 +140,15 @@ func GetUserByUsername(db *sql.DB, username string) (*User, error) {
 		&user.Banned,
 		&user.ThreadCount,
 		&user.MessageCount,
+		&user.Reputation,
 		&user.LastConnection,
 		&user.CreatedAt,
+		&profilePicture,
 	)
 	if err != nil {
 		return nil, err
 	}
+	user.ProfilePicture = AvatarURL(user.ID, profilePicture.String)
 	return user, nil
 }
 
@@ -247,6 +270,11 @@ func (u *User) IsAdmin() bool {
 	return u.Role == "admin"
 }
 
+// IsModerator indique si un rôle donne accès aux outils de modération (historique, contenus masqués...)
+func IsModerator(role string) bool {
+	return role == "admin" || role == "moderator"
+}
+
 // IsBanned vérifie si l'utilisateur est banni
 func (u *User) IsBanned() bool {
 	return u.Banned
@@ -258,14 +286,19 @@ func GetUserStats(db *sql.DB, userID int64) (map[string]int, error) {
 	var count int
 
 	// Nombre de fils de discussion
-	err := db.QueryRow("SELECT COUNT(*) FROM threads WHERE author_id = ?", userID).Scan(&count)
+	err := db.QueryRow("SELECT COUNT(*) FROM threads WHERE author_id = ? AND deleted_at IS NULL", userID).Scan(&count)
 	if err != nil {
 		return nil, err
 	}
 	stats["threads"] = count
 
 	// Nombre de messages
-	err = db.QueryRow("SELECT COUNT(*) FROM messages WHERE author_id = ?", userID).Scan(&count)
+	err = db.QueryRow(`
+		SELECT COUNT(*)
+		FROM messages m
+		JOIN threads t ON m.thread_id = t.id
+		WHERE m.author_id = ? AND m.deleted_at IS NULL AND t.deleted_at IS NULL
+	`, userID).Scan(&count)
 	if err != nil {
 		return nil, err
 	}
@@ -276,7 +309,7 @@ func GetUserStats(db *sql.DB, userID int64) (map[string]int, error) {
 		SELECT COUNT(*) 
 		FROM message_reactions mr
 		JOIN messages m ON mr.message_id = m.id
-		WHERE m.author_id = ? AND mr.reaction_type = 'like'
+		WHERE m.author_id = ? AND mr.reaction_type = 'like' AND m.deleted_at IS NULL
 	`, userID).Scan(&count)
 	if err != nil {
 		return nil, err
@@ -303,7 +336,7 @@ func GetUserMessages(db *sql.DB, userID int64) ([]map[string]interface{}, error)
 		SELECT m.id, m.content, m.created_at, t.title as thread_title
 		FROM messages m
 		JOIN threads t ON m.thread_id = t.id
-		WHERE m.user_id = ?
+		WHERE m.user_id = ? AND m.deleted_at IS NULL AND t.deleted_at IS NULL
 		ORDER BY m.created_at DESC
 	`
 	rows, err := db.Query(query, userID)
@@ -338,7 +371,7 @@ func GetUserThreads(db *sql.DB, userID int64) ([]map[string]interface{}, error)
 	query := `
 		SELECT id, title, description, status, created_at
 		FROM threads
-		WHERE user_id = ?
+		WHERE user_id = ? AND deleted_at IS NULL
 		ORDER BY created_at DESC
 	`
 	rows, err := db.Query(query, userID)
@@ -391,9 +424,7 @@ func AuthenticateUser(db *sql.DB, username, password string) (*User, error) {
 		return nil, err
 	}
 
-	if profilePicture.Valid {
-		user.ProfilePicture = profilePicture.String
-	}
+	user.ProfilePicture = AvatarURL(user.ID, profilePicture.String)
 	if biography.Valid {
 		user.Biography = biography.String
 	}
@@ -419,3 +450,21 @@ func UpdateLastConnection(db *sql.DB, userID int64) error {
 	_, err := db.Exec(query, userID)
 	return err
 }
+
+// SetUserAvatar enregistre le nouvel avatar d'un utilisateur et retourne la clé de l'ancien
+func SetUserAvatar(db *sql.DB, userID int64, key, url string) (string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var oldKey sql.NullString
+	if err := tx.QueryRow("SELECT avatar_key FROM users WHERE id = ? FOR UPDATE", userID).Scan(&oldKey); err != nil {
+		return "", err
+	}
+	if _, err := tx.Exec("UPDATE users SET profile_picture = ?, avatar_key = ? WHERE id = ?", url, key, userID); err != nil {
+		return "", err
+	}
+	return oldKey.String, tx.Commit()
+}
@@ -19,4 +19,15 @@ func SetupAdminRoutes(router *mux.Router, adminController *controllers.AdminCont
 	router.Handle("/admin/threads/{id}/status", middleware.AdminMiddleware(http.HandlerFunc(adminController.UpdateThreadStatus))).Methods("PUT")
 	router.Handle("/admin/threads/{id}", middleware.AdminMiddleware(http.HandlerFunc(adminController.DeleteThread))).Methods("DELETE")
 	router.Handle("/admin/messages/{id}", middleware.AdminMiddleware(http.HandlerFunc(adminController.DeleteMessage))).Methods("DELETE")
+
+	// Corbeille : restauration et purge des fils et messages supprimés
+	router.Handle("/api/admin/trash", middleware.AuthMiddleware(middleware.AdminMiddleware(http.HandlerFunc(adminController.ListTrash)))).Methods("GET")
+	router.Handle("/api/admin/trash/threads/{id:[0-9]+}/restore", middleware.AuthMiddleware(middleware.AdminMiddleware(http.HandlerFunc(adminController.RestoreThread)))).Methods("POST")
+	router.Handle("/api/admin/trash/messages/{id:[0-9]+}/restore", middleware.AuthMiddleware(middleware.AdminMiddleware(http.HandlerFunc(adminController.RestoreMessage)))).Methods("POST")
+	router.Handle("/api/admin/trash/threads/{id:[0-9]+}", middleware.AuthMiddleware(middleware.AdminMiddleware(http.HandlerFunc(adminController.PurgeThread)))).Methods("DELETE")
+	router.Handle("/api/admin/trash/messages/{id:[0-9]+}", middleware.AuthMiddleware(middleware.AdminMiddleware(http.HandlerFunc(adminController.PurgeMessage)))).Methods("DELETE")
+
+	// Compteurs dénormalisés : détection et correction des écarts
+	router.Handle("/api/admin/counters", middleware.AuthMiddleware(middleware.AdminMiddleware(http.HandlerFunc(adminController.GetCounterDrift)))).Methods("GET")
+	router.Handle("/api/admin/counters/repair", middleware.AuthMiddleware(middleware.AdminMiddleware(http.HandlerFunc(adminController.RepairCounters)))).Methods("POST")
 }
@@ -15,9 +15,10 @@ func SetupAPIRoutes(router *mux.Router, authController *controllers.AuthControll
 	router.HandleFunc("/api/auth/register", authController.Register).Methods("POST")
 	router.HandleFunc("/api/auth/login", authController.Login).Methods("POST")
 	router.HandleFunc("/api/stats", statsController.GetStats).Methods("GET")
-	router.HandleFunc("/api/threads", threadController.ListThreads).Methods("GET")
-	router.HandleFunc("/api/threads/{id}", threadController.GetThread).Methods("GET")
-	router.HandleFunc("/api/threads/{id}/messages", threadController.GetThreadMessages).Methods("GET")
+	router.HandleFunc("/api/leaderboards", statsController.GetLeaderboards).Methods("GET")
+	router.Handle("/api/threads", middleware.OptionalAuthMiddleware(http.HandlerFunc(threadController.ListThreads))).Methods("GET")
+	router.Handle("/api/threads/{id}", middleware.OptionalAuthMiddleware(http.HandlerFunc(threadController.GetThread))).Methods("GET")
+	router.Handle("/api/threads/{id}/messages", middleware.OptionalAuthMiddleware(http.HandlerFunc(threadController.GetThreadMessages))).Methods("GET")
 
 	// Routes protégées
 	router.Handle("/api/users/me", middleware.AuthMiddleware(http.HandlerFunc(userController.GetUserProfile))).Methods("GET")
@@ -26,11 +27,21 @@ func SetupAPIRoutes(router *mux.Router, authController *controllers.AuthControll
 	router.Handle("/api/users/{id}/threads", middleware.AuthMiddleware(http.HandlerFunc(userController.GetUserThreads))).Methods("GET")
 	router.Handle("/api/users/{id}/messages", middleware.AuthMiddleware(http.HandlerFunc(userController.GetUserMessages))).Methods("GET")
 	router.Handle("/api/users/stats", middleware.AuthMiddleware(http.HandlerFunc(userController.GetUserStats))).Methods("GET")
+	router.Handle("/api/users/me/mentions", middleware.AuthMiddleware(http.HandlerFunc(userController.ListMentions))).Methods("GET")
+	router.Handle("/api/users/mentions/suggest", middleware.AuthMiddleware(http.HandlerFunc(userController.SuggestMentions))).Methods("GET")
+	router.Handle("/api/users/{id:[0-9]+}", middleware.OptionalAuthMiddleware(http.HandlerFunc(userController.GetUser))).Methods("GET")
+	router.HandleFunc("/api/users/{id:[0-9]+}/reputation", userController.GetUserReputation).Methods("GET")
+	router.Handle("/api/users/{id:[0-9]+}/block", middleware.AuthMiddleware(http.HandlerFunc(userController.BlockUser))).Methods("POST")
+	router.Handle("/api/users/{id:[0-9]+}/block", middleware.AuthMiddleware(http.HandlerFunc(userController.UnblockUser))).Methods("DELETE")
+	router.Handle("/api/users/{id:[0-9]+}/friend", middleware.AuthMiddleware(http.HandlerFunc(userController.SendFriendRequest))).Methods("POST")
+	router.Handle("/api/users/{id:[0-9]+}/friend/accept", middleware.AuthMiddleware(http.HandlerFunc(userController.AcceptFriendRequest))).Methods("POST")
 
 	// Routes des fils de discussion
 	router.Handle("/api/threads", middleware.AuthMiddleware(http.HandlerFunc(threadController.CreateThread))).Methods("POST")
 	router.Handle("/api/threads/{id}", middleware.AuthMiddleware(http.HandlerFunc(threadController.UpdateThread))).Methods("PUT")
 	router.Handle("/api/threads/{id}", middleware.AuthMiddleware(http.HandlerFunc(threadController.DeleteThread))).Methods("DELETE")
+	router.Handle("/api/threads/{id}/history", middleware.AuthMiddleware(http.HandlerFunc(threadController.GetThreadHistory))).Methods("GET")
+	router.Handle("/api/admin/threads/{id:[0-9]+}/revert", middleware.AuthMiddleware(middleware.AdminMiddleware(http.HandlerFunc(threadController.RevertThread)))).Methods("POST")
 	router.Handle("/api/threads/{id}/messages", middleware.AuthMiddleware(http.HandlerFunc(threadController.CreateMessage))).Methods("POST")
 	router.Handle("/api/messages/{id}/like", middleware.AuthMiddleware(http.HandlerFunc(threadController.LikeMessage))).Methods("POST")
 	router.Handle("/api/messages/{id}/dislike", middleware.AuthMiddleware(http.HandlerFunc(threadController.DislikeMessage))).Methods("POST")
@@ -44,4 +55,5 @@ func SetupAPIRoutes(router *mux.Router, authController *controllers.AuthControll
 		http.ServeFile(w, r, "templates/index.html")
 	}).Methods("GET")
 	router.Handle("/profile", middleware.AuthMiddleware(http.HandlerFunc(userController.ShowProfilePage))).Methods("GET")
+	router.HandleFunc("/users/{id:[0-9]+}", userController.ShowProfilePage).Methods("GET")
 }
@@ -0,0 +1,22 @@
+package routes
+
+import (
+	"net/http"
+
+	"projet-forum/controllers"
+	"projet-forum/middleware"
+
+	"github.com/gorilla/mux"
+)
+
+// SetupAttachmentRoutes configure les routes des pièces jointes et de l'espace de stockage
+func SetupAttachmentRoutes(router *mux.Router, attachmentController *controllers.AttachmentController) {
+	// Routes protégées
+	router.Handle("/api/users/me/attachments", middleware.AuthMiddleware(http.HandlerFunc(attachmentController.ListMine))).Methods("GET")
+	router.Handle("/api/users/me/attachments", middleware.AuthMiddleware(http.HandlerFunc(attachmentController.DeleteMine))).Methods("DELETE")
+
+	// Routes d'administration
+	router.Handle("/api/admin/storage/consumers", middleware.AuthMiddleware(middleware.AdminMiddleware(http.HandlerFunc(attachmentController.AdminConsumers)))).Methods("GET")
+	router.Handle("/api/admin/storage/orphans", middleware.AuthMiddleware(middleware.AdminMiddleware(http.HandlerFunc(attachmentController.AdminOrphans)))).Methods("GET")
+	router.Handle("/api/admin/storage/orphans", middleware.AuthMiddleware(middleware.AdminMiddleware(http.HandlerFunc(attachmentController.AdminCleanupOrphans)))).Methods("DELETE")
+}
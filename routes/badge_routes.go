@@ -0,0 +1,14 @@
+package routes
+
+import (
+	"projet-forum/controllers"
+
+	"github.com/gorilla/mux"
+)
+
+// SetupBadgeRoutes configure les routes des badges
+func SetupBadgeRoutes(router *mux.Router, badgeController *controllers.BadgeController) {
+	// Routes publiques
+	router.HandleFunc("/api/badges", badgeController.ListBadges).Methods("GET")
+	router.HandleFunc("/api/users/{id:[0-9]+}/badges", badgeController.GetUserBadges).Methods("GET")
+}
@@ -0,0 +1,22 @@
+package routes
+
+import (
+	"net/http"
+
+	"projet-forum/controllers"
+	"projet-forum/middleware"
+
+	"github.com/gorilla/mux"
+)
+
+// SetupCategoryRoutes configure les routes des catégories
+func SetupCategoryRoutes(router *mux.Router, categoryController *controllers.CategoryController) {
+	// Routes publiques
+	router.HandleFunc("/api/categories", categoryController.ListCategories).Methods("GET")
+	router.HandleFunc("/api/categories/{id:[0-9]+}", categoryController.GetCategory).Methods("GET")
+
+	// Routes d'administration
+	router.Handle("/api/admin/categories", middleware.AuthMiddleware(middleware.AdminMiddleware(http.HandlerFunc(categoryController.CreateCategory)))).Methods("POST")
+	router.Handle("/api/admin/categories/{id:[0-9]+}", middleware.AuthMiddleware(middleware.AdminMiddleware(http.HandlerFunc(categoryController.UpdateCategory)))).Methods("PUT")
+	router.Handle("/api/admin/categories/{id:[0-9]+}", middleware.AuthMiddleware(middleware.AdminMiddleware(http.HandlerFunc(categoryController.DeleteCategory)))).Methods("DELETE")
+}
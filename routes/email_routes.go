@@ -0,0 +1,21 @@
+package routes
+
+import (
+	"net/http"
+
+	"projet-forum/controllers"
+	"projet-forum/middleware"
+
+	"github.com/gorilla/mux"
+)
+
+// SetupEmailRoutes configure les préférences email et la désinscription
+func SetupEmailRoutes(router *mux.Router, emailController *controllers.EmailController) {
+	// Routes publiques : le jeton signé suffit à identifier l'utilisateur
+	router.HandleFunc("/unsubscribe", emailController.ShowUnsubscribePage).Methods("GET")
+	router.HandleFunc("/unsubscribe", emailController.Unsubscribe).Methods("POST")
+
+	// Routes protégées
+	router.Handle("/api/users/me/email-preferences", middleware.AuthMiddleware(http.HandlerFunc(emailController.GetPreferences))).Methods("GET")
+	router.Handle("/api/users/me/email-preferences", middleware.AuthMiddleware(http.HandlerFunc(emailController.UpdatePreferences))).Methods("PUT")
+}
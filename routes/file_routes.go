@@ -0,0 +1,13 @@
+package routes
+
+import (
+	"projet-forum/controllers"
+
+	"github.com/gorilla/mux"
+)
+
+// SetupFileRoutes configure les routes qui servent les fichiers du stockage et les avatars générés
+func SetupFileRoutes(router *mux.Router, fileController *controllers.FileController) {
+	router.HandleFunc("/files/{key:.+}", fileController.ServeFile).Methods("GET")
+	router.HandleFunc("/avatars/{id:[0-9]+}.svg", fileController.ServeIdenticon).Methods("GET")
+}
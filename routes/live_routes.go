@@ -0,0 +1,17 @@
+package routes
+
+import (
+	"net/http"
+
+	"projet-forum/controllers"
+	"projet-forum/middleware"
+
+	"github.com/gorilla/mux"
+)
+
+// SetupLiveRoutes configure les routes du canal temps réel des fils de discussion
+func SetupLiveRoutes(router *mux.Router, liveController *controllers.LiveController) {
+	// Routes protégées
+	router.Handle("/api/threads/{id}/live", middleware.AuthMiddleware(http.HandlerFunc(liveController.StreamThread))).Methods("GET")
+	router.Handle("/api/threads/{id}/typing", middleware.AuthMiddleware(http.HandlerFunc(liveController.SetTyping))).Methods("POST")
+}
@@ -0,0 +1,23 @@
+package routes
+
+import (
+	"net/http"
+
+	"projet-forum/controllers"
+	"projet-forum/middleware"
+
+	"github.com/gorilla/mux"
+)
+
+// SetupMessageRoutes configure les routes d'aperçu, de source brute, de modification, de suppression et d'historique des messages
+func SetupMessageRoutes(router *mux.Router, messageController *controllers.MessageController) {
+	// Routes publiques (les messages des fils privés restent réservés à qui peut les voir)
+	router.Handle("/api/messages/{id:[0-9]+}/raw", middleware.OptionalAuthMiddleware(http.HandlerFunc(messageController.GetRaw))).Methods("GET")
+
+	// Routes protégées
+	router.Handle("/api/messages/preview", middleware.AuthMiddleware(http.HandlerFunc(messageController.PreviewMessage))).Methods("POST")
+	router.Handle("/api/messages/{id:[0-9]+}", middleware.AuthMiddleware(http.HandlerFunc(messageController.UpdateMessage))).Methods("PUT")
+	router.Handle("/api/messages/{id:[0-9]+}", middleware.AuthMiddleware(http.HandlerFunc(messageController.DeleteMessage))).Methods("DELETE")
+	router.Handle("/api/messages/{id:[0-9]+}/revisions", middleware.AuthMiddleware(http.HandlerFunc(messageController.GetRevisions))).Methods("GET")
+	router.Handle("/api/messages/{id:[0-9]+}/diff", middleware.AuthMiddleware(http.HandlerFunc(messageController.GetDiff))).Methods("GET")
+}
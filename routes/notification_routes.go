@@ -0,0 +1,21 @@
+package routes
+
+import (
+	"net/http"
+
+	"projet-forum/controllers"
+	"projet-forum/middleware"
+
+	"github.com/gorilla/mux"
+)
+
+// SetupNotificationRoutes configure les routes du centre de notifications
+func SetupNotificationRoutes(router *mux.Router, notificationController *controllers.NotificationController) {
+	// Routes protégées
+	router.Handle("/api/notifications", middleware.AuthMiddleware(http.HandlerFunc(notificationController.ListNotifications))).Methods("GET")
+	router.Handle("/api/notifications/unread-count", middleware.AuthMiddleware(http.HandlerFunc(notificationController.GetUnreadCount))).Methods("GET")
+	router.Handle("/api/notifications/read-all", middleware.AuthMiddleware(http.HandlerFunc(notificationController.MarkAllRead))).Methods("POST")
+	router.Handle("/api/notifications/preferences", middleware.AuthMiddleware(http.HandlerFunc(notificationController.GetPreferences))).Methods("GET")
+	router.Handle("/api/notifications/preferences", middleware.AuthMiddleware(http.HandlerFunc(notificationController.UpdatePreferences))).Methods("PUT")
+	router.Handle("/api/notifications/{id:[0-9]+}/read", middleware.AuthMiddleware(http.HandlerFunc(notificationController.MarkRead))).Methods("POST")
+}
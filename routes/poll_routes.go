@@ -0,0 +1,20 @@
+package routes
+
+import (
+	"net/http"
+
+	"projet-forum/controllers"
+	"projet-forum/middleware"
+
+	"github.com/gorilla/mux"
+)
+
+// SetupPollRoutes configure les routes des sondages des fils
+func SetupPollRoutes(router *mux.Router, pollController *controllers.PollController) {
+	// Route publique (les sondages des fils privés restent réservés à qui peut les voir)
+	router.Handle("/api/threads/{id:[0-9]+}/poll", middleware.OptionalAuthMiddleware(http.HandlerFunc(pollController.GetPoll))).Methods("GET")
+
+	// Routes protégées
+	router.Handle("/api/threads/{id:[0-9]+}/poll/vote", middleware.AuthMiddleware(http.HandlerFunc(pollController.Vote))).Methods("POST")
+	router.Handle("/api/threads/{id:[0-9]+}/poll/vote", middleware.AuthMiddleware(http.HandlerFunc(pollController.RetractVote))).Methods("DELETE")
+}
@@ -0,0 +1,20 @@
+package routes
+
+import (
+	"net/http"
+
+	"projet-forum/controllers"
+	"projet-forum/middleware"
+
+	"github.com/gorilla/mux"
+)
+
+// SetupQuestionRoutes configure les routes du mode questions/réponses
+func SetupQuestionRoutes(router *mux.Router, questionController *controllers.QuestionController) {
+	// Routes publiques (les questions des fils privés restent réservées à qui peut les voir)
+	router.Handle("/api/questions/unanswered", middleware.OptionalAuthMiddleware(http.HandlerFunc(questionController.ListUnanswered))).Methods("GET")
+
+	// Routes protégées : auteur de la question ou modérateur
+	router.Handle("/api/messages/{id:[0-9]+}/accept", middleware.AuthMiddleware(http.HandlerFunc(questionController.AcceptAnswer))).Methods("POST")
+	router.Handle("/api/messages/{id:[0-9]+}/accept", middleware.AuthMiddleware(http.HandlerFunc(questionController.ClearAcceptedAnswer))).Methods("DELETE")
+}
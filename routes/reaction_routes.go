@@ -0,0 +1,28 @@
+package routes
+
+import (
+	"net/http"
+
+	"projet-forum/controllers"
+	"projet-forum/middleware"
+
+	"github.com/gorilla/mux"
+)
+
+// SetupReactionRoutes configure les routes des réactions emoji et de leur administration
+func SetupReactionRoutes(router *mux.Router, reactionController *controllers.ReactionController) {
+	// Routes publiques (les réactions des fils privés restent réservées à qui peut les voir)
+	router.HandleFunc("/api/reactions", reactionController.ListTypes).Methods("GET")
+	router.Handle("/api/messages/{id:[0-9]+}/reactions", middleware.OptionalAuthMiddleware(http.HandlerFunc(reactionController.GetMessageReactions))).Methods("GET")
+	router.Handle("/api/messages/{id:[0-9]+}/reactions/{code}/users", middleware.OptionalAuthMiddleware(http.HandlerFunc(reactionController.ListReactors))).Methods("GET")
+
+	// Routes protégées
+	router.Handle("/api/messages/{id:[0-9]+}/reactions", middleware.AuthMiddleware(http.HandlerFunc(reactionController.ToggleReaction))).Methods("POST")
+	router.Handle("/api/users/me/reactions", middleware.AuthMiddleware(http.HandlerFunc(reactionController.GetMyReactions))).Methods("GET")
+
+	// Routes d'administration
+	router.Handle("/api/admin/reactions", middleware.AuthMiddleware(middleware.AdminMiddleware(http.HandlerFunc(reactionController.AdminListTypes)))).Methods("GET")
+	router.Handle("/api/admin/reactions", middleware.AuthMiddleware(middleware.AdminMiddleware(http.HandlerFunc(reactionController.CreateType)))).Methods("POST")
+	router.Handle("/api/admin/reactions/{id:[0-9]+}", middleware.AuthMiddleware(middleware.AdminMiddleware(http.HandlerFunc(reactionController.UpdateType)))).Methods("PUT")
+	router.Handle("/api/admin/reactions/{id:[0-9]+}", middleware.AuthMiddleware(middleware.AdminMiddleware(http.HandlerFunc(reactionController.DeleteType)))).Methods("DELETE")
+}
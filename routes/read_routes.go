@@ -0,0 +1,17 @@
+package routes
+
+import (
+	"net/http"
+
+	"projet-forum/controllers"
+	"projet-forum/middleware"
+
+	"github.com/gorilla/mux"
+)
+
+// SetupReadRoutes configure les routes du suivi de lecture
+func SetupReadRoutes(router *mux.Router, readController *controllers.ReadController) {
+	// Routes protégées
+	router.Handle("/api/threads/{id:[0-9]+}/first-unread", middleware.AuthMiddleware(http.HandlerFunc(readController.FirstUnread))).Methods("GET")
+	router.Handle("/api/categories/{id:[0-9]+}/read", middleware.AuthMiddleware(http.HandlerFunc(readController.MarkCategoryRead))).Methods("POST")
+}
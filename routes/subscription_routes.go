@@ -0,0 +1,22 @@
+package routes
+
+import (
+	"net/http"
+
+	"projet-forum/controllers"
+	"projet-forum/middleware"
+
+	"github.com/gorilla/mux"
+)
+
+// SetupSubscriptionRoutes configure les niveaux de suivi des fils, catégories et tags
+func SetupSubscriptionRoutes(router *mux.Router, subscriptionController *controllers.SubscriptionController) {
+	// Routes protégées
+	router.Handle("/api/threads/{id:[0-9]+}/watch", middleware.AuthMiddleware(http.HandlerFunc(subscriptionController.GetThreadWatch))).Methods("GET")
+	router.Handle("/api/threads/{id:[0-9]+}/watch", middleware.AuthMiddleware(http.HandlerFunc(subscriptionController.SetThreadWatch))).Methods("PUT")
+	router.Handle("/api/threads/{id:[0-9]+}/watch", middleware.AuthMiddleware(http.HandlerFunc(subscriptionController.ClearThreadWatch))).Methods("DELETE")
+	router.Handle("/api/categories/{id:[0-9]+}/watch", middleware.AuthMiddleware(http.HandlerFunc(subscriptionController.SetCategoryWatch))).Methods("PUT")
+	router.Handle("/api/tags/{tag}/watch", middleware.AuthMiddleware(http.HandlerFunc(subscriptionController.SetTagWatch))).Methods("PUT")
+	router.Handle("/api/users/me/watches", middleware.AuthMiddleware(http.HandlerFunc(subscriptionController.ListWatches))).Methods("GET")
+	router.Handle("/api/users/me/watched/unread", middleware.AuthMiddleware(http.HandlerFunc(subscriptionController.ListUnreadWatched))).Methods("GET")
+}
@@ -0,0 +1,107 @@
+package services
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+
+	"projet-forum/models"
+)
+
+var badgeCodePattern = regexp.MustCompile(`^[a-z0-9_]{1,50}$`)
+
+// BadgeService attribue les badges définis dans la configuration : à chaque événement pour les
+// utilisateurs concernés, et périodiquement pour tous (rattrapage)
+type BadgeService struct {
+	DB            *sql.DB
+	Badges        []*models.Badge
+	Notifications *NotificationService
+	byCode        map[string]*models.Badge
+}
+
+// NewBadgeServiceFromFile charge les définitions de badges d'un fichier JSON (ex. config/badges.json)
+func NewBadgeServiceFromFile(db *sql.DB, path string, notifications *NotificationService) (*BadgeService, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("lecture des badges: %v", err)
+	}
+	var badges []*models.Badge
+	if err := json.Unmarshal(data, &badges); err != nil {
+		return nil, fmt.Errorf("%s invalide: %v", path, err)
+	}
+
+	byCode := make(map[string]*models.Badge, len(badges))
+	for _, badge := range badges {
+		switch {
+		case !badgeCodePattern.MatchString(badge.Code):
+			return nil, fmt.Errorf("%s invalide: code de badge %q", path, badge.Code)
+		case byCode[badge.Code] != nil:
+			return nil, fmt.Errorf("%s invalide: badge %s défini deux fois", path, badge.Code)
+		case badge.Name == "":
+			return nil, fmt.Errorf("%s invalide: badge %s sans nom", path, badge.Code)
+		case !models.IsValidBadgeMetric(badge.Metric):
+			return nil, fmt.Errorf("%s invalide: métrique inconnue %q pour le badge %s", path, badge.Metric, badge.Code)
+		case badge.Threshold <= 0:
+			return nil, fmt.Errorf("%s invalide: seuil du badge %s", path, badge.Code)
+		}
+		byCode[badge.Code] = badge
+	}
+
+	return &BadgeService{DB: db, Badges: badges, Notifications: notifications, byCode: byCode}, nil
+}
+
+// Evaluate attribue à un utilisateur les badges qu'il vient de mériter et le notifie. Les erreurs sont
+// journalisées : le rattrapage périodique attribuera les badges manqués.
+func (s *BadgeService) Evaluate(userID int64) {
+	if s == nil || userID == 0 {
+		return
+	}
+	awarded, err := models.AwardBadges(s.DB, userID, s.Badges)
+	for _, badge := range awarded {
+		s.Notifications.Notify(models.NotificationInput{
+			UserID: userID,
+			Type:   models.NotificationBadge,
+			Detail: badge.Name,
+		})
+	}
+	if err != nil {
+		log.Printf("Erreur lors de l'attribution des badges de l'utilisateur %d: %v", userID, err)
+	}
+}
+
+// Backfill attribue chaque badge à tous les utilisateurs qui remplissent sa condition. Ces attributions
+// ne sont pas notifiées, pour ne pas inonder les membres quand un badge est ajouté à la configuration.
+func (s *BadgeService) Backfill() error {
+	for _, badge := range s.Badges {
+		count, err := models.BackfillBadge(s.DB, badge)
+		if err != nil {
+			return fmt.Errorf("badge %s: %v", badge.Code, err)
+		}
+		if count > 0 {
+			log.Printf("Badge %s attribué à %d utilisateur(s)", badge.Code, count)
+		}
+	}
+	return nil
+}
+
+// UserBadges retourne les badges obtenus par un utilisateur, les plus récents en premier ; les badges
+// retirés de la configuration ne sont plus affichés
+func (s *BadgeService) UserBadges(userID int64) ([]*models.UserBadge, error) {
+	badges := []*models.UserBadge{}
+	if s == nil {
+		return badges, nil
+	}
+	awards, err := models.GetBadgeAwards(s.DB, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, award := range awards {
+		if badge := s.byCode[award.Code]; badge != nil {
+			badges = append(badges, &models.UserBadge{Badge: badge, AwardedAt: award.AwardedAt})
+		}
+	}
+	return badges, nil
+}
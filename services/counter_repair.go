@@ -0,0 +1,20 @@
+package services
+
+import (
+	"database/sql"
+	"log"
+
+	"projet-forum/models"
+)
+
+// RepairCounters corrige les compteurs dénormalisés (messages et fils par utilisateur, messages par
+// fil) qui ne correspondent plus aux lignes réelles, et journalise chaque type de compteur corrigé
+func RepairCounters(db *sql.DB) (map[string]int64, error) {
+	repaired, err := models.RepairCounters(db)
+	for kind, n := range repaired {
+		if n > 0 {
+			log.Printf("Compteurs %s corrigés: %d", kind, n)
+		}
+	}
+	return repaired, err
+}
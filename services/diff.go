@@ -0,0 +1,122 @@
+package services
+
+import "unicode"
+
+// Types d'opérations d'un diff
+const (
+	DiffEqual  = "equal"
+	DiffInsert = "insert"
+	DiffDelete = "delete"
+)
+
+// Au-delà de ce nombre de cellules, la table LCS prendrait trop de mémoire : le passage modifié
+// est alors présenté comme entièrement supprimé puis réécrit
+const maxDiffCells = 4000000
+
+// DiffOp est un fragment de texte conservé, ajouté ou supprimé
+type DiffOp struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// DiffWords compare deux textes mot à mot (les espaces et retours à la ligne sont des fragments à part
+// entière) ; concaténer les fragments equal et delete redonne a, equal et insert redonne b
+func DiffWords(a, b string) []DiffOp {
+	x, y := splitWords(a), splitWords(b)
+
+	// Le début et la fin communs sont retirés avant le calcul, la plupart des modifications étant locales
+	prefix := 0
+	for prefix < len(x) && prefix < len(y) && x[prefix] == y[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(x)-prefix && suffix < len(y)-prefix && x[len(x)-1-suffix] == y[len(y)-1-suffix] {
+		suffix++
+	}
+
+	var ops []DiffOp
+	ops = appendDiff(ops, DiffEqual, x[:prefix]...)
+	ops = append(ops, diffMiddle(x[prefix:len(x)-suffix], y[prefix:len(y)-suffix])...)
+	ops = appendDiff(ops, DiffEqual, x[len(x)-suffix:]...)
+	return mergeDiff(ops)
+}
+
+// diffMiddle calcule la plus longue sous-séquence commune et en déduit les ajouts et suppressions
+func diffMiddle(x, y []string) []DiffOp {
+	if len(x)*len(y) > maxDiffCells || len(x) == 0 || len(y) == 0 {
+		return appendDiff(appendDiff(nil, DiffDelete, x...), DiffInsert, y...)
+	}
+
+	// lcs[i][j] = longueur de la LCS de x[i:] et y[j:]
+	cols := len(y) + 1
+	lcs := make([]int32, (len(x)+1)*cols)
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i*cols+j] = lcs[(i+1)*cols+j+1] + 1
+			} else if lcs[(i+1)*cols+j] >= lcs[i*cols+j+1] {
+				lcs[i*cols+j] = lcs[(i+1)*cols+j]
+			} else {
+				lcs[i*cols+j] = lcs[i*cols+j+1]
+			}
+		}
+	}
+
+	var ops []DiffOp
+	i, j := 0, 0
+	for i < len(x) && j < len(y) {
+		switch {
+		case x[i] == y[j]:
+			ops = appendDiff(ops, DiffEqual, x[i])
+			i++
+			j++
+		case lcs[(i+1)*cols+j] >= lcs[i*cols+j+1]:
+			ops = appendDiff(ops, DiffDelete, x[i])
+			i++
+		default:
+			ops = appendDiff(ops, DiffInsert, y[j])
+			j++
+		}
+	}
+	ops = appendDiff(ops, DiffDelete, x[i:]...)
+	return appendDiff(ops, DiffInsert, y[j:]...)
+}
+
+func appendDiff(ops []DiffOp, op string, words ...string) []DiffOp {
+	for _, word := range words {
+		ops = append(ops, DiffOp{Op: op, Text: word})
+	}
+	return ops
+}
+
+// mergeDiff regroupe les fragments consécutifs de même type
+func mergeDiff(ops []DiffOp) []DiffOp {
+	merged := []DiffOp{}
+	for _, op := range ops {
+		if n := len(merged); n > 0 && merged[n-1].Op == op.Op {
+			merged[n-1].Text += op.Text
+			continue
+		}
+		merged = append(merged, op)
+	}
+	return merged
+}
+
+// splitWords découpe un texte en suites alternées de caractères blancs et non blancs
+func splitWords(s string) []string {
+	var words []string
+	start := 0
+	var prevSpace bool
+	for i, r := range s {
+		space := unicode.IsSpace(r)
+		if i > 0 && space != prevSpace {
+			words = append(words, s[start:i])
+			start = i
+		}
+		prevSpace = space
+	}
+	if start < len(s) {
+		words = append(words, s[start:])
+	}
+	return words
+}
@@ -0,0 +1,126 @@
+package services
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// rebuildDiff reconstruit l'ancien texte (equal + delete) et le nouveau (equal + insert)
+func rebuildDiff(ops []DiffOp) (a, b string) {
+	var oldText, newText strings.Builder
+	for _, op := range ops {
+		switch op.Op {
+		case DiffEqual:
+			oldText.WriteString(op.Text)
+			newText.WriteString(op.Text)
+		case DiffDelete:
+			oldText.WriteString(op.Text)
+		case DiffInsert:
+			newText.WriteString(op.Text)
+		}
+	}
+	return oldText.String(), newText.String()
+}
+
+// numberedWords retourne « prefix0 prefix1 ... » avec n mots
+func numberedWords(prefix string, n int) string {
+	words := make([]string, n)
+	for i := range words {
+		words[i] = fmt.Sprintf("%s%d", prefix, i)
+	}
+	return strings.Join(words, " ")
+}
+
+func TestDiffWords(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want []DiffOp
+	}{
+		{"deux textes vides", "", "", []DiffOp{}},
+		{"ancien texte vide", "", "Bonjour à tous", []DiffOp{{DiffInsert, "Bonjour à tous"}}},
+		{"nouveau texte vide", "Bonjour à tous", "", []DiffOp{{DiffDelete, "Bonjour à tous"}}},
+		{"identiques", "rien ne change", "rien ne change", []DiffOp{{DiffEqual, "rien ne change"}}},
+		{
+			"mot remplacé", "le chat dort", "le chien dort",
+			[]DiffOp{{DiffEqual, "le "}, {DiffDelete, "chat"}, {DiffInsert, "chien"}, {DiffEqual, " dort"}},
+		},
+		{
+			"mot ajouté", "le chat dort", "le gros chat dort",
+			[]DiffOp{{DiffEqual, "le "}, {DiffInsert, "gros "}, {DiffEqual, "chat dort"}},
+		},
+		{
+			"mot supprimé", "le gros chat dort", "le chat dort",
+			[]DiffOp{{DiffEqual, "le "}, {DiffDelete, "gros "}, {DiffEqual, "chat dort"}},
+		},
+		{
+			"espaces modifiés", "un  deux\ntrois", "un deux trois",
+			[]DiffOp{{DiffEqual, "un"}, {DiffDelete, "  "}, {DiffInsert, " "}, {DiffEqual, "deux"}, {DiffDelete, "\n"}, {DiffInsert, " "}, {DiffEqual, "trois"}},
+		},
+		{"accents", "élève", "élèves", []DiffOp{{DiffDelete, "élève"}, {DiffInsert, "élèves"}}},
+	}
+	for _, tt := range tests {
+		ops := DiffWords(tt.a, tt.b)
+		if !reflect.DeepEqual(ops, tt.want) {
+			t.Errorf("%s : DiffWords(%q, %q) = %v, attendu %v", tt.name, tt.a, tt.b, ops, tt.want)
+		}
+		if a, b := rebuildDiff(ops); a != tt.a || b != tt.b {
+			t.Errorf("%s : reconstruction (%q, %q), attendu (%q, %q)", tt.name, a, b, tt.a, tt.b)
+		}
+	}
+}
+
+func TestDiffWordsRebuildsBothTexts(t *testing.T) {
+	texts := []string{
+		"",
+		" ",
+		"a",
+		"Premier paragraphe.\n\nSecond paragraphe avec `du code` et un lien.",
+		"Premier paragraphe modifié.\n\nSecond paragraphe avec un lien.\n\nUn troisième !",
+		"  espaces en tête et en fin  ",
+		"a b a b a b",
+		"b a b a b a c",
+	}
+	for _, a := range texts {
+		for _, b := range texts {
+			ops := DiffWords(a, b)
+			if gotA, gotB := rebuildDiff(ops); gotA != a || gotB != b {
+				t.Errorf("DiffWords(%q, %q) reconstruit (%q, %q)", a, b, gotA, gotB)
+			}
+			for i, op := range ops {
+				if op.Text == "" {
+					t.Errorf("DiffWords(%q, %q) : fragment vide %v", a, b, op)
+				}
+				if i > 0 && ops[i-1].Op == op.Op {
+					t.Errorf("DiffWords(%q, %q) : fragments %q consécutifs non fusionnés", a, b, op.Op)
+				}
+			}
+		}
+	}
+}
+
+func TestDiffWordsOverLimit(t *testing.T) {
+	// Chaque mot et chaque espace est un fragment : la partie modifiée dépasse maxDiffCells
+	n := 1100
+	if cells := (2*n - 1) * (2*n - 1); cells <= maxDiffCells {
+		t.Fatalf("%d cellules, le test doit dépasser maxDiffCells", cells)
+	}
+	a := "début " + numberedWords("a", n) + " fin"
+	b := "début " + numberedWords("b", n) + " fin"
+
+	ops := DiffWords(a, b)
+	want := []DiffOp{
+		{DiffEqual, "début "},
+		{DiffDelete, numberedWords("a", n)},
+		{DiffInsert, numberedWords("b", n)},
+		{DiffEqual, " fin"},
+	}
+	if !reflect.DeepEqual(ops, want) {
+		t.Errorf("au-delà de maxDiffCells, attendu une suppression puis un ajout du passage modifié, obtenu %d fragments", len(ops))
+	}
+	if gotA, gotB := rebuildDiff(ops); gotA != a || gotB != b {
+		t.Errorf("au-delà de maxDiffCells, la reconstruction ne redonne pas les deux textes")
+	}
+}
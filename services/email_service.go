@@ -1 +1,357 @@
-package services
\ No newline at end of file
+package services
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"log"
+	"path/filepath"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"projet-forum/config"
+	"projet-forum/models"
+)
+
+// Portées possibles d'un lien de désinscription
+const (
+	UnsubscribeReplies = "replies"
+	UnsubscribeDigest  = "digest"
+	unsubscribeThread  = "thread:"
+)
+
+// digestThreadLimit est le nombre maximal de fils présentés dans un digest
+const digestThreadLimit = 10
+
+// ErrInvalidUnsubscribeToken est retourné pour un jeton de désinscription falsifié ou mal formé
+var ErrInvalidUnsubscribeToken = errors.New("invalid unsubscribe token")
+
+// EmailService envoie les emails de réponse et les digests à partir des templates HTML et texte
+type EmailService struct {
+	DB      *sql.DB
+	Mailer  Mailer
+	BaseURL string
+
+	secret []byte
+	html   *htmltemplate.Template
+	text   *texttemplate.Template
+}
+
+// NewEmailService charge les templates d'emails (*.html et *.txt) du dossier templateDir
+func NewEmailService(db *sql.DB, mailer Mailer, baseURL, templateDir string) (*EmailService, error) {
+	html, err := htmltemplate.ParseGlob(filepath.Join(templateDir, "*.html"))
+	if err != nil {
+		return nil, fmt.Errorf("erreur lors du chargement des templates HTML: %v", err)
+	}
+	text, err := texttemplate.ParseGlob(filepath.Join(templateDir, "*.txt"))
+	if err != nil {
+		return nil, fmt.Errorf("erreur lors du chargement des templates texte: %v", err)
+	}
+
+	return &EmailService{
+		DB:      db,
+		Mailer:  mailer,
+		BaseURL: strings.TrimRight(baseURL, "/"),
+		secret:  []byte("unsubscribe:" + config.GetEnvOrDefault("JWT_SECRET", "votre_clé_secrète_jwt")),
+		html:    html,
+		text:    text,
+	}, nil
+}
+
+// render produit les deux versions d'un email à partir des templates name.txt et name.html
+func (s *EmailService) render(name string, data interface{}) (string, string, error) {
+	var text, html bytes.Buffer
+	if err := s.text.ExecuteTemplate(&text, name+".txt", data); err != nil {
+		return "", "", err
+	}
+	if err := s.html.ExecuteTemplate(&html, name+".html", data); err != nil {
+		return "", "", err
+	}
+	return text.String(), html.String(), nil
+}
+
+// UnsubscribeToken signe une portée de désinscription pour un utilisateur
+func (s *EmailService) UnsubscribeToken(userID int64, scope string) string {
+	payload := fmt.Sprintf("%d:%s", userID, scope)
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString([]byte(payload)) + "." +
+		base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// ParseUnsubscribeToken vérifie la signature d'un jeton et retourne l'utilisateur et la portée
+func (s *EmailService) ParseUnsubscribeToken(token string) (int64, string, error) {
+	encodedPayload, encodedSig, ok := strings.Cut(token, ".")
+	if !ok {
+		return 0, "", ErrInvalidUnsubscribeToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil {
+		return 0, "", ErrInvalidUnsubscribeToken
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(encodedSig)
+	if err != nil {
+		return 0, "", ErrInvalidUnsubscribeToken
+	}
+
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write(payload)
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return 0, "", ErrInvalidUnsubscribeToken
+	}
+
+	idStr, scope, ok := strings.Cut(string(payload), ":")
+	if !ok {
+		return 0, "", ErrInvalidUnsubscribeToken
+	}
+	userID, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return 0, "", ErrInvalidUnsubscribeToken
+	}
+	return userID, scope, nil
+}
+
+// ThreadUnsubscribeScope retourne la portée de désinscription d'un fil de discussion
+func ThreadUnsubscribeScope(threadID int64) string {
+	return fmt.Sprintf("%s%d", unsubscribeThread, threadID)
+}
+
+// ApplyUnsubscribe exécute la désinscription décrite par un jeton et retourne sa portée
+func (s *EmailService) ApplyUnsubscribe(token string) (string, error) {
+	userID, scope, err := s.ParseUnsubscribeToken(token)
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case scope == UnsubscribeReplies:
+		err = models.SetReplyEmails(s.DB, userID, false)
+	case scope == UnsubscribeDigest:
+		err = models.SetDigestFrequency(s.DB, userID, models.DigestNone)
+	case strings.HasPrefix(scope, unsubscribeThread):
+		threadID, parseErr := strconv.ParseInt(strings.TrimPrefix(scope, unsubscribeThread), 10, 64)
+		if parseErr != nil {
+			return "", ErrInvalidUnsubscribeToken
+		}
+		err = models.SetThreadWatchLevel(s.DB, userID, threadID, models.WatchNormal)
+	default:
+		return "", ErrInvalidUnsubscribeToken
+	}
+	return scope, err
+}
+
+func (s *EmailService) unsubscribeURL(userID int64, scope string) string {
+	return s.BaseURL + "/unsubscribe?token=" + s.UnsubscribeToken(userID, scope)
+}
+
+// listUnsubscribeHeaders ajoute les en-têtes de désinscription en un clic (RFC 8058)
+func (s *EmailService) listUnsubscribeHeaders(unsubscribeURL string) map[string]string {
+	return map[string]string{
+		"List-Unsubscribe":      "<" + unsubscribeURL + ">",
+		"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+	}
+}
+
+type replyEmailData struct {
+	Username          string
+	AuthorName        string
+	ThreadTitle       string
+	Excerpt           string
+	ThreadURL         string
+	UnsubscribeURL    string
+	UnsubscribeAllURL string
+	PreferencesURL    string
+}
+
+// NotifyReply envoie en arrière-plan un email aux abonnés d'un fil après une réponse
+func (s *EmailService) NotifyReply(thread *models.Thread, message *models.Message) {
+	if s == nil {
+		return
+	}
+	go func() {
+		if err := s.SendReplyEmails(thread, message); err != nil {
+			log.Printf("Erreur lors de l'envoi des emails de réponse pour le fil %d: %v", thread.ID, err)
+		}
+	}()
+}
+
+// SendReplyEmails envoie un email à chaque utilisateur qui surveille le fil (niveau watching)
+// et peut encore le consulter
+func (s *EmailService) SendReplyEmails(thread *models.Thread, message *models.Message) error {
+	watchers, err := models.GetThreadWatchers(s.DB, thread, models.WatchWatching)
+	if err != nil {
+		return err
+	}
+	recipients := watchers[:0]
+	for _, userID := range watchers {
+		if userID != message.AuthorID {
+			recipients = append(recipients, userID)
+		}
+	}
+	subscribers, err := models.GetReplyEmailSubscribers(s.DB, recipients)
+	if err != nil {
+		return err
+	}
+
+	authorName := ""
+	if message.Author != nil {
+		authorName = message.Author.Username
+	}
+	if authorName == "" {
+		if author, err := models.GetUserByID(s.DB, message.AuthorID); err == nil {
+			authorName = author.Username
+		}
+	}
+
+	var lastErr error
+	for _, sub := range subscribers {
+		allowed, err := models.CanViewThread(s.DB, thread, sub.UserID, sub.Role)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		blocked, err := models.IsBlocked(s.DB, sub.UserID, message.AuthorID)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if !allowed || blocked {
+			continue
+		}
+
+		threadUnsubscribe := s.unsubscribeURL(sub.UserID, ThreadUnsubscribeScope(thread.ID))
+		data := replyEmailData{
+			Username:          sub.Username,
+			AuthorName:        authorName,
+			ThreadTitle:       thread.Title,
+			Excerpt:           excerpt(message.Content, 300),
+			ThreadURL:         fmt.Sprintf("%s/threads/show/%d", s.BaseURL, thread.ID),
+			UnsubscribeURL:    threadUnsubscribe,
+			UnsubscribeAllURL: s.unsubscribeURL(sub.UserID, UnsubscribeReplies),
+			PreferencesURL:    s.BaseURL + "/profile",
+		}
+		text, html, err := s.render("reply", data)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		err = s.Mailer.Send(&Email{
+			To:      sub.Email,
+			Subject: fmt.Sprintf("Nouvelle réponse dans « %s »", thread.Title),
+			Text:    text,
+			HTML:    html,
+			Headers: s.listUnsubscribeHeaders(threadUnsubscribe),
+		})
+		if err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+type digestEmailData struct {
+	Username       string
+	Frequency      string
+	Threads        []digestThreadData
+	UnsubscribeURL string
+	PreferencesURL string
+}
+
+type digestThreadData struct {
+	*models.DigestThread
+	URL     string
+	Excerpt string
+}
+
+// SendDueDigests envoie les digests quotidiens et hebdomadaires arrivés à échéance ;
+// un échec pour un utilisateur n'empêche pas l'envoi aux suivants
+func (s *EmailService) SendDueDigests() error {
+	now := time.Now()
+	recipients, err := models.GetDigestRecipients(s.DB, now)
+	if err != nil {
+		return err
+	}
+
+	var lastErr error
+	for _, recipient := range recipients {
+		if err := s.sendDigest(recipient, now); err != nil {
+			log.Printf("Erreur lors de l'envoi du digest à l'utilisateur %d: %v", recipient.UserID, err)
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+func (s *EmailService) sendDigest(recipient *models.DigestRecipient, now time.Time) error {
+	since := now.Add(-recipient.Frequency.Period())
+	if recipient.LastDigestAt != nil {
+		since = *recipient.LastDigestAt
+	}
+
+	threads, err := models.GetDigestThreads(s.DB, recipient.UserID, since, digestThreadLimit)
+	if err != nil {
+		return err
+	}
+	blocked, err := models.GetBlockedUserIDs(s.DB, recipient.UserID)
+	if err != nil {
+		return err
+	}
+
+	data := digestEmailData{
+		Username:       recipient.Username,
+		Frequency:      "semaine",
+		UnsubscribeURL: s.unsubscribeURL(recipient.UserID, UnsubscribeDigest),
+		PreferencesURL: s.BaseURL + "/profile",
+	}
+	if recipient.Frequency == models.DigestDaily {
+		data.Frequency = "journée"
+	}
+	for _, t := range threads {
+		if blocked[t.AuthorID] {
+			continue
+		}
+		data.Threads = append(data.Threads, digestThreadData{
+			DigestThread: t,
+			URL:          fmt.Sprintf("%s/threads/show/%d", s.BaseURL, t.ID),
+			Excerpt:      excerpt(t.Description, 200),
+		})
+	}
+
+	// Rien de neuf : on n'envoie pas d'email vide mais on avance la fenêtre
+	if len(data.Threads) > 0 {
+		text, html, err := s.render("digest", data)
+		if err != nil {
+			return err
+		}
+		err = s.Mailer.Send(&Email{
+			To:      recipient.Email,
+			Subject: "Les discussions populaires de la " + data.Frequency,
+			Text:    text,
+			HTML:    html,
+			Headers: s.listUnsubscribeHeaders(data.UnsubscribeURL),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return models.MarkDigestSent(s.DB, recipient.UserID, now)
+}
+
+// excerpt tronque un texte sur une limite de caractères (et non d'octets)
+func excerpt(content string, limit int) string {
+	content = strings.TrimSpace(content)
+	runes := []rune(content)
+	if len(runes) <= limit {
+		return content
+	}
+	return strings.TrimSpace(string(runes[:limit])) + "…"
+}
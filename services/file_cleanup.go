@@ -0,0 +1,158 @@
+package services
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"projet-forum/models"
+)
+
+// LegacyUploadsDir contient les fichiers envoyés avant le service de stockage
+const LegacyUploadsDir = "static/uploads"
+
+// OrphanGracePeriod protège les fichiers récents : un envoi écrit ses fichiers avant la pièce jointe
+const OrphanGracePeriod = time.Hour
+
+// OrphanFile est un fichier stocké qu'aucune ligne de la base ne référence
+type OrphanFile struct {
+	Key     string    `json:"key"`
+	Source  string    `json:"source"`
+	Size    int64     `json:"size_bytes"`
+	ModTime time.Time `json:"modified_at"`
+}
+
+// ListUserAttachments liste les pièces jointes d'un utilisateur avec leurs URL
+func (s *FileService) ListUserAttachments(userID int64, page, perPage int) ([]*models.UserAttachment, error) {
+	attachments, err := models.ListUserAttachments(s.DB, userID, page, perPage)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range attachments {
+		s.setAttachmentURLs(a.Attachment)
+	}
+	return attachments, nil
+}
+
+// DeleteUserAttachments supprime des pièces jointes d'un utilisateur et leurs fichiers
+func (s *FileService) DeleteUserAttachments(userID int64, ids []int64) ([]*models.Attachment, error) {
+	deleted, err := models.DeleteUserAttachments(s.DB, userID, ids)
+	if err != nil {
+		return nil, err
+	}
+	s.removeAttachments(deleted)
+	return deleted, nil
+}
+
+// FindOrphans parcourt le stockage et l'ancien dossier static/uploads à la recherche de fichiers
+// qui ne sont plus référencés (plus vieux que OrphanGracePeriod)
+func (s *FileService) FindOrphans() ([]*OrphanFile, error) {
+	attachmentKeys, avatarKeys, err := models.GetStorageReferences(s.DB)
+	if err != nil {
+		return nil, err
+	}
+	referenced := make(map[string]bool, len(attachmentKeys)+len(avatarKeys)*(len(AvatarSizes)+1))
+	for _, key := range attachmentKeys {
+		referenced[key] = true
+	}
+	for _, key := range avatarKeys {
+		referenced[key] = true
+		for _, size := range AvatarSizes {
+			referenced[AvatarKey(key, size)] = true
+		}
+	}
+
+	cutoff := time.Now().Add(-OrphanGracePeriod)
+	orphans := []*OrphanFile{}
+	err = s.Storage.List("", func(info *ObjectInfo) error {
+		if !referenced[info.Key] && info.ModTime.Before(cutoff) {
+			orphans = append(orphans, &OrphanFile{Key: info.Key, Source: "storage", Size: info.Size, ModTime: info.ModTime})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	legacy, err := s.findLegacyOrphans(cutoff)
+	if err != nil {
+		return nil, err
+	}
+	return append(orphans, legacy...), nil
+}
+
+// findLegacyOrphans cherche dans static/uploads les fichiers dont l'URL n'est plus utilisée
+func (s *FileService) findLegacyOrphans(cutoff time.Time) ([]*OrphanFile, error) {
+	urls, err := models.GetLegacyUploadReferences(s.DB)
+	if err != nil {
+		return nil, err
+	}
+	referenced := make(map[string]bool, len(urls))
+	for _, u := range urls {
+		referenced[u] = true
+	}
+
+	orphans := []*OrphanFile{}
+	err = filepath.Walk(LegacyUploadsDir, func(p string, stat os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if stat.IsDir() {
+			return nil
+		}
+		key := filepath.ToSlash(p)
+		if !referenced["/"+key] && stat.ModTime().Before(cutoff) {
+			orphans = append(orphans, &OrphanFile{Key: key, Source: "legacy", Size: stat.Size(), ModTime: stat.ModTime()})
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return orphans, nil
+	}
+	return orphans, err
+}
+
+// CleanupOrphans supprime les fichiers orphelins et retourne leur nombre et l'espace libéré. Chaque
+// fichier du stockage est vérifié à nouveau sous le verrou de sa clé juste avant sa suppression : un envoi
+// a pu réserver entre-temps un fichier identique.
+func (s *FileService) CleanupOrphans() (int, int64, error) {
+	if err := models.PurgeStorageReservations(s.DB); err != nil {
+		return 0, 0, err
+	}
+	orphans, err := s.FindOrphans()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	removed := 0
+	var freed int64
+	for _, orphan := range orphans {
+		deleted := true
+		if orphan.Source == "legacy" {
+			err = os.Remove(filepath.FromSlash(orphan.Key))
+		} else {
+			err = models.WithStorageKeyLock(s.DB, BaseKey(orphan.Key), func() error {
+				inUse, err := models.IsStorageKeyInUse(s.DB, BaseKey(orphan.Key))
+				if err != nil || inUse {
+					deleted = false
+					return err
+				}
+				return s.Storage.Delete(orphan.Key)
+			})
+		}
+		if err != nil {
+			log.Printf("Erreur lors de la suppression du fichier orphelin %s: %v", orphan.Key, err)
+			continue
+		}
+		if !deleted {
+			continue
+		}
+		removed++
+		freed += orphan.Size
+	}
+	if removed > 0 {
+		log.Printf("%d fichiers orphelins supprimés (%d octets libérés)", removed, freed)
+	}
+	return removed, freed, nil
+}
@@ -1 +1,497 @@
-package services
\ No newline at end of file
+package services
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"projet-forum/config"
+	"projet-forum/models"
+)
+
+// Limites des images jointes aux messages
+const (
+	MaxImagesPerMessage = 4
+	MaxImageSize        = 5 * 1024 * 1024
+	MaxImageDimension   = 4096
+	MaxImagePixels      = 12000000
+)
+
+// PrivateURLTTL est la durée de validité des URL signées des fichiers privés
+const PrivateURLTTL = 15 * time.Minute
+
+var (
+	ErrTooManyImages      = fmt.Errorf("too many images (max %d)", MaxImagesPerMessage)
+	ErrImageTooLarge      = fmt.Errorf("image too large (max %d MB)", MaxImageSize/(1024*1024))
+	ErrUnsupportedImage   = errors.New("unsupported image format (jpeg, png or gif)")
+	ErrImageDimensions    = fmt.Errorf("image dimensions too large (max %dx%d, %d megapixels)", MaxImageDimension, MaxImageDimension, MaxImagePixels/1000000)
+	ErrInvalidImageHeader = errors.New("invalid image data")
+)
+
+// imageExtensions associe les types détectés aux extensions des fichiers enregistrés
+var imageExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+// StoredImage décrit une image traitée et enregistrée dans le stockage, avec sa miniature
+type StoredImage struct {
+	Key          string
+	ThumbnailKey string
+	OriginalName string
+	MimeType     string
+	Size         int64
+	Width        int
+	Height       int
+	// ReservationID protège les fichiers jusqu'à leur rattachement à un message
+	ReservationID int64
+}
+
+// FileService enregistre les fichiers envoyés (pièces jointes, avatars) dans le stockage configuré
+// et les supprime quand plus rien ne les référence. Les clés étant adressées par le contenu, un même
+// fichier peut être partagé par plusieurs messages ou utilisateurs.
+type FileService struct {
+	DB      *sql.DB
+	Storage Storage
+	Signer  *URLSigner
+	Images  *ImageProcessor
+	Quotas  map[string]int64
+}
+
+// NewFileServiceFromEnv crée le service de fichiers avec le stockage choisi par STORAGE_DRIVER
+func NewFileServiceFromEnv(db *sql.DB) (*FileService, error) {
+	signer := NewURLSigner(config.GetEnvOrDefault("JWT_SECRET", "votre_clé_secrète_jwt"))
+	storage, err := NewStorageFromEnv(signer)
+	if err != nil {
+		return nil, err
+	}
+	quotas, err := quotasFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	workers, _ := strconv.Atoi(config.GetEnvOrDefault("IMAGE_WORKERS", "2"))
+	return &FileService{
+		DB:      db,
+		Storage: storage,
+		Signer:  signer,
+		Images:  NewImageProcessor(workers, 8*workers),
+		Quotas:  quotas,
+	}, nil
+}
+
+// URL retourne l'adresse d'un fichier : publique, ou signée et temporaire pour une clé privée
+func (s *FileService) URL(key string) string {
+	var expires time.Duration
+	if IsPrivateKey(key) {
+		expires = PrivateURLTTL
+	}
+	u, err := s.Storage.URL(key, expires)
+	if err != nil {
+		log.Printf("Erreur lors de la construction de l'URL de %s: %v", key, err)
+		return ""
+	}
+	return u
+}
+
+// inspectImage vérifie le contenu réel d'une image (signature et dimensions), sans se fier
+// au Content-Type envoyé par le client
+func inspectImage(data []byte) (string, int, int, error) {
+	mimeType := http.DetectContentType(data)
+	if _, ok := imageExtensions[mimeType]; !ok {
+		return "", 0, 0, ErrUnsupportedImage
+	}
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || "image/"+format != mimeType {
+		return "", 0, 0, ErrInvalidImageHeader
+	}
+	if config.Width < 1 || config.Height < 1 {
+		return "", 0, 0, ErrInvalidImageHeader
+	}
+	// Les dimensions déclarées sont vérifiées avant tout décodage : un petit fichier
+	// ne peut pas réclamer des centaines de mégaoctets une fois décompressé
+	if config.Width > MaxImageDimension || config.Height > MaxImageDimension || config.Width*config.Height > MaxImagePixels {
+		return "", 0, 0, ErrImageDimensions
+	}
+	return mimeType, config.Width, config.Height, nil
+}
+
+// readUpload lit un fichier envoyé en refusant ceux qui dépassent la taille maximale
+func readUpload(header *multipart.FileHeader) ([]byte, error) {
+	if header.Size > MaxImageSize {
+		return nil, ErrImageTooLarge
+	}
+	file, err := header.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, MaxImageSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxImageSize {
+		return nil, ErrImageTooLarge
+	}
+	return data, nil
+}
+
+// putIfAbsent enregistre un fichier sauf s'il existe déjà (même contenu, même clé). La clé de base du
+// fichier doit avoir été réservée (models.ReserveStorageKey) : sans réservation, une suppression
+// simultanée du dernier fichier identique pourrait retirer celui que l'envoi va référencer.
+func (s *FileService) putIfAbsent(key string, data []byte, contentType string) error {
+	if _, err := s.Storage.Stat(key); err == nil {
+		return nil
+	} else if err != ErrObjectNotFound {
+		return err
+	}
+	return s.Storage.Put(key, bytes.NewReader(data), int64(len(data)), contentType)
+}
+
+// SaveImages valide toutes les images avant d'en traiter une seule, puis les ré-encode (sans
+// métadonnées) et les enregistre avec leur miniature. Les images d'un fil privé reçoivent une clé
+// privée, servie uniquement par URL signée. En cas d'erreur, les fichiers déjà écrits et non
+// référencés sont supprimés.
+func (s *FileService) SaveImages(userID int64, role string, headers []*multipart.FileHeader, private bool) ([]*StoredImage, error) {
+	if len(headers) > MaxImagesPerMessage {
+		return nil, ErrTooManyImages
+	}
+
+	prefix := "attachments"
+	if private {
+		prefix = PrivatePrefix + prefix
+	}
+
+	uploads := make([][]byte, 0, len(headers))
+	for _, header := range headers {
+		data, err := readUpload(header)
+		if err != nil {
+			return nil, err
+		}
+		if _, _, _, err := inspectImage(data); err != nil {
+			return nil, err
+		}
+		uploads = append(uploads, data)
+	}
+	if len(uploads) == 0 {
+		return nil, nil
+	}
+
+	type processed struct {
+		image     *StoredImage
+		full      *ProcessedImage
+		thumbnail *ProcessedImage
+	}
+	results := make([]processed, 0, len(uploads))
+	var total int64
+	for i, data := range uploads {
+		full, thumbnail, err := s.Images.ProcessAttachment(data)
+		if err != nil {
+			return nil, err
+		}
+
+		// La clé dérive du fichier envoyé : le traitement étant déterministe, un même envoi
+		// donne toujours les mêmes fichiers
+		img := &StoredImage{
+			Key:          ContentKey(prefix, data, full.Ext),
+			OriginalName: filepath.Base(headers[i].Filename),
+			MimeType:     full.MimeType,
+			Size:         int64(len(full.Data)),
+			Width:        full.Width,
+			Height:       full.Height,
+		}
+		img.ThumbnailKey = VariantKey(img.Key, "thumb")
+		results = append(results, processed{image: img, full: full, thumbnail: thumbnail})
+		total += img.Size
+	}
+
+	// Le quota porte sur la taille des images ré-encodées ; ce premier contrôle évite d'enregistrer
+	// les fichiers, il est refait sous verrou à l'insertion des pièces jointes
+	if quota := s.Quota(role); quota != UnlimitedQuota {
+		_, used, err := models.GetUserStorageUsage(s.DB, userID)
+		if err != nil {
+			return nil, err
+		}
+		if used+total > quota {
+			return nil, ErrQuotaExceeded
+		}
+	}
+
+	stored := make([]*StoredImage, 0, len(results))
+	for _, r := range results {
+		var err error
+		r.image.ReservationID, err = models.ReserveStorageKey(s.DB, r.image.Key)
+		if err == nil {
+			err = s.putIfAbsent(r.image.Key, r.full.Data, r.full.MimeType)
+		}
+		if err == nil {
+			err = s.putIfAbsent(r.image.ThumbnailKey, r.thumbnail.Data, r.thumbnail.MimeType)
+		}
+		if err != nil {
+			s.DiscardImages(append(stored, r.image))
+			return nil, err
+		}
+		stored = append(stored, r.image)
+	}
+	return stored, nil
+}
+
+// NewAttachments prépare les pièces jointes d'images enregistrées, insérées avec leur message
+func (s *FileService) NewAttachments(images []*StoredImage) []*models.Attachment {
+	attachments := make([]*models.Attachment, 0, len(images))
+	for _, img := range images {
+		attachments = append(attachments, &models.Attachment{
+			StorageKey:   img.Key,
+			ThumbnailKey: img.ThumbnailKey,
+			OriginalName: img.OriginalName,
+			MimeType:     img.MimeType,
+			SizeBytes:    img.Size,
+			Width:        img.Width,
+			Height:       img.Height,
+		})
+	}
+	return attachments
+}
+
+// CommitImages libère les réservations d'images désormais référencées par des pièces jointes et
+// renseigne les URL de celles-ci
+func (s *FileService) CommitImages(images []*StoredImage, attachments []*models.Attachment) {
+	for _, img := range images {
+		s.ReleaseReservation(img.ReservationID)
+	}
+	for _, a := range attachments {
+		s.setAttachmentURLs(a)
+	}
+}
+
+// LoadAttachments ajoute leurs pièces jointes aux messages
+func (s *FileService) LoadAttachments(messages []*models.Message) error {
+	ids := make([]int64, 0, len(messages))
+	for _, m := range messages {
+		ids = append(ids, m.ID)
+	}
+	byMessage, err := models.GetAttachmentsForMessages(s.DB, ids)
+	if err != nil {
+		return err
+	}
+	for _, m := range messages {
+		m.Attachments = byMessage[m.ID]
+		for _, a := range m.Attachments {
+			s.setAttachmentURLs(a)
+		}
+	}
+	return nil
+}
+
+func (s *FileService) setAttachmentURLs(a *models.Attachment) {
+	a.URL = s.URL(a.StorageKey)
+	if a.ThumbnailKey != "" {
+		a.ThumbnailURL = s.URL(a.ThumbnailKey)
+	}
+}
+
+// SaveAvatar recadre l'avatar d'un utilisateur aux tailles d'AvatarSizes, l'enregistre et retourne
+// les URL publiques de chaque taille. L'ancien avatar est supprimé s'il n'est plus utilisé.
+func (s *FileService) SaveAvatar(userID int64, header *multipart.FileHeader) (map[int]string, error) {
+	data, err := readUpload(header)
+	if err != nil {
+		return nil, err
+	}
+	if _, _, _, err := inspectImage(data); err != nil {
+		return nil, err
+	}
+	avatars, err := s.Images.ProcessAvatar(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// avatar_key désigne l'ensemble des tailles ; chaque fichier en est une variante
+	key := ContentKey("avatars", data, avatars[AvatarSizes[0]].Ext)
+	reservationID, err := models.ReserveStorageKey(s.DB, key)
+	if err != nil {
+		return nil, err
+	}
+	for _, size := range AvatarSizes {
+		if err := s.putIfAbsent(AvatarKey(key, size), avatars[size].Data, avatars[size].MimeType); err != nil {
+			s.ReleaseReservation(reservationID)
+			s.removeAvatarIfUnused(key)
+			return nil, err
+		}
+	}
+
+	urls := s.AvatarURLs(key)
+	oldKey, err := models.SetUserAvatar(s.DB, userID, key, urls[AvatarSizes[len(AvatarSizes)-1]])
+	s.ReleaseReservation(reservationID)
+	if err != nil {
+		s.removeAvatarIfUnused(key)
+		return nil, err
+	}
+	if oldKey != "" && oldKey != key {
+		s.removeAvatarIfUnused(oldKey)
+	}
+	return urls, nil
+}
+
+// AvatarURLs retourne l'URL de chaque taille d'un avatar
+func (s *FileService) AvatarURLs(key string) map[int]string {
+	urls := make(map[int]string, len(AvatarSizes))
+	for _, size := range AvatarSizes {
+		urls[size] = s.URL(AvatarKey(key, size))
+	}
+	return urls
+}
+
+// SaveReactionImage enregistre l'image d'une réaction personnalisée et retourne sa clé avec
+// l'identifiant de sa réservation, à libérer (ReleaseReservation) une fois la réaction enregistrée
+func (s *FileService) SaveReactionImage(header *multipart.FileHeader) (string, int64, error) {
+	data, err := readUpload(header)
+	if err != nil {
+		return "", 0, err
+	}
+	if _, _, _, err := inspectImage(data); err != nil {
+		return "", 0, err
+	}
+	icon, err := s.Images.ProcessReactionIcon(data)
+	if err != nil {
+		return "", 0, err
+	}
+	key := ContentKey("reactions", icon.Data, icon.Ext)
+	reservationID, err := models.ReserveStorageKey(s.DB, key)
+	if err != nil {
+		return "", 0, err
+	}
+	if err := s.putIfAbsent(key, icon.Data, icon.MimeType); err != nil {
+		s.ReleaseReservation(reservationID)
+		s.RemoveReactionImage(key)
+		return "", 0, err
+	}
+	return key, reservationID, nil
+}
+
+// RemoveReactionImage supprime l'image d'une réaction si plus aucune réaction ne l'utilise
+func (s *FileService) RemoveReactionImage(key string) {
+	if key != "" {
+		s.removeIfUnused(key, key)
+	}
+}
+
+// ReleaseReservation libère la réservation d'un envoi dont les fichiers sont référencés en base ou
+// abandonnés ; en cas d'échec, elle expire d'elle-même
+func (s *FileService) ReleaseReservation(id int64) {
+	if err := models.ReleaseStorageReservation(s.DB, id); err != nil {
+		log.Printf("Erreur lors de la libération de la réservation %d: %v", id, err)
+	}
+}
+
+// DeleteMessage supprime définitivement un message et les fichiers de ses pièces jointes
+func (s *FileService) DeleteMessage(messageID int64) error {
+	attachments, err := models.GetAttachmentsForMessages(s.DB, []int64{messageID})
+	if err != nil {
+		return err
+	}
+	if err := models.DeleteMessage(s.DB, messageID); err != nil {
+		return err
+	}
+	s.removeAttachments(attachments[messageID])
+	return nil
+}
+
+// DeleteThread supprime définitivement un fil, ses messages et les fichiers de leurs pièces jointes
+func (s *FileService) DeleteThread(threadID int64) error {
+	attachments, err := models.GetThreadAttachments(s.DB, threadID)
+	if err != nil {
+		return err
+	}
+	if err := models.DeleteThread(s.DB, threadID); err != nil {
+		return err
+	}
+	s.removeAttachments(attachments)
+	return nil
+}
+
+// PurgeTrash supprime définitivement les fils et messages mis en corbeille avant une date, avec toutes
+// leurs données (pièces jointes, réactions, historique...) ; une erreur n'interrompt pas la purge
+func (s *FileService) PurgeTrash(before time.Time) (threads, messages int, err error) {
+	threadIDs, messageIDs, err := models.GetExpiredTrash(s.DB, before)
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, id := range threadIDs {
+		if e := s.DeleteThread(id); e != nil {
+			err = e
+			continue
+		}
+		threads++
+	}
+	for _, id := range messageIDs {
+		if e := s.DeleteMessage(id); e != nil {
+			err = e
+			continue
+		}
+		messages++
+	}
+	return threads, messages, err
+}
+
+// removeAttachments supprime du stockage les fichiers de pièces jointes déjà retirées de la base
+func (s *FileService) removeAttachments(attachments []*models.Attachment) {
+	for _, a := range attachments {
+		s.removeIfUnused(a.StorageKey, a.StorageKey, a.ThumbnailKey)
+	}
+}
+
+// DiscardImages supprime des images enregistrées qui ne seront rattachées à aucun message
+func (s *FileService) DiscardImages(images []*StoredImage) {
+	for _, img := range images {
+		s.ReleaseReservation(img.ReservationID)
+		s.removeIfUnused(img.Key, img.Key, img.ThumbnailKey)
+	}
+}
+
+// removeAvatarIfUnused supprime toutes les tailles d'un avatar qu'aucun utilisateur n'utilise plus
+// (la clé elle-même est incluse pour les avatars enregistrés avant le recadrage)
+func (s *FileService) removeAvatarIfUnused(key string) {
+	files := []string{key}
+	for _, size := range AvatarSizes {
+		files = append(files, AvatarKey(key, size))
+	}
+	s.removeIfUnused(key, files...)
+}
+
+// removeIfUnused supprime les fichiers d'une clé que plus aucune pièce jointe, aucun avatar, aucune
+// réaction ni aucun envoi en cours ne référence. La vérification et la suppression se font sous le verrou
+// de la clé ; la réservation de l'envoi qui abandonne ses fichiers doit avoir été libérée avant.
+func (s *FileService) removeIfUnused(key string, files ...string) {
+	err := models.WithStorageKeyLock(s.DB, key, func() error {
+		inUse, err := models.IsStorageKeyInUse(s.DB, key)
+		if err != nil || inUse {
+			return err
+		}
+		for _, file := range files {
+			if file == "" {
+				continue
+			}
+			if err := s.Storage.Delete(file); err != nil {
+				log.Printf("Erreur lors de la suppression du fichier %s: %v", file, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("Erreur lors de la vérification du fichier %s: %v", key, err)
+	}
+}
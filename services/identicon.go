@@ -0,0 +1,44 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"strconv"
+)
+
+// IdenticonVersion change si le dessin des identicons change, pour invalider les caches
+const IdenticonVersion = "1"
+
+// IdenticonSVG dessine l'avatar par défaut d'un utilisateur : une grille 5×5 symétrique dont les
+// cases et la couleur dérivent de l'empreinte de son identifiant. Le résultat ne dépend que de l'ID,
+// il peut donc être mis en cache indéfiniment.
+func IdenticonSVG(userID int64) []byte {
+	sum := sha256.Sum256([]byte("identicon:" + strconv.FormatInt(userID, 10)))
+
+	hue := (int(sum[0])<<8 | int(sum[1])) % 360
+	color := fmt.Sprintf("hsl(%d, 55%%, 50%%)", hue)
+
+	var buf bytes.Buffer
+	buf.WriteString(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 6 6" width="256" height="256" shape-rendering="crispEdges">`)
+	buf.WriteString(`<rect width="6" height="6" fill="#f0f0f0"/>`)
+	fmt.Fprintf(&buf, `<g fill="%s">`, color)
+
+	// Les trois premières colonnes sont tirées de l'empreinte, les deux dernières en sont le miroir
+	bit := 16
+	for col := 0; col < 3; col++ {
+		for row := 0; row < 5; row++ {
+			on := sum[bit/8]&(1<<(bit%8)) != 0
+			bit++
+			if !on {
+				continue
+			}
+			fmt.Fprintf(&buf, `<rect x="%g" y="%g" width="1" height="1"/>`, float64(col)+0.5, float64(row)+0.5)
+			if col < 2 {
+				fmt.Fprintf(&buf, `<rect x="%g" y="%g" width="1" height="1"/>`, float64(4-col)+0.5, float64(row)+0.5)
+			}
+		}
+	}
+	buf.WriteString(`</g></svg>`)
+	return buf.Bytes()
+}
@@ -0,0 +1,335 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"log"
+)
+
+// Tailles des avatars générés, taille maximale des miniatures des pièces jointes et taille des icônes de réaction
+var AvatarSizes = []int{32, 64, 256}
+
+const (
+	ThumbnailSize    = 320
+	ReactionIconSize = 64
+	jpegQuality      = 85
+)
+
+var ErrImageProcessorBusy = errors.New("image processing queue is full, try again later")
+
+// ImageProcessor décode et ré-encode les images dans un nombre borné de workers : un afflux
+// d'envois ne peut pas saturer le CPU ni la mémoire (une image 4096×4096 occupe 64 Mo décodée)
+type ImageProcessor struct {
+	jobs chan func()
+}
+
+// NewImageProcessor démarre les workers ; au-delà de queue images en attente, les envois sont refusés
+func NewImageProcessor(workers, queue int) *ImageProcessor {
+	if workers < 1 {
+		workers = 1
+	}
+	p := &ImageProcessor{jobs: make(chan func(), queue)}
+	for i := 0; i < workers; i++ {
+		go func() {
+			for job := range p.jobs {
+				job()
+			}
+		}()
+	}
+	return p
+}
+
+// run exécute fn dans un worker et attend son résultat ; si la file est pleine, l'appel échoue
+// immédiatement plutôt que de bloquer le gestionnaire de requête
+func (p *ImageProcessor) run(fn func() error) error {
+	done := make(chan error, 1)
+	job := func() {
+		defer func() {
+			if r := recover(); r != nil {
+				log.Printf("Erreur lors du traitement d'une image: %v", r)
+				done <- ErrInvalidImageHeader
+			}
+		}()
+		done <- fn()
+	}
+	select {
+	case p.jobs <- job:
+	default:
+		return ErrImageProcessorBusy
+	}
+	return <-done
+}
+
+// ProcessedImage est une image ré-encodée, sans métadonnées
+type ProcessedImage struct {
+	Data     []byte
+	MimeType string
+	Ext      string
+	Width    int
+	Height   int
+}
+
+// ProcessAttachment ré-encode une image jointe à un message et génère sa miniature
+func (p *ImageProcessor) ProcessAttachment(data []byte) (full, thumbnail *ProcessedImage, err error) {
+	err = p.run(func() error {
+		img, mimeType, err := decodeImage(data)
+		if err != nil {
+			return err
+		}
+		if full, err = encodeImage(img, mimeType); err != nil {
+			return err
+		}
+		w, h := fitWithin(img.Bounds().Dx(), img.Bounds().Dy(), ThumbnailSize)
+		thumbnail, err = encodeImage(resize(img, w, h), mimeType)
+		return err
+	})
+	return full, thumbnail, err
+}
+
+// ProcessAvatar recadre une image au centre en carré et la redimensionne à chaque taille d'AvatarSizes
+func (p *ImageProcessor) ProcessAvatar(data []byte) (map[int]*ProcessedImage, error) {
+	avatars := make(map[int]*ProcessedImage, len(AvatarSizes))
+	err := p.run(func() error {
+		img, mimeType, err := decodeImage(data)
+		if err != nil {
+			return err
+		}
+		square := cropSquare(img)
+		for _, size := range AvatarSizes {
+			if avatars[size], err = encodeImage(resize(square, size, size), mimeType); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return avatars, err
+}
+
+// ProcessReactionIcon recadre l'image d'une réaction personnalisée en carré de ReactionIconSize pixels
+func (p *ImageProcessor) ProcessReactionIcon(data []byte) (*ProcessedImage, error) {
+	var icon *ProcessedImage
+	err := p.run(func() error {
+		img, mimeType, err := decodeImage(data)
+		if err != nil {
+			return err
+		}
+		icon, err = encodeImage(resize(cropSquare(img), ReactionIconSize, ReactionIconSize), mimeType)
+		return err
+	})
+	return icon, err
+}
+
+// decodeImage décode une image déjà validée par inspectImage (les dimensions déclarées ont été vérifiées
+// avant décodage, ce qui écarte les bombes de décompression). Seule la première image d'un GIF est gardée.
+// L'orientation EXIF des JPEG est appliquée aux pixels, puisque les métadonnées ne sont pas conservées.
+func decodeImage(data []byte) (*image.RGBA, string, error) {
+	mimeType, _, _, err := inspectImage(data)
+	if err != nil {
+		return nil, "", err
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", ErrInvalidImageHeader
+	}
+
+	b := src.Bounds()
+	img := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(img, img.Bounds(), src, b.Min, draw.Src)
+
+	if mimeType == "image/jpeg" {
+		img = applyOrientation(img, jpegOrientation(data))
+	}
+	return img, mimeType, nil
+}
+
+// encodeImage ré-encode en JPEG les photos JPEG et en PNG tout le reste (GIF compris) ;
+// les encodeurs n'écrivent aucune métadonnée, ce qui supprime EXIF et coordonnées GPS
+func encodeImage(img image.Image, sourceType string) (*ProcessedImage, error) {
+	var buf bytes.Buffer
+	out := &ProcessedImage{Width: img.Bounds().Dx(), Height: img.Bounds().Dy()}
+	if sourceType == "image/jpeg" {
+		out.MimeType, out.Ext = "image/jpeg", ".jpg"
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+			return nil, err
+		}
+	} else {
+		out.MimeType, out.Ext = "image/png", ".png"
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, err
+		}
+	}
+	out.Data = buf.Bytes()
+	return out, nil
+}
+
+// fitWithin calcule les dimensions d'une image réduite pour tenir dans un carré, sans l'agrandir
+func fitWithin(w, h, max int) (int, int) {
+	if w <= max && h <= max {
+		return w, h
+	}
+	if w >= h {
+		return max, maxInt(1, h*max/w)
+	}
+	return maxInt(1, w*max/h), max
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// cropSquare garde le plus grand carré centré de l'image
+func cropSquare(img *image.RGBA) *image.RGBA {
+	b := img.Bounds()
+	size := b.Dx()
+	if b.Dy() < size {
+		size = b.Dy()
+	}
+	x := b.Min.X + (b.Dx()-size)/2
+	y := b.Min.Y + (b.Dy()-size)/2
+	return img.SubImage(image.Rect(x, y, x+size, y+size)).(*image.RGBA)
+}
+
+// resize redimensionne par moyenne des pixels couverts (filtre « box »), ce qui évite le crénelage
+// lors des fortes réductions ; pour un agrandissement chaque pixel source est simplement répété
+func resize(src *image.RGBA, dw, dh int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	sb := src.Bounds()
+	sw, sh := sb.Dx(), sb.Dy()
+
+	for y := 0; y < dh; y++ {
+		y0, y1 := y*sh/dh, (y+1)*sh/dh
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < dw; x++ {
+			x0, x1 := x*sw/dw, (x+1)*sw/dw
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+
+			var sum [4]uint64
+			for sy := y0; sy < y1; sy++ {
+				off := src.PixOffset(sb.Min.X+x0, sb.Min.Y+sy)
+				for sx := x0; sx < x1; sx++ {
+					sum[0] += uint64(src.Pix[off])
+					sum[1] += uint64(src.Pix[off+1])
+					sum[2] += uint64(src.Pix[off+2])
+					sum[3] += uint64(src.Pix[off+3])
+					off += 4
+				}
+			}
+			n := uint64((y1 - y0) * (x1 - x0))
+			d := dst.PixOffset(x, y)
+			for i := 0; i < 4; i++ {
+				dst.Pix[d+i] = uint8(sum[i] / n)
+			}
+		}
+	}
+	return dst
+}
+
+// applyOrientation redresse une image selon sa valeur d'orientation EXIF (1 à 8)
+func applyOrientation(src *image.RGBA, orientation int) *image.RGBA {
+	if orientation < 2 || orientation > 8 {
+		return src
+	}
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // miroir horizontal
+				sx, sy = w-1-x, y
+			case 3: // rotation de 180°
+				sx, sy = w-1-x, h-1-y
+			case 4: // miroir vertical
+				sx, sy = x, h-1-y
+			case 5: // transposition
+				sx, sy = y, x
+			case 6: // rotation de 90° horaire
+				sx, sy = y, h-1-x
+			case 7: // transposition inverse
+				sx, sy = w-1-y, h-1-x
+			case 8: // rotation de 90° anti-horaire
+				sx, sy = w-1-y, x
+			}
+			copy(dst.Pix[dst.PixOffset(x, y):dst.PixOffset(x, y)+4], src.Pix[src.PixOffset(sx, sy):src.PixOffset(sx, sy)+4])
+		}
+	}
+	return dst
+}
+
+// jpegOrientation lit l'orientation EXIF (tag 0x0112 de l'IFD0) d'un JPEG ; 1 si elle est absente
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 1
+		}
+		marker := data[i+1]
+		// Début des données compressées : les métadonnées sont toujours avant
+		if marker == 0xDA || marker == 0xD9 {
+			return 1
+		}
+		size := int(binary.BigEndian.Uint16(data[i+2:]))
+		if size < 2 || i+2+size > len(data) {
+			return 1
+		}
+		segment := data[i+4 : i+2+size]
+		if marker == 0xE1 && len(segment) > 6 && string(segment[:6]) == "Exif\x00\x00" {
+			return exifOrientation(segment[6:])
+		}
+		i += 2 + size
+	}
+	return 1
+}
+
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for k := 0; k < entries; k++ {
+		entry := ifd + 2 + k*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			if v := int(order.Uint16(tiff[entry+8:])); v >= 1 && v <= 8 {
+				return v
+			}
+			return 1
+		}
+	}
+	return 1
+}
@@ -0,0 +1,25 @@
+package services
+
+import (
+	"log"
+	"time"
+)
+
+// RunPeriodically exécute une tâche de fond à intervalle régulier jusqu'à la fermeture du canal stop
+func RunPeriodically(name string, interval time.Duration, stop <-chan struct{}, task func() error) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if err := task(); err != nil {
+					log.Printf("Erreur lors de la tâche %s: %v", name, err)
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,215 @@
+package services
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"projet-forum/config"
+)
+
+// Email est un message prêt à être envoyé, avec une version texte et une version HTML
+type Email struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+	Headers map[string]string
+}
+
+// Mailer est implémenté par chaque moyen d'envoi d'emails
+type Mailer interface {
+	Send(email *Email) error
+}
+
+// NewMailerFromEnv choisit le driver d'envoi selon EMAIL_DRIVER (smtp, file ou sink)
+func NewMailerFromEnv() (Mailer, error) {
+	from := config.GetEnvOrDefault("EMAIL_FROM", "Forum <no-reply@forum.local>")
+	if _, err := mail.ParseAddress(from); err != nil {
+		return nil, fmt.Errorf("EMAIL_FROM invalide: %v", err)
+	}
+
+	switch driver := config.GetEnvOrDefault("EMAIL_DRIVER", "file"); driver {
+	case "smtp":
+		// Par défaut on vise un serveur de test local (MailHog, Mailpit...) sans authentification
+		return &SMTPMailer{
+			Host:     config.GetEnvOrDefault("EMAIL_HOST", "localhost"),
+			Port:     config.GetEnvOrDefault("EMAIL_PORT", "1025"),
+			Username: os.Getenv("EMAIL_USER"),
+			Password: os.Getenv("EMAIL_PASSWORD"),
+			From:     from,
+		}, nil
+	case "file":
+		return &FileMailer{
+			Dir:  config.GetEnvOrDefault("EMAIL_DIR", "storage/mails"),
+			From: from,
+		}, nil
+	case "sink":
+		return &SinkMailer{From: from}, nil
+	default:
+		return nil, fmt.Errorf("driver d'email inconnu: %s", driver)
+	}
+}
+
+// SMTPMailer envoie les emails via un serveur SMTP
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// Send envoie l'email via SMTP (STARTTLS est utilisé automatiquement si le serveur le propose)
+func (m *SMTPMailer) Send(email *Email) error {
+	msg, err := buildMessage(m.From, email)
+	if err != nil {
+		return err
+	}
+
+	from, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+	return smtp.SendMail(net.JoinHostPort(m.Host, m.Port), auth, from.Address, []string{email.To}, msg)
+}
+
+// FileMailer écrit chaque email dans un fichier .eml, pratique en développement
+type FileMailer struct {
+	Dir  string
+	From string
+}
+
+// Send écrit l'email complet (en-têtes MIME compris) dans le dossier configuré
+func (m *FileMailer) Send(email *Email) error {
+	msg, err := buildMessage(m.From, email)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(m.Dir, 0755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102-150405"), randomHex(4))
+	return os.WriteFile(filepath.Join(m.Dir, name), msg, 0644)
+}
+
+// SinkMailer garde les emails en mémoire au lieu de les envoyer
+type SinkMailer struct {
+	From string
+
+	mu   sync.Mutex
+	sent []*Email
+}
+
+// Send conserve l'email et le journalise
+func (m *SinkMailer) Send(email *Email) error {
+	if _, err := buildMessage(m.From, email); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.sent = append(m.sent, email)
+	m.mu.Unlock()
+	log.Printf("Email intercepté pour %s: %s", email.To, email.Subject)
+	return nil
+}
+
+// Sent retourne les emails reçus par le sink
+func (m *SinkMailer) Sent() []*Email {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]*Email(nil), m.sent...)
+}
+
+// buildMessage construit un message MIME multipart/alternative (texte puis HTML)
+func buildMessage(from string, email *Email) ([]byte, error) {
+	to, err := mail.ParseAddress(email.To)
+	if err != nil {
+		return nil, fmt.Errorf("destinataire invalide: %v", err)
+	}
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	parts := []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=utf-8", email.Text},
+		{"text/html; charset=utf-8", email.HTML},
+	}
+	for _, p := range parts {
+		if p.content == "" {
+			continue
+		}
+		part, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {p.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(part)
+		if _, err := qp.Write([]byte(p.content)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	domain := "forum.local"
+	if addr, err := mail.ParseAddress(from); err == nil {
+		if at := strings.LastIndex(addr.Address, "@"); at >= 0 {
+			domain = addr.Address[at+1:]
+		}
+	}
+
+	var msg bytes.Buffer
+	writeHeader := func(key, value string) {
+		// Empêcher l'injection d'en-têtes
+		value = strings.NewReplacer("\r", "", "\n", "").Replace(value)
+		fmt.Fprintf(&msg, "%s: %s\r\n", key, value)
+	}
+	writeHeader("From", from)
+	writeHeader("To", to.String())
+	writeHeader("Subject", mime.QEncoding.Encode("utf-8", email.Subject))
+	writeHeader("Date", time.Now().Format(time.RFC1123Z))
+	writeHeader("Message-ID", fmt.Sprintf("<%s@%s>", randomHex(12), domain))
+	writeHeader("MIME-Version", "1.0")
+	for key, value := range email.Headers {
+		writeHeader(textproto.CanonicalMIMEHeaderKey(key), value)
+	}
+	writeHeader("Content-Type", "multipart/alternative; boundary="+writer.Boundary())
+	msg.WriteString("\r\n")
+	msg.Write(body.Bytes())
+	return msg.Bytes(), nil
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,206 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+
+	"projet-forum/models"
+)
+
+// NotificationService émet les notifications in-app en respectant les préférences
+// des destinataires et les blocages entre utilisateurs
+type NotificationService struct {
+	DB *sql.DB
+}
+
+// NewNotificationService crée un nouveau service de notifications
+func NewNotificationService(db *sql.DB) *NotificationService {
+	return &NotificationService{DB: db}
+}
+
+// Notify enregistre une notification si le destinataire l'accepte. Les erreurs sont
+// journalisées : une notification manquée ne doit pas faire échouer l'action d'origine.
+func (s *NotificationService) Notify(input models.NotificationInput) {
+	if s == nil {
+		return
+	}
+	if err := s.notify(input); err != nil {
+		log.Printf("Erreur lors de l'envoi de la notification %s à l'utilisateur %d: %v", input.Type, input.UserID, err)
+	}
+}
+
+func (s *NotificationService) notify(input models.NotificationInput) error {
+	// On ne se notifie pas soi-même
+	if input.UserID == 0 || input.UserID == input.ActorID {
+		return nil
+	}
+
+	// Les actions de modération sont toujours transmises, même si l'utilisateur a bloqué le modérateur
+	if input.ActorID != 0 && input.Type != models.NotificationModeration {
+		blocked, err := models.IsBlocked(s.DB, input.UserID, input.ActorID)
+		if err != nil {
+			return err
+		}
+		if blocked {
+			return nil
+		}
+	}
+
+	enabled, err := models.IsNotificationEnabled(s.DB, input.UserID, input.Type)
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		return nil
+	}
+
+	return models.CreateNotification(s.DB, input)
+}
+
+// canSeeThread vérifie qu'un destinataire a toujours accès au fil concerné
+func (s *NotificationService) canSeeThread(userID, threadID int64) bool {
+	if s == nil {
+		return false
+	}
+	thread, err := models.GetThread(s.DB, threadID)
+	if err != nil {
+		return false
+	}
+	role := ""
+	if user, err := models.GetUserByID(s.DB, userID); err == nil {
+		role = user.Role
+	}
+	allowed, err := models.CanViewThread(s.DB, thread, userID, role)
+	return err == nil && allowed
+}
+
+// NotifyReply prévient les utilisateurs qui surveillent un fil (niveau watching) qu'une réponse y a été postée.
+// Si le message répond à parent, son auteur est prévenu individuellement même s'il ne surveille pas le fil.
+func (s *NotificationService) NotifyReply(thread *models.Thread, message *models.Message, parent *models.Message) {
+	if s == nil {
+		return
+	}
+	watchers, err := models.GetThreadWatchers(s.DB, thread, models.WatchWatching)
+	if err != nil {
+		log.Printf("Erreur lors de la récupération des abonnés du fil %d: %v", thread.ID, err)
+		return
+	}
+	if parent != nil && parent.AuthorID != message.AuthorID && !containsID(watchers, parent.AuthorID) &&
+		s.canSeeThread(parent.AuthorID, thread.ID) && !s.isMuted(parent.AuthorID, thread.ID) {
+		s.Notify(models.NotificationInput{
+			UserID:    parent.AuthorID,
+			Type:      models.NotificationReply,
+			ActorID:   message.AuthorID,
+			ThreadID:  thread.ID,
+			MessageID: message.ID,
+		})
+	}
+	for _, userID := range watchers {
+		if userID == message.AuthorID || !s.canSeeThread(userID, thread.ID) {
+			continue
+		}
+		s.Notify(models.NotificationInput{
+			UserID:    userID,
+			Type:      models.NotificationReply,
+			ActorID:   message.AuthorID,
+			ThreadID:  thread.ID,
+			MessageID: message.ID,
+			GroupKey:  fmt.Sprintf("reply:thread:%d", thread.ID),
+		})
+	}
+}
+
+func containsID(ids []int64, id int64) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+// isMuted vérifie si un utilisateur a mis en sourdine un fil (directement ou via sa catégorie ou un tag)
+func (s *NotificationService) isMuted(userID, threadID int64) bool {
+	thread, err := models.GetThread(s.DB, threadID)
+	if err != nil {
+		return false
+	}
+	level, _, err := models.GetThreadWatchLevel(s.DB, userID, thread)
+	return err == nil && level == models.WatchMuted
+}
+
+// NotifyQuote prévient l'auteur d'un message qu'il a été cité
+func (s *NotificationService) NotifyQuote(quotedAuthorID int64, message *models.Message) {
+	if !s.canSeeThread(quotedAuthorID, message.ThreadID) || s.isMuted(quotedAuthorID, message.ThreadID) {
+		return
+	}
+	s.Notify(models.NotificationInput{
+		UserID:    quotedAuthorID,
+		Type:      models.NotificationQuote,
+		ActorID:   message.AuthorID,
+		ThreadID:  message.ThreadID,
+		MessageID: message.ID,
+	})
+}
+
+// NotifyMention prévient un utilisateur qu'il a été mentionné dans un message
+func (s *NotificationService) NotifyMention(mentionedID int64, message *models.Message) {
+	if !s.canSeeThread(mentionedID, message.ThreadID) || s.isMuted(mentionedID, message.ThreadID) {
+		return
+	}
+	s.Notify(models.NotificationInput{
+		UserID:    mentionedID,
+		Type:      models.NotificationMention,
+		ActorID:   message.AuthorID,
+		ThreadID:  message.ThreadID,
+		MessageID: message.ID,
+	})
+}
+
+// NotifyReaction prévient l'auteur d'un message qu'il a été aimé ou a reçu une réaction emoji ; les
+// réactions sont regroupées en une seule notification tant qu'elle n'a pas été lue. Les dislikes ne
+// sont pas notifiés.
+func (s *NotificationService) NotifyReaction(message *models.Message, actorID int64, reactionType string) {
+	if reactionType == "dislike" {
+		return
+	}
+	s.Notify(models.NotificationInput{
+		UserID:    message.AuthorID,
+		Type:      models.NotificationReaction,
+		ActorID:   actorID,
+		ThreadID:  message.ThreadID,
+		MessageID: message.ID,
+		GroupKey:  fmt.Sprintf("reaction:message:%d", message.ID),
+	})
+}
+
+// NotifyFriendRequest prévient un utilisateur qu'il a reçu une demande d'ami
+func (s *NotificationService) NotifyFriendRequest(fromID, toID int64) {
+	s.Notify(models.NotificationInput{
+		UserID:  toID,
+		Type:    models.NotificationFriendRequest,
+		ActorID: fromID,
+	})
+}
+
+// NotifyFriendAccept prévient l'auteur d'une demande d'ami qu'elle a été acceptée
+func (s *NotificationService) NotifyFriendAccept(accepterID, requesterID int64) {
+	s.Notify(models.NotificationInput{
+		UserID:  requesterID,
+		Type:    models.NotificationFriendAccept,
+		ActorID: accepterID,
+	})
+}
+
+// NotifyModeration prévient un utilisateur d'une action de modération sur son compte ou son contenu
+func (s *NotificationService) NotifyModeration(userID, moderatorID int64, action string, threadID, messageID int64) {
+	s.Notify(models.NotificationInput{
+		UserID:    userID,
+		Type:      models.NotificationModeration,
+		ActorID:   moderatorID,
+		ThreadID:  threadID,
+		MessageID: messageID,
+		Detail:    action,
+	})
+}
@@ -0,0 +1,320 @@
+package services
+
+import (
+	"database/sql"
+	"sort"
+	"sync"
+	"time"
+
+	"projet-forum/models"
+)
+
+const (
+	// Durée d'affichage d'un indicateur de saisie sans nouvelle notification du client
+	TypingTTL = 6 * time.Second
+	// Un utilisateur est considéré en ligne s'il a eu une activité dans cet intervalle
+	OnlineWindow = 5 * time.Minute
+)
+
+// PresenceUser représente un utilisateur présent ou en train d'écrire dans un fil
+type PresenceUser struct {
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+}
+
+// PresenceEvent est envoyé aux clients connectés au canal temps réel d'un fil
+type PresenceEvent struct {
+	Type     string              `json:"type"` // "presence", "typing" ou "poll"
+	ThreadID int64               `json:"thread_id"`
+	Users    []PresenceUser      `json:"users"`
+	Poll     *models.PollResults `json:"poll,omitempty"`
+}
+
+// PresenceSubscriber représente une connexion ouverte sur le canal d'un fil
+type PresenceSubscriber struct {
+	UserID int64
+	Events chan PresenceEvent
+	hidden map[int64]bool
+}
+
+type threadViewer struct {
+	username    string
+	connections int
+}
+
+type typingState struct {
+	username string
+	expires  time.Time
+}
+
+type threadPresence struct {
+	subscribers map[*PresenceSubscriber]struct{}
+	viewers     map[int64]*threadViewer
+	typing      map[int64]typingState
+}
+
+// PresenceHub suit en mémoire les lecteurs de chaque fil, les indicateurs de saisie
+// et l'activité récente des utilisateurs
+type PresenceHub struct {
+	mu          sync.Mutex
+	threads     map[int64]*threadPresence
+	connections map[int64]int
+	activity    map[int64]time.Time
+	dirty       map[int64]bool
+}
+
+// NewPresenceHub crée un nouveau hub de présence
+func NewPresenceHub() *PresenceHub {
+	return &PresenceHub{
+		threads:     make(map[int64]*threadPresence),
+		connections: make(map[int64]int),
+		activity:    make(map[int64]time.Time),
+		dirty:       make(map[int64]bool),
+	}
+}
+
+func (h *PresenceHub) thread(threadID int64) *threadPresence {
+	tp, ok := h.threads[threadID]
+	if !ok {
+		tp = &threadPresence{
+			subscribers: make(map[*PresenceSubscriber]struct{}),
+			viewers:     make(map[int64]*threadViewer),
+			typing:      make(map[int64]typingState),
+		}
+		h.threads[threadID] = tp
+	}
+	return tp
+}
+
+// Join enregistre une connexion d'un utilisateur sur un fil. hidden contient les
+// utilisateurs bloqués (dans un sens ou dans l'autre) qui ne doivent pas lui être montrés.
+func (h *PresenceHub) Join(threadID, userID int64, username string, hidden map[int64]bool) *PresenceSubscriber {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	sub := &PresenceSubscriber{
+		UserID: userID,
+		Events: make(chan PresenceEvent, 16),
+		hidden: hidden,
+	}
+
+	tp := h.thread(threadID)
+	tp.subscribers[sub] = struct{}{}
+	if v, ok := tp.viewers[userID]; ok {
+		v.connections++
+	} else {
+		tp.viewers[userID] = &threadViewer{username: username, connections: 1}
+	}
+	h.connections[userID]++
+	h.touch(userID)
+
+	h.broadcastPresence(threadID, tp)
+	h.sendTyping(threadID, tp, sub)
+	return sub
+}
+
+// Leave retire une connexion ; l'utilisateur disparaît des lecteurs quand sa dernière connexion se ferme
+func (h *PresenceHub) Leave(threadID int64, sub *PresenceSubscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	tp, ok := h.threads[threadID]
+	if !ok {
+		return
+	}
+	if _, ok := tp.subscribers[sub]; !ok {
+		return
+	}
+	delete(tp.subscribers, sub)
+
+	if v, ok := tp.viewers[sub.UserID]; ok {
+		v.connections--
+		if v.connections <= 0 {
+			delete(tp.viewers, sub.UserID)
+			delete(tp.typing, sub.UserID)
+		}
+	}
+
+	h.connections[sub.UserID]--
+	if h.connections[sub.UserID] <= 0 {
+		delete(h.connections, sub.UserID)
+	}
+	h.touch(sub.UserID)
+
+	if len(tp.subscribers) == 0 {
+		delete(h.threads, threadID)
+		return
+	}
+	h.broadcastPresence(threadID, tp)
+	h.broadcastTyping(threadID, tp)
+}
+
+// SetTyping active ou désactive l'indicateur de saisie d'un utilisateur dans un fil
+func (h *PresenceHub) SetTyping(threadID, userID int64, username string, typing bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.touch(userID)
+
+	tp, ok := h.threads[threadID]
+	if !ok {
+		return
+	}
+
+	_, wasTyping := tp.typing[userID]
+	if typing {
+		tp.typing[userID] = typingState{username: username, expires: time.Now().Add(TypingTTL)}
+	} else {
+		delete(tp.typing, userID)
+	}
+
+	if wasTyping != typing {
+		h.broadcastTyping(threadID, tp)
+	}
+}
+
+// BroadcastPoll envoie les résultats à jour du sondage d'un fil à ses lecteurs connectés
+func (h *PresenceHub) BroadcastPoll(threadID int64, results *models.PollResults) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	tp, ok := h.threads[threadID]
+	if !ok {
+		return
+	}
+	for sub := range tp.subscribers {
+		sendPresenceEvent(sub, PresenceEvent{Type: "poll", ThreadID: threadID, Users: []PresenceUser{}, Poll: results})
+	}
+}
+
+// Sweep fait expirer les indicateurs de saisie périmés
+func (h *PresenceHub) Sweep() error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	now := time.Now()
+	for threadID, tp := range h.threads {
+		changed := false
+		for userID, state := range tp.typing {
+			if now.After(state.expires) {
+				delete(tp.typing, userID)
+				changed = true
+			}
+		}
+		if changed {
+			h.broadcastTyping(threadID, tp)
+		}
+	}
+
+	for userID, seen := range h.activity {
+		if h.connections[userID] == 0 && !h.dirty[userID] && now.Sub(seen) > OnlineWindow {
+			delete(h.activity, userID)
+		}
+	}
+	return nil
+}
+
+// Touch enregistre une activité de l'utilisateur
+func (h *PresenceHub) Touch(userID int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.touch(userID)
+}
+
+func (h *PresenceHub) touch(userID int64) {
+	h.activity[userID] = time.Now()
+	h.dirty[userID] = true
+}
+
+// IsOnline indique si un utilisateur a une connexion ouverte ou une activité récente
+func (h *PresenceHub) IsOnline(userID int64) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.connections[userID] > 0 {
+		return true
+	}
+	seen, ok := h.activity[userID]
+	return ok && time.Since(seen) <= OnlineWindow
+}
+
+// LastSeen retourne la dernière activité connue en mémoire d'un utilisateur
+func (h *PresenceHub) LastSeen(userID int64) (time.Time, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	seen, ok := h.activity[userID]
+	return seen, ok
+}
+
+// FlushActivity enregistre l'activité récente dans users.last_connection
+func (h *PresenceHub) FlushActivity(db *sql.DB) error {
+	h.mu.Lock()
+	pending := make(map[int64]time.Time, len(h.dirty))
+	for userID := range h.dirty {
+		pending[userID] = h.activity[userID]
+	}
+	h.dirty = make(map[int64]bool)
+	h.mu.Unlock()
+
+	var lastErr error
+	for userID, seen := range pending {
+		_, err := db.Exec("UPDATE users SET last_connection = ? WHERE id = ? AND last_connection < ?", seen, userID, seen)
+		if err != nil {
+			// Réessayer lors du prochain passage
+			h.mu.Lock()
+			h.dirty[userID] = true
+			h.mu.Unlock()
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+func (h *PresenceHub) broadcastPresence(threadID int64, tp *threadPresence) {
+	for sub := range tp.subscribers {
+		users := make([]PresenceUser, 0, len(tp.viewers))
+		for userID, v := range tp.viewers {
+			if sub.hidden[userID] {
+				continue
+			}
+			users = append(users, PresenceUser{ID: userID, Username: v.username})
+		}
+		sendPresenceEvent(sub, PresenceEvent{Type: "presence", ThreadID: threadID, Users: sortPresenceUsers(users)})
+	}
+}
+
+func (h *PresenceHub) broadcastTyping(threadID int64, tp *threadPresence) {
+	for sub := range tp.subscribers {
+		h.sendTyping(threadID, tp, sub)
+	}
+}
+
+func (h *PresenceHub) sendTyping(threadID int64, tp *threadPresence, sub *PresenceSubscriber) {
+	users := make([]PresenceUser, 0, len(tp.typing))
+	for userID, state := range tp.typing {
+		if userID == sub.UserID || sub.hidden[userID] {
+			continue
+		}
+		users = append(users, PresenceUser{ID: userID, Username: state.username})
+	}
+	sendPresenceEvent(sub, PresenceEvent{Type: "typing", ThreadID: threadID, Users: sortPresenceUsers(users)})
+}
+
+func sortPresenceUsers(users []PresenceUser) []PresenceUser {
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Username < users[j].Username
+	})
+	return users
+}
+
+// sendPresenceEvent n'attend jamais un client lent : l'événement suivant portera l'état à jour
+func sendPresenceEvent(sub *PresenceSubscriber, event PresenceEvent) {
+	select {
+	case sub.Events <- event:
+	default:
+	}
+}
@@ -0,0 +1,170 @@
+package services
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"projet-forum/config"
+	"projet-forum/models"
+)
+
+// Privilèges débloqués par la réputation
+const (
+	PrivilegePostImages = "post_images"
+	PrivilegeCreateTags = "create_tags"
+)
+
+// defaultThresholds s'applique quand REPUTATION_THRESHOLDS ne précise pas un privilège
+var defaultThresholds = map[string]int{
+	PrivilegePostImages: 10,
+	PrivilegeCreateTags: 50,
+}
+
+// defaultReputationRules s'applique quand les variables REPUTATION_* ne sont pas définies
+var defaultReputationRules = models.ReputationRules{
+	LikeWeight:    10,
+	DislikeWeight: -2,
+	EmojiWeight:   2,
+	HalfLife:      180 * 24 * time.Hour,
+	VoterCap:      50,
+}
+
+// ReputationService tient à jour la réputation des utilisateurs et vérifie les privilèges qu'elle débloque.
+// Les modérateurs et administrateurs disposent de tous les privilèges.
+type ReputationService struct {
+	DB         *sql.DB
+	Rules      models.ReputationRules
+	Thresholds map[string]int
+}
+
+// Privilege est un privilège débloqué à partir d'une réputation minimale
+type Privilege struct {
+	Name      string `json:"name"`
+	Threshold int    `json:"threshold"`
+	Unlocked  bool   `json:"unlocked"`
+}
+
+// NewReputationServiceFromEnv lit REPUTATION_WEIGHTS (« like=10,dislike=-2,emoji=2 »),
+// REPUTATION_HALF_LIFE, REPUTATION_VOTER_CAP et REPUTATION_THRESHOLDS (« post_images=10,create_tags=50 »)
+func NewReputationServiceFromEnv(db *sql.DB) (*ReputationService, error) {
+	rules := defaultReputationRules
+
+	weights, err := parseSettings(config.GetEnvOrDefault("REPUTATION_WEIGHTS", ""))
+	if err != nil {
+		return nil, fmt.Errorf("REPUTATION_WEIGHTS invalide: %v", err)
+	}
+	for name, value := range weights {
+		weight, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("REPUTATION_WEIGHTS invalide: poids %s", name)
+		}
+		switch name {
+		case "like":
+			rules.LikeWeight = weight
+		case "dislike":
+			rules.DislikeWeight = weight
+		case "emoji":
+			rules.EmojiWeight = weight
+		default:
+			return nil, fmt.Errorf("REPUTATION_WEIGHTS invalide: réaction inconnue %s", name)
+		}
+	}
+
+	if value := config.GetEnvOrDefault("REPUTATION_HALF_LIFE", ""); value != "" {
+		if rules.HalfLife, err = time.ParseDuration(value); err != nil || rules.HalfLife < 0 {
+			return nil, fmt.Errorf("REPUTATION_HALF_LIFE invalide: %s", value)
+		}
+	}
+	if value := config.GetEnvOrDefault("REPUTATION_VOTER_CAP", ""); value != "" {
+		if rules.VoterCap, err = strconv.ParseFloat(value, 64); err != nil || rules.VoterCap < 0 {
+			return nil, fmt.Errorf("REPUTATION_VOTER_CAP invalide: %s", value)
+		}
+	}
+
+	thresholds := make(map[string]int, len(defaultThresholds))
+	for name, threshold := range defaultThresholds {
+		thresholds[name] = threshold
+	}
+	settings, err := parseSettings(config.GetEnvOrDefault("REPUTATION_THRESHOLDS", ""))
+	if err != nil {
+		return nil, fmt.Errorf("REPUTATION_THRESHOLDS invalide: %v", err)
+	}
+	for name, value := range settings {
+		if _, ok := defaultThresholds[name]; !ok {
+			return nil, fmt.Errorf("REPUTATION_THRESHOLDS invalide: privilège inconnu %s", name)
+		}
+		if thresholds[name], err = strconv.Atoi(value); err != nil {
+			return nil, fmt.Errorf("REPUTATION_THRESHOLDS invalide: seuil %s", name)
+		}
+	}
+
+	return &ReputationService{DB: db, Rules: rules, Thresholds: thresholds}, nil
+}
+
+// parseSettings lit une liste de la forme « nom=valeur,nom=valeur »
+func parseSettings(spec string) (map[string]string, error) {
+	settings := make(map[string]string)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("entrée invalide: %s", entry)
+		}
+		settings[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	return settings, nil
+}
+
+// Refresh recalcule la réputation d'un utilisateur après une réaction à l'un de ses messages ; une
+// erreur est journalisée, la tâche périodique rattrapera le calcul
+func (s *ReputationService) Refresh(userID int64) {
+	if s == nil {
+		return
+	}
+	if _, err := models.RefreshUserReputation(s.DB, s.Rules, userID); err != nil {
+		log.Printf("Erreur lors du calcul de la réputation de l'utilisateur %d: %v", userID, err)
+	}
+}
+
+// RefreshAll recalcule toutes les réputations pour appliquer la décroissance dans le temps
+func (s *ReputationService) RefreshAll() error {
+	_, err := models.RefreshAllReputations(s.DB, s.Rules)
+	return err
+}
+
+// Can vérifie qu'un utilisateur a la réputation requise pour un privilège ; retourne aussi le seuil
+func (s *ReputationService) Can(userID int64, role, privilege string) (bool, int, error) {
+	threshold := s.Thresholds[privilege]
+	if models.IsModerator(role) || threshold <= 0 {
+		return true, threshold, nil
+	}
+	reputation, err := models.GetUserReputation(s.DB, userID)
+	if err != nil {
+		return false, threshold, err
+	}
+	return reputation >= threshold, threshold, nil
+}
+
+// Privileges liste les privilèges et indique ceux débloqués pour une réputation et un rôle
+func (s *ReputationService) Privileges(reputation int, role string) []*Privilege {
+	privileges := make([]*Privilege, 0, len(s.Thresholds))
+	for name, threshold := range s.Thresholds {
+		privileges = append(privileges, &Privilege{
+			Name:      name,
+			Threshold: threshold,
+			Unlocked:  models.IsModerator(role) || reputation >= threshold,
+		})
+	}
+	sort.Slice(privileges, func(i, j int) bool {
+		return privileges[i].Threshold < privileges[j].Threshold
+	})
+	return privileges
+}
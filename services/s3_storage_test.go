@@ -0,0 +1,437 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	fakeS3Bucket    = "forum"
+	fakeS3Region    = "eu-west-3"
+	fakeS3AccessKey = "AKIDEXAMPLE"
+	fakeS3SecretKey = "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+	fakeS3PageSize  = 2
+)
+
+type fakeS3Object struct {
+	data        []byte
+	contentType string
+	modTime     time.Time
+}
+
+// fakeS3 imite un bucket S3 adressé en path-style ; chaque requête doit porter une signature SigV4
+// valide, recalculée ici indépendamment de S3Storage
+type fakeS3 struct {
+	t       *testing.T
+	mu      sync.Mutex
+	objects map[string]*fakeS3Object
+}
+
+func newFakeS3(t *testing.T) (*fakeS3, *S3Storage) {
+	fake := &fakeS3{t: t, objects: map[string]*fakeS3Object{}}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return fake, &S3Storage{
+		Endpoint:  server.URL,
+		Region:    fakeS3Region,
+		Bucket:    fakeS3Bucket,
+		AccessKey: fakeS3AccessKey,
+		SecretKey: fakeS3SecretKey,
+		PublicURL: "https://cdn.example.com/",
+		Client:    server.Client(),
+	}
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := verifySigV4(r, time.Now().UTC()); err != nil {
+		f.t.Errorf("%s %s : %v", r.Method, r.URL, err)
+		http.Error(w, "SignatureDoesNotMatch", http.StatusForbidden)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	bucketPath := "/" + fakeS3Bucket
+	if r.URL.Path == bucketPath && r.Method == http.MethodGet {
+		f.list(w, r)
+		return
+	}
+	if !strings.HasPrefix(r.URL.Path, bucketPath+"/") {
+		http.Error(w, "NoSuchBucket", http.StatusNotFound)
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, bucketPath+"/")
+
+	switch r.Method {
+	case http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err != nil || int64(len(data)) != r.ContentLength {
+			http.Error(w, "IncompleteBody", http.StatusBadRequest)
+			return
+		}
+		f.objects[key] = &fakeS3Object{data: data, contentType: r.Header.Get("Content-Type"), modTime: time.Now().UTC()}
+	case http.MethodGet, http.MethodHead:
+		object, ok := f.objects[key]
+		if !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", object.contentType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(object.data)))
+		w.Header().Set("Last-Modified", object.modTime.Format(http.TimeFormat))
+		if r.Method == http.MethodGet {
+			w.Write(object.data)
+		}
+	case http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "MethodNotAllowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// list répond à ListObjectsV2 par pages de fakeS3PageSize objets pour exercer la pagination
+func (f *fakeS3) list(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if query.Get("list-type") != "2" {
+		http.Error(w, "InvalidArgument", http.StatusBadRequest)
+		return
+	}
+	keys := []string{}
+	for key := range f.objects {
+		if strings.HasPrefix(key, query.Get("prefix")) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	start := 0
+	if token := query.Get("continuation-token"); token != "" {
+		start, _ = strconv.Atoi(token)
+	}
+	end := start + fakeS3PageSize
+	if end > len(keys) {
+		end = len(keys)
+	}
+
+	var result s3ListResult
+	for _, key := range keys[start:end] {
+		object := f.objects[key]
+		result.Contents = append(result.Contents, struct {
+			Key          string    `xml:"Key"`
+			Size         int64     `xml:"Size"`
+			LastModified time.Time `xml:"LastModified"`
+		}{key, int64(len(object.data)), object.modTime})
+	}
+	if end < len(keys) {
+		result.IsTruncated = true
+		result.NextContinuationToken = strconv.Itoa(end)
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"ListBucketResult"`
+		s3ListResult
+	}{s3ListResult: result})
+}
+
+// verifySigV4 vérifie l'en-tête Authorization d'une requête comme le ferait S3
+func verifySigV4(r *http.Request, now time.Time) error {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 ") {
+		return fmt.Errorf("algorithme absent : %q", auth)
+	}
+	fields := map[string]string{}
+	for _, part := range strings.Split(strings.TrimPrefix(auth, "AWS4-HMAC-SHA256 "), ", ") {
+		name, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return fmt.Errorf("en-tête Authorization mal formé : %q", auth)
+		}
+		fields[name] = value
+	}
+
+	amzDate := r.Header.Get("X-Amz-Date")
+	date, err := time.Parse("20060102T150405Z", amzDate)
+	if err != nil {
+		return fmt.Errorf("X-Amz-Date invalide : %q", amzDate)
+	}
+	if d := now.Sub(date); d < -time.Minute || d > time.Minute {
+		return fmt.Errorf("X-Amz-Date trop éloignée : %s", amzDate)
+	}
+	if r.Header.Get("X-Amz-Content-Sha256") != "UNSIGNED-PAYLOAD" {
+		return fmt.Errorf("X-Amz-Content-Sha256 = %q", r.Header.Get("X-Amz-Content-Sha256"))
+	}
+	scope := date.Format("20060102") + "/" + fakeS3Region + "/s3/aws4_request"
+	if fields["Credential"] != fakeS3AccessKey+"/"+scope {
+		return fmt.Errorf("Credential = %q", fields["Credential"])
+	}
+
+	signed := strings.Split(fields["SignedHeaders"], ";")
+	for _, required := range []string{"host", "x-amz-content-sha256", "x-amz-date"} {
+		if !containsString(signed, required) {
+			return fmt.Errorf("en-tête %s non signé (%s)", required, fields["SignedHeaders"])
+		}
+	}
+	if r.Header.Get("Content-Type") != "" && !containsString(signed, "content-type") {
+		return fmt.Errorf("content-type non signé (%s)", fields["SignedHeaders"])
+	}
+	var headers strings.Builder
+	for _, name := range signed {
+		value := r.Header.Get(name)
+		if name == "host" {
+			value = r.Host
+		}
+		headers.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+
+	query := r.URL.Query()
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := []string{}
+	for _, name := range names {
+		for _, value := range query[name] {
+			pairs = append(pairs, awsEscape(name)+"="+awsEscape(value))
+		}
+	}
+
+	canonical := strings.Join([]string{
+		r.Method,
+		r.URL.EscapedPath(),
+		strings.Join(pairs, "&"),
+		headers.String(),
+		fields["SignedHeaders"],
+		"UNSIGNED-PAYLOAD",
+	}, "\n")
+	hash := sha256.Sum256([]byte(canonical))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := []byte("AWS4" + fakeS3SecretKey)
+	for _, part := range []string{date.Format("20060102"), fakeS3Region, "s3", "aws4_request"} {
+		key = hmacSum(key, part)
+	}
+	if want := hex.EncodeToString(hmacSum(key, stringToSign)); fields["Signature"] != want {
+		return fmt.Errorf("signature %s, attendu %s", fields["Signature"], want)
+	}
+	return nil
+}
+
+// awsEscape encode une valeur selon RFC 3986, comme l'exige la requête canonique
+func awsEscape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+func hmacSum(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func TestS3Storage(t *testing.T) {
+	fake, storage := newFakeS3(t)
+	key := "attachments/ab/abcdef.png"
+
+	if _, err := storage.Stat(key); err != ErrObjectNotFound {
+		t.Fatalf("Stat d'un objet absent = %v, attendu ErrObjectNotFound", err)
+	}
+	if _, _, err := storage.Get(key); err != ErrObjectNotFound {
+		t.Fatalf("Get d'un objet absent = %v, attendu ErrObjectNotFound", err)
+	}
+
+	if err := storage.Put(key, strings.NewReader("contenu"), 7, "image/png"); err != nil {
+		t.Fatalf("Put = %v", err)
+	}
+	if object := fake.objects[key]; object == nil || string(object.data) != "contenu" || object.contentType != "image/png" {
+		t.Fatalf("objet enregistré = %+v", object)
+	}
+
+	info, err := storage.Stat(key)
+	if err != nil {
+		t.Fatalf("Stat = %v", err)
+	}
+	if info.Size != 7 || info.ContentType != "image/png" || info.ModTime.IsZero() {
+		t.Errorf("Stat = %+v, attendu 7 octets image/png", info)
+	}
+
+	body, info, err := storage.Get(key)
+	if err != nil {
+		t.Fatalf("Get = %v", err)
+	}
+	data, _ := io.ReadAll(body)
+	body.Close()
+	if string(data) != "contenu" || info.Size != 7 {
+		t.Errorf("Get = %q (%d octets), attendu « contenu »", data, info.Size)
+	}
+
+	if err := storage.Delete(key); err != nil {
+		t.Fatalf("Delete = %v", err)
+	}
+	if _, err := storage.Stat(key); err != ErrObjectNotFound {
+		t.Errorf("Stat après Delete = %v, attendu ErrObjectNotFound", err)
+	}
+	if err := storage.Delete(key); err != nil {
+		t.Errorf("Delete d'un objet absent = %v, attendu nil", err)
+	}
+
+	if err := storage.Put("../escape", strings.NewReader("x"), 1, "text/plain"); err != ErrInvalidKey {
+		t.Errorf("Put d'une clé invalide = %v, attendu ErrInvalidKey", err)
+	}
+}
+
+func TestS3StorageList(t *testing.T) {
+	_, storage := newFakeS3(t)
+	keys := []string{
+		"attachments/ab/a1.png",
+		"attachments/ab/a2.png",
+		"attachments/cd/a3.png",
+		"attachments/cd/a4.png",
+		"attachments/ef/a5.png",
+		"private/attachments/ab/p1.png",
+	}
+	for _, key := range keys {
+		if err := storage.Put(key, strings.NewReader(key), int64(len(key)), "image/png"); err != nil {
+			t.Fatalf("Put(%q) = %v", key, err)
+		}
+	}
+
+	var listed []string
+	err := storage.List("attachments/", func(info *ObjectInfo) error {
+		if info.Size != int64(len(info.Key)) || info.ModTime.IsZero() {
+			t.Errorf("List : %+v", info)
+		}
+		listed = append(listed, info.Key)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("List = %v", err)
+	}
+	if got, want := strings.Join(listed, ","), strings.Join(keys[:5], ","); got != want {
+		t.Errorf("List = %s, attendu %s", got, want)
+	}
+
+	stop := fmt.Errorf("stop")
+	count := 0
+	err = storage.List("", func(*ObjectInfo) error {
+		count++
+		if count == 3 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop || count != 3 {
+		t.Errorf("List interrompue = %v après %d objets, attendu stop après 3", err, count)
+	}
+}
+
+func TestS3StorageRejectsBadSignature(t *testing.T) {
+	_, storage := newFakeS3(t)
+	storage.SecretKey = "mauvaise clé"
+	// Le faux serveur ferait échouer le test : la vérification est appelée directement
+	req := httptest.NewRequest(http.MethodGet, storage.Endpoint+"/"+fakeS3Bucket+"/attachments/ab/a.png", nil)
+	req.Host = req.URL.Host
+	storage.sign(req, time.Now().UTC())
+	if err := verifySigV4(req, time.Now().UTC()); err == nil {
+		t.Errorf("une requête signée avec une autre clé secrète est acceptée")
+	}
+
+	storage.SecretKey = fakeS3SecretKey
+	req = httptest.NewRequest(http.MethodPut, storage.Endpoint+"/"+fakeS3Bucket+"/attachments/ab/a.png", strings.NewReader("x"))
+	req.Host = req.URL.Host
+	req.Header.Set("Content-Type", "image/png")
+	storage.sign(req, time.Now().UTC())
+	if err := verifySigV4(req, time.Now().UTC()); err != nil {
+		t.Errorf("signature valide refusée : %v", err)
+	}
+	req.Header.Set("Content-Type", "text/html")
+	if err := verifySigV4(req, time.Now().UTC()); err == nil {
+		t.Errorf("une requête dont le Content-Type a été modifié est acceptée")
+	}
+}
+
+func TestS3StorageURL(t *testing.T) {
+	_, storage := newFakeS3(t)
+	key := "private/attachments/ab/abcdef.png"
+
+	if u, err := storage.URL("attachments/ab/abcdef.png", 0); err != nil || u != "https://cdn.example.com/attachments/ab/abcdef.png" {
+		t.Errorf("URL publique = %q, %v", u, err)
+	}
+
+	u, err := storage.URL(key, 10*24*time.Hour)
+	if err != nil {
+		t.Fatalf("URL pré-signée = %v", err)
+	}
+	parsed, err := url.Parse(u)
+	if err != nil {
+		t.Fatalf("URL pré-signée %q : %v", u, err)
+	}
+	query := parsed.Query()
+	if parsed.Path != "/"+fakeS3Bucket+"/"+key {
+		t.Errorf("chemin = %q", parsed.Path)
+	}
+	if query.Get("X-Amz-Expires") != strconv.Itoa(int((7 * 24 * time.Hour).Seconds())) {
+		t.Errorf("X-Amz-Expires = %q, attendu le maximum de 7 jours", query.Get("X-Amz-Expires"))
+	}
+	if query.Get("X-Amz-SignedHeaders") != "host" || query.Get("X-Amz-Algorithm") != "AWS4-HMAC-SHA256" ||
+		!strings.HasPrefix(query.Get("X-Amz-Credential"), fakeS3AccessKey+"/") || len(query.Get("X-Amz-Signature")) != 64 {
+		t.Errorf("paramètres de pré-signature incomplets : %v", query)
+	}
+
+	// Recalcul de la signature : la requête canonique porte tous les paramètres sauf la signature
+	presigned := url.Values{}
+	for name, values := range query {
+		if name != "X-Amz-Signature" {
+			presigned[name] = values
+		}
+	}
+	names := make([]string, 0, len(presigned))
+	for name := range presigned {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	pairs := []string{}
+	for _, name := range names {
+		pairs = append(pairs, awsEscape(name)+"="+awsEscape(presigned.Get(name)))
+	}
+	canonical := strings.Join([]string{
+		http.MethodGet, parsed.EscapedPath(), strings.Join(pairs, "&"), "host:" + parsed.Host + "\n", "host", "UNSIGNED-PAYLOAD",
+	}, "\n")
+	hash := sha256.Sum256([]byte(canonical))
+	date := query.Get("X-Amz-Date")
+	scope := date[:8] + "/" + fakeS3Region + "/s3/aws4_request"
+	signingKey := []byte("AWS4" + fakeS3SecretKey)
+	for _, part := range []string{date[:8], fakeS3Region, "s3", "aws4_request"} {
+		signingKey = hmacSum(signingKey, part)
+	}
+	stringToSign := "AWS4-HMAC-SHA256\n" + date + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+	if want := hex.EncodeToString(hmacSum(signingKey, stringToSign)); query.Get("X-Amz-Signature") != want {
+		t.Errorf("X-Amz-Signature = %s, attendu %s", query.Get("X-Amz-Signature"), want)
+	}
+
+	if _, err := storage.URL("../escape", time.Minute); err != ErrInvalidKey {
+		t.Errorf("URL d'une clé invalide = %v, attendu ErrInvalidKey", err)
+	}
+}
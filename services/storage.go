@@ -0,0 +1,298 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"projet-forum/config"
+)
+
+var (
+	ErrObjectNotFound = errors.New("object not found")
+	ErrInvalidKey     = errors.New("invalid storage key")
+)
+
+// PrivatePrefix préfixe les clés des fichiers qui ne sont accessibles que par une URL signée
+const PrivatePrefix = "private/"
+
+// ObjectInfo décrit un fichier enregistré
+type ObjectInfo struct {
+	Key         string
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+}
+
+// Storage est implémenté par chaque backend de stockage des fichiers envoyés
+type Storage interface {
+	Put(key string, r io.Reader, size int64, contentType string) error
+	Get(key string) (io.ReadCloser, *ObjectInfo, error)
+	Stat(key string) (*ObjectInfo, error)
+	Delete(key string) error
+	// List appelle fn pour chaque fichier dont la clé commence par prefix
+	List(prefix string, fn func(*ObjectInfo) error) error
+	// URL retourne l'adresse d'un fichier ; avec expires > 0 l'adresse est signée et expire
+	URL(key string, expires time.Duration) (string, error)
+}
+
+// NewStorageFromEnv choisit le backend de stockage selon STORAGE_DRIVER (local ou s3)
+func NewStorageFromEnv(signer *URLSigner) (Storage, error) {
+	switch driver := config.GetEnvOrDefault("STORAGE_DRIVER", "local"); driver {
+	case "local":
+		return &LocalStorage{
+			Dir:     config.GetEnvOrDefault("STORAGE_DIR", "storage/files"),
+			BaseURL: "/files/",
+			Signer:  signer,
+		}, nil
+	case "s3":
+		bucket := os.Getenv("S3_BUCKET")
+		endpoint := os.Getenv("S3_ENDPOINT")
+		if bucket == "" || endpoint == "" {
+			return nil, errors.New("S3_BUCKET et S3_ENDPOINT sont requis pour le stockage s3")
+		}
+		return &S3Storage{
+			Endpoint:  strings.TrimRight(endpoint, "/"),
+			Region:    config.GetEnvOrDefault("S3_REGION", "us-east-1"),
+			Bucket:    bucket,
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+			// Sans URL publique, les fichiers publics passent par /files/ (lecture via Get)
+			PublicURL: config.GetEnvOrDefault("S3_PUBLIC_URL", "/files"),
+		}, nil
+	default:
+		return nil, fmt.Errorf("driver de stockage inconnu: %s", driver)
+	}
+}
+
+var validKey = regexp.MustCompile(`^[a-z0-9]+(/[a-z0-9._-]+)+$`)
+
+// ValidateKey refuse les clés qui pourraient sortir du répertoire de stockage
+func ValidateKey(key string) error {
+	if !validKey.MatchString(key) || strings.Contains(key, "..") {
+		return ErrInvalidKey
+	}
+	return nil
+}
+
+// ContentKey construit une clé adressée par le contenu : deux envois identiques partagent le même fichier
+func ContentKey(prefix string, data []byte, ext string) string {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	return path.Join(strings.TrimSuffix(prefix, "/"), hash[:2], hash+ext)
+}
+
+// VariantKey construit la clé d'une variante d'un fichier (miniature, taille d'avatar...)
+func VariantKey(key, variant string) string {
+	ext := path.Ext(key)
+	return strings.TrimSuffix(key, ext) + "-" + variant + ext
+}
+
+// BaseKey retourne la clé du fichier dont une variante est dérivée (la clé elle-même si ce n'est pas
+// une variante) : c'est elle que référencent les pièces jointes, les avatars et les réservations
+func BaseKey(key string) string {
+	ext := path.Ext(key)
+	stem := strings.TrimSuffix(key, ext)
+	if i := strings.LastIndex(stem, "-"); i > strings.LastIndex(stem, "/") {
+		return stem[:i] + ext
+	}
+	return key
+}
+
+// AvatarKey retourne la clé d'une taille d'avatar
+func AvatarKey(key string, size int) string {
+	return VariantKey(key, strconv.Itoa(size))
+}
+
+// IsPrivateKey indique si un fichier exige une URL signée
+func IsPrivateKey(key string) bool {
+	return strings.HasPrefix(key, PrivatePrefix)
+}
+
+// URLSigner signe les URL de fichiers servies par l'application
+type URLSigner struct {
+	secret []byte
+}
+
+// NewURLSigner crée un signataire dérivé du secret de l'application
+func NewURLSigner(secret string) *URLSigner {
+	return &URLSigner{secret: []byte("files:" + secret)}
+}
+
+func (s *URLSigner) signature(key string, expires int64) string {
+	mac := hmac.New(sha256.New, s.secret)
+	fmt.Fprintf(mac, "%s:%d", key, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Sign retourne les paramètres de requête d'une URL valable jusqu'à expiresAt
+func (s *URLSigner) Sign(key string, expiresAt time.Time) url.Values {
+	expires := expiresAt.Unix()
+	return url.Values{
+		"expires":   {strconv.FormatInt(expires, 10)},
+		"signature": {s.signature(key, expires)},
+	}
+}
+
+// Verify vérifie la signature et l'expiration d'une URL
+func (s *URLSigner) Verify(key string, query url.Values, now time.Time) bool {
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil || now.Unix() > expires {
+		return false
+	}
+	return hmac.Equal([]byte(query.Get("signature")), []byte(s.signature(key, expires)))
+}
+
+// LocalStorage enregistre les fichiers sur le disque ; ils sont servis par /files/
+type LocalStorage struct {
+	Dir     string
+	BaseURL string
+	Signer  *URLSigner
+}
+
+func (s *LocalStorage) path(key string) (string, error) {
+	if err := ValidateKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(s.Dir, filepath.FromSlash(key)), nil
+}
+
+// Put écrit le fichier dans un fichier temporaire puis le renomme, pour ne jamais exposer un fichier partiel
+func (s *LocalStorage) Put(key string, r io.Reader, size int64, contentType string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+// Get ouvre un fichier en lecture
+func (s *LocalStorage) Get(key string) (io.ReadCloser, *ObjectInfo, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	file, err := os.Open(p)
+	if os.IsNotExist(err) {
+		return nil, nil, ErrObjectNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	return file, localObjectInfo(key, stat), nil
+}
+
+// Stat récupère les informations d'un fichier sans l'ouvrir
+func (s *LocalStorage) Stat(key string) (*ObjectInfo, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := os.Stat(p)
+	if os.IsNotExist(err) {
+		return nil, ErrObjectNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return localObjectInfo(key, stat), nil
+}
+
+// Delete supprime un fichier ; supprimer un fichier absent n'est pas une erreur
+func (s *LocalStorage) Delete(key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// List parcourt les fichiers du répertoire de stockage (les fichiers temporaires sont ignorés)
+func (s *LocalStorage) List(prefix string, fn func(*ObjectInfo) error) error {
+	err := filepath.Walk(s.Dir, func(p string, stat os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if stat.IsDir() || strings.HasPrefix(stat.Name(), ".") {
+			return nil
+		}
+		rel, err := filepath.Rel(s.Dir, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) || ValidateKey(key) != nil {
+			return nil
+		}
+		return fn(localObjectInfo(key, stat))
+	})
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// URL retourne l'adresse /files/ d'un fichier, signée si expires > 0
+func (s *LocalStorage) URL(key string, expires time.Duration) (string, error) {
+	if err := ValidateKey(key); err != nil {
+		return "", err
+	}
+	u := s.BaseURL + key
+	if expires > 0 {
+		u += "?" + s.Signer.Sign(key, time.Now().Add(expires)).Encode()
+	}
+	return u, nil
+}
+
+func localObjectInfo(key string, stat os.FileInfo) *ObjectInfo {
+	contentType := mime.TypeByExtension(path.Ext(key))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return &ObjectInfo{
+		Key:         key,
+		Size:        stat.Size(),
+		ContentType: contentType,
+		ModTime:     stat.ModTime(),
+	}
+}
@@ -0,0 +1,241 @@
+package services
+
+import (
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateKey(t *testing.T) {
+	tests := []struct {
+		key   string
+		valid bool
+	}{
+		{"attachments/ab/abcdef.jpg", true},
+		{"attachments/ab/abcdef-thumb.jpg", true},
+		{"private/attachments/ab/abcdef.png", true},
+		{"avatars/0f/0f12_34.png", true},
+		{"attachments", false},
+		{"", false},
+		{"../etc/passwd", false},
+		{"attachments/../../etc/passwd", false},
+		{"attachments/ab/..", false},
+		{"attachments/ab/a..b.jpg", false},
+		{"/attachments/ab/abcdef.jpg", false},
+		{"attachments//abcdef.jpg", false},
+		{"attachments/ab/", false},
+		{`attachments\..\secret`, false},
+		{"attachments/ab/ABC.jpg", false},
+		{"Attachments/ab/abc.jpg", false},
+		{"attachments/ab/abc.jpg?x=1", false},
+		{"attachments/ab/abc%2e%2e.jpg", false},
+		{"attachments/ab/abc.jpg\x00", false},
+		{"attachments/ab/abc def.jpg", false},
+	}
+	for _, tt := range tests {
+		err := ValidateKey(tt.key)
+		if (err == nil) != tt.valid {
+			t.Errorf("ValidateKey(%q) = %v, attendu valide=%v", tt.key, err, tt.valid)
+		}
+		if err != nil && err != ErrInvalidKey {
+			t.Errorf("ValidateKey(%q) = %v, attendu ErrInvalidKey", tt.key, err)
+		}
+	}
+}
+
+func TestContentKey(t *testing.T) {
+	a := ContentKey("attachments/", []byte("image"), ".png")
+	if a != ContentKey("attachments", []byte("image"), ".png") {
+		t.Errorf("ContentKey dépend du « / » final du préfixe : %q", a)
+	}
+	if a == ContentKey("attachments", []byte("autre image"), ".png") {
+		t.Errorf("ContentKey(%q) identique pour deux contenus différents", a)
+	}
+	parts := strings.Split(a, "/")
+	if len(parts) != 3 || parts[0] != "attachments" || !strings.HasPrefix(parts[2], parts[1]) || !strings.HasSuffix(a, ".png") {
+		t.Errorf("ContentKey = %q, attendu attachments/<hh>/<hash>.png", a)
+	}
+	if err := ValidateKey(a); err != nil {
+		t.Errorf("ValidateKey(%q) = %v", a, err)
+	}
+}
+
+func TestVariantAndBaseKey(t *testing.T) {
+	tests := []struct {
+		key, variant, want string
+	}{
+		{"attachments/ab/abcdef.jpg", "thumb", "attachments/ab/abcdef-thumb.jpg"},
+		{"private/attachments/ab/abcdef.png", "thumb", "private/attachments/ab/abcdef-thumb.png"},
+		{"avatars/0f/0f12.png", "128", "avatars/0f/0f12-128.png"},
+		{"legacy/ab/noext", "thumb", "legacy/ab/noext-thumb"},
+	}
+	for _, tt := range tests {
+		got := VariantKey(tt.key, tt.variant)
+		if got != tt.want {
+			t.Errorf("VariantKey(%q, %q) = %q, attendu %q", tt.key, tt.variant, got, tt.want)
+		}
+		if base := BaseKey(got); base != tt.key {
+			t.Errorf("BaseKey(%q) = %q, attendu %q", got, base, tt.key)
+		}
+		if base := BaseKey(tt.key); base != tt.key {
+			t.Errorf("BaseKey(%q) = %q, attendu la clé elle-même", tt.key, base)
+		}
+	}
+
+	if got := AvatarKey("avatars/0f/0f12.png", 64); got != "avatars/0f/0f12-64.png" {
+		t.Errorf("AvatarKey = %q, attendu avatars/0f/0f12-64.png", got)
+	}
+	// Un tiret dans un répertoire ne fait pas d'une clé une variante
+	if got := BaseKey("my-dir/ab/abcdef.jpg"); got != "my-dir/ab/abcdef.jpg" {
+		t.Errorf("BaseKey = %q, attendu my-dir/ab/abcdef.jpg", got)
+	}
+}
+
+func TestURLSignerVerify(t *testing.T) {
+	signer := NewURLSigner("secret")
+	key := "private/attachments/ab/abcdef.jpg"
+	now := time.Unix(1700000000, 0)
+	query := signer.Sign(key, now.Add(time.Minute))
+
+	tamper := func(name, value string) url.Values {
+		q := url.Values{}
+		for k, v := range query {
+			q[k] = append([]string(nil), v...)
+		}
+		q.Set(name, value)
+		return q
+	}
+	expires, _ := strconv.ParseInt(query.Get("expires"), 10, 64)
+
+	tests := []struct {
+		name   string
+		signer *URLSigner
+		key    string
+		query  url.Values
+		now    time.Time
+		valid  bool
+	}{
+		{"valide", signer, key, query, now, true},
+		{"expire exactement maintenant", signer, key, query, time.Unix(expires, 0), true},
+		{"expirée", signer, key, query, now.Add(2 * time.Minute), false},
+		{"autre clé", signer, "private/attachments/ab/other.jpg", query, now, false},
+		{"expiration prolongée", signer, key, tamper("expires", strconv.FormatInt(expires+3600, 10)), now, false},
+		{"signature modifiée", signer, key, tamper("signature", strings.Repeat("0", 64)), now, false},
+		{"signature absente", signer, key, tamper("signature", ""), now, false},
+		{"expiration invalide", signer, key, tamper("expires", "demain"), now, false},
+		{"autre secret", NewURLSigner("autre secret"), key, query, now, false},
+	}
+	for _, tt := range tests {
+		if valid := tt.signer.Verify(tt.key, tt.query, tt.now); valid != tt.valid {
+			t.Errorf("%s : Verify = %v, attendu %v", tt.name, valid, tt.valid)
+		}
+	}
+}
+
+func TestLocalStorage(t *testing.T) {
+	dir := t.TempDir()
+	storage := &LocalStorage{Dir: dir, BaseURL: "/files/", Signer: NewURLSigner("secret")}
+	key := "attachments/ab/abcdef.png"
+
+	if _, err := storage.Stat(key); err != ErrObjectNotFound {
+		t.Fatalf("Stat d'un fichier absent = %v, attendu ErrObjectNotFound", err)
+	}
+	if err := storage.Put(key, strings.NewReader("contenu"), 7, "image/png"); err != nil {
+		t.Fatalf("Put = %v", err)
+	}
+	if err := storage.Put("private/attachments/cd/cdef.jpg", strings.NewReader("privé"), 6, "image/jpeg"); err != nil {
+		t.Fatalf("Put = %v", err)
+	}
+
+	info, err := storage.Stat(key)
+	if err != nil {
+		t.Fatalf("Stat = %v", err)
+	}
+	if info.Size != 7 || info.ContentType != "image/png" || info.Key != key {
+		t.Errorf("Stat = %+v, attendu 7 octets image/png", info)
+	}
+
+	body, info, err := storage.Get(key)
+	if err != nil {
+		t.Fatalf("Get = %v", err)
+	}
+	data, _ := io.ReadAll(body)
+	body.Close()
+	if string(data) != "contenu" || info.Size != 7 {
+		t.Errorf("Get = %q (%d octets), attendu « contenu »", data, info.Size)
+	}
+
+	// Les fichiers temporaires d'un envoi en cours ne sont pas listés
+	if err := os.WriteFile(filepath.Join(dir, "attachments", "ab", ".upload-123"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var keys []string
+	list := func(prefix string) []string {
+		keys = nil
+		if err := storage.List(prefix, func(info *ObjectInfo) error {
+			keys = append(keys, info.Key)
+			return nil
+		}); err != nil {
+			t.Fatalf("List(%q) = %v", prefix, err)
+		}
+		sort.Strings(keys)
+		return keys
+	}
+	if got := list(""); strings.Join(got, ",") != "attachments/ab/abcdef.png,private/attachments/cd/cdef.jpg" {
+		t.Errorf("List(\"\") = %v", got)
+	}
+	if got := list(PrivatePrefix); strings.Join(got, ",") != "private/attachments/cd/cdef.jpg" {
+		t.Errorf("List(%q) = %v", PrivatePrefix, got)
+	}
+
+	u, err := storage.URL(key, 0)
+	if err != nil || u != "/files/"+key {
+		t.Errorf("URL = %q, %v, attendu /files/%s", u, err, key)
+	}
+	u, err = storage.URL(key, time.Minute)
+	if err != nil {
+		t.Fatalf("URL signée = %v", err)
+	}
+	parsed, err := url.Parse(u)
+	if err != nil || parsed.Path != "/files/"+key || !storage.Signer.Verify(key, parsed.Query(), time.Now()) {
+		t.Errorf("URL signée %q invalide", u)
+	}
+
+	if err := storage.Delete(key); err != nil {
+		t.Fatalf("Delete = %v", err)
+	}
+	if err := storage.Delete(key); err != nil {
+		t.Errorf("Delete d'un fichier absent = %v, attendu nil", err)
+	}
+	if _, _, err := storage.Get(key); err != ErrObjectNotFound {
+		t.Errorf("Get après Delete = %v, attendu ErrObjectNotFound", err)
+	}
+
+	for _, bad := range []string{"../outside.txt", "attachments/../../outside.txt"} {
+		if err := storage.Put(bad, strings.NewReader("x"), 1, "text/plain"); err != ErrInvalidKey {
+			t.Errorf("Put(%q) = %v, attendu ErrInvalidKey", bad, err)
+		}
+		if _, _, err := storage.Get(bad); err != ErrInvalidKey {
+			t.Errorf("Get(%q) = %v, attendu ErrInvalidKey", bad, err)
+		}
+		if err := storage.Delete(bad); err != ErrInvalidKey {
+			t.Errorf("Delete(%q) = %v, attendu ErrInvalidKey", bad, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(dir), "outside.txt")); !os.IsNotExist(err) {
+		t.Errorf("un fichier a été écrit hors du répertoire de stockage")
+	}
+}
+
+func TestLocalStorageListMissingDir(t *testing.T) {
+	storage := &LocalStorage{Dir: filepath.Join(t.TempDir(), "absent")}
+	if err := storage.List("", func(*ObjectInfo) error { return nil }); err != nil {
+		t.Errorf("List d'un répertoire absent = %v, attendu nil", err)
+	}
+}
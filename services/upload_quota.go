@@ -0,0 +1,79 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"projet-forum/config"
+	"projet-forum/models"
+)
+
+// ErrQuotaExceeded est aussi retournée à la création d'un message, le quota y étant vérifié sous verrou
+var ErrQuotaExceeded = models.ErrQuotaExceeded
+
+// UnlimitedQuota désigne un rôle sans limite d'espace
+const UnlimitedQuota int64 = -1
+
+// defaultQuotas s'applique quand UPLOAD_QUOTAS ne précise pas un rôle
+var defaultQuotas = map[string]int64{
+	"user":  50 * 1024 * 1024,
+	"admin": UnlimitedQuota,
+}
+
+// ParseQuotas lit une configuration de la forme « user=50MB,moderator=200MB,admin=unlimited »
+func ParseQuotas(spec string) (map[string]int64, error) {
+	quotas := make(map[string]int64, len(defaultQuotas))
+	for role, quota := range defaultQuotas {
+		quotas[role] = quota
+	}
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		role, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("quota invalide: %s", entry)
+		}
+		quota, err := parseSize(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("quota invalide pour %s: %v", role, err)
+		}
+		quotas[strings.TrimSpace(role)] = quota
+	}
+	return quotas, nil
+}
+
+// parseSize lit une taille en octets avec un suffixe optionnel (KB, MB, GB) ou « unlimited »
+func parseSize(value string) (int64, error) {
+	value = strings.ToUpper(value)
+	if value == "UNLIMITED" {
+		return UnlimitedQuota, nil
+	}
+	multiplier := int64(1)
+	for suffix, m := range map[string]int64{"KB": 1 << 10, "MB": 1 << 20, "GB": 1 << 30} {
+		if strings.HasSuffix(value, suffix) {
+			value, multiplier = strings.TrimSuffix(value, suffix), m
+			break
+		}
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("taille invalide: %s", value)
+	}
+	return n * multiplier, nil
+}
+
+// quotasFromEnv lit UPLOAD_QUOTAS
+func quotasFromEnv() (map[string]int64, error) {
+	return ParseQuotas(config.GetEnvOrDefault("UPLOAD_QUOTAS", ""))
+}
+
+// Quota retourne l'espace autorisé pour un rôle (celui des utilisateurs pour un rôle inconnu)
+func (s *FileService) Quota(role string) int64 {
+	if quota, ok := s.Quotas[role]; ok {
+		return quota
+	}
+	return s.Quotas["user"]
+}
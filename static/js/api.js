@@ -139,7 +139,9 @@ const api = {
         updateProfile: (data) => apiCall('/api/users/me', 'PUT', data),
         getStats: () => apiCall('/api/users/stats'),
         getThreads: () => apiCall('/api/users/threads'),
-        getMessages: () => apiCall('/api/users/messages')
+        getMessages: () => apiCall('/api/users/messages'),
+        getMentions: (page = 1) => apiCall(`/api/users/me/mentions?page=${page}`),
+        suggestMentions: (prefix) => apiCall(`/api/users/mentions/suggest?q=${encodeURIComponent(prefix)}`)
     },
 
     // Fils de discussion
@@ -154,12 +156,15 @@ const api = {
             };
         },
         getById: (id) => apiCall(`/api/threads/${id}`),
-        create: (title, description, tags) => {
+        create: (title, description, tags, poll = null) => {
             const data = {
                 title,
                 description,
                 tags: Array.isArray(tags) ? tags : [tags]
             };
+            if (poll) {
+                data.poll = poll;
+            }
             return apiCall('/api/threads', 'POST', data);
         },
         update: (id, data) => apiCall(`/api/threads/${id}`, 'PUT', data),
@@ -168,12 +173,55 @@ const api = {
 
     // Messages
     messages: {
-        getByThread: (threadId) => apiCall(`/api/threads/${threadId}/messages`),
+        getByThread: (threadId, sortBy = 'newest', perPage = 10) => apiCall(`/api/threads/${threadId}/messages?sort_by=${sortBy}&per_page=${perPage}`),
         create: (threadId, content) => apiCall(`/api/threads/${threadId}/messages`, 'POST', { content }),
+        createWithImages: async (threadId, content, images) => {
+            const formData = new FormData();
+            formData.append('content', content);
+            Array.from(images).forEach(image => formData.append('images', image));
+            const token = localStorage.getItem('jwt_token');
+            const response = await fetch(`/api/threads/${threadId}/messages`, {
+                method: 'POST',
+                headers: token ? { 'Authorization': `Bearer ${token}` } : {},
+                body: formData
+            });
+            return response.json();
+        },
+        preview: (content) => apiCall('/api/messages/preview', 'POST', { content }),
         update: (messageId, content) => apiCall(`/api/messages/${messageId}`, 'PUT', { content }),
         delete: (messageId) => apiCall(`/api/messages/${messageId}`, 'DELETE'),
         like: (messageId) => apiCall(`/api/messages/${messageId}/like`, 'POST'),
-        dislike: (messageId) => apiCall(`/api/messages/${messageId}/dislike`, 'POST')
+        dislike: (messageId) => apiCall(`/api/messages/${messageId}/dislike`, 'POST'),
+        accept: (messageId) => apiCall(`/api/messages/${messageId}/accept`, 'POST'),
+        unaccept: (messageId) => apiCall(`/api/messages/${messageId}/accept`, 'DELETE')
+    },
+
+    // Questions
+    questions: {
+        unanswered: (page = 1, categoryId = '') => apiCall(`/api/questions/unanswered?page=${page}&category_id=${categoryId}`)
+    },
+
+    // Sondages des fils
+    polls: {
+        get: (threadId) => apiCall(`/api/threads/${threadId}/poll`),
+        vote: (threadId, optionIds) => apiCall(`/api/threads/${threadId}/poll/vote`, 'POST', { option_ids: optionIds }),
+        retract: (threadId) => apiCall(`/api/threads/${threadId}/poll/vote`, 'DELETE')
+    },
+
+    // Réactions emoji
+    reactions: {
+        list: () => apiCall('/api/reactions'),
+        toggle: (messageId, code) => apiCall(`/api/messages/${messageId}/reactions`, 'POST', { code }),
+        getUsers: (messageId, code, page = 1) => apiCall(`/api/messages/${messageId}/reactions/${code}/users?page=${page}`),
+        getMine: (messageIds) => apiCall(`/api/users/me/reactions?message_ids=${messageIds.join(',')}`)
+    },
+
+    // Classements (period : day, week, month ou all)
+    leaderboards: {
+        get: (period = 'week', filters = {}) => {
+            const params = new URLSearchParams({ period, ...filters });
+            return apiCall(`/api/leaderboards?${params}`);
+        }
     },
 
     // Likes
@@ -4,6 +4,7 @@ document.addEventListener('DOMContentLoaded', function() {
     checkAuthStatus();
     loadThreads();
     loadStats();
+    loadLeaderboards();
 });
 
 // Fonction pour vérifier l'état de l'authentification
@@ -58,6 +59,42 @@ async function loadStats() {
     }
 }
 
+// Fonction pour charger les classements de la période choisie
+async function loadLeaderboards() {
+    const period = document.getElementById('leaderboardPeriod').value;
+    try {
+        const response = await api.leaderboards.get(period, { limit: 5 });
+        const boards = response.data || {};
+        renderLeaderboard('topPosters', boards.top_posters, u => [u.username, `/users/${u.user_id}`, `${u.score} message(s)`]);
+        renderLeaderboard('mostLiked', boards.most_liked, u => [u.username, `/users/${u.user_id}`, `${u.score} like(s)`]);
+        renderLeaderboard('activeThreads', boards.active_threads, t => [t.title, `/threads/${t.thread_id}`, `${t.messages} message(s)`]);
+    } catch (error) {
+        console.error('[DEBUG] loadLeaderboards - Error:', error);
+    }
+}
+
+// Affiche un classement ; describe retourne le libellé, le lien et le score d'une entrée
+function renderLeaderboard(id, entries, describe) {
+    const list = document.getElementById(id);
+    list.innerHTML = '';
+    if (!entries || entries.length === 0) {
+        list.innerHTML = '<li class="no-content">Aucune activité sur cette période</li>';
+        return;
+    }
+    entries.forEach(entry => {
+        const [label, href, score] = describe(entry);
+        const item = document.createElement('li');
+        const link = document.createElement('a');
+        link.href = href;
+        link.textContent = label;
+        const count = document.createElement('span');
+        count.className = 'leaderboard-score';
+        count.textContent = score;
+        item.append(link, ' ', count);
+        list.appendChild(item);
+    });
+}
+
 // Fonction pour charger les discussions
 async function loadThreads() {
     console.log('[DEBUG] loadThreads - Starting to load threads');
@@ -95,7 +132,7 @@ function createThreadElement(thread) {
     threadElement.className = 'thread-card';
     threadElement.innerHTML = `
         <div class="thread-details">
-            <h1><a href="/threads/show/${thread.id}">${thread.title}</a></h1>
+            <h1><a href="/threads/show/${thread.id}">${thread.title}</a>${thread.unread_count ? ` <span class="unread-badge">${thread.unread_count}</span>` : ''}</h1>
             <div class="thread-meta">
                 <span class="author">Par ${thread.author ? thread.author.username : 'Anonyme'}</span>
                 <span class="date">Le ${new Date(thread.created_at).toLocaleDateString()}</span>
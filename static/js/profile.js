@@ -23,10 +23,11 @@ function setupEventListeners() {
     }
 }
 
-// Charger le profil utilisateur
+// Charger le profil utilisateur : le sien sur /profile, celui d'un autre membre sur /users/{id}
 async function loadUserProfile() {
+    const match = window.location.pathname.match(/^\/users\/(\d+)/);
     try {
-        const response = await fetch('/api/users/me', {
+        const response = await fetch(match ? `/api/users/${match[1]}` : '/api/users/me', {
             method: 'GET',
             headers: {
                 'Content-Type': 'application/json',
@@ -38,7 +39,9 @@ async function loadUserProfile() {
             const data = await response.json();
             currentUser = data.data;
             displayUserProfile(currentUser);
-            showProfileActions();
+            if (!match) {
+                showProfileActions();
+            }
             loadUserThreads();
         } else if (response.status === 401) {
             // Token expiré, rediriger vers la connexion
@@ -67,18 +70,31 @@ function displayUserProfile(user) {
     // Photo de profil
     const profilePicture = document.getElementById('profilePicture');
     if (profilePicture) {
-        profilePicture.src = user.profile_picture || '/static/images/default-avatar.png';
+        profilePicture.src = user.profile_picture || `/avatars/${user.id}.svg`;
     }
 
     // Statistiques
     document.getElementById('threadCount').textContent = user.thread_count || 0;
     document.getElementById('messageCount').textContent = user.message_count || 0;
+    document.getElementById('reputation').textContent = user.reputation || 0;
+
+    // Badges obtenus, les plus récents en premier (définis dans la configuration du serveur)
+    const badgesElement = document.getElementById('profileBadges');
+    if (badgesElement) {
+        badgesElement.innerHTML = (user.badges || []).map(badge => `
+            <span class="badge" title="${badge.description} — obtenu le ${new Date(badge.awarded_at).toLocaleDateString()}">
+                ${badge.icon || '🏅'} ${badge.name}
+            </span>
+        `).join('');
+    }
     
     // Dernière connexion
     const lastConnection = document.getElementById('lastConnection');
-    if (lastConnection && user.last_login) {
-        const date = new Date(user.last_login);
-        lastConnection.textContent = date.toLocaleDateString('fr-FR');
+    if (lastConnection && user.online) {
+        lastConnection.textContent = '🟢 En ligne';
+    } else if (lastConnection && user.last_connection) {
+        const date = new Date(user.last_connection);
+        lastConnection.textContent = date.toLocaleString('fr-FR');
     } else if (lastConnection) {
         lastConnection.textContent = 'Jamais connecté';
     }
@@ -10,11 +10,15 @@ async function loadThread() {
         
         if (response.status === 'success') {
             const thread = response.data;
+            currentThread = thread;
             const container = document.getElementById('threadContainer');
             
             container.innerHTML = `
                 <div class="thread-details">
                     <h1>${thread.title}</h1>
+                    ${thread.type === 'question' ? `<span class="question-status ${thread.solved ? 'solved' : ''}">
+                        ${thread.solved ? '✅ Question résolue' : '❓ Question en attente de réponse'}
+                    </span>` : ''}
                     <div class="thread-meta">
                         <span class="author">Par ${thread.author ? thread.author.username : 'Anonyme'}</span>
                         <span class="date">Le ${new Date(thread.created_at).toLocaleDateString()}</span>
@@ -24,8 +28,21 @@ async function loadThread() {
                         ${Array.isArray(thread.tags) ? thread.tags.map(tag => `<span class="tag">${tag}</span>`).join('') : ''}
                     </div>
                 </div>
+                <div id="threadPoll"></div>
+                ${thread.accepted_answer ? `
+                <div class="accepted-answer">
+                    <h2>✅ Réponse acceptée</h2>
+                    <div class="message-header">
+                        <span class="author">${thread.accepted_answer.author ? thread.accepted_answer.author.username : 'Anonyme'}</span>
+                        <a href="#message-${thread.accepted_answer.id}" class="date">Le ${new Date(thread.accepted_answer.created_at).toLocaleDateString()}</a>
+                    </div>
+                    <div class="message-content">${thread.accepted_answer.content_html}</div>
+                </div>` : ''}
             `;
 
+            currentPoll = thread.poll;
+            renderPoll();
+
             // Afficher le formulaire de réponse si l'utilisateur est connecté
             if (window.auth.isAuthenticated()) {
                 document.getElementById('messageForm').style.display = 'block';
@@ -33,6 +50,11 @@ async function loadThread() {
 
             // Charger les messages
             loadMessages(threadId);
+
+            // Ouvrir le canal temps réel (lecteurs et indicateurs de saisie)
+            if (window.auth.isAuthenticated()) {
+                startLiveChannel(threadId);
+            }
         }
     } catch (error) {
         console.error('[DEBUG] loadThread - Error:', error);
@@ -44,7 +66,9 @@ async function loadThread() {
 async function loadMessages(threadId) {
     console.log('[DEBUG] loadMessages - Loading messages for thread:', threadId);
     try {
-        const response = await api.messages.getByThread(threadId);
+        await loadReactionTypes();
+        // Ordre chronologique : seule cette vue avance le pointeur de lecture
+        const response = await api.messages.getByThread(threadId, 'oldest', 100);
         console.log('[DEBUG] loadMessages - API Response:', response);
         
         const container = document.getElementById('messagesContainer');
@@ -58,12 +82,18 @@ async function loadMessages(threadId) {
             }
 
             container.innerHTML = messages.map(message => `
-                <div class="message" data-id="${message.id}">
+                <div class="message${message.accepted ? ' accepted' : ''}" data-id="${message.id}" id="message-${message.id}">
                     <div class="message-header">
+                        <img class="message-avatar" src="${message.author && message.author.profile_picture ? message.author.profile_picture : `/avatars/${message.author_id}.svg`}" alt="" width="32" height="32">
                         <span class="author">${message.author ? message.author.username : 'Anonyme'}</span>
+                        ${message.author ? `<span class="reputation" title="Réputation">★ ${message.author.reputation || 0}</span>` : ''}
                         <span class="date">Le ${new Date(message.created_at).toLocaleDateString()}</span>
+                        ${message.edited_at ? `<span class="edited" title="Modifié le ${new Date(message.edited_at).toLocaleString()}">(modifié)</span>` : ''}
                     </div>
-                    <div class="message-content">${message.content}</div>
+                    <div class="message-content">${renderMentions(message.content_html, message.mentions)}</div>
+                    ${message.attachments ? `<div class="message-attachments">${message.attachments.map(a => `
+                        <a href="${a.url}" target="_blank"><img src="${a.thumbnail_url || a.url}" alt="${a.original_name}" loading="lazy"></a>
+                    `).join('')}</div>` : ''}
                     <div class="message-actions">
                         <button onclick="likeMessage(${message.id})" class="like-btn">
                             👍 ${message.likes}
@@ -71,9 +101,18 @@ async function loadMessages(threadId) {
                         <button onclick="dislikeMessage(${message.id})" class="dislike-btn">
                             👎 ${message.dislikes}
                         </button>
+                        ${renderReactions(message)}
+                        ${renderAcceptButton(message)}
                     </div>
                 </div>
             `).join('');
+
+            // Les messages sont chargés après la page : suivre ici un lien vers une ligne de code
+            const target = window.location.hash && document.getElementById(window.location.hash.slice(1));
+            if (target) {
+                target.classList.add('line-target');
+                target.scrollIntoView({ block: 'center' });
+            }
         }
     } catch (error) {
         console.error('[DEBUG] loadMessages - Error:', error);
@@ -81,6 +120,224 @@ async function loadMessages(threadId) {
     }
 }
 
+// Fil affiché, pour savoir si c'est une question et qui peut en accepter la réponse
+let currentThread = null;
+
+// Identité de l'utilisateur connecté, lue dans le token JWT
+function currentClaims() {
+    const token = localStorage.getItem('jwt_token');
+    if (!token) return null;
+    try {
+        return JSON.parse(atob(token.split('.')[1].replace(/-/g, '+').replace(/_/g, '/')));
+    } catch (error) {
+        return null;
+    }
+}
+
+// Bouton d'acceptation d'une réponse, réservé à l'auteur de la question et aux modérateurs
+function renderAcceptButton(message) {
+    const claims = currentClaims();
+    if (!currentThread || currentThread.type !== 'question' || !claims) return '';
+    if (claims.user_id !== currentThread.author_id && !['moderator', 'admin'].includes(claims.role)) {
+        return message.accepted ? '<span class="accepted-label">✅ Réponse acceptée</span>' : '';
+    }
+    return message.accepted
+        ? `<button class="accept-btn accepted" onclick="acceptAnswer(${message.id}, false)">✅ Réponse acceptée (retirer)</button>`
+        : `<button class="accept-btn" onclick="acceptAnswer(${message.id}, true)">Accepter cette réponse</button>`;
+}
+
+async function acceptAnswer(messageId, accept) {
+    try {
+        const response = accept ? await api.messages.accept(messageId) : await api.messages.unaccept(messageId);
+        if (response.status === 'success') {
+            // La réponse acceptée est affichée sous le message d'origine : recharger la page
+            window.location.reload();
+        }
+    } catch (error) {
+        console.error('[DEBUG] acceptAnswer - Error:', error);
+    }
+}
+
+// Sondage du fil affiché, mis à jour par les votes et le canal temps réel
+let currentPoll = null;
+
+// Un sondage est figé quand le fil est fermé ou que sa date de clôture est passée
+function pollIsClosed(poll) {
+    return poll.closed || (poll.closes_at && new Date(poll.closes_at) <= new Date());
+}
+
+function renderPoll() {
+    const container = document.getElementById('threadPoll');
+    const poll = currentPoll;
+    if (!container || !poll) return;
+
+    const closed = pollIsClosed(poll);
+    const voted = poll.my_votes.length > 0;
+    const canVote = window.auth.isAuthenticated() && !closed && (!voted || poll.allow_change);
+    const total = poll.options.reduce((sum, option) => sum + option.vote_count, 0);
+    const inputType = poll.multiple_choice ? 'checkbox' : 'radio';
+
+    const options = poll.options.map(option => {
+        const percent = total ? Math.round(option.vote_count * 100 / total) : 0;
+        const checked = poll.my_votes.includes(option.id) ? 'checked' : '';
+        const voters = option.voters && option.voters.length
+            ? `<div class="poll-voters">${option.voters.map(voter => escapeHTML(voter.username)).join(', ')}</div>`
+            : '';
+        return `
+            <li class="poll-option${checked ? ' mine' : ''}" data-option-id="${option.id}">
+                <label>
+                    ${canVote ? `<input type="${inputType}" name="pollOption" value="${option.id}" ${checked}>` : ''}
+                    ${escapeHTML(option.label)}
+                </label>
+                <span class="poll-count">${option.vote_count} (${percent} %)</span>
+                <div class="poll-bar"><div class="poll-bar-fill" style="width: ${percent}%"></div></div>
+                ${voters}
+            </li>`;
+    }).join('');
+
+    const details = [
+        `${poll.voter_count} votant${poll.voter_count > 1 ? 's' : ''}`,
+        poll.multiple_choice ? 'choix multiple' : 'choix unique',
+        poll.anonymous ? 'votes anonymes' : 'votes publics'
+    ];
+    if (closed) {
+        details.push('sondage clos');
+    } else if (poll.closes_at) {
+        details.push(`clôture le ${new Date(poll.closes_at).toLocaleString()}`);
+    }
+
+    container.innerHTML = `
+        <div class="poll${closed ? ' closed' : ''}">
+            <h2>📊 ${escapeHTML(poll.question)}</h2>
+            <ul class="poll-options">${options}</ul>
+            <div class="poll-meta">${details.join(' · ')}</div>
+            ${canVote ? `<button class="btn btn-primary" onclick="votePoll()">${voted ? 'Modifier mon vote' : 'Voter'}</button>` : ''}
+            ${canVote && voted ? '<button class="btn btn-secondary" onclick="retractPollVote()">Retirer mon vote</button>' : ''}
+        </div>
+    `;
+}
+
+async function votePoll() {
+    const optionIds = Array.from(document.querySelectorAll('#threadPoll input[name="pollOption"]:checked'))
+        .map(input => parseInt(input.value, 10));
+    if (optionIds.length === 0) return;
+    try {
+        const response = await api.polls.vote(currentThread.id, optionIds);
+        if (response.status === 'success') {
+            currentPoll = response.data;
+            renderPoll();
+        }
+    } catch (error) {
+        console.error('[DEBUG] votePoll - Error:', error);
+        alert(error.message);
+    }
+}
+
+async function retractPollVote() {
+    try {
+        const response = await api.polls.retract(currentThread.id);
+        if (response.status === 'success') {
+            currentPoll = response.data;
+            renderPoll();
+        }
+    } catch (error) {
+        console.error('[DEBUG] retractPollVote - Error:', error);
+        alert(error.message);
+    }
+}
+
+// Applique les résultats reçus en direct ; les votants des sondages publics sont rechargés
+async function updatePollResults(results) {
+    if (!currentPoll || currentPoll.id !== results.poll_id) return;
+    if (!currentPoll.anonymous) {
+        const response = await api.polls.get(currentThread.id);
+        if (response.status === 'success') {
+            currentPoll = response.data;
+        }
+    } else {
+        currentPoll.closed = results.closed;
+        currentPoll.voter_count = results.voter_count;
+        results.options.forEach(result => {
+            const option = currentPoll.options.find(o => o.id === result.id);
+            if (option) option.vote_count = result.vote_count;
+        });
+    }
+    renderPoll();
+}
+
+// Réactions emoji proposées, chargées une fois par page
+let reactionTypes = [];
+
+async function loadReactionTypes() {
+    if (reactionTypes.length > 0) return;
+    try {
+        const response = await api.reactions.list();
+        if (response.status === 'success') {
+            reactionTypes = response.data || [];
+        }
+    } catch (error) {
+        console.error('[DEBUG] loadReactionTypes - Error:', error);
+    }
+}
+
+// Affiche une réaction : son emoji ou l'image d'une réaction personnalisée
+function reactionIcon(type) {
+    if (type.image_url) {
+        return `<img class="reaction-icon" src="${type.image_url}" alt="${escapeHTML(type.label)}" width="20" height="20">`;
+    }
+    return escapeHTML(type.emoji);
+}
+
+// Pastilles des réactions d'un message et sélecteur pour en ajouter
+function renderReactions(message) {
+    const byCode = new Map(reactionTypes.map(t => [t.code, t]));
+    const chips = (message.reactions || []).filter(r => byCode.has(r.code)).map(r => {
+        const type = byCode.get(r.code);
+        return `<button class="reaction-chip${r.reacted ? ' reacted' : ''}" title="${escapeHTML(type.label)}"
+            onclick="toggleReaction(${message.id}, '${r.code}')" oncontextmenu="showReactors(event, ${message.id}, '${r.code}')">
+            ${reactionIcon(type)} ${r.count}</button>`;
+    }).join('');
+    const picker = window.auth.isAuthenticated() && reactionTypes.length > 0 ? `
+        <details class="reaction-picker">
+            <summary title="Réagir">🙂+</summary>
+            <div class="reaction-picker-list">${reactionTypes.map(t => `
+                <button title="${escapeHTML(t.label)}" onclick="toggleReaction(${message.id}, '${t.code}')">${reactionIcon(t)}</button>
+            `).join('')}</div>
+        </details>` : '';
+    return `<span class="message-reactions">${chips}${picker}</span>`;
+}
+
+// Ajoute ou retire une réaction emoji
+async function toggleReaction(messageId, code) {
+    if (!window.auth.isAuthenticated()) {
+        alert('Vous devez être connecté pour réagir à un message');
+        return;
+    }
+    try {
+        const response = await api.reactions.toggle(messageId, code);
+        if (response.status === 'success') {
+            loadMessages(window.location.pathname.split('/').pop());
+        }
+    } catch (error) {
+        console.error('[DEBUG] toggleReaction - Error:', error);
+    }
+}
+
+// Liste les utilisateurs ayant mis une réaction (clic droit sur la pastille)
+async function showReactors(event, messageId, code) {
+    event.preventDefault();
+    try {
+        const response = await api.reactions.getUsers(messageId, code);
+        if (response.status === 'success') {
+            const names = response.data.users.map(u => u.username);
+            const more = response.data.total - names.length;
+            alert(names.join(', ') + (more > 0 ? ` et ${more} autre(s)` : ''));
+        }
+    } catch (error) {
+        console.error('[DEBUG] showReactors - Error:', error);
+    }
+}
+
 // Fonction pour liker un message
 async function likeMessage(messageId) {
     console.log('[DEBUG] likeMessage - Liking message:', messageId);
@@ -119,6 +376,165 @@ async function dislikeMessage(messageId) {
     }
 }
 
+// Ouvre le flux temps réel d'une discussion et se reconnecte en cas de coupure
+async function startLiveChannel(threadId) {
+    const token = localStorage.getItem('jwt_token');
+    if (!token) {
+        return;
+    }
+
+    try {
+        const response = await fetch(`/api/threads/${threadId}/live`, {
+            headers: {
+                'Accept': 'text/event-stream',
+                'Authorization': `Bearer ${token}`
+            }
+        });
+        if (!response.ok || !response.body) {
+            console.log('[DEBUG] startLiveChannel - Canal indisponible:', response.status);
+            return;
+        }
+
+        const reader = response.body.getReader();
+        const decoder = new TextDecoder();
+        let buffer = '';
+
+        while (true) {
+            const { value, done } = await reader.read();
+            if (done) {
+                break;
+            }
+            buffer += decoder.decode(value, { stream: true });
+
+            let separator;
+            while ((separator = buffer.indexOf('\n\n')) !== -1) {
+                const chunk = buffer.slice(0, separator);
+                buffer = buffer.slice(separator + 2);
+                const dataLine = chunk.split('\n').find(line => line.startsWith('data: '));
+                if (dataLine) {
+                    handleLiveEvent(JSON.parse(dataLine.slice(6)));
+                }
+            }
+        }
+    } catch (error) {
+        console.error('[DEBUG] startLiveChannel - Error:', error);
+    }
+
+    setTimeout(() => startLiveChannel(threadId), 5000);
+}
+
+// Met à jour les lecteurs, l'indicateur de saisie et les résultats du sondage
+function handleLiveEvent(event) {
+    if (event.type === 'poll') {
+        updatePollResults(event.poll);
+        return;
+    }
+    const names = event.users.map(user => escapeHTML(user.username));
+    if (event.type === 'presence') {
+        const container = document.getElementById('liveViewers');
+        container.innerHTML = names.length ? `👀 ${names.join(', ')}` : '';
+    } else if (event.type === 'typing') {
+        const container = document.getElementById('typingIndicator');
+        if (names.length === 0) {
+            container.textContent = '';
+        } else if (names.length === 1) {
+            container.innerHTML = `${names[0]} est en train d'écrire…`;
+        } else {
+            container.innerHTML = `${names.join(', ')} sont en train d'écrire…`;
+        }
+    }
+}
+
+// Transforme les @pseudo reconnus par le serveur en liens vers le profil. Le HTML est celui rendu
+// (et assaini) par le serveur ; seuls ses nœuds texte hors liens et code sont modifiés.
+function renderMentions(contentHTML, mentions) {
+    if (!mentions || mentions.length === 0) {
+        return contentHTML;
+    }
+    const byName = {};
+    mentions.forEach(m => { byName[m.username.toLowerCase()] = m; });
+
+    const container = document.createElement('div');
+    container.innerHTML = contentHTML;
+    const walker = document.createTreeWalker(container, NodeFilter.SHOW_TEXT, {
+        acceptNode: node => node.parentElement.closest('a, code, pre') ? NodeFilter.FILTER_REJECT : NodeFilter.FILTER_ACCEPT
+    });
+    const nodes = [];
+    while (walker.nextNode()) {
+        nodes.push(walker.currentNode);
+    }
+    nodes.forEach(node => {
+        const html = escapeHTML(node.textContent).replace(/(^|[^\p{L}\p{N}_@.])@([\p{L}\p{N}_.\-]{1,50})/gu, (match, before, name) => {
+            const trimmed = name.replace(/[.\-]+$/, '');
+            const mention = byName[trimmed.toLowerCase()];
+            if (!mention) {
+                return match;
+            }
+            return `${before}<a class="mention" href="${mention.profile_url}">@${escapeHTML(mention.username)}</a>${name.slice(trimmed.length)}`;
+        });
+        if (html !== escapeHTML(node.textContent)) {
+            const span = document.createElement('span');
+            span.innerHTML = html;
+            node.replaceWith(...span.childNodes);
+        }
+    });
+    return container.innerHTML;
+}
+
+// Autocomplétion des @mentions dans la zone de saisie
+let mentionRequest = 0;
+async function suggestMentions(textarea) {
+    const list = document.getElementById('mentionSuggestions');
+    const before = textarea.value.slice(0, textarea.selectionStart);
+    const match = before.match(/(?:^|[^\p{L}\p{N}_@.])@([\p{L}\p{N}_.\-]{1,50})$/u);
+    if (!list || !match) {
+        if (list) list.innerHTML = '';
+        return;
+    }
+
+    const request = ++mentionRequest;
+    try {
+        const response = await api.users.suggestMentions(match[1]);
+        if (request !== mentionRequest || response.status !== 'success') {
+            return;
+        }
+        list.innerHTML = response.data.map(u => `
+            <li data-username="${escapeHTML(u.username)}">
+                <img src="${u.profile_picture}" alt="" width="20" height="20"> ${escapeHTML(u.username)}
+            </li>
+        `).join('');
+        list.querySelectorAll('li').forEach(item => {
+            item.addEventListener('mousedown', e => {
+                e.preventDefault();
+                const start = textarea.selectionStart - match[1].length;
+                textarea.value = textarea.value.slice(0, start) + item.dataset.username + ' ' + textarea.value.slice(textarea.selectionStart);
+                textarea.selectionStart = textarea.selectionEnd = start + item.dataset.username.length + 1;
+                list.innerHTML = '';
+                textarea.focus();
+            });
+        });
+    } catch (error) {
+        list.innerHTML = '';
+    }
+}
+
+function escapeHTML(text) {
+    const div = document.createElement('div');
+    div.textContent = text;
+    return div.innerHTML;
+}
+
+// Signale la saisie au plus une fois toutes les 3 secondes
+let lastTypingSignal = 0;
+function signalTyping(threadId, typing) {
+    const now = Date.now();
+    if (typing && now - lastTypingSignal < 3000) {
+        return;
+    }
+    lastTypingSignal = typing ? now : 0;
+    apiCall(`/api/threads/${threadId}/typing`, 'POST', { typing }).catch(() => {});
+}
+
 // Gérer la soumission d'un nouveau message
 document.addEventListener('DOMContentLoaded', () => {
     const messageForm = document.getElementById('newMessageForm');
@@ -129,17 +545,23 @@ document.addEventListener('DOMContentLoaded', () => {
 
             const threadId = window.location.pathname.split('/').pop();
             const content = document.getElementById('messageContent').value;
+            const images = document.getElementById('messageImages').files;
+            signalTyping(threadId, false);
 
             try {
-                console.log('[DEBUG] newMessageForm - Creating message:', { threadId, content });
-                const response = await api.messages.create(threadId, content);
+                console.log('[DEBUG] newMessageForm - Creating message:', { threadId, content, images: images.length });
+                const response = images.length > 0
+                    ? await api.messages.createWithImages(threadId, content, images)
+                    : await api.messages.create(threadId, content);
                 console.log('[DEBUG] newMessageForm - API Response:', response);
                 
                 if (response.status === 'success') {
                     document.getElementById('messageContent').value = '';
+                    document.getElementById('messageImages').value = '';
+                    document.getElementById('messagePreview').style.display = 'none';
                     loadMessages(threadId);
                 } else {
-                    alert('Erreur lors de l\'envoi du message');
+                    alert(response.message || 'Erreur lors de l\'envoi du message');
                 }
             } catch (error) {
                 console.error('[DEBUG] newMessageForm - Error:', error);
@@ -148,6 +570,33 @@ document.addEventListener('DOMContentLoaded', () => {
         });
     }
 
+    const previewButton = document.getElementById('previewButton');
+    if (previewButton) {
+        previewButton.addEventListener('click', async () => {
+            const preview = document.getElementById('messagePreview');
+            try {
+                const response = await api.messages.preview(document.getElementById('messageContent').value);
+                if (response.status === 'success') {
+                    preview.innerHTML = response.data.content_html;
+                    preview.style.display = 'block';
+                }
+            } catch (error) {
+                console.error('[DEBUG] preview - Error:', error);
+            }
+        });
+    }
+
+    const messageContent = document.getElementById('messageContent');
+    if (messageContent) {
+        messageContent.addEventListener('input', () => {
+            signalTyping(window.location.pathname.split('/').pop(), messageContent.value !== '');
+            suggestMentions(messageContent);
+        });
+        messageContent.addEventListener('blur', () => {
+            document.getElementById('mentionSuggestions').innerHTML = '';
+        });
+    }
+
     // Vérifier l'authentification pour mettre à jour la barre de navigation
     if (window.auth && typeof window.auth.checkAuth === 'function') {
         auth.checkAuth();
@@ -0,0 +1,302 @@
+package utils
+
+import (
+	"html"
+	"strings"
+)
+
+// Classes CSS produites par HighlightCode
+const (
+	hlKeyword = "hl-kw"
+	hlType    = "hl-type"
+	hlLiteral = "hl-lit"
+	hlBuiltin = "hl-builtin"
+	hlString  = "hl-str"
+	hlComment = "hl-com"
+	hlNumber  = "hl-num"
+	hlVar     = "hl-var"
+	hlKey     = "hl-key"
+)
+
+// languageSpec décrit la coloration d'un langage
+type languageSpec struct {
+	keywords        map[string]string // mot → classe CSS
+	caseInsensitive bool
+	lineComments    []string
+	blockComment    [2]string
+	quotes          string // délimiteurs de chaînes sur une ligne
+	rawQuotes       string // délimiteurs de chaînes pouvant s'étendre sur plusieurs lignes, sans échappement
+	hashComment     bool   // # ne commence un commentaire qu'en début de mot
+	shellVars       bool   // $VAR et ${VAR}
+	yamlKeys        bool   // « clé: » en début de ligne
+}
+
+func words(class string, list string, into map[string]string) map[string]string {
+	if into == nil {
+		into = make(map[string]string)
+	}
+	for _, w := range strings.Fields(list) {
+		into[w] = class
+	}
+	return into
+}
+
+var (
+	goSpec = &languageSpec{
+		keywords: words(hlBuiltin, "append cap close complex copy delete imag len make max min new panic print println real recover",
+			words(hlLiteral, "true false nil iota",
+				words(hlType, "any bool byte comparable complex64 complex128 error float32 float64 int int8 int16 int32 int64 rune string uint uint8 uint16 uint32 uint64 uintptr",
+					words(hlKeyword, "break case chan const continue default defer else fallthrough for func go goto if import interface map package range return select struct switch type var", nil)))),
+		lineComments: []string{"//"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       `"'`,
+		rawQuotes:    "`",
+	}
+	jsSpec = &languageSpec{
+		keywords: words(hlLiteral, "true false null undefined NaN Infinity this",
+			words(hlKeyword, "async await break case catch class const continue debugger default delete do else export extends finally for from function get if import in instanceof let new of return set static super switch throw try typeof var void while with yield", nil)),
+		lineComments: []string{"//"},
+		blockComment: [2]string{"/*", "*/"},
+		quotes:       `"'`,
+		rawQuotes:    "`",
+	}
+	sqlSpec = &languageSpec{
+		keywords: words(hlBuiltin, "avg coalesce concat count current_timestamp greatest ifnull least max min now sum",
+			words(hlLiteral, "true false null",
+				words(hlType, "bigint binary blob bool boolean char date datetime decimal double enum float int integer json mediumtext numeric serial smallint text time timestamp tinyint varchar",
+					words(hlKeyword, "add all alter and as asc auto_increment begin between by cascade case check commit constraint create cross default delete desc distinct drop else end exists for foreign from full group having if in index inner insert into is join key left like limit not offset on or order outer primary references returning right rollback select set table then transaction trigger union unique update using values view when where with", nil)))),
+		caseInsensitive: true,
+		lineComments:    []string{"--", "#"},
+		blockComment:    [2]string{"/*", "*/"},
+		quotes:          `'"`,
+		rawQuotes:       "`",
+	}
+	shellSpec = &languageSpec{
+		keywords: words(hlBuiltin, "alias cd echo eval exec printf pwd read set source test trap unset",
+			words(hlKeyword, "break case continue do done elif else esac exit export fi for function if in local readonly return shift then until while", nil)),
+		lineComments: []string{"#"},
+		hashComment:  true,
+		quotes:       `"'`,
+		shellVars:    true,
+	}
+	yamlSpec = &languageSpec{
+		keywords:     words(hlLiteral, "true false null yes no on off True False Null", nil),
+		lineComments: []string{"#"},
+		hashComment:  true,
+		quotes:       `"'`,
+		yamlKeys:     true,
+	}
+)
+
+// highlightLanguages associe les indications de langage acceptées à leur coloration
+var highlightLanguages = map[string]*languageSpec{
+	"go": goSpec, "golang": goSpec,
+	"js": jsSpec, "javascript": jsSpec, "ts": jsSpec, "typescript": jsSpec, "json": jsSpec,
+	"sql": sqlSpec, "mysql": sqlSpec, "postgres": sqlSpec, "postgresql": sqlSpec, "sqlite": sqlSpec,
+	"sh": shellSpec, "bash": shellSpec, "shell": shellSpec, "zsh": shellSpec, "console": shellSpec,
+	"yaml": yamlSpec, "yml": yamlSpec,
+}
+
+// hlToken est un fragment de code et sa classe CSS (vide pour le texte ordinaire)
+type hlToken struct {
+	class string
+	text  string
+}
+
+// HighlightCode colore un extrait de code et retourne une ligne HTML par ligne de code. Chaque ligne
+// est autonome : un jeton qui s'étend sur plusieurs lignes (commentaire, chaîne) est refermé et rouvert.
+// Le langage inconnu ou vide donne le code échappé sans coloration.
+func HighlightCode(code, language string) []string {
+	spec := highlightLanguages[strings.ToLower(language)]
+	var tokens []hlToken
+	if spec != nil {
+		tokens = spec.tokenize(code)
+	} else {
+		tokens = []hlToken{{text: code}}
+	}
+
+	lines := []string{}
+	var line strings.Builder
+	for _, t := range tokens {
+		parts := strings.Split(t.text, "\n")
+		for i, part := range parts {
+			if i > 0 {
+				lines = append(lines, line.String())
+				line.Reset()
+			}
+			if part == "" {
+				continue
+			}
+			if t.class == "" {
+				line.WriteString(html.EscapeString(part))
+			} else {
+				line.WriteString(`<span class="` + t.class + `">` + html.EscapeString(part) + "</span>")
+			}
+		}
+	}
+	return append(lines, line.String())
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentByte(c byte) bool {
+	return isIdentStart(c) || (c >= '0' && c <= '9')
+}
+
+func (spec *languageSpec) tokenize(code string) []hlToken {
+	var tokens []hlToken
+	plain := 0
+	emit := func(start, end int, class string) {
+		if plain < start {
+			tokens = append(tokens, hlToken{text: code[plain:start]})
+		}
+		tokens = append(tokens, hlToken{class: class, text: code[start:end]})
+		plain = end
+	}
+	lineStart := true // seuls des blancs (ou « - » en YAML) depuis le début de la ligne
+
+	for i := 0; i < len(code); {
+		c := code[i]
+		if c == '\n' {
+			lineStart = true
+			i++
+			continue
+		}
+
+		if spec.blockComment[0] != "" && strings.HasPrefix(code[i:], spec.blockComment[0]) {
+			end := strings.Index(code[i+len(spec.blockComment[0]):], spec.blockComment[1])
+			if end < 0 {
+				end = len(code)
+			} else {
+				end += i + len(spec.blockComment[0]) + len(spec.blockComment[1])
+			}
+			emit(i, end, hlComment)
+			i = end
+			lineStart = false
+			continue
+		}
+
+		if spec.isLineComment(code, i) {
+			end := strings.IndexByte(code[i:], '\n')
+			if end < 0 {
+				end = len(code)
+			} else {
+				end += i
+			}
+			emit(i, end, hlComment)
+			i = end
+			continue
+		}
+
+		if strings.IndexByte(spec.quotes, c) >= 0 || strings.IndexByte(spec.rawQuotes, c) >= 0 {
+			end := spec.stringEnd(code, i)
+			class := hlString
+			if spec.yamlKeys && lineStart && isYAMLKey(code, end) {
+				class = hlKey
+			}
+			emit(i, end, class)
+			i = end
+			lineStart = false
+			continue
+		}
+
+		if spec.shellVars && c == '$' && i+1 < len(code) {
+			end := i + 1
+			if code[end] == '{' {
+				if close := strings.IndexByte(code[end:], '}'); close > 0 {
+					end += close + 1
+				}
+			} else {
+				for end < len(code) && isIdentByte(code[end]) {
+					end++
+				}
+			}
+			if end > i+1 {
+				emit(i, end, hlVar)
+				i = end
+				lineStart = false
+				continue
+			}
+		}
+
+		if c >= '0' && c <= '9' && (i == 0 || !isIdentByte(code[i-1])) {
+			end := i
+			for end < len(code) && (isIdentByte(code[end]) || code[end] == '.') {
+				end++
+			}
+			emit(i, end, hlNumber)
+			i = end
+			lineStart = false
+			continue
+		}
+
+		if isIdentStart(c) {
+			end := i
+			for end < len(code) && (isIdentByte(code[end]) || (spec.yamlKeys && code[end] == '-')) {
+				end++
+			}
+			word := code[i:end]
+			if spec.caseInsensitive {
+				word = strings.ToLower(word)
+			}
+			if spec.yamlKeys && lineStart && isYAMLKey(code, end) {
+				emit(i, end, hlKey)
+			} else if class, ok := spec.keywords[word]; ok {
+				emit(i, end, class)
+			}
+			i = end
+			lineStart = false
+			continue
+		}
+
+		if c != ' ' && c != '\t' && !(spec.yamlKeys && c == '-') {
+			lineStart = false
+		}
+		i++
+	}
+	if plain < len(code) {
+		tokens = append(tokens, hlToken{text: code[plain:]})
+	}
+	return tokens
+}
+
+func (spec *languageSpec) isLineComment(code string, i int) bool {
+	for _, prefix := range spec.lineComments {
+		if !strings.HasPrefix(code[i:], prefix) {
+			continue
+		}
+		// En shell et YAML, # au milieu d'un mot (url#ancre, $#) n'est pas un commentaire
+		if prefix == "#" && spec.hashComment && i > 0 && code[i-1] != ' ' && code[i-1] != '\t' && code[i-1] != '\n' {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// stringEnd retourne la fin de la chaîne ouverte en i ; une chaîne non terminée s'arrête à la fin de la ligne
+func (spec *languageSpec) stringEnd(code string, i int) int {
+	quote := code[i]
+	raw := strings.IndexByte(spec.rawQuotes, quote) >= 0
+	for j := i + 1; j < len(code); j++ {
+		switch {
+		case code[j] == quote:
+			return j + 1
+		case code[j] == '\\' && !raw:
+			j++
+		case code[j] == '\n' && !raw:
+			return j
+		}
+	}
+	return len(code)
+}
+
+// isYAMLKey indique si le mot qui se termine en end est suivi de « : »
+func isYAMLKey(code string, end int) bool {
+	for end < len(code) && code[end] == ' ' {
+		end++
+	}
+	return end < len(code) && code[end] == ':' && (end+1 == len(code) || code[end+1] == ' ' || code[end+1] == '\n')
+}
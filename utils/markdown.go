@@ -0,0 +1,596 @@
+package utils
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// RenderMarkdown convertit un sous-ensemble de CommonMark en HTML sûr : paragraphes (les retours à la
+// ligne sont conservés), blocs de code délimités par ``` ou ~~~ avec indication de langage, citations
+// (>), listes à puces et numérotées, code en ligne, liens, emphase (* et _) et caractères échappés (\).
+//
+// Le HTML n'est jamais recopié depuis la source : tout le texte est échappé et seules les balises de
+// MarkdownAllowedTags sont produites, avec pour seuls attributs href/rel sur a, class="language-x"
+// sur code et start sur ol, plus les classes, identifiants et liens des blocs de code colorés
+// (voir RenderMessageMarkdown). Les liens n'acceptent que http, https, mailto et les adresses relatives.
+func RenderMarkdown(source string) string {
+	return RenderMessageMarkdown(source, 0)
+}
+
+// RenderMessageMarkdown fait le rendu du contenu d'un message. Les blocs de code sont colorés
+// (HighlightCode) et chaque ligne porte une ancre m{message}-c{bloc}-L{ligne} ; pour un message
+// enregistré (messageID non nul), chaque bloc a un lien vers sa version brute.
+func RenderMessageMarkdown(source string, messageID int64) string {
+	r := &markdownRenderer{messageID: messageID}
+	var b strings.Builder
+	r.renderBlocks(&b, splitMarkdownLines(source), 0, false)
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// CodeBlock est un bloc de code délimité d'un texte Markdown
+type CodeBlock struct {
+	Language string
+	Code     string
+}
+
+// ExtractCodeBlocks retourne les blocs de code d'un texte Markdown, dans l'ordre et avec la même
+// numérotation (à partir de 1) que les ancres de RenderMessageMarkdown
+func ExtractCodeBlocks(source string) []CodeBlock {
+	r := &markdownRenderer{}
+	var b strings.Builder
+	r.renderBlocks(&b, splitMarkdownLines(source), 0, false)
+	return r.codeBlocks
+}
+
+// Éléments dont le texte n'est jamais lu comme une mention (voir MentionText)
+var (
+	preElementPattern  = regexp.MustCompile(`(?s)<pre\b.*?</pre>`)
+	codeElementPattern = regexp.MustCompile(`(?s)<code\b.*?</code>`)
+	linkElementPattern = regexp.MustCompile(`(?s)<a\b.*?</a>`)
+	tagPattern         = regexp.MustCompile(`<[^>]*>`)
+)
+
+// MentionText retourne le texte d'un contenu Markdown où chercher les @mentions, tel que le client les
+// affiche : les blocs de code, le code en ligne et les liens sont retirés, et chaque balise sépare deux
+// nœuds texte (une mention ne peut pas être à cheval sur une balise)
+func MentionText(source string) string {
+	rendered := RenderMarkdown(source)
+	rendered = preElementPattern.ReplaceAllString(rendered, "\n")
+	rendered = codeElementPattern.ReplaceAllString(rendered, "\n")
+	rendered = linkElementPattern.ReplaceAllString(rendered, "\n")
+	return html.UnescapeString(tagPattern.ReplaceAllString(rendered, "\n"))
+}
+
+func splitMarkdownLines(source string) []string {
+	source = strings.ReplaceAll(source, "\r\n", "\n")
+	source = strings.ReplaceAll(source, "\r", "\n")
+	return expandIndentTabs(strings.Split(source, "\n"))
+}
+
+// markdownRenderer garde l'état d'un rendu : numérotation des blocs de code
+type markdownRenderer struct {
+	messageID  int64
+	codeBlocks []CodeBlock
+}
+
+// MarkdownAllowedTags liste les balises que RenderMarkdown peut produire
+var MarkdownAllowedTags = []string{"p", "br", "pre", "code", "blockquote", "ul", "ol", "li", "a", "em", "strong", "span", "div"}
+
+const (
+	// maxMarkdownDepth limite l'imbrication des citations et listes
+	maxMarkdownDepth = 8
+	// maxInlineScan borne la recherche d'un délimiteur fermant pour garder un rendu linéaire
+	maxInlineScan = 2000
+	// maxInlineDepth limite l'imbrication des liens et de l'emphase
+	maxInlineDepth = 6
+)
+
+var (
+	fencePattern   = regexp.MustCompile("^( {0,3})(`{3,}|~{3,})\\s*([^`\\s]*)")
+	bulletPattern  = regexp.MustCompile(`^( {0,3})([-*+])( +|$)`)
+	orderedPattern = regexp.MustCompile(`^( {0,3})([0-9]{1,9})([.)])( +|$)`)
+	quotePattern   = regexp.MustCompile(`^ {0,3}> ?`)
+	languageClean  = regexp.MustCompile(`[^a-zA-Z0-9_+\-]`)
+	schemePattern  = regexp.MustCompile(`^([a-zA-Z][a-zA-Z0-9+.\-]*):`)
+)
+
+// expandIndentTabs remplace les tabulations de l'indentation par 4 espaces, sauf dans les blocs de
+// code où elles sont conservées telles quelles
+func expandIndentTabs(lines []string) []string {
+	fence := ""
+	for i, line := range lines {
+		if fence != "" {
+			trimmed := strings.TrimLeft(line, " \t")
+			if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]+" \t") == "" {
+				fence = ""
+			}
+			continue
+		}
+		body := strings.TrimLeft(line, " \t")
+		lines[i] = strings.ReplaceAll(line[:len(line)-len(body)], "\t", "    ") + body
+		if m := fencePattern.FindStringSubmatch(lines[i]); m != nil {
+			fence = m[2]
+		}
+	}
+	return lines
+}
+
+func isBlank(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
+
+func indentOf(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// listMarker décrit le début d'un élément de liste
+type listMarker struct {
+	ordered bool
+	char    string // -, *, + ou le délimiteur . / ) d'une liste numérotée
+	start   int
+	indent  int // colonne du contenu de l'élément
+}
+
+func parseListMarker(line string) (listMarker, string, bool) {
+	if m := bulletPattern.FindStringSubmatch(line); m != nil {
+		// Une ligne comme "* * *" ou "---" n'est pas un élément de liste vide
+		if strings.Trim(line, " "+m[2]) == "" && strings.Count(line, m[2]) >= 3 {
+			return listMarker{}, "", false
+		}
+		return newListMarker(false, m[2], 0, len(m[1])+len(m[2]), m[3]), line[len(m[0]):], true
+	}
+	if m := orderedPattern.FindStringSubmatch(line); m != nil {
+		start, _ := strconv.Atoi(m[2])
+		return newListMarker(true, m[3], start, len(m[1])+len(m[2])+1, m[4]), line[len(m[0]):], true
+	}
+	return listMarker{}, "", false
+}
+
+func newListMarker(ordered bool, char string, start, width int, spaces string) listMarker {
+	pad := len(spaces)
+	if pad == 0 || pad > 4 {
+		pad = 1
+	}
+	return listMarker{ordered: ordered, char: char, start: start, indent: width + pad}
+}
+
+// startsBlock indique si une ligne ouvre un bloc qui interrompt un paragraphe
+func startsBlock(line string) bool {
+	if fencePattern.MatchString(line) || quotePattern.MatchString(line) {
+		return true
+	}
+	if marker, rest, ok := parseListMarker(line); ok && !isBlank(rest) {
+		return !marker.ordered || marker.start == 1
+	}
+	return false
+}
+
+func (r *markdownRenderer) renderBlocks(b *strings.Builder, lines []string, depth int, tight bool) {
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		switch {
+		case isBlank(line):
+			i++
+
+		case fencePattern.MatchString(line):
+			i = r.renderFence(b, lines, i)
+
+		case quotePattern.MatchString(line) && depth < maxMarkdownDepth:
+			var inner []string
+			for ; i < len(lines) && !isBlank(lines[i]); i++ {
+				if loc := quotePattern.FindStringIndex(lines[i]); loc != nil {
+					inner = append(inner, lines[i][loc[1]:])
+				} else if len(inner) > 0 && !startsBlock(lines[i]) {
+					// Ligne de continuation paresseuse d'un paragraphe cité
+					inner = append(inner, lines[i])
+				} else {
+					break
+				}
+			}
+			b.WriteString("<blockquote>\n")
+			r.renderBlocks(b, inner, depth+1, false)
+			b.WriteString("</blockquote>\n")
+
+		case depth < maxMarkdownDepth && isListStart(line):
+			i = r.renderList(b, lines, i, depth)
+
+		default:
+			start := i
+			for i++; i < len(lines) && !isBlank(lines[i]) && !startsBlock(lines[i]); i++ {
+			}
+			paragraph := make([]string, 0, i-start)
+			for _, l := range lines[start:i] {
+				paragraph = append(paragraph, strings.TrimSpace(l))
+			}
+			text := strings.ReplaceAll(renderInline(strings.Join(paragraph, "\n"), 0, false), "\n", "<br>\n")
+			if tight {
+				b.WriteString(text)
+				b.WriteString("\n")
+			} else {
+				b.WriteString("<p>" + text + "</p>\n")
+			}
+		}
+	}
+}
+
+func isListStart(line string) bool {
+	_, _, ok := parseListMarker(line)
+	return ok
+}
+
+// renderFence écrit un bloc de code délimité et retourne l'indice de la ligne qui le suit
+func (r *markdownRenderer) renderFence(b *strings.Builder, lines []string, i int) int {
+	m := fencePattern.FindStringSubmatch(lines[i])
+	indent, fence := len(m[1]), m[2]
+	language := languageClean.ReplaceAllString(m[3], "")
+	if len(language) > 20 {
+		language = language[:20]
+	}
+
+	var code []string
+	for i++; i < len(lines); i++ {
+		trimmed := strings.TrimLeft(lines[i], " ")
+		if indentOf(lines[i]) <= 3 && strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]+" ") == "" {
+			i++
+			break
+		}
+		line := lines[i]
+		if strip := indentOf(line); strip > 0 {
+			if strip > indent {
+				strip = indent
+			}
+			line = line[strip:]
+		}
+		code = append(code, line)
+	}
+
+	if len(code) > 0 && code[len(code)-1] == "" {
+		code = code[:len(code)-1]
+	}
+	r.codeBlocks = append(r.codeBlocks, CodeBlock{Language: strings.ToLower(language), Code: strings.Join(code, "\n")})
+	block := len(r.codeBlocks)
+
+	b.WriteString(`<div class="code-block">`)
+	if r.messageID != 0 {
+		b.WriteString(fmt.Sprintf(`<a class="code-raw" href="/api/messages/%d/raw?block=%d">brut</a>`, r.messageID, block))
+	}
+	if language != "" {
+		b.WriteString(`<pre><code class="language-` + strings.ToLower(language) + `">`)
+	} else {
+		b.WriteString("<pre><code>")
+	}
+	for n, line := range HighlightCode(strings.Join(code, "\n"), language) {
+		anchor := fmt.Sprintf("m%d-c%d-L%d", r.messageID, block, n+1)
+		b.WriteString(fmt.Sprintf(`<span class="line" id="%s"><a class="line-number" href="#%s" data-line="%d"></a>%s</span>`, anchor, anchor, n+1, line))
+		b.WriteString("\n")
+	}
+	b.WriteString("</code></pre></div>\n")
+	return i
+}
+
+// renderList écrit une liste et retourne l'indice de la ligne qui la suit
+func (r *markdownRenderer) renderList(b *strings.Builder, lines []string, i, depth int) int {
+	first, _, _ := parseListMarker(lines[i])
+
+	var items [][]string
+	loose := false
+	for i < len(lines) {
+		marker, rest, ok := parseListMarker(lines[i])
+		if !ok || marker.ordered != first.ordered || marker.char != first.char {
+			break
+		}
+
+		item := []string{rest}
+		blankBefore := false
+		for i++; i < len(lines); i++ {
+			line := lines[i]
+			if isBlank(line) {
+				blankBefore = true
+				item = append(item, "")
+				continue
+			}
+			if indentOf(line) >= marker.indent {
+				if blankBefore && len(item) > 1 {
+					loose = true
+				}
+				blankBefore = false
+				item = append(item, line[marker.indent:])
+				continue
+			}
+			if !blankBefore && !startsBlock(line) && !isListStart(line) {
+				// Continuation paresseuse du paragraphe de l'élément
+				item = append(item, strings.TrimSpace(line))
+				continue
+			}
+			break
+		}
+		for len(item) > 0 && isBlank(item[len(item)-1]) {
+			item = item[:len(item)-1]
+		}
+		items = append(items, item)
+
+		if blankBefore {
+			if next, _, ok := parseListMarker(lineAt(lines, i)); ok && next.ordered == first.ordered && next.char == first.char {
+				loose = true
+			} else {
+				break
+			}
+		}
+	}
+
+	switch {
+	case !first.ordered:
+		b.WriteString("<ul>\n")
+	case first.start != 1:
+		b.WriteString(`<ol start="` + strconv.Itoa(first.start) + `">` + "\n")
+	default:
+		b.WriteString("<ol>\n")
+	}
+	for _, item := range items {
+		var inner strings.Builder
+		r.renderBlocks(&inner, item, depth+1, !loose)
+		b.WriteString("<li>" + strings.TrimSuffix(inner.String(), "\n") + "</li>\n")
+	}
+	if first.ordered {
+		b.WriteString("</ol>\n")
+	} else {
+		b.WriteString("</ul>\n")
+	}
+	return i
+}
+
+func lineAt(lines []string, i int) string {
+	if i < len(lines) {
+		return lines[i]
+	}
+	return ""
+}
+
+func isASCIIPunct(c byte) bool {
+	return strings.IndexByte("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", c) >= 0
+}
+
+func isWordByte(c byte) bool {
+	return c >= 0x80 || c == '_' || (c >= '0' && c <= '9') || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func runLength(s string, i int, c byte) int {
+	n := 0
+	for i+n < len(s) && s[i+n] == c {
+		n++
+	}
+	return n
+}
+
+func scanLimit(s string, from int) int {
+	if limit := from + maxInlineScan; limit < len(s) {
+		return limit
+	}
+	return len(s)
+}
+
+// renderInline convertit le texte d'un paragraphe ; inLink empêche les liens imbriqués
+func renderInline(s string, depth int, inLink bool) string {
+	if depth > maxInlineDepth {
+		return html.EscapeString(s)
+	}
+
+	var b strings.Builder
+	text := 0 // début du texte brut pas encore écrit
+	flush := func(i int) {
+		b.WriteString(html.EscapeString(s[text:i]))
+	}
+
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && isASCIIPunct(s[i+1]):
+			flush(i)
+			b.WriteString(html.EscapeString(s[i+1 : i+2]))
+			i += 2
+			text = i
+			continue
+
+		case c == '`':
+			n := runLength(s, i, '`')
+			if end := findCodeSpanEnd(s, i+n, n); end >= 0 {
+				flush(i)
+				code := strings.ReplaceAll(s[i+n:end], "\n", " ")
+				if len(code) > 2 && code[0] == ' ' && code[len(code)-1] == ' ' && strings.Trim(code, " ") != "" {
+					code = code[1 : len(code)-1]
+				}
+				b.WriteString("<code>" + html.EscapeString(code) + "</code>")
+				i = end + n
+				text = i
+				continue
+			}
+			i += n
+			continue
+
+		case c == '[' && !inLink:
+			if label, url, end, ok := parseLink(s, i); ok {
+				flush(i)
+				inner := renderInline(label, depth+1, true)
+				if href, safe := safeURL(url); safe {
+					b.WriteString(`<a href="` + html.EscapeString(href) + `" rel="nofollow noopener ugc">` + inner + "</a>")
+				} else {
+					b.WriteString(inner)
+				}
+				i = end
+				text = i
+				continue
+			}
+
+		case c == '<' && !inLink:
+			if end := strings.IndexByte(s[i:scanLimit(s, i)], '>'); end > 0 {
+				target := s[i+1 : i+end]
+				if !strings.ContainsAny(target, " \n<") && schemePattern.MatchString(target) {
+					if href, safe := safeURL(target); safe {
+						flush(i)
+						escaped := html.EscapeString(href)
+						b.WriteString(`<a href="` + escaped + `" rel="nofollow noopener ugc">` + escaped + "</a>")
+						i += end + 1
+						text = i
+						continue
+					}
+				}
+			}
+
+		case c == '*' || c == '_':
+			n := runLength(s, i, c)
+			if end, width := findEmphasisEnd(s, i, n, c); end >= 0 {
+				flush(i)
+				inner := renderInline(s[i+width:end], depth+1, inLink)
+				switch width {
+				case 1:
+					b.WriteString("<em>" + inner + "</em>")
+				case 2:
+					b.WriteString("<strong>" + inner + "</strong>")
+				default:
+					b.WriteString("<em><strong>" + inner + "</strong></em>")
+				}
+				i = end + width
+				text = i
+				continue
+			}
+			i += n
+			continue
+		}
+		i++
+	}
+	flush(len(s))
+	return b.String()
+}
+
+// findCodeSpanEnd cherche une suite d'exactement n accents graves fermant un code en ligne
+func findCodeSpanEnd(s string, from, n int) int {
+	limit := scanLimit(s, from)
+	for j := from; j < limit; {
+		if s[j] != '`' {
+			j++
+			continue
+		}
+		run := runLength(s, j, '`')
+		if run == n {
+			return j
+		}
+		j += run
+	}
+	return -1
+}
+
+// findEmphasisEnd cherche le délimiteur fermant d'une emphase ouverte par n caractères c en i.
+// L'ouvrant doit être suivi d'un caractère non blanc et le fermant précédé d'un caractère non blanc ;
+// avec _, ils ne peuvent pas être collés à un mot (snake_case reste intact).
+func findEmphasisEnd(s string, i, n int, c byte) (int, int) {
+	width := n
+	if width > 3 {
+		return -1, 0
+	}
+	open := i + width
+	if open >= len(s) || s[open] == ' ' || s[open] == '\n' {
+		return -1, 0
+	}
+	if c == '_' && i > 0 && isWordByte(s[i-1]) {
+		return -1, 0
+	}
+
+	limit := scanLimit(s, open)
+	for j := open + 1; j < limit; {
+		if s[j] == '`' {
+			// Les délimiteurs à l'intérieur d'un code en ligne ne comptent pas
+			run := runLength(s, j, '`')
+			if end := findCodeSpanEnd(s, j+run, run); end >= 0 {
+				j = end + run
+				continue
+			}
+			j += run
+			continue
+		}
+		if s[j] == '\\' {
+			j += 2
+			continue
+		}
+		if s[j] != c {
+			j++
+			continue
+		}
+		run := runLength(s, j, c)
+		if run == width && s[j-1] != ' ' && s[j-1] != '\n' && (c != '_' || j+run >= len(s) || !isWordByte(s[j+run])) {
+			return j, width
+		}
+		j += run
+	}
+	return -1, 0
+}
+
+// parseLink reconnaît [texte](adresse) à partir de i et retourne le texte, l'adresse et la fin du lien
+func parseLink(s string, i int) (label, url string, end int, ok bool) {
+	limit := scanLimit(s, i)
+	depth := 0
+	closeLabel := -1
+	for j := i; j < limit && closeLabel < 0; j++ {
+		switch s[j] {
+		case '\\':
+			j++
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				closeLabel = j
+			}
+		}
+	}
+	if closeLabel < 0 || closeLabel+1 >= len(s) || s[closeLabel+1] != '(' {
+		return "", "", 0, false
+	}
+
+	parens := 0
+	for j := closeLabel + 2; j < limit; j++ {
+		switch s[j] {
+		case ' ', '\t', '\n', '<':
+			return "", "", 0, false
+		case '\\':
+			j++
+		case '(':
+			parens++
+		case ')':
+			if parens == 0 {
+				return s[i+1 : closeLabel], s[closeLabel+2 : j], j + 1, true
+			}
+			parens--
+		}
+	}
+	return "", "", 0, false
+}
+
+// safeURL n'accepte que les adresses http(s), mailto et relatives. Les navigateurs retirent les
+// tabulations et sauts de ligne d'une URL et ignorent les caractères de contrôle en tête avant d'en lire
+// le schéma (« java\tscript: » devient « javascript: ») : une URL qui en contient est refusée.
+func safeURL(url string) (string, bool) {
+	url = strings.TrimSpace(url)
+	if url == "" {
+		return "", false
+	}
+	for i := 0; i < len(url); i++ {
+		if url[i] <= ' ' || url[i] == 0x7f {
+			return "", false
+		}
+	}
+	if m := schemePattern.FindStringSubmatch(url); m != nil {
+		switch strings.ToLower(m[1]) {
+		case "http", "https", "mailto":
+			return url, true
+		}
+		return "", false
+	}
+	// Sans schéma : chemin relatif, ancre ou requête, mais pas //hôte qui changerait de site
+	if strings.HasPrefix(url, "//") || strings.HasPrefix(url, `/\`) || strings.HasPrefix(url, `\`) {
+		return "", false
+	}
+	return url, true
+}
@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSafeURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		safe bool
+	}{
+		{"https://example.com/page", true},
+		{"http://example.com", true},
+		{"mailto:admin@forum.com", true},
+		{"/threads/3", true},
+		{"#message-12", true},
+		{"?page=2", true},
+		{"javascript:alert(1)", false},
+		{"JavaScript:alert(1)", false},
+		{"java\tscript:alert(1)", false},
+		{"java\nscript:alert(1)", false},
+		{"java\rscript:alert(1)", false},
+		{"\x01javascript:alert(1)", false},
+		{"\x00javascript:alert(1)", false},
+		{"jav\x7fascript:alert(1)", false},
+		{"data:text/html,<script>alert(1)</script>", false},
+		{"//evil.example", false},
+		{`/\evil.example`, false},
+		{`\\evil.example`, false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if _, safe := safeURL(tt.url); safe != tt.safe {
+			t.Errorf("safeURL(%q) = %v, attendu %v", tt.url, safe, tt.safe)
+		}
+	}
+}
+
+func TestRenderMarkdownLinks(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		href   string // attendu dans le rendu ; vide si aucun lien ne doit être produit
+	}{
+		{"http", "[site](https://example.com)", `href="https://example.com"`},
+		{"relatif", "[fil](/threads/3)", `href="/threads/3"`},
+		{"javascript", "[a](javascript:alert(1))", ""},
+		{"tabulation dans le schéma", "[a](java\tscript:alert(1))", ""},
+		{"caractère de contrôle en tête", "[a](\x01javascript:alert(1))", ""},
+		{"retour chariot dans le schéma", "[a](java\rscript:alert(1))", ""},
+		{"autolien javascript", "<javascript:alert(1)>", ""},
+		{"autolien avec tabulation", "<java\tscript:alert(1)>", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := RenderMarkdown(tt.source)
+			if tt.href == "" {
+				if strings.Contains(out, "<a ") {
+					t.Errorf("RenderMarkdown(%q) = %q, aucun lien attendu", tt.source, out)
+				}
+				return
+			}
+			if !strings.Contains(out, tt.href) {
+				t.Errorf("RenderMarkdown(%q) = %q, attendu %s", tt.source, out, tt.href)
+			}
+		})
+	}
+}
+
+func TestMentionText(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		contains []string
+		excludes []string
+	}{
+		{"texte simple", "Merci @alice !", []string{"@alice"}, nil},
+		{"code en ligne", "Utiliser `@bob` puis @alice", []string{"@alice"}, []string{"@bob"}},
+		{"bloc de code", "Voir :\n```go\n// @bob\nfunc main() {}\n```\n@alice", []string{"@alice"}, []string{"@bob", "main"}},
+		{"bloc de code ~~~", "~~~\n@bob\n~~~", nil, []string{"@bob"}},
+		{"bloc de code dans une citation", "> ```\n> @bob\n> ```\n> @alice", []string{"@alice"}, []string{"@bob"}},
+		{"lien", "[@bob](https://example.com) et @alice", []string{"@alice"}, []string{"@bob"}},
+		{"emphase", "*@alice*", []string{"@alice"}, nil},
+		{"entités", "a & b < @alice", []string{"& b < @alice"}, []string{"&amp;", "&lt;"}},
+	}
+	for _, tt := range tests {
+		text := MentionText(tt.source)
+		for _, s := range tt.contains {
+			if !strings.Contains(text, s) {
+				t.Errorf("%s : MentionText(%q) = %q, attendu %q", tt.name, tt.source, text, s)
+			}
+		}
+		for _, s := range tt.excludes {
+			if strings.Contains(text, s) {
+				t.Errorf("%s : MentionText(%q) = %q, %q ne doit pas y figurer", tt.name, tt.source, text, s)
+			}
+		}
+	}
+}